@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/xfer"
+)
+
+// alertsConfig is the format of the alerts file, e.g.
+//
+//	{"webhooks": ["http://localhost:4041/"],
+//	 "rules": [{
+//	   "name": "internet-egress",
+//	   "topology": "containers",
+//	   "condition": "edge_added",
+//	   "from": "!id:theinternet",
+//	   "to": "id:theinternet"
+//	 }, {
+//	   "name": "db-gone",
+//	   "topology": "containers",
+//	   "options": {"system": "show"},
+//	   "condition": "node_removed",
+//	   "filter": "image:postgres*"
+//	 }, {
+//	   "name": "few-hosts",
+//	   "topology": "hosts",
+//	   "condition": "count_below",
+//	   "threshold": 3
+//	 }, {
+//	   "name": "hot-frontend",
+//	   "topology": "containers",
+//	   "condition": "matches",
+//	   "filter": "label.app=frontend cpu>90"
+//	 }]}
+//
+// Filters are queries, as in the filter parameter of topologies. Options
+// are the topology's request parameters.
+type alertsConfig struct {
+	Webhooks []string     `json:"webhooks,omitempty"`
+	Rules    []ruleConfig `json:"rules"`
+}
+
+// ruleConfig is an alerting rule on a topology view.
+type ruleConfig struct {
+	Name      string            `json:"name"`
+	Topology  string            `json:"topology"`
+	Options   map[string]string `json:"options,omitempty"`
+	Condition string            `json:"condition"`
+	Filter    string            `json:"filter,omitempty"`
+	From      string            `json:"from,omitempty"`
+	To        string            `json:"to,omitempty"`
+	Threshold int               `json:"threshold,omitempty"`
+}
+
+// Conditions rules can alert on.
+const (
+	conditionMatches     = "matches"      // a node matches the filter; per node
+	conditionCountBelow  = "count_below"  // fewer real nodes than threshold match the filter
+	conditionNodeRemoved = "node_removed" // a node matching the filter disappeared, until it's back; per node
+	conditionEdgeAdded   = "edge_added"   // a new edge between from and to nodes, while it lasts; per edge
+)
+
+// Statuses of alerts.
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// maxResolvedAlerts is how many resolved alerts are kept for /api/alerts.
+const maxResolvedAlerts = 100
+
+// Alert is an instance of a rule firing, e.g. for one node, or an edge.
+type Alert struct {
+	Rule     string     `json:"rule"`
+	Topology string     `json:"topology"`
+	Key      string     `json:"key"` // identifies the alert among the rule's
+	Summary  string     `json:"summary"`
+	Status   string     `json:"status"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+// APIAlerts is returned by the /api/alerts handler.
+type APIAlerts struct {
+	Firing   []Alert `json:"firing"`
+	Resolved []Alert `json:"resolved"`
+}
+
+// webhookPayload is posted to webhooks whenever alerts fire or resolve.
+type webhookPayload struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+type alertRule struct {
+	ruleConfig
+	filter, from, to render.Query
+}
+
+func makeRules(configs []ruleConfig) ([]alertRule, error) {
+	rules := []alertRule{}
+	names := map[string]struct{}{}
+	for _, c := range configs {
+		if c.Name == "" {
+			return nil, fmt.Errorf("rule without a name")
+		}
+		if _, ok := names[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate rule %s", c.Name)
+		}
+		names[c.Name] = struct{}{}
+		if c.Topology == "" {
+			return nil, fmt.Errorf("rule %s: no topology", c.Name)
+		}
+
+		rule := alertRule{ruleConfig: c}
+		for _, q := range []struct {
+			expr  string
+			query *render.Query
+		}{
+			{c.Filter, &rule.filter},
+			{c.From, &rule.from},
+			{c.To, &rule.to},
+		} {
+			query, err := render.ParseQuery(q.expr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %v", c.Name, err)
+			}
+			*q.query = query
+		}
+
+		switch c.Condition {
+		case conditionMatches, conditionNodeRemoved:
+		case conditionCountBelow:
+			if c.Threshold < 1 {
+				return nil, fmt.Errorf("rule %s: %s needs a threshold", c.Name, c.Condition)
+			}
+		case conditionEdgeAdded:
+			if c.Filter != "" {
+				return nil, fmt.Errorf("rule %s: %s takes from and to, not a filter", c.Name, c.Condition)
+			}
+		default:
+			return nil, fmt.Errorf("rule %s: unknown condition %q", c.Name, c.Condition)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func readAlerts(filename string) (alertsConfig, []alertRule, error) {
+	var config alertsConfig
+	if filename == "" {
+		return config, nil, nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return config, nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return config, nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	rules, err := makeRules(config.Rules)
+	if err != nil {
+		return config, nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return config, rules, nil
+}
+
+// firing is what a rule finds wrong with a topology: summaries by key.
+type firing map[string]string
+
+// evaluate returns what the rule finds firing in the current render of its
+// topology, given the previous one and what was firing then. There's no
+// previous render the first time, so changes aren't alerted on.
+func (r alertRule) evaluate(prev, cur render.RenderableNodes, before firing) firing {
+	result := firing{}
+	switch r.Condition {
+	case conditionMatches:
+		for id, n := range cur {
+			if r.filter.Match(n) {
+				result[id] = fmt.Sprintf("%s matches %q", n.LabelMajor, r.Filter)
+			}
+		}
+
+	case conditionCountBelow:
+		count := 0
+		for _, n := range cur {
+			if !n.Pseudo && r.filter.Match(n) {
+				count++
+			}
+		}
+		if count < r.Threshold {
+			result[""] = fmt.Sprintf("%d nodes match %q, below %d", count, r.Filter, r.Threshold)
+		}
+
+	case conditionNodeRemoved:
+		for id, summary := range before {
+			if _, ok := cur[id]; !ok {
+				result[id] = summary
+			}
+		}
+		if prev == nil {
+			break
+		}
+		for _, id := range render.TopoDiff(prev, cur).Remove {
+			if n := prev[id]; r.filter.Match(n) {
+				result[id] = fmt.Sprintf("%s disappeared", n.LabelMajor)
+			}
+		}
+
+	case conditionEdgeAdded:
+		for key, summary := range before {
+			if from, to, ok := splitEdgeKey(key); ok && cur[from].Adjacency.Contains(to) {
+				result[key] = summary
+			}
+		}
+		if prev == nil {
+			break
+		}
+		diff := render.TopoDiff(prev, cur)
+		for _, n := range append(diff.Add, diff.Update...) {
+			if !r.from.Match(n) {
+				continue
+			}
+			for _, to := range n.Adjacency {
+				target, ok := cur[to]
+				if !ok || prev[n.ID].Adjacency.Contains(to) || !r.to.Match(target) {
+					continue
+				}
+				result[edgeKey(n.ID, to)] = fmt.Sprintf("new edge from %s to %s", n.LabelMajor, target.LabelMajor)
+			}
+		}
+	}
+	return result
+}
+
+func edgeKey(from, to string) string {
+	return strconv.Quote(from) + " -> " + strconv.Quote(to)
+}
+
+func splitEdgeKey(key string) (string, string, bool) {
+	var from, to string
+	if _, err := fmt.Sscanf(key, "%q -> %q", &from, &to); err != nil {
+		return "", "", false
+	}
+	return from, to, true
+}
+
+// alerter evaluates alerting rules whenever the collector's report changes,
+// keeps track of the alerts firing, and notifies webhooks when alerts fire
+// or resolve. Alerts are only notified once each way.
+type alerter struct {
+	mtx      sync.Mutex
+	rules    []alertRule
+	webhooks []string
+	prev     map[string]render.RenderableNodes // by rule
+	firing   map[string]map[string]*Alert      // by rule, then key
+	resolved []Alert                           // most recent first
+	queue    chan []Alert
+}
+
+func newAlerter(rules []alertRule, webhooks []string) *alerter {
+	return &alerter{
+		rules:    rules,
+		webhooks: webhooks,
+		prev:     map[string]render.RenderableNodes{},
+		firing:   map[string]map[string]*Alert{},
+		queue:    make(chan []Alert, 100),
+	}
+}
+
+// alertRegistry holds the alerts of the app, set up from the alerts file.
+var alertRegistry = newAlerter(nil, nil)
+
+// set replaces the rules and webhooks. Alerts of rules no longer present
+// are forgotten, without notifying.
+func (a *alerter) set(rules []alertRule, webhooks []string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.rules, a.webhooks = rules, webhooks
+	names := map[string]struct{}{}
+	for _, rule := range rules {
+		names[rule.Name] = struct{}{}
+	}
+	for name := range a.firing {
+		if _, ok := names[name]; !ok {
+			delete(a.firing, name)
+			delete(a.prev, name)
+		}
+	}
+}
+
+// update evaluates the rules against renders of their topologies, by rule,
+// and queues notifications of the alerts which fired or resolved. Rules
+// without a render are left as they were.
+func (a *alerter) update(renders map[string]render.RenderableNodes, now time.Time) []Alert {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	changed := []Alert{}
+	for _, rule := range a.rules {
+		cur, ok := renders[rule.Name]
+		if !ok {
+			continue
+		}
+		before := firing{}
+		for key, alert := range a.firing[rule.Name] {
+			before[key] = alert.Summary
+		}
+		after := rule.evaluate(a.prev[rule.Name], cur, before)
+		a.prev[rule.Name] = cur
+
+		alerts := a.firing[rule.Name]
+		if alerts == nil {
+			alerts = map[string]*Alert{}
+			a.firing[rule.Name] = alerts
+		}
+		for _, key := range sortedFiring(after) {
+			if _, ok := alerts[key]; ok {
+				continue
+			}
+			alert := &Alert{
+				Rule:     rule.Name,
+				Topology: rule.Topology,
+				Key:      key,
+				Summary:  after[key],
+				Status:   alertFiring,
+				StartsAt: now,
+			}
+			alerts[key] = alert
+			changed = append(changed, *alert)
+		}
+		for _, key := range sortedFiring(before) {
+			if _, ok := after[key]; ok {
+				continue
+			}
+			alert := *alerts[key]
+			delete(alerts, key)
+			alert.Status, alert.EndsAt = alertResolved, &now
+			a.resolved = append([]Alert{alert}, a.resolved...)
+			changed = append(changed, alert)
+		}
+	}
+	if len(a.resolved) > maxResolvedAlerts {
+		a.resolved = a.resolved[:maxResolvedAlerts]
+	}
+
+	if len(changed) > 0 && len(a.webhooks) > 0 {
+		select {
+		case a.queue <- changed:
+		default:
+			log.Printf("Alert notifications backed up; dropping %d", len(changed))
+		}
+	}
+	return changed
+}
+
+func sortedFiring(f firing) []string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// alerts returns the firing alerts, oldest first, and the latest resolved.
+func (a *alerter) alerts() APIAlerts {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	result := APIAlerts{Firing: []Alert{}, Resolved: append([]Alert{}, a.resolved...)}
+	for _, alerts := range a.firing {
+		for _, alert := range alerts {
+			result.Firing = append(result.Firing, *alert)
+		}
+	}
+	sort.Sort(alertsByStart(result.Firing))
+	return result
+}
+
+type alertsByStart []Alert
+
+func (a alertsByStart) Len() int      { return len(a) }
+func (a alertsByStart) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a alertsByStart) Less(i, j int) bool {
+	switch {
+	case !a[i].StartsAt.Equal(a[j].StartsAt):
+		return a[i].StartsAt.Before(a[j].StartsAt)
+	case a[i].Rule != a[j].Rule:
+		return a[i].Rule < a[j].Rule
+	}
+	return a[i].Key < a[j].Key
+}
+
+// run renders the rules' topologies, and updates the alerts, whenever the
+// report changes, checking every interval.
+func (a *alerter) run(rep *renderCache, registry *viewRegistry, interval time.Duration, quit <-chan struct{}) {
+	go a.notify(quit)
+	var (
+		ticker     = time.NewTicker(interval)
+		generation uint64
+	)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+		if g, ok := rep.Reporter.(xfer.Generationer); ok {
+			current := g.Generation()
+			if current == generation {
+				continue
+			}
+			generation = current
+		}
+		a.update(a.render(rep, registry), time.Now())
+	}
+}
+
+// render renders the topology of every rule, with the rule's options.
+func (a *alerter) render(rep *renderCache, registry *viewRegistry) map[string]render.RenderableNodes {
+	a.mtx.Lock()
+	rules := a.rules
+	a.mtx.Unlock()
+
+	renders := map[string]render.RenderableNodes{}
+	for _, rule := range rules {
+		view, ok := registry.get(rule.Topology)
+		if !ok {
+			log.Printf("Alert rule %s: no topology %s", rule.Name, rule.Topology)
+			continue
+		}
+		params := url.Values{}
+		for param, value := range rule.Options {
+			params.Set(param, value)
+		}
+		r, err := http.NewRequest("GET", "/?"+params.Encode(), nil)
+		if err == nil {
+			err = decorateTopologyForRequest(r, &view)
+		}
+		if err != nil {
+			log.Printf("Alert rule %s: %v", rule.Name, err)
+			continue
+		}
+		_, nodes, _ := rep.render(view)
+		renders[rule.Name] = nodes
+	}
+	return renders
+}
+
+var webhookClient = http.Client{
+	Timeout: 5 * time.Second,
+}
+
+// notify posts queued alerts to every webhook.
+func (a *alerter) notify(quit <-chan struct{}) {
+	for {
+		select {
+		case alerts := <-a.queue:
+			body, err := json.Marshal(webhookPayload{Alerts: alerts})
+			if err != nil {
+				log.Printf("Error encoding alerts: %v", err)
+				continue
+			}
+			a.mtx.Lock()
+			webhooks := a.webhooks
+			a.mtx.Unlock()
+			for _, webhook := range webhooks {
+				resp, err := webhookClient.Post(webhook, "application/json", bytes.NewReader(body))
+				if err != nil {
+					log.Printf("Error notifying %s of alerts: %v", webhook, err)
+					continue
+				}
+				resp.Body.Close()
+				if resp.StatusCode/100 != 2 {
+					log.Printf("Error notifying %s of alerts: %s", webhook, resp.Status)
+				}
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Alerts firing and recently resolved.
+func makeAlertsHandler(a *alerter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondWith(w, http.StatusOK, a.alerts())
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestMakeRules(t *testing.T) {
+	for _, c := range []ruleConfig{
+		{Topology: "containers", Condition: conditionMatches},
+		{Name: "a", Condition: conditionMatches},
+		{Name: "a", Topology: "containers", Condition: "sometimes"},
+		{Name: "a", Topology: "containers", Condition: conditionCountBelow},
+		{Name: "a", Topology: "containers", Condition: conditionEdgeAdded, Filter: "web"},
+		{Name: "a", Topology: "containers", Condition: conditionMatches, Filter: "cpu>lots"},
+	} {
+		if _, err := makeRules([]ruleConfig{c}); err == nil {
+			t.Errorf("%+v: want an error", c)
+		}
+	}
+	if _, err := makeRules([]ruleConfig{
+		{Name: "a", Topology: "containers", Condition: conditionMatches},
+		{Name: "a", Topology: "hosts", Condition: conditionMatches},
+	}); err == nil {
+		t.Error("duplicate rules: want an error")
+	}
+}
+
+func alertNode(id string, adjacent ...string) render.RenderableNode {
+	node := report.MakeNode()
+	for _, a := range adjacent {
+		node = node.WithAdjacent(a)
+	}
+	return render.RenderableNode{ID: id, LabelMajor: id, Pseudo: id == render.TheInternetID, Node: node}
+}
+
+func alertNodes(nodes ...render.RenderableNode) render.RenderableNodes {
+	result := render.RenderableNodes{}
+	for _, n := range nodes {
+		result[n.ID] = n
+	}
+	return result
+}
+
+func TestAlerter(t *testing.T) {
+	rules, err := makeRules([]ruleConfig{
+		{Name: "egress", Topology: "containers", Condition: conditionEdgeAdded, From: "!id:theinternet", To: "id:theinternet"},
+		{Name: "db-gone", Topology: "containers", Condition: conditionNodeRemoved, Filter: "id:db*"},
+		{Name: "few", Topology: "containers", Condition: conditionCountBelow, Threshold: 3},
+		{Name: "web", Topology: "containers", Condition: conditionMatches, Filter: "id:web*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newAlerter(rules, nil)
+	renders := func(nodes render.RenderableNodes) map[string]render.RenderableNodes {
+		return map[string]render.RenderableNodes{"egress": nodes, "db-gone": nodes, "few": nodes, "web": nodes}
+	}
+	changes := func(alerts []Alert) []string {
+		result := []string{}
+		for _, alert := range alerts {
+			result = append(result, alert.Status+" "+alert.Rule+" "+alert.Key)
+		}
+		return result
+	}
+	start := time.Unix(0, 0)
+
+	// Existing edges aren't new, and nothing's gone yet.
+	have := changes(a.update(renders(alertNodes(
+		alertNode("web", "db"),
+		alertNode("db"),
+		alertNode("cache", render.TheInternetID),
+		alertNode(render.TheInternetID),
+	)), start))
+	want := []string{"firing web web"}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// The same again is deduplicated.
+	have = changes(a.update(renders(alertNodes(
+		alertNode("web", "db"),
+		alertNode("db"),
+		alertNode("cache", render.TheInternetID),
+		alertNode(render.TheInternetID),
+	)), start.Add(time.Second)))
+	if len(have) != 0 {
+		t.Errorf("want no changes, have %v", have)
+	}
+
+	// The database goes, web talks to the internet instead.
+	have = changes(a.update(renders(alertNodes(
+		alertNode("web", render.TheInternetID),
+		alertNode("cache", render.TheInternetID),
+		alertNode(render.TheInternetID),
+	)), start.Add(2*time.Second)))
+	want = []string{
+		`firing egress "web" -> "theinternet"`,
+		"firing db-gone db",
+		"firing few ",
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// It comes back, and web stops using the internet; only web still fires.
+	have = changes(a.update(renders(alertNodes(
+		alertNode("web", "db"),
+		alertNode("db"),
+		alertNode("cache", render.TheInternetID),
+		alertNode(render.TheInternetID),
+	)), start.Add(3*time.Second)))
+	want = []string{
+		`resolved egress "web" -> "theinternet"`,
+		"resolved db-gone db",
+		"resolved few ",
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	alerts := a.alerts()
+	if want, have := []string{"firing web web"}, changes(alerts.Firing); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if want, have := 3, len(alerts.Resolved); want != have {
+		t.Errorf("want %d resolved alerts, have %d", want, have)
+	}
+	if resolved := alerts.Resolved[0]; resolved.EndsAt == nil || !resolved.StartsAt.Equal(start.Add(2*time.Second)) {
+		t.Errorf("bad times on %+v", resolved)
+	}
+}
+
+func TestAlerterCPU(t *testing.T) {
+	rules, err := makeRules([]ruleConfig{{Name: "hot", Topology: "containers", Condition: conditionMatches, Filter: "cpu>90"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := func(id string, metadata map[string]string) render.RenderableNode {
+		node := alertNode(id)
+		node.Node = node.Node.WithMetadata(metadata)
+		return node
+	}
+	nodes := alertNodes(
+		// Long running, so it's used a lot of CPU time, but idle now.
+		container("idle", map[string]string{docker.CPUTotalUsage: "987654321000", docker.CPUUsagePercent: "0.50"}),
+		// Only sampled once so far.
+		container("new", map[string]string{docker.CPUTotalUsage: "987654321000"}),
+		container("busy", map[string]string{docker.CPUTotalUsage: "1000", docker.CPUUsagePercent: "95.00"}),
+	)
+
+	have := []string{}
+	for _, alert := range newAlerter(rules, nil).update(map[string]render.RenderableNodes{"hot": nodes}, time.Now()) {
+		have = append(have, alert.Rule+" "+alert.Key)
+	}
+	if want := []string{"hot busy"}; !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestAlerterWebhook(t *testing.T) {
+	received := make(chan webhookPayload, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		received <- payload
+	}))
+	defer hook.Close()
+
+	rules, err := makeRules([]ruleConfig{{Name: "few", Topology: "hosts", Condition: conditionCountBelow, Threshold: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newAlerter(rules, []string{hook.URL})
+	quit := make(chan struct{})
+	defer close(quit)
+	go a.notify(quit)
+
+	a.update(map[string]render.RenderableNodes{"few": {}}, time.Now())
+	select {
+	case payload := <-received:
+		if len(payload.Alerts) != 1 || payload.Alerts[0].Rule != "few" || payload.Alerts[0].Status != alertFiring {
+			t.Errorf("bad payload %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestAPIAlerts(t *testing.T) {
+	ts := httptest.NewServer(Router(StaticReport{}))
+	defer ts.Close()
+
+	var alerts APIAlerts
+	if err := json.Unmarshal(getRawJSON(t, ts, "/api/alerts"), &alerts); err != nil {
+		t.Fatal(err)
+	}
+	if alerts.Firing == nil || alerts.Resolved == nil {
+		t.Errorf("want empty lists, have %+v", alerts)
+	}
+}
+
+func TestAlerterRender(t *testing.T) {
+	rules, err := makeRules([]ruleConfig{
+		{Name: "hosts", Topology: "hosts", Condition: conditionCountBelow, Threshold: 5},
+		{Name: "clients", Topology: "containers", Options: map[string]string{"filter": "container=client"}, Condition: conditionMatches},
+		{Name: "gone", Topology: "nonexistent", Condition: conditionMatches},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newAlerter(rules, nil)
+	renders := a.render(newRenderCache(StaticReport{}), topologyRegistry)
+	if _, ok := renders["gone"]; ok {
+		t.Error("rendered a nonexistent topology")
+	}
+	if _, ok := renders["clients"][test.ServerContainerID]; ok {
+		t.Error("options not applied")
+	}
+
+	have := []string{}
+	for _, alert := range a.update(renders, time.Now()) {
+		have = append(have, alert.Rule+" "+alert.Key)
+	}
+	want := []string{"hosts ", "clients " + test.ClientContainerID}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// Limits on the number of hops to walk, and paths to return, as the number of
+// paths grows exponentially with hops.
+const (
+	defaultMaxHops = 5
+	maxMaxHops     = 10
+	maxPaths       = 100
+)
+
+// APIPaths is returned by the /api/topology/{name}/paths handler.
+// Only the shortest maxPaths paths are returned; Truncated is set if there
+// are more.
+type APIPaths struct {
+	Paths     []APIPath `json:"paths"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// APIPath is a path between two nodes, with the metadata of each edge along
+// it.
+type APIPath struct {
+	Nodes []string `json:"nodes"`
+	Hops  []APIHop `json:"hops"`
+}
+
+// APIHop is an edge along a path.
+type APIHop struct {
+	From     string              `json:"from"`
+	To       string              `json:"to"`
+	Metadata report.EdgeMetadata `json:"metadata"`
+}
+
+// APIBlastRadius is returned by the /api/topology/{name}/blast-radius
+// handler.
+type APIBlastRadius struct {
+	Node       string         `json:"node"`
+	Direction  string         `json:"direction"`
+	Dependants []APIDependant `json:"dependants"`
+}
+
+// APIDependant is a node depending on, or depended on by, another node.
+type APIDependant struct {
+	ID   string `json:"id"`
+	Hops int    `json:"hops"`
+}
+
+// Paths between two nodes.
+func handlePaths(rep *renderCache, t topologyView, w http.ResponseWriter, r *http.Request) {
+	maxHops, ok := maxHopsParam(w, r)
+	if !ok {
+		return
+	}
+	var (
+		from          = r.FormValue("from")
+		to            = r.FormValue("to")
+		rpt, nodes, _ = rep.render(t)
+	)
+	if _, ok := nodes[from]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if _, ok := nodes[to]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var (
+		found  = nodes.Paths(from, to, maxHops, maxPaths+1)
+		result = APIPaths{Paths: []APIPath{}, Truncated: len(found) > maxPaths}
+		edges  = render.EdgeMetadatas(t.renderer, rpt)
+	)
+	if result.Truncated {
+		found = found[:maxPaths]
+	}
+	for _, path := range found {
+		hops := []APIHop{}
+		for i := 1; i < len(path); i++ {
+			hops = append(hops, APIHop{From: path[i-1], To: path[i], Metadata: edges[path[i-1]].Get(path[i])})
+		}
+		result.Paths = append(result.Paths, APIPath{Nodes: path, Hops: hops})
+	}
+	respondWith(w, http.StatusOK, result)
+}
+
+// Nodes transitively depending on, or depended on by, a node.
+func handleBlastRadius(rep *renderCache, t topologyView, w http.ResponseWriter, r *http.Request) {
+	maxHops, ok := maxHopsParam(w, r)
+	if !ok {
+		return
+	}
+	direction := render.Direction(r.FormValue("direction"))
+	switch direction {
+	case "":
+		direction = render.Upstream
+	case render.Upstream, render.Downstream:
+	default:
+		respondWith(w, http.StatusBadRequest, "direction must be upstream or downstream")
+		return
+	}
+	var (
+		id          = r.FormValue("node")
+		_, nodes, _ = rep.render(t)
+	)
+	if _, ok := nodes[id]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	dependants := []APIDependant{}
+	for dependant, hops := range nodes.Dependants(id, direction, maxHops) {
+		dependants = append(dependants, APIDependant{ID: dependant, Hops: hops})
+	}
+	sort.Sort(dependantsByHops(dependants))
+	respondWith(w, http.StatusOK, APIBlastRadius{
+		Node:       id,
+		Direction:  string(direction),
+		Dependants: dependants,
+	})
+}
+
+// maxHopsParam returns the maxHops parameter of a request, or responds with
+// an error if it's invalid.
+func maxHopsParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.FormValue("maxHops")
+	if value == "" {
+		return defaultMaxHops, true
+	}
+	maxHops, err := strconv.Atoi(value)
+	if err != nil || maxHops < 1 || maxHops > maxMaxHops {
+		respondWith(w, http.StatusBadRequest, "maxHops must be between 1 and "+strconv.Itoa(maxMaxHops))
+		return 0, false
+	}
+	return maxHops, true
+}
+
+type dependantsByHops []APIDependant
+
+func (d dependantsByHops) Len() int      { return len(d) }
+func (d dependantsByHops) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d dependantsByHops) Less(i, j int) bool {
+	if d[i].Hops != d[j].Hops {
+		return d[i].Hops < d[j].Hops
+	}
+	return d[i].ID < d[j].ID
+}
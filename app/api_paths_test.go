@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestAPIPaths(t *testing.T) {
+	ts := httptest.NewServer(Router(StaticReport{}))
+	defer ts.Close()
+
+	pathsURL := func(from, to, maxHops string) string {
+		return "/api/topology/containers/paths?" + url.Values{"from": {from}, "to": {to}, "maxHops": {maxHops}}.Encode()
+	}
+	is404(t, ts, pathsURL("nope", test.ServerContainerID, ""))
+	is404(t, ts, pathsURL(test.ClientContainerID, "nope", ""))
+	is400(t, ts, pathsURL(test.ClientContainerID, test.ServerContainerID, "0"))
+	is400(t, ts, pathsURL(test.ClientContainerID, test.ServerContainerID, "lots"))
+
+	var paths APIPaths
+	ok(t, json.Unmarshal(getRawJSON(t, ts, pathsURL(test.ClientContainerID, test.ServerContainerID, "")), &paths))
+	equals(t, 1, len(paths.Paths))
+	equals(t, false, paths.Truncated)
+	equals(t, []string{test.ClientContainerID, test.ServerContainerID}, paths.Paths[0].Nodes)
+	equals(t, 1, len(paths.Paths[0].Hops))
+	hop := paths.Paths[0].Hops[0]
+	equals(t, test.ClientContainerID, hop.From)
+	equals(t, test.ServerContainerID, hop.To)
+	assert(t, hop.Metadata.EgressPacketCount != nil, "no edge metadata on hop: %+v", hop)
+
+	// Nothing reaches the client.
+	ok(t, json.Unmarshal(getRawJSON(t, ts, pathsURL(test.ServerContainerID, test.ClientContainerID, "")), &paths))
+	equals(t, 0, len(paths.Paths))
+}
+
+func TestAPIBlastRadius(t *testing.T) {
+	ts := httptest.NewServer(Router(StaticReport{}))
+	defer ts.Close()
+
+	blastURL := func(node, direction string) string {
+		return "/api/topology/containers/blast-radius?" + url.Values{"node": {node}, "direction": {direction}}.Encode()
+	}
+	is404(t, ts, blastURL("nope", ""))
+	is400(t, ts, blastURL(test.ServerContainerID, "sideways"))
+
+	var radius APIBlastRadius
+	ok(t, json.Unmarshal(getRawJSON(t, ts, blastURL(test.ServerContainerID, "")), &radius))
+	equals(t, "upstream", radius.Direction)
+	dependants := map[string]int{}
+	for _, d := range radius.Dependants {
+		dependants[d.ID] = d.Hops
+	}
+	equals(t, 1, dependants[test.ClientContainerID])
+	equals(t, 1, dependants[render.TheInternetID])
+
+	ok(t, json.Unmarshal(getRawJSON(t, ts, blastURL(test.ClientContainerID, "downstream")), &radius))
+	equals(t, []APIDependant{{ID: test.ServerContainerID, Hops: 1}}, radius.Dependants)
+}
@@ -1,11 +1,27 @@
 package main
 
 import (
+	"compress/gzip"
+	"errors"
+	"io"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/xfer"
 )
 
+// Limits on the reports probes may post, so one misbehaving probe can't
+// exhaust the app's memory. Set by flags.
+var (
+	maxReportSize    int64 = 64 << 20 // bytes, once decompressed
+	maxTopologyNodes       = 100000
+)
+
+var errReportTooLarge = errors.New("report too large")
+
 // Raw report handler
 func makeRawReportHandler(rep xfer.Reporter) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -13,3 +29,98 @@ func makeRawReportHandler(rep xfer.Reporter) func(http.ResponseWriter, *http.Req
 		respondWith(w, http.StatusOK, rep.Report())
 	}
 }
+
+// makeReportPostHandler decodes reports straight off the wire, without
+// buffering the body, and adds them to the collector. Reports larger than
+// maxReportSize are rejected; topologies with more than maxTopologyNodes
+// nodes are truncated, and the probe told so in the response.
+func makeReportPostHandler(a xfer.Adder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			rpt    report.Report
+			body   = &limitedReader{r: r.Body, n: maxReportSize}
+			reader io.Reader
+			err    error
+		)
+		reader = body
+		if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+			if reader, err = gzip.NewReader(body); err != nil {
+				reportsRejected.WithLabelValues("invalid").Inc()
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		// Compressed reports may be many times larger once decompressed.
+		decoded := &limitedReader{r: reader, n: maxReportSize}
+
+		begin := time.Now()
+		if err := rpt.ReadBinary(decoded); err != nil {
+			if body.exceeded || decoded.exceeded {
+				reportsRejected.WithLabelValues("too_large").Inc()
+				http.Error(w, errReportTooLarge.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			reportsRejected.WithLabelValues("invalid").Inc()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reportDecodeDuration.Observe(float64(time.Since(begin)))
+		reportSize.Observe(float64(decoded.read))
+
+		truncated := truncateReport(&rpt, maxTopologyNodes)
+		for name, dropped := range truncated {
+			nodesTruncated.WithLabelValues(name).Add(float64(dropped))
+		}
+		a.Add(rpt)
+		reportsReceived.Inc()
+		respondWith(w, http.StatusOK, xfer.ReportResponse{Truncated: truncated})
+	}
+}
+
+// limitedReader reads at most n bytes, failing once a reader has more.
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	read     int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.read >= l.n {
+		// Only fail if there's more to read; a report may fit exactly.
+		var b [1]byte
+		if n, _ := l.r.Read(b[:]); n > 0 {
+			l.exceeded = true
+			return 0, errReportTooLarge
+		}
+		return 0, io.EOF
+	}
+	if remaining := l.n - l.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	return n, err
+}
+
+// truncateReport drops nodes from any topology with more than max, keeping
+// the first max by ID so repeated reports keep the same nodes. It returns
+// how many nodes were dropped, by topology.
+func truncateReport(rpt *report.Report, max int) map[string]int {
+	truncated := map[string]int{}
+	rpt.WalkTopologies(func(name string, t *report.Topology) {
+		if t.Nodes.Size() <= max {
+			return
+		}
+		ids := make([]string, 0, t.Nodes.Size())
+		t.Nodes.ForEach(func(id string, _ report.Node) {
+			ids = append(ids, id)
+		})
+		sort.Strings(ids)
+		for _, id := range ids[max:] {
+			t.Nodes = t.Nodes.Delete(id)
+		}
+		truncated[name] = len(ids) - max
+	})
+	return truncated
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/xfer"
 )
 
 func TestAPIReport(t *testing.T) {
@@ -22,3 +29,73 @@ func TestAPIReport(t *testing.T) {
 		t.Fatalf("JSON parse error: %s", err)
 	}
 }
+
+func postReport(t *testing.T, ts *httptest.Server, rpt report.Report) (int, xfer.ReportResponse) {
+	buf := &bytes.Buffer{}
+	gzwriter := gzip.NewWriter(buf)
+	if err := rpt.WriteBinary(gzwriter); err != nil {
+		t.Fatal(err)
+	}
+	gzwriter.Close()
+
+	req, err := http.NewRequest("POST", ts.URL+"/api/report", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var response xfer.ReportResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, response
+}
+
+func TestReportPost(t *testing.T) {
+	defer func(size int64, nodes int) {
+		maxReportSize, maxTopologyNodes = size, nodes
+	}(maxReportSize, maxTopologyNodes)
+
+	c := xfer.NewCollector(time.Minute)
+	ts := httptest.NewServer(Router(c))
+	defer ts.Close()
+
+	status, response := postReport(t, ts, test.Report)
+	if status != http.StatusOK {
+		t.Fatalf("want %d, have %d", http.StatusOK, status)
+	}
+	if len(response.Truncated) != 0 {
+		t.Errorf("want nothing truncated, have %v", response.Truncated)
+	}
+	if want, have := test.Report.Topologies[report.Endpoint].Nodes.Size(), c.Report().Topologies[report.Endpoint].Nodes.Size(); want != have {
+		t.Errorf("want %d endpoints, have %d", want, have)
+	}
+
+	// Topologies with too many nodes are truncated, keeping the first by ID.
+	maxTopologyNodes = 2
+	status, response = postReport(t, ts, test.Report)
+	if status != http.StatusOK {
+		t.Fatalf("want %d, have %d", http.StatusOK, status)
+	}
+	want := map[string]int{
+		report.Endpoint: test.Report.Topologies[report.Endpoint].Nodes.Size() - 2,
+		report.Process:  test.Report.Topologies[report.Process].Nodes.Size() - 2,
+		report.Address:  test.Report.Topologies[report.Address].Nodes.Size() - 2,
+	}
+	if !reflect.DeepEqual(want, response.Truncated) {
+		t.Error(test.Diff(want, response.Truncated))
+	}
+
+	// Reports too large are rejected outright.
+	maxReportSize = 256
+	if status, _ := postReport(t, ts, test.Report); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("want %d, have %d", http.StatusRequestEntityTooLarge, status)
+	}
+}
@@ -3,9 +3,7 @@ package main
 import (
 	"net/http"
 
-	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/report"
-	"github.com/weaveworks/scope/xfer"
 )
 
 // APITopologyDesc is returned in a list by the /api/topology handler.
@@ -32,49 +30,66 @@ type topologyStats struct {
 }
 
 // makeTopologyList returns a handler that yields an APITopologyList.
-func makeTopologyList(rep xfer.Reporter) func(w http.ResponseWriter, r *http.Request) {
+func makeTopologyList(rep *renderCache) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
-			rpt        = rep.Report()
 			topologies = []APITopologyDesc{}
+			rpt        = rep.Report()
+			err        error
 		)
-		for name, def := range topologyRegistry {
+		topologyRegistry.walk(func(name string, def topologyView) {
 			// Don't show sub-topologies at the top level.
-			if def.parent != "" {
-				continue
+			if def.parent != "" || err != nil {
+				return
+			}
+			if err = decorateTopologyForRequest(r, &def); err != nil {
+				return
 			}
-			decorateTopologyForRequest(r, &def)
 
 			// Collect all sub-topologies of this one, depth=1 only.
 			subTopologies := []APITopologyDesc{}
-			for subName, subDef := range topologyRegistry {
-				if subDef.parent == name {
-					decorateTopologyForRequest(r, &subDef)
+			topologyRegistry.walk(func(subName string, subDef topologyView) {
+				if subDef.parent == name && err == nil {
+					if err = decorateTopologyForRequest(r, &subDef); err != nil {
+						return
+					}
 					subTopologies = append(subTopologies, APITopologyDesc{
 						Name:    subDef.human,
 						URL:     "/api/topology/" + subName,
-						Options: makeTopologyOptions(subDef),
-						Stats:   stats(subDef.renderer, rpt),
+						Options: makeTopologyOptions(rpt, subDef),
+						Stats:   stats(rep, subDef),
 					})
 				}
-			}
+			})
 
 			// Append.
 			topologies = append(topologies, APITopologyDesc{
 				Name:          def.human,
 				URL:           "/api/topology/" + name,
 				SubTopologies: subTopologies,
-				Options:       makeTopologyOptions(def),
-				Stats:         stats(def.renderer, rpt),
+				Options:       makeTopologyOptions(rpt, def),
+				Stats:         stats(rep, def),
 			})
+		})
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, err.Error())
+			return
 		}
 		respondWith(w, http.StatusOK, topologies)
 	}
 }
 
-func makeTopologyOptions(view topologyView) map[string][]APITopologyOption {
+func makeTopologyOptions(rpt report.Report, view topologyView) map[string][]APITopologyOption {
+	params := view.options
+	if groupBy := groupByOptions(rpt, view); len(groupBy) > 0 {
+		params = optionParams{groupByParam: groupBy}
+		for param, optionVals := range view.options {
+			params[param] = optionVals
+		}
+	}
+
 	options := map[string][]APITopologyOption{}
-	for param, optionVals := range view.options {
+	for param, optionVals := range params {
 		for _, optionVal := range optionVals {
 			options[param] = append(options[param], APITopologyOption{
 				Value:   optionVal.value,
@@ -86,14 +101,15 @@ func makeTopologyOptions(view topologyView) map[string][]APITopologyOption {
 	return options
 }
 
-func stats(renderer render.Renderer, rpt report.Report) *topologyStats {
+func stats(rep *renderCache, view topologyView) *topologyStats {
 	var (
 		nodes     int
 		realNodes int
 		edges     int
 	)
 
-	for _, n := range renderer.Render(rpt) {
+	_, rendered, renderStats := rep.render(view)
+	for _, n := range rendered {
 		nodes++
 		if !n.Pseudo {
 			realNodes++
@@ -101,8 +117,6 @@ func stats(renderer render.Renderer, rpt report.Report) *topologyStats {
 		edges += len(n.Adjacency)
 	}
 
-	renderStats := renderer.Stats(rpt)
-
 	return &topologyStats{
 		NodeCount:          nodes,
 		NonpseudoNodeCount: realNodes,
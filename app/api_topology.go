@@ -1,22 +1,31 @@
 package main
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 
 	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/export"
 	"github.com/weaveworks/scope/report"
-	"github.com/weaveworks/scope/xfer"
 )
 
 const (
 	websocketLoop    = 1 * time.Second
 	websocketTimeout = 10 * time.Second
+
+	// minWebsocketLoop is the shortest loop a client may ask for.
+	minWebsocketLoop = 100 * time.Millisecond
 )
 
+// maxMaxSeries bounds the limit on series a Prometheus scrape may ask for.
+const maxMaxSeries = 10000
+
 // APITopology is returned by the /api/topology/{name} handler.
 type APITopology struct {
 	Nodes render.RenderableNodes `json:"nodes"`
@@ -29,40 +38,97 @@ type APINode struct {
 
 // APIEdge is returned by the /api/topology/*/*/* handlers.
 type APIEdge struct {
-	Metadata report.EdgeMetadata `json:"metadata"`
+	Metadata  report.EdgeMetadata     `json:"metadata"`
+	Violation *render.PolicyViolation `json:"policy_violation,omitempty"`
 }
 
-// Full topology.
-func handleTopology(rep xfer.Reporter, t topologyView, w http.ResponseWriter, r *http.Request) {
-	respondWith(w, http.StatusOK, APITopology{
-		Nodes: t.renderer.Render(rep.Report()).Prune(),
-	})
+// Full topology, as JSON, or in one of the export formats.
+func handleTopology(rep *renderCache, t topologyView, w http.ResponseWriter, r *http.Request) {
+	formatName := r.FormValue("format")
+	if formatName == "" || formatName == "json" {
+		_, nodes, _ := rep.render(t)
+		respondWith(w, http.StatusOK, APITopology{
+			Nodes: nodes.Prune(),
+		})
+		return
+	}
+	exportTopology(rep, t, formatName, w)
 }
 
-// Websocket for the full topology. This route overlaps with the next.
-func handleWs(rep xfer.Reporter, t topologyView, w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		respondWith(w, http.StatusInternalServerError, err.Error())
+// Full topology, drawn in the given export format.
+func makeImageHandler(formatName string) func(*renderCache, topologyView, http.ResponseWriter, *http.Request) {
+	return func(rep *renderCache, t topologyView, w http.ResponseWriter, r *http.Request) {
+		exportTopology(rep, t, formatName, w)
+	}
+}
+
+func exportTopology(rep *renderCache, t topologyView, formatName string, w http.ResponseWriter) {
+	format, ok := export.Formats[formatName]
+	if !ok {
+		respondWith(w, http.StatusBadRequest, fmt.Sprintf("unknown format %q", formatName))
 		return
 	}
-	loop := websocketLoop
-	if t := r.Form.Get("t"); t != "" {
+	var (
+		rpt, nodes, _ = rep.render(t)
+		edges         = render.EdgeMetadatas(t.renderer, rpt)
+		edge          = func(from, to string) report.EdgeMetadata { return edges[from].Get(to) }
+	)
+	w.Header().Set("Content-Type", format.ContentType)
+	if err := format.Export(w, nodes, edge); err != nil {
+		log.Printf("Error exporting %s: %v", formatName, err)
+	}
+}
+
+// Gauges of the topology's nodes and edges, for Prometheus to scrape.
+func handleMetrics(rep *renderCache, t topologyView, w http.ResponseWriter, r *http.Request) {
+	maxSeries := export.DefaultMaxSeries
+	if value := r.FormValue("limit"); value != "" {
 		var err error
-		if loop, err = time.ParseDuration(t); err != nil {
-			respondWith(w, http.StatusBadRequest, t)
+		if maxSeries, err = strconv.Atoi(value); err != nil || maxSeries < 1 || maxSeries > maxMaxSeries {
+			respondWith(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxMaxSeries))
+			return
+		}
+	}
+	var (
+		rpt, nodes, _ = rep.render(t)
+		edges         = render.EdgeMetadatas(t.renderer, rpt)
+		edge          = func(from, to string) report.EdgeMetadata { return edges[from].Get(to) }
+	)
+	w.Header().Set("Content-Type", export.PrometheusContentType)
+	if err := export.Prometheus(w, t.id, nodes, edge, maxSeries); err != nil {
+		log.Printf("Error exporting metrics: %v", err)
+	}
+}
+
+// Websocket for the full topology. This route overlaps with the next.
+func makeWsHandler(b *broadcaster) func(*renderCache, topologyView, http.ResponseWriter, *http.Request) {
+	return func(rep *renderCache, t topologyView, w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
 			return
 		}
+		loop := websocketLoop
+		if t := r.Form.Get("t"); t != "" {
+			var err error
+			if loop, err = time.ParseDuration(t); err != nil || loop <= 0 {
+				respondWith(w, http.StatusBadRequest, t)
+				return
+			}
+			if loop < minWebsocketLoop {
+				loop = minWebsocketLoop
+			}
+		}
+		handleWebsocket(w, r, b, t, loop)
 	}
-	handleWebsocket(w, r, rep, t, loop)
 }
 
 // Individual nodes.
-func handleNode(rep xfer.Reporter, t topologyView, w http.ResponseWriter, r *http.Request) {
+func handleNode(rep *renderCache, t topologyView, w http.ResponseWriter, r *http.Request) {
 	var (
-		vars     = mux.Vars(r)
-		nodeID   = vars["id"]
-		rpt      = rep.Report()
-		node, ok = t.renderer.Render(rep.Report())[nodeID]
+		vars          = mux.Vars(r)
+		nodeID        = vars["id"]
+		rpt, nodes, _ = rep.render(t)
+		node, ok      = nodes[nodeID]
 	)
 	if !ok {
 		http.NotFound(w, r)
@@ -72,16 +138,26 @@ func handleNode(rep xfer.Reporter, t topologyView, w http.ResponseWriter, r *htt
 }
 
 // Individual edges.
-func handleEdge(rep xfer.Reporter, t topologyView, w http.ResponseWriter, r *http.Request) {
+func handleEdge(rep *renderCache, t topologyView, w http.ResponseWriter, r *http.Request) {
 	var (
 		vars     = mux.Vars(r)
 		localID  = vars["local"]
 		remoteID = vars["remote"]
 		rpt      = rep.Report()
 		metadata = t.renderer.EdgeMetadata(rpt, localID, remoteID)
+		edge     = APIEdge{Metadata: metadata}
 	)
 
-	respondWith(w, http.StatusOK, APIEdge{Metadata: metadata})
+	if t.audited && networkPolicy != nil {
+		rendered, nodes, _ := rep.render(t)
+		local, remote := nodes[localID], nodes[remoteID]
+		if render.Violates(local, remoteID) {
+			if violation, ok := networkPolicy.Check(rendered, local, remote); ok {
+				edge.Violation = &violation
+			}
+		}
+	}
+	respondWith(w, http.StatusOK, edge)
 }
 
 var upgrader = websocket.Upgrader{
@@ -91,7 +167,7 @@ var upgrader = websocket.Upgrader{
 func handleWebsocket(
 	w http.ResponseWriter,
 	r *http.Request,
-	rep xfer.Reporter,
+	b *broadcaster,
 	t topologyView,
 	loop time.Duration,
 ) {
@@ -101,6 +177,8 @@ func handleWebsocket(
 		return
 	}
 	defer conn.Close()
+	websocketClients.WithLabelValues(t.id).Inc()
+	defer websocketClients.WithLabelValues(t.id).Dec()
 
 	quit := make(chan struct{})
 	go func(c *websocket.Conn) {
@@ -112,12 +190,18 @@ func handleWebsocket(
 		}
 	}(conn)
 
-	var (
-		previousTopo render.RenderableNodes
-		tick         = time.Tick(loop)
-	)
+	updates, unsubscribe := b.subscribe(t, loop)
+	defer unsubscribe()
+
+	var previousTopo render.RenderableNodes
 	for {
-		newTopo := t.renderer.Render(rep.Report()).Prune()
+		var newTopo render.RenderableNodes
+		select {
+		case <-quit:
+			return
+		case newTopo = <-updates:
+		}
+
 		diff := render.TopoDiff(previousTopo, newTopo)
 		previousTopo = newTopo
 
@@ -127,11 +211,5 @@ func handleWebsocket(
 		if err := conn.WriteJSON(diff); err != nil {
 			return
 		}
-
-		select {
-		case <-quit:
-			return
-		case <-tick:
-		}
 	}
 }
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"image/png"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/websocket"
@@ -138,6 +142,93 @@ func TestAPITopologyHosts(t *testing.T) {
 	}
 }
 
+func TestAPITopologyFilter(t *testing.T) {
+	ts := httptest.NewServer(Router(StaticReport{}))
+	defer ts.Close()
+	is400(t, ts, "/api/topology/containers?filter=image%3D")
+	is400(t, ts, "/api/topology/containers?filter=client&hops=-1")
+	is400(t, ts, "/api/topology?filter=cpu%3Elots")
+
+	for _, tc := range []struct {
+		url  string
+		want []string
+	}{
+		{"/api/topology/containers?filter=container%3Dclient", []string{test.ClientContainerID}},
+		{"/api/topology/containers?filter=container%3Dclient&hops=1", []string{test.ServerContainerID, test.ClientContainerID}},
+		{"/api/topology/containers?filter=label.foo1%3Dbar1", []string{test.ServerContainerID}},
+	} {
+		var topo APITopology
+		ok(t, json.Unmarshal(getRawJSON(t, ts, tc.url), &topo))
+		have := []string{}
+		for id := range topo.Nodes {
+			have = append(have, id)
+		}
+		sort.Strings(have)
+		equals(t, tc.want, have)
+	}
+
+	// The stats count the nodes filtered by the query.
+	filtered := map[string]int{}
+	for _, url := range []string{"/api/topology", "/api/topology?filter=container%3Dclient"} {
+		var topologies []APITopologyDesc
+		ok(t, json.Unmarshal(getRawJSON(t, ts, url), &topologies))
+		for _, topology := range topologies {
+			if topology.URL == "/api/topology/containers" {
+				filtered[url] = topology.Stats.FilteredNodes
+			}
+		}
+	}
+	assert(t, filtered["/api/topology?filter=container%3Dclient"] > filtered["/api/topology"], "filtered nodes not counted: %v", filtered)
+}
+
+func TestAPITopologyExport(t *testing.T) {
+	ts := httptest.NewServer(Router(StaticReport{}))
+	defer ts.Close()
+	is400(t, ts, "/api/topology/containers?format=pdf")
+
+	for format, contentType := range map[string]string{
+		"dot":       "text/vnd.graphviz; charset=utf-8",
+		"graphml":   "application/graphml+xml",
+		"jsongraph": "application/vnd.jgf+json",
+	} {
+		res, body := checkGet(t, ts, "/api/topology/containers?format="+format)
+		equals(t, 200, res.StatusCode)
+		equals(t, contentType, res.Header.Get("Content-Type"))
+		assert(t, strings.Contains(string(body), test.ServerContainerID), "%s: server container missing from %s", format, body)
+	}
+
+	res, body := checkGet(t, ts, "/api/topology/containers/image.svg")
+	equals(t, 200, res.StatusCode)
+	equals(t, "image/svg+xml", res.Header.Get("Content-Type"))
+	assert(t, strings.HasPrefix(string(body), "<svg"), "not an SVG: %s", body)
+
+	res, body = checkGet(t, ts, "/api/topology/containers/image.png")
+	equals(t, 200, res.StatusCode)
+	equals(t, "image/png", res.Header.Get("Content-Type"))
+	_, err := png.Decode(bytes.NewReader(body))
+	ok(t, err)
+
+	// Options apply to exports.
+	_, body = checkGet(t, ts, "/api/topology/containers?format=dot&filter=container%3Dclient")
+	assert(t, !strings.Contains(string(body), test.ServerContainerID), "server container not filtered from %s", body)
+}
+
+func TestAPITopologyMetrics(t *testing.T) {
+	ts := httptest.NewServer(Router(StaticReport{}))
+	defer ts.Close()
+	is400(t, ts, "/api/topology/containers-by-image/metrics?limit=0")
+
+	res, body := checkGet(t, ts, "/api/topology/containers-by-image/metrics")
+	equals(t, 200, res.StatusCode)
+	equals(t, "text/plain; version=0.0.4", res.Header.Get("Content-Type"))
+	want := `scope_node_members{topology="containers-by-image",id="` + test.ServerContainerImageName + `",name="` + test.ServerContainerImageName + `",kind="containers"} 1`
+	assert(t, strings.Contains(string(body), want), "%q missing from %s", want, body)
+	assert(t, strings.Contains(string(body), `label_foo1="bar1"`), "labels missing from %s", body)
+
+	_, body = checkGet(t, ts, "/api/topology/containers-by-image/metrics?limit=1")
+	assert(t, !strings.Contains(string(body), `scope_topology_truncated{topology="containers-by-image",kind="nodes"} 0`), "nodes not truncated in %s", body)
+}
+
 // Basic websocket test
 func TestAPITopologyWebsocket(t *testing.T) {
 	ts := httptest.NewServer(Router(StaticReport{}))
@@ -150,6 +241,11 @@ func TestAPITopologyWebsocket(t *testing.T) {
 		t.Fatalf("Expected status %d, got %d.", 400, have)
 	}
 
+	// Loops must be positive.
+	for _, loop := range []string{"0s", "-1s", "soon"} {
+		is400(t, ts, url+"?t="+loop)
+	}
+
 	// Proper websocket request
 	ts.URL = "ws" + ts.URL[len("http"):]
 	dialer := &websocket.Dialer{}
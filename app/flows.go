@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/export"
+	"github.com/weaveworks/scope/xfer"
+)
+
+const (
+	// maxRecordedFlows bounds the flows kept in memory; later ones are
+	// dropped.
+	maxRecordedFlows = 100000
+
+	// flowSaveInterval is how often recorded flows are saved, if they've
+	// changed.
+	flowSaveInterval = time.Minute
+
+	// flowView is the view of containers flows are recorded from, with
+	// system containers shown, as they're part of the network too.
+	flowView = "containers"
+)
+
+// flowRecorder accumulates the flows between containers across reports,
+// beyond the window of the collector, to generate network policies from.
+// They're kept in memory, and saved to a file, if given, to outlive
+// restarts.
+type flowRecorder struct {
+	mtx      sync.Mutex
+	flows    map[string]render.FlowRecord
+	dropped  int
+	filename string
+	changed  bool
+}
+
+func newFlowRecorder() *flowRecorder {
+	return &flowRecorder{flows: map[string]render.FlowRecord{}}
+}
+
+// loadFlowRecorder returns a flowRecorder saving flows to a file, starting
+// with those saved there, if any. If filename is empty, flows are only kept
+// in memory.
+func loadFlowRecorder(filename string) (*flowRecorder, error) {
+	f := newFlowRecorder()
+	if filename == "" {
+		return f, nil
+	}
+	f.filename = filename
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var records []render.FlowRecord
+	if err := json.NewDecoder(file).Decode(&records); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	flows := map[string]render.FlowRecord{}
+	for _, record := range records {
+		flows[record.Key()] = record
+	}
+	f.record(flows)
+	f.changed = false
+	return f, nil
+}
+
+// save writes the flows recorded to the file, if they've changed since last
+// saved. The file is replaced, rather than written over, so it's never left
+// half-written.
+func (f *flowRecorder) save() error {
+	f.mtx.Lock()
+	changed := f.changed
+	f.changed = false
+	f.mtx.Unlock()
+	if f.filename == "" || !changed {
+		return nil
+	}
+
+	tmp := f.filename + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(f.since(time.Time{})); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.filename)
+}
+
+// flowHistory records the flows between containers. It is nil unless
+// enabled at startup.
+var flowHistory *flowRecorder
+
+// record merges flows into those recorded.
+func (f *flowRecorder) record(flows map[string]render.FlowRecord) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for key, flow := range flows {
+		existing, ok := f.flows[key]
+		switch {
+		case ok:
+			flow = existing.Merge(flow)
+		case len(f.flows) >= maxRecordedFlows:
+			if f.dropped++; f.dropped == 1 {
+				log.Printf("Recorded %d flows; dropping new ones", maxRecordedFlows)
+			}
+			continue
+		}
+		f.flows[key] = flow
+		f.changed = true
+	}
+}
+
+// since returns the flows recorded, last seen after t, in the order of their
+// keys.
+func (f *flowRecorder) since(t time.Time) []render.FlowRecord {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	keys := make([]string, 0, len(f.flows))
+	for key, flow := range f.flows {
+		if flow.LastSeen.After(t) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	result := make([]render.FlowRecord, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, f.flows[key])
+	}
+	return result
+}
+
+// run records the flows between containers of every new report, checking
+// every interval, and saves them every flowSaveInterval, and when quitting.
+// They're rendered from the registry's flowView, sharing the render with
+// requests for it.
+func (f *flowRecorder) run(rep *renderCache, registry *viewRegistry, interval time.Duration, quit <-chan struct{}) {
+	var (
+		ticker     = time.NewTicker(interval)
+		saver      = time.NewTicker(flowSaveInterval)
+		generation uint64
+	)
+	defer ticker.Stop()
+	defer saver.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-saver.C:
+			if err := f.save(); err != nil {
+				log.Printf("Error saving flows: %v", err)
+			}
+			continue
+		case <-quit:
+			if err := f.save(); err != nil {
+				log.Printf("Error saving flows: %v", err)
+			}
+			return
+		}
+		if g, ok := rep.Reporter.(xfer.Generationer); ok {
+			current := g.Generation()
+			if current == generation {
+				continue
+			}
+			generation = current
+		}
+		view, ok := registry.get(flowView)
+		if !ok || !view.audited {
+			log.Printf("Not recording flows: no ungrouped %s view of containers", flowView)
+			continue
+		}
+		r, err := http.NewRequest("GET", "/?system=show", nil)
+		if err == nil {
+			err = decorateTopologyForRequest(r, &view)
+		}
+		if err != nil {
+			log.Printf("Not recording flows: %v", err)
+			continue
+		}
+		rpt, nodes, _ := rep.render(view)
+		f.record(render.ObservedFlows(rpt, nodes, time.Now()))
+	}
+}
+
+// makePolicyGenerateHandler returns a handler writing the network policy
+// allowing the flows recorded between containers, in the format given by
+// the format parameter, json by default (see export.PolicyFormats). Flows
+// are grouped by the group_by parameter, image or label.<name>, and those
+// last seen before the since parameter, a duration ago, are left out.
+func makePolicyGenerateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if flowHistory == nil {
+			respondWith(w, http.StatusNotFound, "flows aren't being recorded")
+			return
+		}
+		formatName := r.FormValue("format")
+		if formatName == "" {
+			formatName = "json"
+		}
+		format, ok := export.PolicyFormats[formatName]
+		if !ok {
+			respondWith(w, http.StatusBadRequest, fmt.Sprintf("unknown format %q", formatName))
+			return
+		}
+		groupBy := r.FormValue("group_by")
+		if groupBy == "" {
+			groupBy = "image"
+		}
+		var since time.Time
+		if value := r.FormValue("since"); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				respondWith(w, http.StatusBadRequest, fmt.Sprintf("invalid since: %q", value))
+				return
+			}
+			since = time.Now().Add(-d)
+		}
+
+		rules, err := render.GeneratePolicy(flowHistory.since(since), groupBy)
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", format.ContentType)
+		if err := format.Write(w, rules); err != nil {
+			log.Printf("Error writing %s policy: %v", formatName, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestFlowRecorder(t *testing.T) {
+	var (
+		f     = newFlowRecorder()
+		quit  = make(chan struct{})
+		begin = time.Now()
+	)
+	go f.run(newRenderCache(StaticReport{}), topologyRegistry, 10*time.Millisecond, quit)
+	defer close(quit)
+
+	var flows []render.FlowRecord
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if flows = f.since(time.Time{}); len(flows) > 0 {
+			break
+		}
+	}
+	if len(flows) != 3 {
+		t.Fatalf("want 3 flows, have %d", len(flows))
+	}
+	for _, flow := range flows {
+		if flow.FirstSeen.Before(begin) || flow.LastSeen.Before(flow.FirstSeen) {
+			t.Errorf("%s: seen from %v to %v", flow.Key(), flow.FirstSeen, flow.LastSeen)
+		}
+	}
+	if have := f.since(time.Now().Add(time.Hour)); len(have) != 0 {
+		t.Errorf("want no flows, have %v", have)
+	}
+}
+
+func TestFlowRecorderSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "flows.json")
+
+	f, err := loadFlowRecorder(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be saved, have %v", err)
+	}
+
+	nodes := render.ContainerWithImageNameRenderer.Render(test.Report)
+	f.record(render.ObservedFlows(test.Report, nodes, time.Unix(1, 0).UTC()))
+	if err := f.save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadFlowRecorder(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := f.since(time.Time{}), loaded.since(time.Time{}); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadFlowRecorder(filename); err == nil {
+		t.Errorf("expected error loading a corrupt file")
+	}
+}
+
+func TestAPIPolicyGenerate(t *testing.T) {
+	ts := httptest.NewServer(Router(StaticReport{}))
+	defer ts.Close()
+
+	is404(t, ts, "/api/policy/generate")
+
+	defer func(f *flowRecorder) { flowHistory = f }(flowHistory)
+	flowHistory = newFlowRecorder()
+	nodes := render.ContainerWithImageNameRenderer.Render(test.Report)
+	flowHistory.record(render.ObservedFlows(test.Report, nodes, time.Now()))
+
+	is400(t, ts, "/api/policy/generate?format=xml")
+	is400(t, ts, "/api/policy/generate?group_by=name")
+	is400(t, ts, "/api/policy/generate?since=yesterday")
+
+	for _, c := range []struct {
+		query, contentType, want string
+	}{
+		{"", "application/json", `"image":"` + test.ClientContainerImageID + `"`},
+		{"?format=kubernetes&group_by=pod_label.app", "application/x-yaml", `"app": "pong"`},
+		{"?format=iptables", "text/plain; charset=utf-8", "-A SCOPE-POLICY -s " + test.ClientIP + "/32 -d " + test.ServerIP + "/32 -p tcp --dport 80 -j ACCEPT\n"},
+	} {
+		res, body := checkGet(t, ts, "/api/policy/generate"+c.query)
+		if have := res.Header.Get("Content-Type"); have != c.contentType {
+			t.Errorf("%s: want content type %q, have %q", c.query, c.contentType, have)
+		}
+		if !strings.Contains(string(body), c.want) {
+			t.Errorf("%s: want %q in:\n%s", c.query, c.want, body)
+		}
+	}
+
+	// The JSON policy can be audited, and allows everything observed.
+	_, body := checkGet(t, ts, "/api/policy/generate")
+	policy, err := render.ReadPolicy(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Allow) != 3 {
+		t.Errorf("want 3 rules, have %d", len(policy.Allow))
+	}
+	if have := policy.Violations(test.Report, nodes); len(have) != 0 {
+		t.Errorf("want no violations, have %v", have)
+	}
+}
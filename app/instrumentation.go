@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/weaveworks/scope/xfer"
+)
+
+var (
+	reportsReceived = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "scope",
+			Subsystem: "app",
+			Name:      "reports_received_total",
+			Help:      "Reports received from probes and added to the collector.",
+		},
+	)
+	reportSize = prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Namespace: "scope",
+			Subsystem: "app",
+			Name:      "report_size_bytes",
+			Help:      "Size of reports received from probes, once decompressed.",
+			MaxAge:    10 * time.Second, // like statsd
+		},
+	)
+	reportDecodeDuration = prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Namespace: "scope",
+			Subsystem: "app",
+			Name:      "report_decode_time_nanoseconds",
+			Help:      "Time spent decoding reports received from probes.",
+			MaxAge:    10 * time.Second, // like statsd
+		},
+	)
+	reportsRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "scope",
+			Subsystem: "app",
+			Name:      "reports_rejected_total",
+			Help:      "Reports rejected, by reason: too_large or invalid.",
+		},
+		[]string{"reason"},
+	)
+	nodesTruncated = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "scope",
+			Subsystem: "app",
+			Name:      "report_nodes_truncated_total",
+			Help:      "Nodes dropped from reports with too many nodes in a topology, by topology.",
+		},
+		[]string{"topology"},
+	)
+	renderDuration = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace: "scope",
+			Subsystem: "app",
+			Name:      "render_time_nanoseconds",
+			Help:      "Time spent rendering topologies, by topology. Renders served from the cache aren't counted.",
+			MaxAge:    10 * time.Second, // like statsd
+		},
+		[]string{"topology"},
+	)
+	websocketClients = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "scope",
+			Subsystem: "app",
+			Name:      "websocket_clients",
+			Help:      "Websocket clients connected, by topology.",
+		},
+		[]string{"topology"},
+	)
+	requestDuration = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace: "scope",
+			Subsystem: "app",
+			Name:      "request_duration_nanoseconds",
+			Help:      "Time spent serving HTTP requests, by method, route and status code.",
+			MaxAge:    10 * time.Second, // like statsd
+		},
+		[]string{"method", "route", "status_code"},
+	)
+)
+
+func makePrometheusHandler(c *xfer.Collector) http.Handler {
+	prometheus.MustRegister(reportsReceived)
+	prometheus.MustRegister(reportSize)
+	prometheus.MustRegister(reportDecodeDuration)
+	prometheus.MustRegister(reportsRejected)
+	prometheus.MustRegister(nodesTruncated)
+	prometheus.MustRegister(renderDuration)
+	prometheus.MustRegister(websocketClients)
+	prometheus.MustRegister(requestDuration)
+	prometheus.MustRegister(xfer.MergeDuration)
+	prometheus.MustRegister(collectorMetrics{c})
+	return prometheus.Handler()
+}
+
+var (
+	collectorReportsDesc = prometheus.NewDesc(
+		"scope_app_collector_reports",
+		"Reports in the collector's window.",
+		nil, nil,
+	)
+	collectorNodesDesc = prometheus.NewDesc(
+		"scope_app_collector_nodes",
+		"Nodes in the merged report, by topology.",
+		[]string{"topology"}, nil,
+	)
+)
+
+// collectorMetrics reports the size of the collector when scraped.
+type collectorMetrics struct {
+	c *xfer.Collector
+}
+
+func (m collectorMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collectorReportsDesc
+	ch <- collectorNodesDesc
+}
+
+func (m collectorMetrics) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(collectorReportsDesc, prometheus.GaugeValue, float64(m.c.Size()))
+	rpt := m.c.Report()
+	for _, name := range rpt.TopologyNames() {
+		t, _ := rpt.Topology(name)
+		ch <- prometheus.MustNewConstMetric(collectorNodesDesc, prometheus.GaugeValue, float64(t.Nodes.Size()), name)
+	}
+}
+
+// instrument records the latency of requests to a route.
+func instrument(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			begin    = time.Now()
+			recorder = &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		)
+		h(recorder, r)
+		requestDuration.WithLabelValues(r.Method, route, strconv.Itoa(recorder.status)).Observe(float64(time.Since(begin)))
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
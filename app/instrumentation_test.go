@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/xfer"
+)
+
+func TestMetrics(t *testing.T) {
+	c := xfer.NewCollector(time.Minute)
+	ts := httptest.NewServer(Router(c))
+	defer ts.Close()
+	metrics := httptest.NewServer(makePrometheusHandler(c))
+	defer metrics.Close()
+
+	if status, _ := postReport(t, ts, test.Report); status != http.StatusOK {
+		t.Fatalf("want %d, have %d", http.StatusOK, status)
+	}
+	getRawJSON(t, ts, "/api/topology/containers")
+
+	resp, err := http.Get(metrics.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Other tests share the metrics, so only the collector's are exact.
+	for _, want := range []string{
+		"scope_app_reports_received_total ",
+		"scope_app_report_size_bytes_count ",
+		"scope_app_report_decode_time_nanoseconds_count ",
+		"scope_app_report_merge_time_nanoseconds_count ",
+		"scope_app_collector_reports 1\n",
+		`scope_app_collector_nodes{topology="endpoint"} 9` + "\n",
+		`scope_app_render_time_nanoseconds_count{topology="containers"} `,
+		`scope_app_request_duration_nanoseconds_count{method="GET",route="/api/topology/{topology}",status_code="200"} `,
+		`scope_app_request_duration_nanoseconds_count{method="POST",route="/api/report",status_code="200"} `,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("want %q in metrics", want)
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/xfer"
 )
 
@@ -31,7 +32,22 @@ func main() {
 		listen       = flag.String("http.address", ":"+strconv.Itoa(xfer.AppPort), "webserver listen address")
 		logPrefix    = flag.String("log.prefix", "<app>", "prefix for each log line")
 		printVersion = flag.Bool("version", false, "print version number and exit")
+		servicesFile = flag.String("services.file", "", "table of well-known services, in the format of /etc/services, used to label pseudo nodes")
+		services     = flag.String("services", "", "additional well-known services as comma-separated name:port pairs, e.g. postgres:5432")
+		internetNets = flag.String("internet.networks", "", "networks to split the internet node by, as comma-separated [name=]CIDR, e.g. payments=203.0.113.0/24")
+		viewsFile    = flag.String("views.file", "", "JSON file defining additional topology views; reloaded when it changes")
+		viewsReload  = flag.Duration("views.reload.interval", 5*time.Second, "how often to check the views file for changes")
+		alertsFile   = flag.String("alerts.file", "", "JSON file of alerting rules on topologies, and webhooks to notify")
+		alertsCheck  = flag.Duration("alerts.check.interval", time.Second, "how often to check for new reports to evaluate alerting rules on")
+		policyFile   = flag.String("policy.file", "", "JSON file of the edges allowed between containers; others are flagged as violations")
+		policyLearn  = flag.Bool("policy.learn", false, "record the flows between containers, to generate network policies from")
+		learnCheck   = flag.Duration("policy.learn.interval", 5*time.Second, "how often to record the flows between containers; at most the window")
+		learnFile    = flag.String("policy.learn.file", "", fmt.Sprintf("file to save recorded flows to, every minute and on exit, and load them from on start; otherwise they're lost on restart. At most %d flows are recorded", maxRecordedFlows))
+
+		prometheusEndpoint = flag.String("prometheus.endpoint", "/metrics", "Prometheus metrics exposition endpoint")
 	)
+	flag.Int64Var(&maxReportSize, "report.max.size", maxReportSize, "largest report accepted from a probe, in bytes once decompressed")
+	flag.IntVar(&maxTopologyNodes, "report.max.nodes", maxTopologyNodes, "most nodes accepted per topology of a report from a probe; any more are dropped")
 	flag.Parse()
 
 	if *printVersion {
@@ -50,8 +66,69 @@ func main() {
 	uniqueID = strconv.FormatInt(rand.Int63(), 16)
 	log.Printf("app starting, version %s, ID %s", version, uniqueID)
 
+	knownServices, err := loadServiceNames(*servicesFile, *services)
+	if err != nil {
+		log.Fatal(err)
+	}
+	render.KnownServices = knownServices
+
+	if render.InternetNetworks, err = render.ParseNamedNetworks(*internetNets); err != nil {
+		log.Fatal(err)
+	}
+
+	views, err := readViews(*viewsFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	topologyRegistry.set(views)
+	if *viewsFile != "" {
+		if *viewsReload <= 0 {
+			log.Fatalf("-views.reload.interval must be positive, not %v", *viewsReload)
+		}
+		quit := make(chan struct{})
+		defer close(quit)
+		go watchViews(*viewsFile, *viewsReload, topologyRegistry, quit)
+	}
+
+	if networkPolicy, err = readPolicy(*policyFile); err != nil {
+		log.Fatal(err)
+	}
+
+	alerts, rules, err := readAlerts(*alertsFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *alertsCheck <= 0 {
+		log.Fatalf("-alerts.check.interval must be positive, not %v", *alertsCheck)
+	}
+	alertRegistry.set(rules, alerts.Webhooks)
+
 	c := xfer.NewCollector(*window)
-	http.Handle("/", Router(c))
+	cache := newRenderCache(c)
+	if len(rules) > 0 {
+		quit := make(chan struct{})
+		defer close(quit)
+		go alertRegistry.run(cache, topologyRegistry, *alertsCheck, quit)
+	}
+	if *policyLearn {
+		if *learnCheck <= 0 {
+			log.Fatalf("-policy.learn.interval must be positive, not %v", *learnCheck)
+		}
+		if flowHistory, err = loadFlowRecorder(*learnFile); err != nil {
+			log.Fatal(err)
+		}
+		quit, done := make(chan struct{}), make(chan struct{})
+		defer func() { close(quit); <-done }() // for the flows to be saved
+		go func() {
+			flowHistory.run(cache, topologyRegistry, *learnCheck, quit)
+			close(done)
+		}()
+	}
+	http.Handle("/", cachedRouter(c, cache))
+	if *prometheusEndpoint != "" {
+		log.Printf("exposing Prometheus endpoint at %s", *prometheusEndpoint)
+		http.Handle(*prometheusEndpoint, makePrometheusHandler(c))
+	}
 	go func() {
 		log.Printf("listening on %s", *listen)
 		log.Print(http.ListenAndServe(*listen, nil))
@@ -59,6 +136,25 @@ func main() {
 	log.Printf("%s", <-interrupt())
 }
 
+func loadServiceNames(filename, extra string) (render.ServiceNames, error) {
+	result := render.ServiceNames{}
+	if filename != "" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if result, err = render.ReadServiceNames(f); err != nil {
+			return nil, err
+		}
+	}
+	additional, err := render.ParseServiceNames(extra)
+	if err != nil {
+		return nil, err
+	}
+	return result.Merge(additional), nil
+}
+
 func interrupt() chan os.Signal {
 	c := make(chan os.Signal)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
@@ -22,16 +22,16 @@ type OriginHost struct {
 }
 
 func getOriginHost(t report.Topology, nodeID string) (OriginHost, bool) {
-	h, ok := t.Nodes[nodeID]
+	h, ok := t.Nodes.Lookup(nodeID)
 	if !ok {
 		return OriginHost{}, false
 	}
 
 	return OriginHost{
-		Hostname: h.Metadata[host.HostName],
-		OS:       h.Metadata[host.OS],
-		Networks: strings.Split(h.Metadata[host.LocalNetworks], " "),
-		Load:     h.Metadata[host.Load],
+		Hostname: h.Metadata.Get(host.HostName),
+		OS:       h.Metadata.Get(host.OS),
+		Networks: strings.Split(h.Metadata.Get(host.LocalNetworks), " "),
+		Load:     h.Metadata.Get(host.Load),
 	}, true
 }
 
@@ -42,7 +42,7 @@ func makeOriginHostHandler(rep xfer.Reporter) http.HandlerFunc {
 			vars   = mux.Vars(r)
 			nodeID = vars["id"]
 		)
-		origin, ok := getOriginHost(rep.Report().Host, nodeID)
+		origin, ok := getOriginHost(rep.Report().Topologies[report.Host], nodeID)
 		if !ok {
 			http.NotFound(w, r)
 			return
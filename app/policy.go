@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/weaveworks/scope/render"
+)
+
+// policyRenderer is the base renderer of the views the network policy is
+// audited on: those of containers, unless they're grouped.
+const policyRenderer = "containers"
+
+// networkPolicy is the network policy audited on the views of containers.
+// It is nil unless loaded from the policy file at startup.
+var networkPolicy *render.Policy
+
+// readPolicy reads a policy file (see render.Policy). If filename is empty,
+// there's no policy.
+func readPolicy(filename string) (*render.Policy, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	policy, err := render.ReadPolicy(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return policy, nil
+}
+
+// APIPolicyViolations is returned by the /api/policy/violations handler.
+type APIPolicyViolations struct {
+	Topology   string                   `json:"topology"`
+	Violations []render.PolicyViolation `json:"violations"`
+}
+
+// makePolicyViolationsHandler returns a handler listing the edges of a view
+// of containers which the network policy doesn't allow. The view is given
+// by the topology parameter, containers by default, along with its options.
+func makePolicyViolationsHandler(rep *renderCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if networkPolicy == nil {
+			respondWith(w, http.StatusNotFound, "no network policy loaded")
+			return
+		}
+		id := r.FormValue("topology")
+		if id == "" {
+			id = "containers"
+		}
+		view, ok := topologyRegistry.get(id)
+		if !ok {
+			respondWith(w, http.StatusNotFound, fmt.Sprintf("unknown topology %q", id))
+			return
+		}
+		if !view.audited {
+			respondWith(w, http.StatusBadRequest, fmt.Sprintf("the network policy doesn't apply to %s", id))
+			return
+		}
+		if err := decorateTopologyForRequest(r, &view); err != nil {
+			respondWith(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		rpt, nodes, _ := rep.render(view)
+		respondWith(w, http.StatusOK, APIPolicyViolations{
+			Topology:   id,
+			Violations: networkPolicy.Violations(rpt, nodes),
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestAPIPolicyViolations(t *testing.T) {
+	ts := httptest.NewServer(Router(StaticReport{}))
+	defer ts.Close()
+
+	is404(t, ts, "/api/policy/violations")
+
+	policy, err := render.ReadPolicy(strings.NewReader(`{"allow": [
+		{"from": {"image": "imageid123"}, "to": {"labels": {"foo1": "bar1"}}, "ports": [80]},
+		{"from": {"id": "pseudo:*"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(policy *render.Policy) { networkPolicy = policy }(networkPolicy)
+	networkPolicy = policy
+
+	is400(t, ts, "/api/policy/violations?topology=hosts")
+	is400(t, ts, "/api/policy/violations?topology=containers-by-image")
+	is404(t, ts, "/api/policy/violations?topology=foo")
+
+	var violations APIPolicyViolations
+	if err := json.Unmarshal(getRawJSON(t, ts, "/api/policy/violations"), &violations); err != nil {
+		t.Fatal(err)
+	}
+	want := APIPolicyViolations{
+		Topology: "containers",
+		Violations: []render.PolicyViolation{{
+			From:      render.TheInternetID,
+			FromLabel: render.TheInternetMajor,
+			To:        test.ServerContainerID,
+			ToLabel:   "server",
+			Ports:     []string{test.ServerPort},
+		}},
+	}
+	if !reflect.DeepEqual(want, violations) {
+		t.Error(test.Diff(want, violations))
+	}
+
+	view, _ := topologyRegistry.get("containers")
+	req, err := http.NewRequest("GET", "/api/topology/containers", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decorateTopologyForRequest(req, &view); err != nil {
+		t.Fatal(err)
+	}
+	_, nodes, _ := newRenderCache(StaticReport{}).render(view)
+	if have := nodes[render.TheInternetID].Metadata.Get(render.PolicyViolations); have != test.ServerContainerID {
+		t.Errorf("want the internet flagged, have %q", have)
+	}
+	if _, ok := nodes[test.ClientContainerID].Metadata.Lookup(render.PolicyViolations); ok {
+		t.Errorf("want the client not flagged")
+	}
+
+	edge := func(from, to string) APIEdge {
+		var edge APIEdge
+		body := getRawJSON(t, ts, "/api/topology/containers/"+url.QueryEscape(from)+"/"+url.QueryEscape(to))
+		if err := json.Unmarshal(body, &edge); err != nil {
+			t.Fatal(err)
+		}
+		return edge
+	}
+	if have := edge(render.TheInternetID, test.ServerContainerID).Violation; have == nil || !reflect.DeepEqual(want.Violations[0], *have) {
+		t.Errorf("want %v, have %v", want.Violations[0], have)
+	}
+	if have := edge(test.ClientContainerID, test.ServerContainerID).Violation; have != nil {
+		t.Errorf("want no violation, have %v", have)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/xfer"
+)
+
+// renderCache is a Reporter which also renders views of its reports,
+// memoizing them per view, options and report generation, so concurrent
+// requests for the same view share one render. Reporters without
+// generations aren't cached.
+type renderCache struct {
+	xfer.Reporter
+
+	mtx        sync.Mutex
+	generation uint64
+	entries    map[string]*renderEntry
+}
+
+type renderEntry struct {
+	once  sync.Once
+	nodes render.RenderableNodes
+	stats render.Stats
+}
+
+func newRenderCache(rep xfer.Reporter) *renderCache {
+	return &renderCache{Reporter: rep, entries: map[string]*renderEntry{}}
+}
+
+// render returns the current report and a view of it, along with the
+// view's stats. The nodes are shared with every other caller, so they must
+// not be modified; copy them first.
+func (c *renderCache) render(t topologyView) (report.Report, render.RenderableNodes, render.Stats) {
+	g, ok := c.Reporter.(xfer.Generationer)
+	if !ok {
+		rpt := c.Report()
+		nodes, stats := renderTimed(t, rpt)
+		return rpt, nodes, stats
+	}
+
+	// The report may be newer than the generation, never older.
+	generation := g.Generation()
+	rpt := c.Report()
+	entry := c.entry(t.key, generation)
+	entry.once.Do(func() {
+		entry.nodes, entry.stats = renderTimed(t, rpt)
+	})
+	return rpt, entry.nodes, entry.stats
+}
+
+func renderTimed(t topologyView, rpt report.Report) (render.RenderableNodes, render.Stats) {
+	begin := time.Now()
+	nodes, stats := t.renderer.Render(rpt), t.renderer.Stats(rpt)
+	renderDuration.WithLabelValues(t.id).Observe(float64(time.Since(begin)))
+	return nodes, stats
+}
+
+func (c *renderCache) entry(key string, generation uint64) *renderEntry {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	switch {
+	case generation > c.generation:
+		c.generation = generation
+		c.entries = map[string]*renderEntry{}
+	case generation < c.generation:
+		// A late request; don't cache what may be a newer report under
+		// an older generation.
+		return &renderEntry{}
+	}
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &renderEntry{}
+		c.entries[key] = entry
+	}
+	return entry
+}
+
+// broadcaster renders views for websocket clients, once per view, options
+// and interval, and shares the renders between all clients of a view.
+type broadcaster struct {
+	mtx   sync.Mutex
+	cache *renderCache
+	feeds map[string]*feed
+}
+
+type feed struct {
+	subscribers map[chan render.RenderableNodes]struct{}
+	latest      render.RenderableNodes
+	quit        chan struct{}
+}
+
+func newBroadcaster(cache *renderCache) *broadcaster {
+	return &broadcaster{cache: cache, feeds: map[string]*feed{}}
+}
+
+// subscribe returns a channel receiving renders of the view every loop, and
+// a function to stop receiving them. Slow subscribers miss renders, rather
+// than receive stale ones.
+func (b *broadcaster) subscribe(t topologyView, loop time.Duration) (<-chan render.RenderableNodes, func()) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	key := loop.String() + " " + t.key
+	f, ok := b.feeds[key]
+	if !ok {
+		f = &feed{
+			subscribers: map[chan render.RenderableNodes]struct{}{},
+			quit:        make(chan struct{}),
+		}
+		b.feeds[key] = f
+		go b.loop(f, t, loop)
+	}
+	c := make(chan render.RenderableNodes, 1)
+	f.subscribers[c] = struct{}{}
+	if f.latest != nil {
+		c <- f.latest
+	}
+
+	return c, func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+		delete(f.subscribers, c)
+		if len(f.subscribers) == 0 {
+			delete(b.feeds, key)
+			close(f.quit)
+		}
+	}
+}
+
+func (b *broadcaster) loop(f *feed, t topologyView, loop time.Duration) {
+	ticker := time.NewTicker(loop)
+	defer ticker.Stop()
+	for {
+		_, nodes, _ := b.cache.render(t)
+		nodes = nodes.Prune()
+
+		b.mtx.Lock()
+		f.latest = nodes
+		for c := range f.subscribers {
+			// Replace any render the subscriber hasn't picked up yet.
+			select {
+			case <-c:
+			default:
+			}
+			c <- nodes
+		}
+		b.mtx.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-f.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/xfer"
+)
+
+// countingRenderer counts its renders.
+type countingRenderer struct {
+	mtx     sync.Mutex
+	renders int
+}
+
+func (c *countingRenderer) Render(rpt report.Report) render.RenderableNodes {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.renders++
+	return render.RenderableNodes{"foo": render.NewRenderableNode("foo")}
+}
+
+func (c *countingRenderer) EdgeMetadata(rpt report.Report, localID, remoteID string) report.EdgeMetadata {
+	return report.EdgeMetadata{}
+}
+
+func (c *countingRenderer) Stats(rpt report.Report) render.Stats {
+	return render.Stats{}
+}
+
+func (c *countingRenderer) count() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.renders
+}
+
+func TestRenderCache(t *testing.T) {
+	var (
+		collector = xfer.NewCollector(time.Minute)
+		cache     = newRenderCache(collector)
+		renderer  = &countingRenderer{}
+		view      = topologyView{renderer: renderer, key: "0/foo?"}
+	)
+
+	for i := 0; i < 3; i++ {
+		_, nodes, _ := cache.render(view)
+		equals(t, 1, len(nodes))
+	}
+	equals(t, 1, renderer.count())
+
+	// Other options are rendered separately.
+	other := view
+	other.key = "0/foo?system=show"
+	cache.render(other)
+	equals(t, 2, renderer.count())
+
+	// New reports are rendered again.
+	collector.Add(report.MakeReport())
+	cache.render(view)
+	cache.render(view)
+	equals(t, 3, renderer.count())
+
+	// Reporters without generations aren't cached.
+	uncached := newRenderCache(StaticReport{})
+	uncached.render(view)
+	uncached.render(view)
+	equals(t, 5, renderer.count())
+}
+
+func TestBroadcaster(t *testing.T) {
+	var (
+		collector   = xfer.NewCollector(time.Minute)
+		broadcaster = newBroadcaster(newRenderCache(collector))
+		renderer    = &countingRenderer{}
+		view        = topologyView{renderer: renderer, key: "0/foo?"}
+	)
+
+	updates1, unsubscribe1 := broadcaster.subscribe(view, 10*time.Millisecond)
+	updates2, unsubscribe2 := broadcaster.subscribe(view, 10*time.Millisecond)
+	for _, updates := range []<-chan render.RenderableNodes{updates1, updates2, updates1, updates2} {
+		select {
+		case nodes := <-updates:
+			equals(t, 1, len(nodes))
+		case <-time.After(time.Second):
+			t.Fatal("no update")
+		}
+	}
+	// Both subscribers share one render per report.
+	equals(t, 1, renderer.count())
+
+	unsubscribe1()
+	unsubscribe2()
+	test.Poll(t, time.Second, 0, func() interface{} {
+		broadcaster.mtx.Lock()
+		defer broadcaster.mtx.Unlock()
+		return len(broadcaster.feeds)
+	})
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
-	"compress/gzip"
-	"encoding/gob"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/PuerkitoBio/ghost/handlers"
@@ -59,66 +59,127 @@ func gzipHandler(h http.HandlerFunc) http.HandlerFunc {
 // accepting reports from probes.. It will always use the embedded HTML
 // resources for the UI.
 func Router(c collector) *mux.Router {
+	return cachedRouter(c, newRenderCache(c))
+}
+
+// cachedRouter is Router, rendering views through a cache shared with
+// whatever else renders them in the background.
+func cachedRouter(c collector, cache *renderCache) *mux.Router {
 	router := mux.NewRouter()
-	router.HandleFunc("/api/report", makeReportPostHandler(c)).Methods("POST")
+	router.HandleFunc("/api/report", instrument("/api/report", makeReportPostHandler(c))).Methods("POST")
 
+	broadcaster := newBroadcaster(cache)
 	get := router.Methods("GET").Subrouter()
-	get.HandleFunc("/api", gzipHandler(apiHandler))
-	get.HandleFunc("/api/topology", gzipHandler(makeTopologyList(c)))
-	get.HandleFunc("/api/topology/{topology}", gzipHandler(captureTopology(c, handleTopology)))
-	get.HandleFunc("/api/topology/{topology}/ws", captureTopology(c, handleWs)) // NB not gzip!
-	get.MatcherFunc(URLMatcher("/api/topology/{topology}/{id}")).HandlerFunc(gzipHandler(captureTopology(c, handleNode)))
-	get.MatcherFunc(URLMatcher("/api/topology/{topology}/{local}/{remote}")).HandlerFunc(gzipHandler(captureTopology(c, handleEdge)))
-	get.MatcherFunc(URLMatcher("/api/origin/host/{id}")).HandlerFunc(gzipHandler(makeOriginHostHandler(c)))
-	get.HandleFunc("/api/report", gzipHandler(makeRawReportHandler(c)))
-	get.PathPrefix("/").Handler(http.FileServer(FS(false))) // everything else is static
+	get.HandleFunc("/api", instrument("/api", gzipHandler(apiHandler)))
+	get.HandleFunc("/api/topology", instrument("/api/topology", gzipHandler(makeTopologyList(cache))))
+	get.HandleFunc("/api/topology/{topology}", instrument("/api/topology/{topology}", gzipHandler(captureTopology(cache, handleTopology))))
+	get.HandleFunc("/api/topology/{topology}/ws", captureTopology(cache, makeWsHandler(broadcaster))) // NB not gzip, nor timed, as it lasts as long as the client
+	get.HandleFunc("/api/topology/{topology}/image.svg", instrument("/api/topology/{topology}/image.svg", gzipHandler(captureTopology(cache, makeImageHandler("svg")))))
+	get.HandleFunc("/api/topology/{topology}/image.png", instrument("/api/topology/{topology}/image.png", captureTopology(cache, makeImageHandler("png")))) // NB not gzip, as PNGs are compressed already
+	get.HandleFunc("/api/topology/{topology}/metrics", instrument("/api/topology/{topology}/metrics", gzipHandler(captureTopology(cache, handleMetrics))))
+	get.HandleFunc("/api/topology/{topology}/paths", instrument("/api/topology/{topology}/paths", gzipHandler(captureTopology(cache, handlePaths))))
+	get.HandleFunc("/api/topology/{topology}/blast-radius", instrument("/api/topology/{topology}/blast-radius", gzipHandler(captureTopology(cache, handleBlastRadius))))
+	get.MatcherFunc(URLMatcher("/api/topology/{topology}/{id}")).HandlerFunc(instrument("/api/topology/{topology}/{id}", gzipHandler(captureTopology(cache, handleNode))))
+	get.MatcherFunc(URLMatcher("/api/topology/{topology}/{local}/{remote}")).HandlerFunc(instrument("/api/topology/{topology}/{local}/{remote}", gzipHandler(captureTopology(cache, handleEdge))))
+	get.MatcherFunc(URLMatcher("/api/origin/host/{id}")).HandlerFunc(instrument("/api/origin/host/{id}", gzipHandler(makeOriginHostHandler(c))))
+	get.HandleFunc("/api/report", instrument("/api/report", gzipHandler(makeRawReportHandler(c))))
+	get.HandleFunc("/api/alerts", instrument("/api/alerts", gzipHandler(makeAlertsHandler(alertRegistry))))
+	get.HandleFunc("/api/policy/violations", instrument("/api/policy/violations", gzipHandler(makePolicyViolationsHandler(cache))))
+	get.HandleFunc("/api/policy/generate", instrument("/api/policy/generate", gzipHandler(makePolicyGenerateHandler())))
+	get.PathPrefix("/").Handler(instrument("static", http.FileServer(FS(false)).ServeHTTP)) // everything else is static
 
 	return router
 }
 
-func makeReportPostHandler(a xfer.Adder) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var (
-			rpt    report.Report
-			reader = r.Body
-			err    error
-		)
-		if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
-			reader, err = gzip.NewReader(r.Body)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-		}
-
-		if err := gob.NewDecoder(reader).Decode(&rpt); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+func decorateTopologyForRequest(r *http.Request, topology *topologyView) error {
+	params := url.Values{}
+	defer func() { topology.key += "?" + params.Encode() }()
+	for _, param := range []string{filterParam, hopsParam, groupByParam} {
+		if value := r.FormValue(param); value != "" {
+			params.Set(param, value)
 		}
-		a.Add(rpt)
-		w.WriteHeader(http.StatusOK)
 	}
-}
 
-func decorateTopologyForRequest(r *http.Request, topology *topologyView) {
 	for param, opts := range topology.options {
 		value := r.FormValue(param)
+		params.Set(param, value)
 		for _, opt := range opts {
 			if (value == "" && opt.def) || (opt.value != "" && opt.value == value) {
 				topology.renderer = opt.decorator(topology.renderer)
 			}
 		}
 	}
+
+	// The policy is audited before filtering, so the violations don't
+	// depend on which nodes are shown.
+	if topology.audited && networkPolicy != nil {
+		topology.renderer = render.PolicyAudit{Renderer: topology.renderer, Policy: networkPolicy}
+	}
+
+	if expr := r.FormValue(filterParam); expr != "" {
+		query, err := render.ParseQuery(expr)
+		if err != nil {
+			return err
+		}
+		hops := 0
+		if value := r.FormValue(hopsParam); value != "" {
+			if hops, err = strconv.Atoi(value); err != nil || hops < 0 {
+				return fmt.Errorf("invalid %s: %q", hopsParam, value)
+			}
+		}
+		topology.renderer = render.QueryFilter{Renderer: topology.renderer, Query: query, Hops: hops}
+	}
+
+	// Grouping goes last, so the other options apply to the nodes being
+	// grouped.
+	if key := r.FormValue(groupByParam); key != "" && key != groupByNone && !topology.grouped {
+		topology.renderer = render.GroupBy(key, topology.nouns, topology.renderer)
+	}
+	return nil
 }
 
-func captureTopology(rep xfer.Reporter, f func(xfer.Reporter, topologyView, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+// The filter parameter keeps the nodes of any view matching a query (see
+// render.ParseQuery), and those up to hops edges away from them.
+const (
+	filterParam = "filter"
+	hopsParam   = "hops"
+)
+
+// The group_by parameter groups the nodes of any view by a metadata key.
+const (
+	groupByParam = "group_by"
+	groupByNone  = "none"
+)
+
+// groupByOptions returns the values of the group_by parameter for a view,
+// i.e. the Docker labels present on the nodes it's rendered from, as found
+// in the report without rendering the view.
+func groupByOptions(rpt report.Report, view topologyView) []optionValue {
+	if view.labels == nil || view.grouped {
+		return nil
+	}
+	keys := render.GroupingKeys(view.labels(rpt))
+	if len(keys) == 0 {
+		return nil
+	}
+	options := []optionValue{{groupByNone, "Not grouped", true, nop}}
+	for _, key := range keys {
+		options = append(options, optionValue{key, "Grouped by " + render.GroupingName(key), false, nop})
+	}
+	return options
+}
+
+func captureTopology(rep *renderCache, f func(*renderCache, topologyView, http.ResponseWriter, *http.Request)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		topology, ok := topologyRegistry[mux.Vars(r)["topology"]]
+		topology, ok := topologyRegistry.get(mux.Vars(r)["topology"])
 		if !ok {
 			http.NotFound(w, r)
 			return
 		}
-		decorateTopologyForRequest(r, &topology)
+		if err := decorateTopologyForRequest(r, &topology); err != nil {
+			respondWith(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		f(rep, topology, w, r)
 	}
 }
@@ -133,58 +194,20 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 	respondWith(w, http.StatusOK, APIDetails{ID: uniqueID, Version: version})
 }
 
-// Topology option labels should tell the current state. The first item must
-// be the verb to get to that state
-var topologyRegistry = map[string]topologyView{
-	"applications": {
-		human:    "Applications",
-		parent:   "",
-		renderer: render.FilterUnconnected(render.ProcessWithContainerNameRenderer),
-		options: optionParams{"unconnected": {
-			// Show the user why there are filtered nodes in this view.
-			// Don't give them the option to show those nodes.
-			{"hide", "Unconnected nodes hidden", true, nop},
-		}},
-	},
-	"applications-by-name": {
-		human:    "by name",
-		parent:   "applications",
-		renderer: render.FilterUnconnected(render.ProcessNameRenderer),
-		options: optionParams{"unconnected": {
-			// Ditto above.
-			{"hide", "Unconnected nodes hidden", true, nop},
-		}},
-	},
-	"containers": {
-		human:    "Containers",
-		parent:   "",
-		renderer: render.ContainerWithImageNameRenderer,
-		options: optionParams{"system": {
-			{"show", "System containers shown", false, nop},
-			{"hide", "System containers hidden", true, render.FilterSystem},
-		}},
-	},
-	"containers-by-image": {
-		human:    "by image",
-		parent:   "containers",
-		renderer: render.ContainerImageRenderer,
-		options: optionParams{"system": {
-			{"show", "System containers shown", false, nop},
-			{"hide", "System containers hidden", true, render.FilterSystem},
-		}},
-	},
-	"hosts": {
-		human:    "Hosts",
-		parent:   "",
-		renderer: render.HostRenderer,
-	},
-}
-
 type topologyView struct {
+	id       string // as in the URL
 	human    string
 	parent   string
 	renderer render.Renderer
 	options  optionParams
+	nouns    render.Nouns // for counting grouped nodes
+	grouped  bool         // if the view is grouped already
+	audited  bool         // if the network policy applies to the view
+	key      string       // identifies the view and its options in caches
+
+	// labels selects the nodes the view's nodes have the Docker labels of,
+	// to group them by, or is nil if they have none.
+	labels render.TopologySelector
 }
 
 type optionParams map[string][]optionValue // param: values
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// viewsConfig is the format of the views file, e.g.
+//
+//	{"views": [{
+//	  "id": "containers-by-team",
+//	  "name": "by team",
+//	  "parent": "containers",
+//	  "renderer": "containers",
+//	  "filters": [{"label": "com.example.team", "regex": ".+"}],
+//	  "group_by": "docker_label_com.example.team",
+//	  "options": ["system", "internet"]
+//	}]}
+//
+// Views which aren't grouped can also be grouped by any Docker label of
+// their nodes per request, with the group_by parameter.
+//
+// Views in the file are added to the default ones, replacing any with the
+// same ID.
+type viewsConfig struct {
+	Views []viewConfig `json:"views"`
+}
+
+// viewConfig is the declarative definition of a topology view: a base
+// renderer, optionally filtered and grouped, with a set of options.
+type viewConfig struct {
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Parent   string         `json:"parent,omitempty"`
+	Renderer string         `json:"renderer"`
+	Filters  []filterConfig `json:"filters,omitempty"`
+	GroupBy  string         `json:"group_by,omitempty"`
+	Options  []string       `json:"options,omitempty"`
+}
+
+// filterConfig keeps the nodes of a view matching a metadata key, a Docker
+// label or a host. Keys and labels match if they're present, unless a value
+// or regex is given. Pseudo nodes are always kept.
+type filterConfig struct {
+	Key     string `json:"key,omitempty"`
+	Label   string `json:"label,omitempty"`
+	Host    string `json:"host,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Regex   string `json:"regex,omitempty"`
+	Exclude bool   `json:"exclude,omitempty"`
+}
+
+// baseRenderer is a renderer views can be built on, the nouns for its nodes,
+// used to count them when they're grouped, and the topology whose Docker
+// labels they carry, if any.
+type baseRenderer struct {
+	renderer render.Renderer
+	nouns    render.Nouns
+	labels   render.TopologySelector
+}
+
+var (
+	processNouns   = render.Nouns{Singular: "process", Plural: "processes"}
+	containerNouns = render.Nouns{Singular: "container", Plural: "containers"}
+)
+
+// baseRenderers are the renderers views can be built on.
+var baseRenderers = map[string]baseRenderer{
+	"endpoints":            {render.EndpointRenderer, render.Nouns{Singular: "endpoint", Plural: "endpoints"}, nil},
+	"processes":            {render.ProcessRenderer, processNouns, nil},
+	"applications":         {render.ProcessWithContainerNameRenderer, processNouns, render.SelectContainer},
+	"applications-by-name": {render.FilterUnconnected(render.ProcessNameRenderer), render.Nouns{Singular: "application", Plural: "applications"}, nil},
+	"containers":           {render.ContainerWithImageNameRenderer, containerNouns, render.SelectContainer},
+	"containers-by-image":  {render.ContainerImageRenderer, render.Nouns{Singular: "image", Plural: "images"}, render.SelectContainerImage},
+	"pods":                 {render.PodRenderer, render.Nouns{Singular: "pod", Plural: "pods"}, nil},
+	"services":             {render.ServiceRenderer, render.Nouns{Singular: "service", Plural: "services"}, nil},
+	"addresses":            {render.AddressRenderer, render.Nouns{Singular: "address", Plural: "addresses"}, nil},
+	"hosts":                {render.HostRenderer, render.Nouns{Singular: "host", Plural: "hosts"}, nil},
+}
+
+// optionSet is a request parameter, and its values.
+type optionSet struct {
+	param  string
+	values []optionValue
+}
+
+// optionSets are the options views can have. Topology option labels should
+// tell the current state. The first item must be the verb to get to that
+// state.
+var optionSets = map[string]optionSet{
+	"unconnected": {"unconnected", []optionValue{
+		// Show the user why there are filtered nodes in this view.
+		// Don't give them the option to show all those nodes, only
+		// those which are idle servers.
+		{"hide", "Unconnected nodes hidden", true, render.FilterUnconnected},
+		{"listening", "Unconnected nodes hidden, except listening", false, render.FilterUnconnectedExceptListening},
+	}},
+	"unconnected-hidden": {"unconnected", []optionValue{
+		// For views whose renderer already hides unconnected nodes.
+		{"hide", "Unconnected nodes hidden", true, nop},
+	}},
+	"system": {"system", []optionValue{
+		{"show", "System containers shown", false, nop},
+		{"hide", "System containers hidden", true, render.FilterSystem},
+	}},
+	"internet": {"internet", internetOptions},
+}
+
+// internetOptions split the internet pseudo node into groups.
+var internetOptions = []optionValue{
+	{"merged", "Internet shown as one node", true, render.MergeTheInternet},
+	{"domain", "Internet split by domain", false, render.SplitInternetByDomain},
+	{"network", "Internet split by network", false, render.SplitInternetByNetwork},
+}
+
+// defaultViews are the views available without a views file.
+var defaultViews = []viewConfig{
+	{ID: "applications", Name: "Applications", Renderer: "applications", Options: []string{"unconnected", "internet"}},
+	{ID: "applications-by-name", Name: "by name", Parent: "applications", Renderer: "applications-by-name", Options: []string{"unconnected-hidden", "internet"}},
+	{ID: "containers", Name: "Containers", Renderer: "containers", Options: []string{"system", "internet"}},
+	{ID: "containers-by-image", Name: "by image", Parent: "containers", Renderer: "containers-by-image", Options: []string{"system", "internet"}},
+	{ID: "pods", Name: "Pods", Renderer: "pods", Options: []string{"internet"}},
+	{ID: "services", Name: "Services", Renderer: "services", Options: []string{"internet"}},
+	{ID: "hosts", Name: "Hosts", Renderer: "hosts", Options: []string{"internet"}},
+}
+
+func (f filterConfig) predicate() (func(render.RenderableNode) bool, error) {
+	var get func(render.RenderableNode) (string, bool)
+	switch {
+	case f.Key != "" && f.Label == "" && f.Host == "":
+		get = func(n render.RenderableNode) (string, bool) {
+			v, ok := n.Metadata.Lookup(f.Key)
+			return v, ok
+		}
+	case f.Label != "" && f.Key == "" && f.Host == "":
+		get = func(n render.RenderableNode) (string, bool) {
+			v, ok := n.Metadata.Lookup(docker.LabelPrefix + f.Label)
+			return v, ok
+		}
+	case f.Host != "" && f.Key == "" && f.Label == "":
+		get = func(n render.RenderableNode) (string, bool) {
+			v := report.ExtractHostID(n.Node)
+			return v, v == f.Host
+		}
+	default:
+		return nil, fmt.Errorf("filter needs exactly one of key, label or host")
+	}
+
+	match := func(string) bool { return true }
+	switch {
+	case f.Value != "" && f.Regex != "":
+		return nil, fmt.Errorf("filter can't have both a value and a regex")
+	case f.Value != "":
+		match = func(v string) bool { return v == f.Value }
+	case f.Regex != "":
+		re, err := regexp.Compile(f.Regex)
+		if err != nil {
+			return nil, err
+		}
+		match = re.MatchString
+	}
+
+	return func(n render.RenderableNode) bool {
+		if n.Pseudo {
+			return true
+		}
+		v, ok := get(n)
+		return (ok && match(v)) != f.Exclude
+	}, nil
+}
+
+func (c viewConfig) build() (topologyView, error) {
+	if c.ID == "" {
+		return topologyView{}, fmt.Errorf("view without an ID")
+	}
+	base, ok := baseRenderers[c.Renderer]
+	if !ok {
+		return topologyView{}, fmt.Errorf("view %s: unknown renderer %q", c.ID, c.Renderer)
+	}
+	renderer := base.renderer
+
+	for i, fc := range c.Filters {
+		predicate, err := fc.predicate()
+		if err != nil {
+			return topologyView{}, fmt.Errorf("view %s: filter %d: %v", c.ID, i, err)
+		}
+		renderer = render.Filter{Renderer: renderer, FilterFunc: predicate}
+	}
+	if c.GroupBy != "" {
+		renderer = render.GroupBy(c.GroupBy, base.nouns, renderer)
+	}
+
+	options := optionParams{}
+	for _, name := range c.Options {
+		set, ok := optionSets[name]
+		if !ok {
+			return topologyView{}, fmt.Errorf("view %s: unknown options %q", c.ID, name)
+		}
+		if _, ok := options[set.param]; ok {
+			return topologyView{}, fmt.Errorf("view %s: duplicate options for %q", c.ID, set.param)
+		}
+		options[set.param] = set.values
+	}
+	// Views which can't split the internet still need its nodes merged.
+	if _, ok := options["internet"]; !ok {
+		renderer = render.MergeTheInternet(renderer)
+	}
+
+	name := c.Name
+	if name == "" {
+		name = c.ID
+	}
+	return topologyView{
+		human:    name,
+		parent:   c.Parent,
+		renderer: renderer,
+		options:  options,
+		nouns:    base.nouns,
+		grouped:  c.GroupBy != "",
+		labels:   base.labels,
+		audited:  c.Renderer == policyRenderer && c.GroupBy == "",
+	}, nil
+}
+
+// makeViews builds the views, replacing earlier ones with later ones of the
+// same ID. Sub-views must have a top-level parent.
+func makeViews(configs []viewConfig) (map[string]topologyView, error) {
+	views := map[string]topologyView{}
+	for _, c := range configs {
+		view, err := c.build()
+		if err != nil {
+			return nil, err
+		}
+		views[c.ID] = view
+	}
+	for id, view := range views {
+		if view.parent == "" {
+			continue
+		}
+		parent, ok := views[view.parent]
+		if !ok || parent.parent != "" {
+			return nil, fmt.Errorf("view %s: parent %q isn't a top-level view", id, view.parent)
+		}
+	}
+	return views, nil
+}
+
+// readViews reads a views file, returning the default views plus those in
+// the file. If filename is empty, only the default views are returned.
+func readViews(filename string) (map[string]topologyView, error) {
+	configs := defaultViews
+	if filename != "" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		var config viewsConfig
+		if err := json.NewDecoder(f).Decode(&config); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		configs = append(append([]viewConfig{}, defaultViews...), config.Views...)
+	}
+	return makeViews(configs)
+}
+
+// viewRegistry holds the topology views served by the app, which may be
+// replaced at any time when the views file changes.
+type viewRegistry struct {
+	sync.RWMutex
+	views   map[string]topologyView
+	version int // of the views, to tell them apart in caches
+}
+
+func newViewRegistry(views map[string]topologyView) *viewRegistry {
+	return &viewRegistry{views: views}
+}
+
+func (r *viewRegistry) get(id string) (topologyView, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	view, ok := r.views[id]
+	view.id, view.key = id, viewKey(r.version, id)
+	return view, ok
+}
+
+// walk calls f for every view. The views may not be modified.
+func (r *viewRegistry) walk(f func(id string, view topologyView)) {
+	r.RLock()
+	views, version := r.views, r.version
+	r.RUnlock()
+	for id, view := range views {
+		view.id, view.key = id, viewKey(version, id)
+		f(id, view)
+	}
+}
+
+func (r *viewRegistry) set(views map[string]topologyView) {
+	r.Lock()
+	defer r.Unlock()
+	r.views = views
+	r.version++
+}
+
+func viewKey(version int, id string) string {
+	return strconv.Itoa(version) + "/" + id
+}
+
+// topologyRegistry holds the views served by the app.
+var topologyRegistry = newViewRegistry(mustMakeViews(defaultViews))
+
+func mustMakeViews(configs []viewConfig) map[string]topologyView {
+	views, err := makeViews(configs)
+	if err != nil {
+		panic(err)
+	}
+	return views
+}
+
+// watchViews reloads the views file into the registry whenever it changes,
+// checking every interval, until quit is closed. If the file can't be
+// loaded, the previous views are kept.
+func watchViews(filename string, interval time.Duration, registry *viewRegistry, quit <-chan struct{}) {
+	var lastMod time.Time
+	if fi, err := os.Stat(filename); err == nil {
+		lastMod = fi.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+		fi, err := os.Stat(filename)
+		if err != nil || fi.ModTime().Equal(lastMod) {
+			continue
+		}
+		lastMod = fi.ModTime()
+		views, err := readViews(filename)
+		if err != nil {
+			log.Printf("Error reloading views: %v", err)
+			continue
+		}
+		registry.set(views)
+		log.Printf("Reloaded %d views from %s", len(views), filename)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test"
+)
+
+const teamViews = `{"views": [{
+	"id": "containers-by-foo",
+	"name": "by foo",
+	"parent": "containers",
+	"renderer": "containers",
+	"filters": [{"label": "foo1", "value": "bar1"}],
+	"group_by": "docker_label_foo2",
+	"options": ["system", "internet"]
+}]}`
+
+func writeViews(t *testing.T, dir, contents string) string {
+	filename := filepath.Join(dir, "views.json")
+	if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestViewsFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "views")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	views, err := readViews(writeViews(t, dir, teamViews))
+	ok(t, err)
+	defer topologyRegistry.set(mustMakeViews(defaultViews))
+	topologyRegistry.set(views)
+
+	ts := httptest.NewServer(Router(StaticReport{}))
+	defer ts.Close()
+
+	var topologies []APITopologyDesc
+	ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/topology"), &topologies))
+	subTopologies := []string{}
+	for _, topology := range topologies {
+		if topology.URL == "/api/topology/containers" {
+			for _, sub := range topology.SubTopologies {
+				subTopologies = append(subTopologies, sub.Name)
+			}
+		}
+	}
+	sort.Strings(subTopologies)
+	equals(t, []string{"by foo", "by image"}, subTopologies)
+
+	// Only the server container has the foo1 label, and it's grouped by its
+	// foo2 label.
+	var topology APITopology
+	ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/topology/containers-by-foo"), &topology))
+	groupID := render.MakeGroupID("docker_label_foo2", "bar2")
+	group, found := topology.Nodes[groupID]
+	assert(t, found, "no group node in %v", topology.Nodes)
+	equals(t, "bar2", group.LabelMajor)
+	for id, node := range topology.Nodes {
+		assert(t, id == groupID || node.Pseudo, "unexpected node %s", id)
+	}
+	_, found = topology.Nodes[test.ClientContainerID]
+	assert(t, !found, "client container not filtered")
+}
+
+func TestViewErrors(t *testing.T) {
+	for _, config := range []viewConfig{
+		{ID: "", Renderer: "containers"},
+		{ID: "a", Renderer: "nope"},
+		{ID: "a", Renderer: "containers", Options: []string{"nope"}},
+		{ID: "a", Renderer: "containers", Options: []string{"unconnected", "unconnected-hidden"}},
+		{ID: "a", Renderer: "containers", Parent: "nope"},
+		{ID: "a", Renderer: "containers", Parent: "containers-by-image"},
+		{ID: "a", Renderer: "containers", Filters: []filterConfig{{}}},
+		{ID: "a", Renderer: "containers", Filters: []filterConfig{{Key: "a", Label: "b"}}},
+		{ID: "a", Renderer: "containers", Filters: []filterConfig{{Key: "a", Value: "b", Regex: "c"}}},
+		{ID: "a", Renderer: "containers", Filters: []filterConfig{{Key: "a", Regex: "("}}},
+	} {
+		if _, err := makeViews(append(append([]viewConfig{}, defaultViews...), config)); err == nil {
+			t.Errorf("%+v: expected error", config)
+		}
+	}
+}
+
+func TestViewFilters(t *testing.T) {
+	nodes := render.ContainerWithImageNameRenderer.Render(test.Report)
+	server, client := nodes[test.ServerContainerID], nodes[test.ClientContainerID]
+	for _, tc := range []struct {
+		filter         filterConfig
+		server, client bool
+	}{
+		{filterConfig{Key: "docker_container_name"}, true, true},
+		{filterConfig{Label: "foo1"}, true, false},
+		{filterConfig{Label: "foo1", Exclude: true}, false, true},
+		{filterConfig{Key: "docker_container_name", Value: "client"}, false, true},
+		{filterConfig{Key: "docker_image_id", Regex: "456$"}, true, false},
+		{filterConfig{Host: test.ServerHostID}, true, false},
+	} {
+		predicate, err := tc.filter.predicate()
+		ok(t, err)
+		if have := predicate(server); have != tc.server {
+			t.Errorf("%+v: server: want %v, have %v", tc.filter, tc.server, have)
+		}
+		if have := predicate(client); have != tc.client {
+			t.Errorf("%+v: client: want %v, have %v", tc.filter, tc.client, have)
+		}
+	}
+}
+
+func TestWatchViews(t *testing.T) {
+	dir, err := ioutil.TempDir("", "views")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := writeViews(t, dir, `{"views": []}`)
+	registry := newViewRegistry(mustMakeViews(defaultViews))
+	quit := make(chan struct{})
+	defer close(quit)
+	go watchViews(filename, 10*time.Millisecond, registry, quit)
+
+	// Broken files are ignored.
+	writeViews(t, dir, `{"views": [{"id": "broken"}]}`)
+	future := time.Now().Add(time.Minute)
+	ok(t, os.Chtimes(filename, future, future))
+	time.Sleep(50 * time.Millisecond)
+	_, found := registry.get("containers")
+	assert(t, found, "views lost after broken reload")
+
+	writeViews(t, dir, teamViews)
+	future = future.Add(time.Minute)
+	ok(t, os.Chtimes(filename, future, future))
+	test.Poll(t, time.Second, true, func() interface{} {
+		_, found := registry.get("containers-by-foo")
+		return found
+	})
+}
+
+func TestGroupByParam(t *testing.T) {
+	ts := httptest.NewServer(Router(StaticReport{}))
+	defer ts.Close()
+
+	var topologies []APITopologyDesc
+	ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/topology"), &topologies))
+	var groupBy []APITopologyOption
+	for _, topology := range topologies {
+		switch topology.URL {
+		case "/api/topology/containers":
+			groupBy = topology.Options[groupByParam]
+		case "/api/topology/hosts":
+			_, found := topology.Options[groupByParam]
+			assert(t, !found, "group_by options for hosts, which have no labels")
+		}
+	}
+	assert(t, len(groupBy) > 0, "no group_by options for containers")
+	equals(t, APITopologyOption{Value: groupByNone, Display: "Not grouped", Default: true}, groupBy[0])
+	values := map[string]string{}
+	for _, option := range groupBy[1:] {
+		values[option.Value] = option.Display
+	}
+	equals(t, "Grouped by foo1", values["docker_label_foo1"])
+
+	var topology APITopology
+	ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/topology/containers?group_by=docker_label_foo1"), &topology))
+	group, found := topology.Nodes[render.MakeGroupID("docker_label_foo1", "bar1")]
+	assert(t, found, "no group node in %v", topology.Nodes)
+	equals(t, "1 container", group.LabelMinor)
+	_, found = topology.Nodes[test.ServerContainerID]
+	assert(t, !found, "server container not grouped")
+
+	// Processes in containers have their containers' labels.
+	ok(t, json.Unmarshal(getRawJSON(t, ts, "/api/topology/applications?group_by=docker_label_foo1"), &topology))
+	group, found = topology.Nodes[render.MakeGroupID("docker_label_foo1", "bar1")]
+	assert(t, found, "no group node in %v", topology.Nodes)
+	equals(t, "1 process", group.LabelMinor)
+}
@@ -0,0 +1,44 @@
+// Alertreceiver logs the alerts the app notifies webhooks of, to try out
+// alerting rules. Point the app at it with an alerts file like
+//
+//	{"webhooks": ["http://localhost:4041/"], "rules": [...]}
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+)
+
+type alert struct {
+	Rule     string     `json:"rule"`
+	Topology string     `json:"topology"`
+	Key      string     `json:"key"`
+	Summary  string     `json:"summary"`
+	Status   string     `json:"status"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+func main() {
+	listen := flag.String("listen", ":4041", "listen address")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Alerts []alert `json:"alerts"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			log.Printf("bad payload from %s: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, a := range payload.Alerts {
+			log.Printf("%s %s/%s [%s] %s (since %s)", a.Status, a.Topology, a.Rule, a.Key, a.Summary, a.StartsAt.Format(time.RFC3339))
+		}
+	})
+	log.Printf("listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
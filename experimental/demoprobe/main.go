@@ -85,14 +85,14 @@ func demoReport(nodeCount int) report.Report {
 		)
 
 		// Endpoint topology
-		r.Endpoint = r.Endpoint.AddNode(srcPortID, report.MakeNode().WithMetadata(map[string]string{
+		r.Topologies[report.Endpoint] = r.Topologies[report.Endpoint].AddNode(srcPortID, report.MakeNode().WithMetadata(map[string]string{
 			process.PID: "4000",
 			"name":      c.srcProc,
 			"domain":    "node-" + src,
 		}).WithEdge(dstPortID, report.EdgeMetadata{
 			MaxConnCountTCP: newu64(uint64(rand.Intn(100) + 10)),
 		}))
-		r.Endpoint = r.Endpoint.AddNode(dstPortID, report.MakeNode().WithMetadata(map[string]string{
+		r.Topologies[report.Endpoint] = r.Topologies[report.Endpoint].AddNode(dstPortID, report.MakeNode().WithMetadata(map[string]string{
 			process.PID: "4000",
 			"name":      c.dstProc,
 			"domain":    "node-" + dst,
@@ -101,15 +101,15 @@ func demoReport(nodeCount int) report.Report {
 		}))
 
 		// Address topology
-		r.Address = r.Address.AddNode(srcAddressID, report.MakeNode().WithMetadata(map[string]string{
+		r.Topologies[report.Address] = r.Topologies[report.Address].AddNode(srcAddressID, report.MakeNode().WithMetadata(map[string]string{
 			docker.Name: src,
 		}).WithAdjacent(dstAddressID))
-		r.Address = r.Address.AddNode(srcAddressID, report.MakeNode().WithMetadata(map[string]string{
+		r.Topologies[report.Address] = r.Topologies[report.Address].AddNode(srcAddressID, report.MakeNode().WithMetadata(map[string]string{
 			docker.Name: dst,
 		}).WithAdjacent(srcAddressID))
 
 		// Host data
-		r.Host = r.Host.AddNode("hostX", report.MakeNodeWith(map[string]string{
+		r.Topologies[report.Host] = r.Topologies[report.Host].AddNode("hostX", report.MakeNodeWith(map[string]string{
 			"ts":             time.Now().UTC().Format(time.RFC3339Nano),
 			"host_name":      "host-x",
 			"local_networks": localNet.String(),
@@ -1,111 +1,63 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
-	"os"
-	"os/exec"
-
-	"github.com/weaveworks/scope/render"
-	"github.com/weaveworks/scope/report"
+	"strings"
 )
 
-func dot(w io.Writer, t render.RenderableNodes) {
-	fmt.Fprintf(w, "digraph G {\n")
-	fmt.Fprintf(w, "\toutputorder=edgesfirst;\n")
-	fmt.Fprintf(w, "\toverlap=scale;\n")
-	fmt.Fprintf(w, "\tnode [style=filled];\n")
-	fmt.Fprintf(w, "\t\n")
-	for id, rn := range t {
-		label := rn.LabelMajor
-		if len(label) > 20 {
-			label = label[:20] + "..."
-		}
-		fmt.Fprintf(w, "\t%q [label=%q];\n", id, label)
-		for _, other := range rn.Adjacency {
-			fmt.Fprintf(w, "\t%q -> %q;\n", id, other)
-		}
-		fmt.Fprintf(w, "\t\n")
-	}
-	fmt.Fprintf(w, "}\n")
+func handleHTML(w http.ResponseWriter, r *http.Request) {
+	logRequest("HTML", r)
+	format := `<html><head></head><body><center><img src="/svg?%s" style="margin:5%;"/></center></body></html>`
+	fmt.Fprintf(w, format, r.URL.RawQuery)
 }
 
-func handleHTML(rpt report.Report) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		logRequest("HTML", r)
-		format := `<html><head></head><body><center><img src="/svg?%s" style="margin:5%;"/></center></body></html>`
-		fmt.Fprintf(w, format, r.URL.RawQuery)
-	}
+func handleDot(app string) http.HandlerFunc {
+	return handleExport(app, "Dot", "text/plain; charset=utf-8", "dot")
 }
 
-func handleDot(rpt report.Report) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		logRequest("Dot", r)
-
-		r.ParseForm()
-		var (
-			engine   = getDefault(r.Form, "engine", "twopi")
-			topology = getDefault(r.Form, "topology", "containers")
-		)
-		log.Printf("engine=%s topology=%s", engine, topology)
-
-		t, err := renderTo(rpt, topology)
-		if err != nil {
-			log.Print(err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		log.Printf("render %s to %d node(s)", topology, len(t))
-
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		dot(w, t)
-	}
+func handleSVG(app string) http.HandlerFunc {
+	return handleExport(app, "SVG", "image/svg+xml", "svg")
 }
 
-func handleSVG(rpt report.Report) http.HandlerFunc {
+// handleExport gets a topology from the app in an export format, so it's
+// rendered as the app's views are, with the same options. Parameters other
+// than the topology, e.g. internet=domain, are passed on to the app.
+func handleExport(app, what, contentType, format string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logRequest("SVG", r)
+		logRequest(what, r)
 
 		r.ParseForm()
-		var (
-			engine   = getDefault(r.Form, "engine", "twopi")
-			topology = getDefault(r.Form, "topology", "containers")
-		)
-		log.Printf("engine=%s topology=%s", engine, topology)
-
-		t, err := renderTo(rpt, topology)
-		if err != nil {
-			log.Print(err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		topology := getDefault(r.Form, "topology", "containers")
+		log.Printf("topology=%s", topology)
+
+		params := url.Values{}
+		for key, values := range r.Form {
+			if key != "topology" {
+				params[key] = values
+			}
 		}
-		log.Printf("render %s to %d node(s)", topology, len(t))
+		params.Set("format", format)
+		u := strings.TrimSuffix(app, "/") + "/api/topology/" + url.QueryEscape(topology) + "?" + params.Encode()
 
-		vizcmd, err := exec.LookPath(engine)
+		resp, err := http.Get(u)
 		if err != nil {
 			log.Print(err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadGateway)
 			return
 		}
-
-		var buf bytes.Buffer
-		dot(&buf, t)
-
-		w.Header().Set("Content-Type", "image/svg+xml")
-		if err := (&exec.Cmd{
-			Path:   vizcmd,
-			Args:   []string{vizcmd, "-Tsvg"},
-			Stdin:  &buf,
-			Stdout: w,
-			Stderr: os.Stderr,
-		}).Run(); err != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		} else {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.WriteHeader(resp.StatusCode)
+		if _, err := io.Copy(w, resp.Body); err != nil {
 			log.Print(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
 		}
 	}
 }
@@ -1,31 +1,25 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
 
-	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/xfer"
 )
 
 func main() {
 	var (
 		listen = flag.String("listen", ":8080", "HTTP listen address")
+		app    = flag.String("app", "http://localhost:"+strconv.Itoa(xfer.AppPort), "URL of the app to draw the topologies of")
 	)
 	flag.Parse()
 
-	log.Printf("reading /api/report from stdin...")
-	var rpt report.Report
-	if err := json.NewDecoder(os.Stdin).Decode(&rpt); err != nil {
-		log.Fatal(err)
-	}
-
-	http.HandleFunc("/", handleHTML(rpt))
-	http.HandleFunc("/dot", handleDot(rpt))
-	http.HandleFunc("/svg", handleSVG(rpt))
+	http.HandleFunc("/", handleHTML)
+	http.HandleFunc("/dot", handleDot(*app))
+	http.HandleFunc("/svg", handleSVG(*app))
 	http.HandleFunc("/favicon.ico", func(w http.ResponseWriter, _ *http.Request) { http.Error(w, "Stop it", http.StatusTeapot) })
-	log.Printf("listening on %s", *listen)
+	log.Printf("listening on %s, drawing topologies of %s", *listen, *app)
 	http.ListenAndServe(*listen, nil)
 }
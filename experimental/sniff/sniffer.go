@@ -156,9 +156,9 @@ func interpolateCounts(r report.Report) {
 		return
 	}
 	factor := 1.0 / rate
-	for _, topology := range r.Topologies() {
-		for _, nmd := range topology.Nodes {
-			for _, emd := range nmd.Edges {
+	for _, topology := range r.Topologies {
+		topology.Nodes.ForEach(func(_ string, nmd report.Node) {
+			nmd.Edges.ForEach(func(_ string, emd report.EdgeMetadata) {
 				if emd.EgressPacketCount != nil {
 					*emd.EgressPacketCount = uint64(float64(*emd.EgressPacketCount) * factor)
 				}
@@ -171,8 +171,8 @@ func interpolateCounts(r report.Report) {
 				if emd.IngressByteCount != nil {
 					*emd.IngressByteCount = uint64(float64(*emd.IngressByteCount) * factor)
 				}
-			}
-		}
+			})
+		})
 	}
 }
 
@@ -297,6 +297,13 @@ func (s *Sniffer) Merge(p Packet, rpt *report.Report) {
 		return result
 	}
 
+	setEdge := func(t report.Topology, srcNodeID, dstNodeID string, emd report.EdgeMetadata) report.Topology {
+		node := t.Nodes.Get(srcNodeID)
+		node.Edges = node.Edges.Set(dstNodeID, emd)
+		t.Nodes = t.Nodes.Set(srcNodeID, node)
+		return t
+	}
+
 	// For sure, we can add to the address topology.
 	{
 		var (
@@ -304,9 +311,9 @@ func (s *Sniffer) Merge(p Packet, rpt *report.Report) {
 			dstNodeID = report.MakeAddressNodeID(s.hostID, remoteIP)
 		)
 
-		rpt.Address = addAdjacency(rpt.Address, srcNodeID, dstNodeID)
+		rpt.Topologies[report.Address] = addAdjacency(rpt.Topologies[report.Address], srcNodeID, dstNodeID)
 
-		emd := rpt.Address.Nodes[srcNodeID].Edges[dstNodeID]
+		emd := rpt.Topologies[report.Address].Nodes.Get(srcNodeID).Edges.Get(dstNodeID)
 		if egress {
 			if emd.EgressPacketCount == nil {
 				emd.EgressPacketCount = new(uint64)
@@ -326,7 +333,7 @@ func (s *Sniffer) Merge(p Packet, rpt *report.Report) {
 			}
 			*emd.IngressByteCount += uint64(p.Network)
 		}
-		rpt.Address.Nodes[srcNodeID].Edges[dstNodeID] = emd
+		rpt.Topologies[report.Address] = setEdge(rpt.Topologies[report.Address], srcNodeID, dstNodeID, emd)
 	}
 
 	// If we have ports, we can add to the endpoint topology, too.
@@ -336,9 +343,9 @@ func (s *Sniffer) Merge(p Packet, rpt *report.Report) {
 			dstNodeID = report.MakeEndpointNodeID(s.hostID, remoteIP, remotePort)
 		)
 
-		rpt.Endpoint = addAdjacency(rpt.Endpoint, srcNodeID, dstNodeID)
+		rpt.Topologies[report.Endpoint] = addAdjacency(rpt.Topologies[report.Endpoint], srcNodeID, dstNodeID)
 
-		emd := rpt.Endpoint.Nodes[srcNodeID].Edges[dstNodeID]
+		emd := rpt.Topologies[report.Endpoint].Nodes.Get(srcNodeID).Edges.Get(dstNodeID)
 		if egress {
 			if emd.EgressPacketCount == nil {
 				emd.EgressPacketCount = new(uint64)
@@ -358,6 +365,6 @@ func (s *Sniffer) Merge(p Packet, rpt *report.Report) {
 			}
 			*emd.IngressByteCount += uint64(p.Transport)
 		}
-		rpt.Endpoint.Nodes[srcNodeID].Edges[dstNodeID] = emd
+		rpt.Topologies[report.Endpoint] = setEdge(rpt.Topologies[report.Endpoint], srcNodeID, dstNodeID, emd)
 	}
 }
@@ -65,14 +65,14 @@ func TestMerge(t *testing.T) {
 		dstEndpointNodeID = report.MakeEndpointNodeID(hostID, p.DstIP, p.DstPort)
 	)
 	if want, have := (report.Topology{
-		Nodes: report.Nodes{
+		Nodes: report.MakeNodes(map[string]report.Node{
 			srcEndpointNodeID: report.MakeNode().WithEdge(dstEndpointNodeID, report.EdgeMetadata{
 				EgressPacketCount: newu64(1),
 				EgressByteCount:   newu64(256),
 			}),
 			dstEndpointNodeID: report.MakeNode(),
-		},
-	}), rpt.Endpoint; !reflect.DeepEqual(want, have) {
+		}),
+	}), rpt.Topologies[report.Endpoint]; !reflect.DeepEqual(want, have) {
 		t.Errorf("%s", test.Diff(want, have))
 	}
 
@@ -81,14 +81,14 @@ func TestMerge(t *testing.T) {
 		dstAddressNodeID = report.MakeAddressNodeID(hostID, p.DstIP)
 	)
 	if want, have := (report.Topology{
-		Nodes: report.Nodes{
+		Nodes: report.MakeNodes(map[string]report.Node{
 			srcAddressNodeID: report.MakeNode().WithEdge(dstAddressNodeID, report.EdgeMetadata{
 				EgressPacketCount: newu64(1),
 				EgressByteCount:   newu64(512),
 			}),
 			dstAddressNodeID: report.MakeNode(),
-		},
-	}), rpt.Address; !reflect.DeepEqual(want, have) {
+		}),
+	}), rpt.Topologies[report.Address]; !reflect.DeepEqual(want, have) {
 		t.Errorf("%s", test.Diff(want, have))
 	}
 }
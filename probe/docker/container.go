@@ -47,6 +47,7 @@ const (
 	CPUTotalUsage        = "cpu_total_usage"
 	CPUUsageInKernelmode = "cpu_usage_in_kernelmode"
 	CPUSystemCPUUsage    = "cpu_system_cpu_usage"
+	CPUUsagePercent      = "cpu_usage_percent"
 )
 
 // Exported for testing
@@ -78,9 +79,10 @@ type Container interface {
 
 type container struct {
 	sync.RWMutex
-	container   *docker.Container
-	statsConn   ClientConn
-	latestStats *docker.Stats
+	container     *docker.Container
+	statsConn     ClientConn
+	latestStats   *docker.Stats
+	previousStats *docker.Stats
 }
 
 // NewContainer creates a new Container
@@ -146,7 +148,7 @@ func (c *container) StartGatheringStats() error {
 
 			log.Printf("docker container: stopped collecting stats for %s", c.container.ID)
 			c.statsConn = nil
-			c.latestStats = nil
+			c.latestStats, c.previousStats = nil, nil
 		}()
 
 		stats := &docker.Stats{}
@@ -159,7 +161,7 @@ func (c *container) StartGatheringStats() error {
 			}
 
 			c.Lock()
-			c.latestStats = stats
+			c.latestStats, c.previousStats = stats, c.latestStats
 			c.Unlock()
 
 			stats = &docker.Stats{}
@@ -179,7 +181,7 @@ func (c *container) StopGatheringStats() {
 
 	c.statsConn.Close()
 	c.statsConn = nil
-	c.latestStats = nil
+	c.latestStats, c.previousStats = nil, nil
 	return
 }
 
@@ -216,7 +218,7 @@ func (c *container) GetNode() report.Node {
 		ContainerIPs: strings.Join(append(c.container.NetworkSettings.SecondaryIPAddresses,
 			c.container.NetworkSettings.IPAddress), " "),
 	})
-	AddLabels(result, c.container.Config.Labels)
+	result = AddLabels(result, c.container.Config.Labels)
 
 	if c.latestStats == nil {
 		return result
@@ -243,10 +245,40 @@ func (c *container) GetNode() report.Node {
 		CPUUsageInKernelmode: strconv.FormatUint(c.latestStats.CPUStats.CPUUsage.UsageInKernelmode, 10),
 		CPUSystemCPUUsage:    strconv.FormatUint(c.latestStats.CPUStats.SystemCPUUsage, 10),
 	}))
+	if percent, ok := cpuPercent(c.previousStats, c.latestStats); ok {
+		result = result.WithMetadata(map[string]string{
+			CPUUsagePercent: strconv.FormatFloat(percent, 'f', 2, 64),
+		})
+	}
 	return result
 }
 
+// cpuPercent returns the CPU used by a container between two samples of its
+// stats, as a percentage of one CPU, as docker stats shows it. The total and
+// system usage are cumulative, so a single sample says nothing about it.
+func cpuPercent(previous, latest *docker.Stats) (float64, bool) {
+	if previous == nil || latest == nil {
+		return 0, false
+	}
+	var (
+		usage  = latest.CPUStats.CPUUsage.TotalUsage
+		system = latest.CPUStats.SystemCPUUsage
+		cpus   = len(latest.CPUStats.CPUUsage.PercpuUsage)
+	)
+	if usage < previous.CPUStats.CPUUsage.TotalUsage || system <= previous.CPUStats.SystemCPUUsage {
+		return 0, false
+	}
+	if cpus == 0 {
+		cpus = 1
+	}
+	var (
+		usageDelta  = float64(usage - previous.CPUStats.CPUUsage.TotalUsage)
+		systemDelta = float64(system - previous.CPUStats.SystemCPUUsage)
+	)
+	return usageDelta / systemDelta * float64(cpus) * 100, true
+}
+
 // ExtractContainerIPs returns the list of container IPs given a Node from the Container topology.
 func ExtractContainerIPs(nmd report.Node) []string {
-	return strings.Fields(nmd.Metadata[ContainerIPs])
+	return strings.Fields(nmd.Metadata.Get(ContainerIPs))
 }
@@ -57,11 +57,17 @@ func TestContainer(t *testing.T) {
 	}
 	defer c.StopGatheringStats()
 
-	// Send some stats to the docker container
-	stats := &client.Stats{}
-	stats.MemoryStats.Usage = 12345
-	if err = json.NewEncoder(writer).Encode(&stats); err != nil {
-		t.Error(err)
+	// Send some stats to the docker container: two samples, as CPU usage is
+	// worked out from the difference between them.
+	for _, sample := range []struct{ usage, system uint64 }{{100, 1000}, {300, 2000}} {
+		stats := &client.Stats{}
+		stats.MemoryStats.Usage = 12345
+		stats.CPUStats.CPUUsage.TotalUsage = sample.usage
+		stats.CPUStats.CPUUsage.PercpuUsage = []uint64{sample.usage / 2, sample.usage / 2}
+		stats.CPUStats.SystemCPUUsage = sample.system
+		if err = json.NewEncoder(writer).Encode(&stats); err != nil {
+			t.Error(err)
+		}
 	}
 
 	// Now see if we go them
@@ -76,14 +82,17 @@ func TestContainer(t *testing.T) {
 		"docker_label_foo1":        "bar1",
 		"docker_label_foo2":        "bar2",
 		"memory_usage":             "12345",
+		"cpu_total_usage":          "300",
+		"cpu_system_cpu_usage":     "2000",
+		"cpu_usage_percent":        "40.00",
 	})
 	test.Poll(t, 100*time.Millisecond, want, func() interface{} {
 		node := c.GetNode()
-		for k, v := range node.Metadata {
+		node.Metadata.ForEach(func(k, v string) {
 			if v == "0" {
-				delete(node.Metadata, k)
+				node.Metadata = node.Metadata.Delete(k)
 			}
-		}
+		})
 		return node
 	})
 
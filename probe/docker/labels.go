@@ -11,21 +11,22 @@ import (
 // "docker_label_labelKey"="dockerValue" in the metadata)
 const LabelPrefix = "docker_label_"
 
-// AddLabels appends Docker labels to the Node from a topology.
-func AddLabels(nmd report.Node, labels map[string]string) {
+// AddLabels returns the Node from a topology with Docker labels appended.
+func AddLabels(nmd report.Node, labels map[string]string) report.Node {
 	for key, value := range labels {
-		nmd.Metadata[LabelPrefix+key] = value
+		nmd.Metadata = nmd.Metadata.Set(LabelPrefix+key, value)
 	}
+	return nmd
 }
 
 // ExtractLabels returns the list of Docker labels given a Node from a topology.
 func ExtractLabels(nmd report.Node) map[string]string {
 	result := map[string]string{}
-	for key, value := range nmd.Metadata {
+	nmd.Metadata.ForEach(func(key, value string) {
 		if strings.HasPrefix(key, LabelPrefix) {
 			label := key[len(LabelPrefix):]
 			result[label] = value
 		}
-	}
+	})
 	return result
 }
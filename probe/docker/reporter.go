@@ -29,8 +29,8 @@ func NewReporter(registry Registry, hostID string) *Reporter {
 // Report generates a Report containing Container and ContainerImage topologies
 func (r *Reporter) Report() (report.Report, error) {
 	result := report.MakeReport()
-	result.Container = result.Container.Merge(r.containerTopology())
-	result.ContainerImage = result.ContainerImage.Merge(r.containerImageTopology())
+	result.Topologies[report.Container] = result.Topologies[report.Container].Merge(r.containerTopology())
+	result.Topologies[report.ContainerImage] = result.Topologies[report.ContainerImage].Merge(r.containerImageTopology())
 	return result, nil
 }
 
@@ -39,7 +39,7 @@ func (r *Reporter) containerTopology() report.Topology {
 
 	r.registry.WalkContainers(func(c Container) {
 		nodeID := report.MakeContainerNodeID(r.hostID, c.ID())
-		result.AddNode(nodeID, c.GetNode())
+		result = result.AddNode(nodeID, c.GetNode())
 	})
 
 	return result
@@ -52,14 +52,14 @@ func (r *Reporter) containerImageTopology() report.Topology {
 		nmd := report.MakeNodeWith(map[string]string{
 			ImageID: image.ID,
 		})
-		AddLabels(nmd, image.Labels)
+		nmd = AddLabels(nmd, image.Labels)
 
 		if len(image.RepoTags) > 0 {
-			nmd.Metadata[ImageName] = image.RepoTags[0]
+			nmd.Metadata = nmd.Metadata.Set(ImageName, image.RepoTags[0])
 		}
 
 		nodeID := report.MakeContainerNodeID(r.hostID, image.ID)
-		result.AddNode(nodeID, nmd)
+		result = result.AddNode(nodeID, nmd)
 	})
 
 	return result
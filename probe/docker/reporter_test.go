@@ -49,22 +49,22 @@ var (
 
 func TestReporter(t *testing.T) {
 	want := report.MakeReport()
-	want.Container = report.Topology{
-		Nodes: report.Nodes{
+	want.Topologies[report.Container] = report.Topology{
+		Nodes: report.MakeNodes(map[string]report.Node{
 			report.MakeContainerNodeID("", "ping"): report.MakeNodeWith(map[string]string{
 				docker.ContainerID:   "ping",
 				docker.ContainerName: "pong",
 				docker.ImageID:       "baz",
 			}),
-		},
+		}),
 	}
-	want.ContainerImage = report.Topology{
-		Nodes: report.Nodes{
+	want.Topologies[report.ContainerImage] = report.Topology{
+		Nodes: report.MakeNodes(map[string]report.Node{
 			report.MakeContainerNodeID("", "baz"): report.MakeNodeWith(map[string]string{
 				docker.ImageID:   "baz",
 				docker.ImageName: "bang",
 			}),
-		},
+		}),
 	}
 
 	reporter := docker.NewReporter(mockRegistryInstance, "")
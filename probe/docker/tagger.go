@@ -40,20 +40,21 @@ func (t *Tagger) Tag(r report.Report) (report.Report, error) {
 	if err != nil {
 		return report.MakeReport(), err
 	}
-	t.tag(tree, &r.Process)
+	r.Topologies[report.Process] = t.tag(tree, r.Topologies[report.Process])
 	return r, nil
 }
 
-func (t *Tagger) tag(tree process.Tree, topology *report.Topology) {
-	for nodeID, node := range topology.Nodes {
-		pidStr, ok := node.Metadata[process.PID]
+func (t *Tagger) tag(tree process.Tree, topology report.Topology) report.Topology {
+	result := topology
+	topology.Nodes.ForEach(func(nodeID string, node report.Node) {
+		pidStr, ok := node.Metadata.Lookup(process.PID)
 		if !ok {
-			continue
+			return
 		}
 
 		pid, err := strconv.ParseUint(pidStr, 10, 64)
 		if err != nil {
-			continue
+			return
 		}
 
 		var (
@@ -76,11 +77,12 @@ func (t *Tagger) tag(tree process.Tree, topology *report.Topology) {
 		})
 
 		if c == nil {
-			continue
+			return
 		}
 
-		topology.AddNode(nodeID, report.MakeNodeWith(map[string]string{
+		result = result.AddNode(nodeID, report.MakeNodeWith(map[string]string{
 			ContainerID: c.ID(),
 		}))
-	}
+	})
+	return result
 }
@@ -71,6 +71,42 @@ type Conntracker interface {
 	Stop()
 }
 
+// Conntrack address families; the conntrack command only lists IPv4 flows
+// unless told otherwise.
+var (
+	IPv4 = []string{"-f", "ipv4"}
+	IPv6 = []string{"-f", "ipv6"}
+)
+
+// conntrackers combines several Conntrackers, e.g. one per address family.
+type conntrackers []Conntracker
+
+// NewMultiConntracker returns a Conntracker which walks the flows of all the
+// given Conntrackers, skipping any which are nil.
+func NewMultiConntracker(cs ...Conntracker) Conntracker {
+	result := conntrackers{}
+	for _, c := range cs {
+		if c != nil {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// WalkFlows implements Conntracker
+func (cs conntrackers) WalkFlows(f func(Flow)) {
+	for _, c := range cs {
+		c.WalkFlows(f)
+	}
+}
+
+// Stop implements Conntracker
+func (cs conntrackers) Stop() {
+	for _, c := range cs {
+		c.Stop()
+	}
+}
+
 // Conntracker uses the conntrack command to track network connections
 type conntracker struct {
 	sync.Mutex
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/xml"
 	"io"
+	"reflect"
 	"testing"
 	"time"
 
@@ -151,3 +152,21 @@ func TestConntracker(t *testing.T) {
 	test.Poll(t, ts, []Flow{flow1}, have)
 	test.Poll(t, ts, []Flow{}, have)
 }
+
+func TestMultiConntracker(t *testing.T) {
+	flow4, flow6 := makeFlow(New), makeFlow(New)
+	addMeta(&flow4, "original", "1.2.3.4", "2.3.4.5", 2, 3)
+	addMeta(&flow6, "original", "2001:db8::1", "2001:db8::2", 2, 3)
+
+	ct := NewMultiConntracker(
+		&mockConntracker{flows: []Flow{flow4}},
+		nil,
+		&mockConntracker{flows: []Flow{flow6}},
+	)
+	have := []Flow{}
+	ct.WalkFlows(func(f Flow) { have = append(have, f) })
+	if want := []Flow{flow4, flow6}; !reflect.DeepEqual(want, have) {
+		t.Fatal(test.Diff(want, have))
+	}
+	ct.Stop()
+}
@@ -0,0 +1,89 @@
+package endpoint
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// directionInferer works out which end of a connection is the client. It
+// prefers the original direction of a conntrack flow, then the listening
+// socket tables, and only falls back to comparing port numbers when neither
+// knows about the connection.
+type directionInferer struct {
+	listening map[string]struct{} // listening addresses, as joined host:port
+	flows     map[string]struct{} // original directions of flows, as src->dst
+}
+
+func newDirectionInferer(listeners []Listener, flows []Flow) directionInferer {
+	d := directionInferer{
+		listening: map[string]struct{}{},
+		flows:     map[string]struct{}{},
+	}
+	for _, l := range listeners {
+		d.listening[joinAddr(l.Address.String(), l.Port)] = struct{}{}
+	}
+	for _, f := range flows {
+		if f.Original == nil {
+			continue
+		}
+		d.flows[flowKey(
+			normalizeAddr(f.Original.Layer3.SrcIP), uint16(f.Original.Layer4.SrcPort),
+			normalizeAddr(f.Original.Layer3.DstIP), uint16(f.Original.Layer4.DstPort),
+		)] = struct{}{}
+	}
+	return d
+}
+
+// infer returns whether the local end of the connection is the client, and
+// which of the report.DirectionFrom* methods it used to decide.
+func (d directionInferer) infer(localAddr, remoteAddr string, localPort, remotePort uint16) (bool, string) {
+	if _, ok := d.flows[flowKey(localAddr, localPort, remoteAddr, remotePort)]; ok {
+		return true, report.DirectionFromConntrack
+	}
+	if _, ok := d.flows[flowKey(remoteAddr, remotePort, localAddr, localPort)]; ok {
+		return false, report.DirectionFromConntrack
+	}
+
+	if d.isListening(localAddr, localPort, true) {
+		return false, report.DirectionFromListening
+	}
+	if d.isListening(remoteAddr, remotePort, isLoopback(remoteAddr)) {
+		return true, report.DirectionFromListening
+	}
+
+	return int(localPort) > int(remotePort), report.DirectionFromPorts
+}
+
+// isListening returns true if a socket is listening on the given address
+// and port. Sockets bound to the unspecified address listen on every local
+// address, so they only count if the address is known to be local.
+func (d directionInferer) isListening(addr string, port uint16, local bool) bool {
+	if _, ok := d.listening[joinAddr(addr, port)]; ok {
+		return true
+	}
+	if !local {
+		return false
+	}
+	for _, unspecified := range []string{net.IPv4zero.String(), net.IPv6unspecified.String()} {
+		if _, ok := d.listening[joinAddr(unspecified, port)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isLoopback(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+func joinAddr(addr string, port uint16) string {
+	return net.JoinHostPort(addr, strconv.Itoa(int(port)))
+}
+
+func flowKey(srcAddr string, srcPort uint16, dstAddr string, dstPort uint16) string {
+	return fmt.Sprintf("%s->%s", joinAddr(srcAddr, srcPort), joinAddr(dstAddr, dstPort))
+}
@@ -0,0 +1,134 @@
+package endpoint
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	snoopedCacheLen        = 5000
+	snoopedCacheExpiration = 30 * time.Minute
+)
+
+// PacketSource is a source of packets which can be closed, such as a live
+// capture on a network interface. Reads should time out now and then, with
+// an error whose Timeout method returns true, so the snooper can be stopped;
+// sources are only closed once nothing reads them.
+type PacketSource interface {
+	gopacket.ZeroCopyPacketDataSource
+	Close()
+}
+
+// DNSSnooper is a caching, forward resolver. Rather than performing any
+// resolutions itself, it watches the DNS responses received by the host,
+// remembering which name each address was looked up by. Unlike the names
+// found by a ReverseResolver, these are the names clients actually used.
+type DNSSnooper struct {
+	sources []PacketSource
+	cache   gcache.Cache
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewDNSSnooperFromSources starts a new DNSSnooper which decodes the DNS
+// responses found in the given sources of Ethernet frames.
+func NewDNSSnooperFromSources(sources ...PacketSource) *DNSSnooper {
+	s := &DNSSnooper{
+		sources: sources,
+		cache:   gcache.New(snoopedCacheLen).LRU().Expiration(snoopedCacheExpiration).Build(),
+		quit:    make(chan struct{}),
+	}
+	for _, src := range sources {
+		s.wg.Add(1)
+		go s.loop(src)
+	}
+	return s
+}
+
+// Get returns the name an IP address was most recently looked up by, if it
+// has been seen, and an error otherwise.
+func (s *DNSSnooper) Get(address string) (string, error) {
+	val, err := s.cache.Get(address)
+	if name, ok := val.(string); err == nil && ok {
+		return name, nil
+	}
+	return "", errNotFound
+}
+
+// Stop the DNSSnooper, closing its sources once they're no longer read.
+func (s *DNSSnooper) Stop() {
+	close(s.quit)
+	s.wg.Wait()
+	for _, src := range s.sources {
+		src.Close()
+	}
+}
+
+func (s *DNSSnooper) loop(src PacketSource) {
+	defer s.wg.Done()
+
+	var (
+		eth     layers.Ethernet
+		ip4     layers.IPv4
+		ip6     layers.IPv6
+		udp     layers.UDP
+		dns     layers.DNS
+		decoded []gopacket.LayerType
+		parser  = gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet, &eth, &ip4, &ip6, &udp, &dns)
+	)
+	parser.IgnoreUnsupported = true
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+		data, _, err := src.ZeroCopyReadPacketData()
+		if err, ok := err.(interface {
+			Timeout() bool
+		}); ok && err.Timeout() {
+			continue
+		}
+		if err != nil {
+			log.Printf("DNS snooper: %v", err)
+			return
+		}
+		// Errors only mean we couldn't decode everything, e.g. the packet
+		// was truncated; any layers which were decoded are still valid.
+		parser.DecodeLayers(data, &decoded)
+		for _, layerType := range decoded {
+			if layerType == layers.LayerTypeDNS {
+				s.processDNS(&dns)
+			}
+		}
+	}
+}
+
+// processDNS remembers the name of the question for every address in the
+// answers of a successful response. Any CNAMEs in between are skipped, as
+// they're not what the client asked for.
+func (s *DNSSnooper) processDNS(dns *layers.DNS) {
+	if !dns.QR || dns.ResponseCode != layers.DNSResponseCodeNoErr || len(dns.Questions) == 0 {
+		return
+	}
+	name := strings.TrimRight(string(dns.Questions[0].Name), ".")
+	if name == "" {
+		return
+	}
+	for _, answer := range dns.Answers {
+		if answer.Type != layers.DNSTypeA && answer.Type != layers.DNSTypeAAAA {
+			continue
+		}
+		if answer.IP == nil {
+			continue
+		}
+		s.cache.Set(normalizeAddr(answer.IP.String()), name)
+	}
+}
@@ -0,0 +1,120 @@
+package endpoint
+
+import (
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// snoopReadTimeout is how long a read of a raw socket blocks for, before
+// the snooper checks whether it's been stopped.
+const snoopReadTimeout = 500 * time.Millisecond
+
+// dnsResponses is a BPF program matching unfragmented UDP packets from port
+// 53 in Ethernet frames, i.e. "udp src port 53".
+var dnsResponses = []bpf.Instruction{
+	bpf.LoadAbsolute{Off: 12, Size: 2},                                  // 0: ethertype
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0800, SkipFalse: 7},          // 1: IPv4?
+	bpf.LoadAbsolute{Off: 23, Size: 1},                                  // 2: IPv4 protocol
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: 17, SkipFalse: 11},             // 3: UDP?
+	bpf.LoadAbsolute{Off: 20, Size: 2},                                  // 4: flags and fragment offset
+	bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x1fff, SkipTrue: 9},         // 5: not the first fragment?
+	bpf.LoadMemShift{Off: 14},                                           // 6: X = IPv4 header length
+	bpf.LoadIndirect{Off: 14, Size: 2},                                  // 7: UDP source port
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: 53, SkipTrue: 5, SkipFalse: 6}, // 8: DNS?
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x86dd, SkipFalse: 5},          // 9: IPv6?
+	bpf.LoadAbsolute{Off: 20, Size: 1},                                  // 10: IPv6 next header
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: 17, SkipFalse: 3},              // 11: UDP?
+	bpf.LoadAbsolute{Off: 54, Size: 2},                                  // 12: UDP source port
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: 53, SkipFalse: 1},              // 13: DNS?
+	bpf.RetConstant{Val: 0xffff},                                        // 14: accept
+	bpf.RetConstant{Val: 0},                                             // 15: drop
+}
+
+// NewDNSSnooper starts a new DNSSnooper which captures the DNS responses
+// received on the given network interfaces. It needs root.
+func NewDNSSnooper(interfaces []string) (*DNSSnooper, error) {
+	filter, err := bpf.Assemble(dnsResponses)
+	if err != nil {
+		return nil, err
+	}
+	var sources []PacketSource
+	for _, iface := range interfaces {
+		src, err := newRawSource(iface, filter)
+		if err != nil {
+			for _, src := range sources {
+				src.Close()
+			}
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return NewDNSSnooperFromSources(sources...), nil
+}
+
+// rawSource captures the Ethernet frames received on an interface with a raw
+// socket. Reads time out after snoopReadTimeout, as closing the socket
+// doesn't interrupt them.
+type rawSource struct {
+	fd  int
+	buf []byte
+}
+
+func newRawSource(iface string, filter []bpf.RawInstruction) (*rawSource, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(unix.ETH_P_ALL)))
+	if err != nil {
+		return nil, err
+	}
+	src := &rawSource{fd: fd, buf: make([]byte, 65536)}
+
+	// The filter goes on before binding, so no other packets are queued.
+	prog := make([]unix.SockFilter, 0, len(filter))
+	for _, ins := range filter {
+		prog = append(prog, unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K})
+	}
+	timeout := unix.NsecToTimeval(int64(snoopReadTimeout))
+	for _, err := range []func() error{
+		func() error {
+			return unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]})
+		},
+		func() error { return unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout) },
+		func() error {
+			return unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ALL), Ifindex: ifi.Index})
+		},
+	} {
+		if err := err(); err != nil {
+			src.Close()
+			return nil, err
+		}
+	}
+	return src, nil
+}
+
+// ZeroCopyReadPacketData implements gopacket.ZeroCopyPacketDataSource. The
+// data is only valid until the next read.
+func (s *rawSource) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	n, _, err := unix.Recvfrom(s.fd, s.buf, unix.MSG_TRUNC)
+	if err != nil {
+		return nil, gopacket.CaptureInfo{}, err
+	}
+	ci := gopacket.CaptureInfo{Timestamp: time.Now(), Length: n, CaptureLength: n}
+	if n > len(s.buf) {
+		ci.CaptureLength = len(s.buf)
+	}
+	return s.buf[:ci.CaptureLength], ci, nil
+}
+
+// Close closes the socket. It must not be called while reading.
+func (s *rawSource) Close() {
+	unix.Close(s.fd)
+}
+
+// htons converts to network byte order, on little-endian hosts.
+func htons(v uint16) uint16 { return v<<8 | v>>8 }
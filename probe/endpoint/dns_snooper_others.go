@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package endpoint
+
+import (
+	"fmt"
+)
+
+// NewDNSSnooper is only supported on Linux.
+func NewDNSSnooper(interfaces []string) (*DNSSnooper, error) {
+	return nil, fmt.Errorf("DNS snooping is only supported on Linux")
+}
@@ -0,0 +1,139 @@
+package endpoint_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/test"
+)
+
+// mockSource replays packets, then times out reads, like a quiet raw socket.
+type mockSource struct {
+	packets chan []byte
+	closed  chan struct{}
+}
+
+func newMockSource(packets ...[]byte) *mockSource {
+	s := &mockSource{
+		packets: make(chan []byte, len(packets)),
+		closed:  make(chan struct{}),
+	}
+	for _, p := range packets {
+		s.packets <- p
+	}
+	return s
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func (s *mockSource) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	select {
+	case <-s.closed:
+		panic("read after close")
+	default:
+	}
+	select {
+	case p := <-s.packets:
+		return p, gopacket.CaptureInfo{CaptureLength: len(p), Length: len(p)}, nil
+	case <-time.After(10 * time.Millisecond):
+		return nil, gopacket.CaptureInfo{}, timeoutError{}
+	}
+}
+
+func (s *mockSource) Close() { close(s.closed) }
+
+func dnsResponse(t *testing.T, rcode layers.DNSResponseCode, question string, answers ...layers.DNSResourceRecord) []byte {
+	var (
+		eth = layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+			DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip = layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Protocol: layers.IPProtocolUDP,
+			SrcIP:    net.ParseIP("192.168.1.53"),
+			DstIP:    net.ParseIP("192.168.1.1"),
+		}
+		udp = layers.UDP{SrcPort: 53, DstPort: 40000}
+		dns = layers.DNS{
+			ID:           1,
+			QR:           true,
+			ResponseCode: rcode,
+			Questions: []layers.DNSQuestion{
+				{Name: []byte(question), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+			},
+			Answers: answers,
+		}
+		buf = gopacket.NewSerializeBuffer()
+	)
+	udp.SetNetworkLayerForChecksum(&ip)
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, &eth, &ip, &udp, &dns); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDNSSnooper(t *testing.T) {
+	var (
+		a = func(name, ip string) layers.DNSResourceRecord {
+			return layers.DNSResourceRecord{Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 60, IP: net.ParseIP(ip).To4()}
+		}
+		aaaa = func(name, ip string) layers.DNSResourceRecord {
+			return layers.DNSResourceRecord{Name: []byte(name), Type: layers.DNSTypeAAAA, Class: layers.DNSClassIN, TTL: 60, IP: net.ParseIP(ip)}
+		}
+		cname = layers.DNSResourceRecord{Name: []byte("www.example.com"), Type: layers.DNSTypeCNAME, Class: layers.DNSClassIN, TTL: 60, CNAME: []byte("example.cdn.net")}
+	)
+	src := newMockSource(
+		dnsResponse(t, layers.DNSResponseCodeNXDomain, "nope.example.com", a("nope.example.com", "10.9.9.9")),
+		dnsResponse(t, layers.DNSResponseCodeNoErr, "www.example.com", cname, a("example.cdn.net", "93.184.216.34"), aaaa("example.cdn.net", "2606:2800:220:1::1")),
+	)
+	snooper := endpoint.NewDNSSnooperFromSources(src)
+	defer snooper.Stop()
+
+	// Addresses are named after the question, not the CNAME.
+	for ip, want := range map[string]string{
+		"93.184.216.34":      "www.example.com",
+		"2606:2800:220:1::1": "www.example.com",
+	} {
+		test.Poll(t, 100*time.Millisecond, want, func() interface{} {
+			name, _ := snooper.Get(ip)
+			return name
+		})
+	}
+
+	// Failed lookups, which came first, are ignored.
+	if name, err := snooper.Get("10.9.9.9"); err == nil {
+		t.Errorf("want error, have %q", name)
+	}
+}
+
+func TestDNSSnooperStop(t *testing.T) {
+	src := newMockSource()
+	snooper := endpoint.NewDNSSnooperFromSources(src)
+
+	stopped := make(chan struct{})
+	go func() {
+		snooper.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop didn't return")
+	}
+	select {
+	case <-src.closed:
+	default:
+		t.Error("source not closed")
+	}
+}
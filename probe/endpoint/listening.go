@@ -0,0 +1,243 @@
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Transports, as used in Listener.Transport and the Listening metadata key.
+const (
+	TransportTCP = "tcp"
+	TransportUDP = "udp"
+)
+
+// Socket states, as found in /proc/net/{tcp,udp}[6].
+const (
+	tcpEstablished = "01" // TCP_ESTABLISHED
+	tcpListen      = "0A" // TCP_LISTEN
+	udpUnconned    = "07" // TCP_CLOSE; UDP sockets which are bound but not connected
+)
+
+// Listener is a socket waiting for connections: a TCP socket in the LISTEN
+// state, or a bound, unconnected UDP socket.
+type Listener struct {
+	Transport string
+	Address   net.IP
+	Port      uint16
+	PID       int // 0 if unknown
+}
+
+// ListenerWalker is something that walks the listening sockets of a host.
+// As finding the processes of sockets means scanning the file descriptors of
+// every process, it also keeps the processes of the established TCP
+// connections it found, so they needn't be scanned for again.
+type ListenerWalker interface {
+	Walk(func(Listener)) error
+
+	// ConnectionPID returns the PID of the process with the TCP connection,
+	// as of the last Walk, or 0 if unknown.
+	ConnectionPID(localAddr net.IP, localPort uint16, remoteAddr net.IP, remotePort uint16) int
+}
+
+type listenerWalker struct {
+	procRoot         string
+	includeProcesses bool
+
+	mtx            sync.Mutex
+	connectionPIDs map[string]int // by connectionKey
+}
+
+// NewListenerWalker returns a ListenerWalker which reads listening sockets
+// from the proc filesystem at procRoot. If includeProcesses is true, it also
+// works out which process owns each socket, which needs root.
+func NewListenerWalker(procRoot string, includeProcesses bool) ListenerWalker {
+	return &listenerWalker{
+		procRoot:         procRoot,
+		includeProcesses: includeProcesses,
+	}
+}
+
+// ConnectionPID implements ListenerWalker.
+func (w *listenerWalker) ConnectionPID(localAddr net.IP, localPort uint16, remoteAddr net.IP, remotePort uint16) int {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.connectionPIDs[connectionKey(localAddr, localPort, remoteAddr, remotePort)]
+}
+
+func connectionKey(localAddr net.IP, localPort uint16, remoteAddr net.IP, remotePort uint16) string {
+	return fmt.Sprintf("%s:%d-%s:%d", localAddr, localPort, remoteAddr, remotePort)
+}
+
+// Walk implements ListenerWalker.
+func (w *listenerWalker) Walk(f func(Listener)) error {
+	var (
+		listeners   = map[uint64][]Listener{} // inode -> listeners
+		connections = map[uint64]string{}     // inode -> connectionKey
+		found       = false
+	)
+	for _, table := range []struct {
+		file, transport, state string
+	}{
+		{"tcp", TransportTCP, tcpListen},
+		{"tcp6", TransportTCP, tcpListen},
+		{"udp", TransportUDP, udpUnconned},
+		{"udp6", TransportUDP, udpUnconned},
+	} {
+		buf, err := ioutil.ReadFile(path.Join(w.procRoot, "net", table.file))
+		if err != nil {
+			continue // e.g. IPv6 disabled
+		}
+		found = true
+		if err := parseListeners(buf, table.transport, table.state, listeners); err != nil {
+			return err
+		}
+		if w.includeProcesses && table.transport == TransportTCP {
+			if err := parseConnections(buf, connections); err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("no socket tables found in %s", path.Join(w.procRoot, "net"))
+	}
+
+	if w.includeProcesses {
+		connectionPIDs := map[string]int{}
+		w.findPIDs(func(inode uint64, pid int) {
+			ls := listeners[inode]
+			for i := range ls {
+				ls[i].PID = pid
+			}
+			if key, ok := connections[inode]; ok {
+				connectionPIDs[key] = pid
+			}
+		})
+		w.mtx.Lock()
+		w.connectionPIDs = connectionPIDs
+		w.mtx.Unlock()
+	}
+
+	for _, ls := range listeners {
+		for _, l := range ls {
+			f(l)
+		}
+	}
+	return nil
+}
+
+// parseListeners parses a /proc/net/{tcp,udp}[6] table, adding any sockets
+// in the given state to listeners, keyed by inode.
+func parseListeners(buf []byte, transport, state string, listeners map[uint64][]Listener) error {
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	scanner.Scan() // skip the header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+		address, port, err := parseHexAddr(fields[1])
+		if err != nil {
+			return err
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return err
+		}
+		listeners[inode] = append(listeners[inode], Listener{
+			Transport: transport,
+			Address:   address,
+			Port:      port,
+		})
+	}
+	return scanner.Err()
+}
+
+// parseConnections parses a /proc/net/tcp[6] table, adding the established
+// connections to connections, keyed by inode.
+func parseConnections(buf []byte, connections map[uint64]string) error {
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	scanner.Scan() // skip the header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpEstablished {
+			continue
+		}
+		localAddr, localPort, err := parseHexAddr(fields[1])
+		if err != nil {
+			return err
+		}
+		remoteAddr, remotePort, err := parseHexAddr(fields[2])
+		if err != nil {
+			return err
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return err
+		}
+		connections[inode] = connectionKey(localAddr, localPort, remoteAddr, remotePort)
+	}
+	return scanner.Err()
+}
+
+// parseHexAddr parses an address as found in /proc/net/tcp[6], e.g.
+// "0100007F:1F90". The address is a sequence of 32-bit words, each in host
+// (little-endian) byte order; the port is big-endian.
+func parseHexAddr(s string) (net.IP, uint16, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("invalid address %q", s)
+	}
+	ip, err := hex.DecodeString(parts[0])
+	if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid address %q", s)
+	}
+	for i := 0; i < len(ip); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = ip[i+3], ip[i+2], ip[i+1], ip[i]
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port %q", s)
+	}
+	return net.IP(ip), uint16(port), nil
+}
+
+// findPIDs walks the file descriptors of every process, calling f with the
+// inode of each socket found, and the PID of its process.
+func (w *listenerWalker) findPIDs(f func(inode uint64, pid int)) {
+	dirEntries, err := ioutil.ReadDir(w.procRoot)
+	if err != nil {
+		return
+	}
+	for _, dirEntry := range dirEntries {
+		pid, err := strconv.Atoi(dirEntry.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := path.Join(w.procRoot, dirEntry.Name(), "fd")
+		fds, err := ioutil.ReadDir(fdDir)
+		if err != nil {
+			continue // process has gone away, or we're not root
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(path.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			f(inode, pid)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package endpoint_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/test"
+)
+
+const (
+	fixProcNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 100 0 0 10 0
+   2: 0101A8C0:0050 0201A8C0:3039 01 00000000:00000000 00:00000000 00000000     0        0 1003 1 0000000000000000 100 0 0 10 0
+`
+	fixProcNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: B80D0120000000000000000001000000:01BB 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2001 1 0000000000000000 100 0 0 10 0
+`
+	fixProcNetUDP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when ref pointer drops
+   0: 00000000:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 3001 2 0000000000000000 0
+   1: 0100007F:0035 0100007F:1234 01 00000000:00000000 00:00000000 00000000     0        0 3002 2 0000000000000000 0
+`
+)
+
+// makeProcRoot builds a fake /proc, with socket tables and a couple of
+// processes holding socket file descriptors.
+func makeProcRoot(t *testing.T) string {
+	procRoot, err := ioutil.TempDir("", "scope-proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, contents := range map[string]string{
+		"net/tcp":  fixProcNetTCP,
+		"net/tcp6": fixProcNetTCP6,
+		"net/udp":  fixProcNetUDP,
+	} {
+		if err := os.MkdirAll(path.Dir(path.Join(procRoot, file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(procRoot, file), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for fd, link := range map[string]string{
+		"42/fd/3": "socket:[1001]",
+		"42/fd/4": "socket:[3001]",
+		"42/fd/5": "/dev/null",
+		"43/fd/3": "socket:[2001]",
+		"44/fd/3": "socket:[1003]",
+	} {
+		if err := os.MkdirAll(path.Dir(path.Join(procRoot, fd)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(link, path.Join(procRoot, fd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return procRoot
+}
+
+type listeners []endpoint.Listener
+
+func (ls listeners) Len() int           { return len(ls) }
+func (ls listeners) Swap(i, j int)      { ls[i], ls[j] = ls[j], ls[i] }
+func (ls listeners) Less(i, j int) bool { return ls[i].Port < ls[j].Port }
+
+func TestListenerWalker(t *testing.T) {
+	procRoot := makeProcRoot(t)
+	defer os.RemoveAll(procRoot)
+
+	for _, includeProcesses := range []bool{false, true} {
+		pid := func(pid int) int {
+			if includeProcesses {
+				return pid
+			}
+			return 0
+		}
+		want := listeners{
+			{Transport: endpoint.TransportUDP, Address: net.ParseIP("0.0.0.0").To4(), Port: 53, PID: pid(42)},
+			{Transport: endpoint.TransportTCP, Address: net.ParseIP("0.0.0.0").To4(), Port: 80, PID: pid(42)},
+			{Transport: endpoint.TransportTCP, Address: net.ParseIP("2001:db8::1"), Port: 443, PID: pid(43)},
+			{Transport: endpoint.TransportTCP, Address: net.ParseIP("127.0.0.1").To4(), Port: 8080},
+		}
+
+		have := listeners{}
+		if err := endpoint.NewListenerWalker(procRoot, includeProcesses).Walk(func(l endpoint.Listener) {
+			have = append(have, l)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		sort.Sort(have)
+
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("includeProcesses=%v: %s", includeProcesses, test.Diff(want, have))
+		}
+	}
+}
+
+func TestListenerWalkerConnectionPID(t *testing.T) {
+	procRoot := makeProcRoot(t)
+	defer os.RemoveAll(procRoot)
+
+	var (
+		walker = endpoint.NewListenerWalker(procRoot, true)
+		local  = net.ParseIP("192.168.1.1").To4()
+		remote = net.ParseIP("192.168.1.2").To4()
+	)
+	if want, have := 0, walker.ConnectionPID(local, 80, remote, 12345); want != have {
+		t.Errorf("before walking: want %d, have %d", want, have)
+	}
+	if err := walker.Walk(func(endpoint.Listener) {}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 44, walker.ConnectionPID(local, 80, remote, 12345); want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if want, have := 0, walker.ConnectionPID(remote, 12345, local, 80); want != have {
+		t.Errorf("other end: want %d, have %d", want, have)
+	}
+}
+
+func TestListenerWalkerNoTables(t *testing.T) {
+	if err := endpoint.NewListenerWalker("/nonexistent", true).Walk(func(endpoint.Listener) {}); err == nil {
+		t.Error("expected an error")
+	}
+}
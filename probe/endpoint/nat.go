@@ -28,18 +28,18 @@ func NewNATMapper(ct Conntracker) NATMapper {
 
 func toMapping(f Flow) *endpointMapping {
 	var mapping endpointMapping
-	if f.Original.Layer3.SrcIP == f.Reply.Layer3.DstIP {
+	if normalizeAddr(f.Original.Layer3.SrcIP) == normalizeAddr(f.Reply.Layer3.DstIP) {
 		mapping = endpointMapping{
-			originalIP:    f.Reply.Layer3.SrcIP,
+			originalIP:    normalizeAddr(f.Reply.Layer3.SrcIP),
 			originalPort:  f.Reply.Layer4.SrcPort,
-			rewrittenIP:   f.Original.Layer3.DstIP,
+			rewrittenIP:   normalizeAddr(f.Original.Layer3.DstIP),
 			rewrittenPort: f.Original.Layer4.DstPort,
 		}
 	} else {
 		mapping = endpointMapping{
-			originalIP:    f.Original.Layer3.SrcIP,
+			originalIP:    normalizeAddr(f.Original.Layer3.SrcIP),
 			originalPort:  f.Original.Layer4.SrcPort,
-			rewrittenIP:   f.Reply.Layer3.DstIP,
+			rewrittenIP:   normalizeAddr(f.Reply.Layer3.DstIP),
 			rewrittenPort: f.Reply.Layer4.DstPort,
 		}
 	}
@@ -56,16 +56,16 @@ func (n NATMapper) ApplyNAT(rpt report.Report, scope string) {
 			realEndpointID   = report.MakeEndpointNodeID(scope, mapping.originalIP, strconv.Itoa(mapping.originalPort))
 			copyEndpointPort = strconv.Itoa(mapping.rewrittenPort)
 			copyEndpointID   = report.MakeEndpointNodeID(scope, mapping.rewrittenIP, copyEndpointPort)
-			node, ok         = rpt.Endpoint.Nodes[realEndpointID]
+			node, ok         = rpt.Topologies[report.Endpoint].Nodes.Lookup(realEndpointID)
 		)
 		if !ok {
 			return
 		}
 
 		node = node.Copy()
-		node.Metadata[Addr] = mapping.rewrittenIP
-		node.Metadata[Port] = copyEndpointPort
-		node.Metadata["copy_of"] = realEndpointID
-		rpt.Endpoint.AddNode(copyEndpointID, node)
+		node.Metadata = node.Metadata.Set(Addr, mapping.rewrittenIP)
+		node.Metadata = node.Metadata.Set(Port, copyEndpointPort)
+		node.Metadata = node.Metadata.Set("copy_of", realEndpointID)
+		rpt.Topologies[report.Endpoint] = rpt.Topologies[report.Endpoint].AddNode(copyEndpointID, node)
 	})
 }
@@ -41,14 +41,14 @@ func TestNat(t *testing.T) {
 
 		have := report.MakeReport()
 		originalID := report.MakeEndpointNodeID("host1", "10.0.47.1", "80")
-		have.Endpoint.AddNode(originalID, report.MakeNodeWith(report.Metadata{
+		have.Topologies[report.Endpoint] = have.Topologies[report.Endpoint].AddNode(originalID, report.MakeNodeWith(map[string]string{
 			endpoint.Addr: "10.0.47.1",
 			endpoint.Port: "80",
 			"foo":         "bar",
 		}))
 
 		want := have.Copy()
-		want.Endpoint.AddNode(report.MakeEndpointNodeID("host1", "1.2.3.4", "80"), report.MakeNodeWith(report.Metadata{
+		want.Topologies[report.Endpoint] = want.Topologies[report.Endpoint].AddNode(report.MakeEndpointNodeID("host1", "1.2.3.4", "80"), report.MakeNodeWith(map[string]string{
 			endpoint.Addr: "1.2.3.4",
 			endpoint.Port: "80",
 			"copy_of":     originalID,
@@ -74,14 +74,14 @@ func TestNat(t *testing.T) {
 
 		have := report.MakeReport()
 		originalID := report.MakeEndpointNodeID("host2", "10.0.47.2", "22222")
-		have.Endpoint.AddNode(originalID, report.MakeNodeWith(report.Metadata{
+		have.Topologies[report.Endpoint] = have.Topologies[report.Endpoint].AddNode(originalID, report.MakeNodeWith(map[string]string{
 			endpoint.Addr: "10.0.47.2",
 			endpoint.Port: "22222",
 			"foo":         "baz",
 		}))
 
 		want := have.Copy()
-		want.Endpoint.AddNode(report.MakeEndpointNodeID("host2", "2.3.4.5", "22223"), report.MakeNodeWith(report.Metadata{
+		want.Topologies[report.Endpoint] = want.Topologies[report.Endpoint].AddNode(report.MakeEndpointNodeID("host2", "2.3.4.5", "22223"), report.MakeNodeWith(map[string]string{
 			endpoint.Addr: "2.3.4.5",
 			endpoint.Port: "22223",
 			"copy_of":     originalID,
@@ -94,4 +94,35 @@ func TestNat(t *testing.T) {
 			t.Fatal(test.Diff(want, have))
 		}
 	}
+
+	// IPv6, with conntrack's addresses in a non-canonical form
+	{
+		flow := makeFlow("")
+		addIndependant(&flow, 3, "")
+		flow.Original = addMeta(&flow, "original", "2001:db8:0:0::5", "2001:db8::1", 33333, 80)
+		flow.Reply = addMeta(&flow, "reply", "fd00::47:1", "2001:0db8::5", 80, 33333)
+		ct := &mockConntracker{
+			flows: []endpoint.Flow{flow},
+		}
+
+		have := report.MakeReport()
+		originalID := report.MakeEndpointNodeID("host1", "fd00::47:1", "80")
+		have.Topologies[report.Endpoint] = have.Topologies[report.Endpoint].AddNode(originalID, report.MakeNodeWith(map[string]string{
+			endpoint.Addr: "fd00::47:1",
+			endpoint.Port: "80",
+		}))
+
+		want := have.Copy()
+		want.Topologies[report.Endpoint] = want.Topologies[report.Endpoint].AddNode(report.MakeEndpointNodeID("host1", "2001:db8::1", "80"), report.MakeNodeWith(map[string]string{
+			endpoint.Addr: "2001:db8::1",
+			endpoint.Port: "80",
+			"copy_of":     originalID,
+		}))
+
+		natmapper := endpoint.NewNATMapper(ct)
+		natmapper.ApplyNAT(have, "host1")
+		if !reflect.DeepEqual(want, have) {
+			t.Fatal(test.Diff(want, have))
+		}
+	}
 }
@@ -2,7 +2,9 @@ package endpoint
 
 import (
 	"log"
+	"net"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -14,10 +16,11 @@ import (
 
 // Node metadata keys.
 const (
-	Addr        = "addr" // typically IPv4
+	Addr        = "addr" // IPv4 or IPv6, without brackets
 	Port        = "port"
 	Conntracked = "conntracked"
 	Procspied   = "procspied"
+	Listening   = "listening" // space-separated transports, e.g. "tcp udp"
 )
 
 // Reporter generates Reports containing the Endpoint topology.
@@ -27,8 +30,10 @@ type Reporter struct {
 	includeProcesses bool
 	includeNAT       bool
 	conntracker      Conntracker
+	listeners        ListenerWalker
 	natmapper        *NATMapper
 	revResolver      *ReverseResolver
+	dnsSnooper       *DNSSnooper
 }
 
 // SpyDuration is an exported prometheus metric
@@ -47,34 +52,50 @@ var SpyDuration = prometheus.NewSummaryVec(
 // generate a report.Report that contains every discovered (spied) connection
 // on the host machine, at the granularity of host and port. That information
 // is stored in the Endpoint topology. It optionally enriches that topology
-// with process (PID) information.
-func NewReporter(hostID, hostName string, includeProcesses bool, useConntrack bool) *Reporter {
+// with process (PID) information, and with the sockets listening for
+// connections, read from the proc filesystem at procRoot. Remote endpoints
+// are named after the names found by dnsSnooper, falling back to those found
+// by revResolver; either may be nil.
+func NewReporter(hostID, hostName string, includeProcesses bool, useConntrack bool, procRoot string, revResolver *ReverseResolver, dnsSnooper *DNSSnooper) *Reporter {
 	var (
 		conntrackModulePresent = ConntrackModulePresent()
 		conntracker            Conntracker
-		natmapper              NATMapper
-		err                    error
+		natmapper              *NATMapper
 	)
 	if conntrackModulePresent && useConntrack {
-		conntracker, err = NewConntracker(true)
-		if err != nil {
-			log.Printf("Failed to start conntracker: %v", err)
+		var cts []Conntracker
+		for _, family := range [][]string{IPv4, IPv6} {
+			ct, err := NewConntracker(true, family...)
+			if err != nil {
+				log.Printf("Failed to start conntracker: %v", err)
+				continue
+			}
+			cts = append(cts, ct)
 		}
+		conntracker = NewMultiConntracker(cts...)
 	}
 	if conntrackModulePresent {
-		ct, err := NewConntracker(true, "--any-nat")
-		if err != nil {
-			log.Printf("Failed to start conntracker for natmapper: %v", err)
+		var cts []Conntracker
+		for _, family := range [][]string{IPv4, IPv6} {
+			ct, err := NewConntracker(true, append([]string{"--any-nat"}, family...)...)
+			if err != nil {
+				log.Printf("Failed to start conntracker for natmapper: %v", err)
+				continue
+			}
+			cts = append(cts, ct)
 		}
-		natmapper = NewNATMapper(ct)
+		nm := NewNATMapper(NewMultiConntracker(cts...))
+		natmapper = &nm
 	}
 	return &Reporter{
 		hostID:           hostID,
 		hostName:         hostName,
 		includeProcesses: includeProcesses,
 		conntracker:      conntracker,
-		natmapper:        &natmapper,
-		revResolver:      NewReverseResolver(),
+		listeners:        NewListenerWalker(procRoot, includeProcesses),
+		natmapper:        natmapper,
+		revResolver:      revResolver,
+		dnsSnooper:       dnsSnooper,
 	}
 }
 
@@ -86,7 +107,12 @@ func (r *Reporter) Stop() {
 	if r.natmapper != nil {
 		r.natmapper.Stop()
 	}
-	r.revResolver.Stop()
+	if r.revResolver != nil {
+		r.revResolver.Stop()
+	}
+	if r.dnsSnooper != nil {
+		r.dnsSnooper.Stop()
+	}
 }
 
 // Report implements Reporter.
@@ -98,45 +124,75 @@ func (r *Reporter) Report() (report.Report, error) {
 	hostNodeID := report.MakeHostNodeID(r.hostID)
 	rpt := report.MakeReport()
 
+	// The processes of connections are those found walking the listening
+	// sockets, so the processes' file descriptors are only scanned once,
+	// unless they couldn't be walked, e.g. without a proc filesystem.
+	var listeners []Listener
+	spyProcesses := false
+	if err := r.listeners.Walk(func(l Listener) {
+		listeners = append(listeners, l)
+	}); err != nil {
+		log.Printf("Failed to walk listening sockets: %v", err)
+		spyProcesses = r.includeProcesses
+	}
+
+	var flows []Flow
+	if r.conntracker != nil {
+		r.conntracker.WalkFlows(func(f Flow) {
+			flows = append(flows, f)
+		})
+	}
+
 	{
-		conns, err := procspy.Connections(r.includeProcesses)
+		conns, err := procspy.Connections(spyProcesses)
 		if err != nil {
 			return rpt, err
 		}
-		commonNodeInfo := report.MakeNode().WithMetadata(report.Metadata{
+		commonNodeInfo := report.MakeNode().WithMetadata(map[string]string{
 			Procspied: "true",
 		})
+		directions := newDirectionInferer(listeners, flows)
 		for conn := conns.Next(); conn != nil; conn = conns.Next() {
 			var (
 				localPort  = conn.LocalPort
 				remotePort = conn.RemotePort
-				localAddr  = conn.LocalAddress.String()
-				remoteAddr = conn.RemoteAddress.String()
+				localAddr  = normalizeAddr(conn.LocalAddress.String())
+				remoteAddr = normalizeAddr(conn.RemoteAddress.String())
 			)
+			pid := uint64(conn.Proc.PID)
+			if pid == 0 && r.includeProcesses {
+				pid = uint64(r.listeners.ConnectionPID(conn.LocalAddress, localPort, conn.RemoteAddress, remotePort))
+			}
 			extraNodeInfo := commonNodeInfo.Copy()
-			if conn.Proc.PID > 0 {
-				extraNodeInfo = extraNodeInfo.WithMetadata(report.Metadata{
-					process.PID:       strconv.FormatUint(uint64(conn.Proc.PID), 10),
+			if pid > 0 {
+				extraNodeInfo = extraNodeInfo.WithMetadata(map[string]string{
+					process.PID:       strconv.FormatUint(pid, 10),
 					report.HostNodeID: hostNodeID,
 				})
 			}
-			r.addConnection(&rpt, localAddr, remoteAddr, localPort, remotePort, &extraNodeInfo, &commonNodeInfo)
+			localIsClient, inferredFrom := directions.infer(localAddr, remoteAddr, localPort, remotePort)
+			r.addConnection(&rpt, localAddr, remoteAddr, localPort, remotePort, localIsClient, inferredFrom, &extraNodeInfo, &commonNodeInfo)
 		}
 	}
 
+	if r.includeProcesses {
+		r.addListeners(&rpt, listeners)
+	}
+
 	if r.conntracker != nil {
-		extraNodeInfo := report.MakeNode().WithMetadata(report.Metadata{
+		extraNodeInfo := report.MakeNode().WithMetadata(map[string]string{
 			Conntracked: "true",
 		})
-		r.conntracker.WalkFlows(func(f Flow) {
+		for _, f := range flows {
 			var (
 				localPort  = uint16(f.Original.Layer4.SrcPort)
 				remotePort = uint16(f.Original.Layer4.DstPort)
-				localAddr  = f.Original.Layer3.SrcIP
-				remoteAddr = f.Original.Layer3.DstIP
+				localAddr  = normalizeAddr(f.Original.Layer3.SrcIP)
+				remoteAddr = normalizeAddr(f.Original.Layer3.DstIP)
 			)
-			r.addConnection(&rpt, localAddr, remoteAddr, localPort, remotePort, &extraNodeInfo, &extraNodeInfo)
-		})
+			// The original direction of a flow is from the client.
+			r.addConnection(&rpt, localAddr, remoteAddr, localPort, remotePort, true, report.DirectionFromConntrack, &extraNodeInfo, &extraNodeInfo)
+		}
 	}
 
 	if r.natmapper != nil {
@@ -146,8 +202,11 @@ func (r *Reporter) Report() (report.Report, error) {
 	return rpt, nil
 }
 
-func (r *Reporter) addConnection(rpt *report.Report, localAddr, remoteAddr string, localPort, remotePort uint16, extraLocalNode, extraRemoteNode *report.Node) {
-	localIsClient := int(localPort) > int(remotePort)
+func (r *Reporter) addConnection(rpt *report.Report, localAddr, remoteAddr string, localPort, remotePort uint16, localIsClient bool, inferredFrom string, extraLocalNode, extraRemoteNode *report.Node) {
+	edge := report.EdgeMetadata{
+		MaxConnCountTCP:       newu64(1),
+		DirectionInferredFrom: inferredFrom,
+	}
 
 	// Update address topology
 	{
@@ -163,24 +222,19 @@ func (r *Reporter) addConnection(rpt *report.Report, localAddr, remoteAddr strin
 			})
 		)
 
-		// In case we have a reverse resolution for the IP, we can use it for
-		// the name...
-		if revRemoteName, err := r.revResolver.Get(remoteAddr); err == nil {
+		// In case we have a name for the IP, we can use it for the name...
+		if remoteName, err := r.remoteName(remoteAddr); err == nil {
 			remoteNode = remoteNode.WithMetadata(map[string]string{
-				"name": revRemoteName,
+				"name": remoteName,
 			})
 		}
 
 		if localIsClient {
 			// New nodes are merged into the report so we don't need to do any
 			// counting here; the merge does it for us.
-			localNode = localNode.WithEdge(remoteAddressNodeID, report.EdgeMetadata{
-				MaxConnCountTCP: newu64(1),
-			})
+			localNode = localNode.WithEdge(remoteAddressNodeID, edge)
 		} else {
-			remoteNode = localNode.WithEdge(localAddressNodeID, report.EdgeMetadata{
-				MaxConnCountTCP: newu64(1),
-			})
+			remoteNode = remoteNode.WithEdge(localAddressNodeID, edge)
 		}
 
 		if extraLocalNode != nil {
@@ -189,8 +243,8 @@ func (r *Reporter) addConnection(rpt *report.Report, localAddr, remoteAddr strin
 		if extraRemoteNode != nil {
 			remoteNode = remoteNode.Merge(*extraRemoteNode)
 		}
-		rpt.Address = rpt.Address.AddNode(localAddressNodeID, localNode)
-		rpt.Address = rpt.Address.AddNode(remoteAddressNodeID, remoteNode)
+		rpt.Topologies[report.Address] = rpt.Topologies[report.Address].AddNode(localAddressNodeID, localNode)
+		rpt.Topologies[report.Address] = rpt.Topologies[report.Address].AddNode(remoteAddressNodeID, remoteNode)
 	}
 
 	// Update endpoint topology
@@ -209,24 +263,19 @@ func (r *Reporter) addConnection(rpt *report.Report, localAddr, remoteAddr strin
 			})
 		)
 
-		// In case we have a reverse resolution for the IP, we can use it for
-		// the name...
-		if revRemoteName, err := r.revResolver.Get(remoteAddr); err == nil {
+		// In case we have a name for the IP, we can use it for the name...
+		if remoteName, err := r.remoteName(remoteAddr); err == nil {
 			remoteNode = remoteNode.WithMetadata(map[string]string{
-				"name": revRemoteName,
+				"name": remoteName,
 			})
 		}
 
 		if localIsClient {
 			// New nodes are merged into the report so we don't need to do any
 			// counting here; the merge does it for us.
-			localNode = localNode.WithEdge(remoteEndpointNodeID, report.EdgeMetadata{
-				MaxConnCountTCP: newu64(1),
-			})
+			localNode = localNode.WithEdge(remoteEndpointNodeID, edge)
 		} else {
-			remoteNode = remoteNode.WithEdge(localEndpointNodeID, report.EdgeMetadata{
-				MaxConnCountTCP: newu64(1),
-			})
+			remoteNode = remoteNode.WithEdge(localEndpointNodeID, edge)
 		}
 
 		if extraLocalNode != nil {
@@ -235,9 +284,70 @@ func (r *Reporter) addConnection(rpt *report.Report, localAddr, remoteAddr strin
 		if extraRemoteNode != nil {
 			remoteNode = remoteNode.Merge(*extraRemoteNode)
 		}
-		rpt.Endpoint = rpt.Endpoint.AddNode(localEndpointNodeID, localNode)
-		rpt.Endpoint = rpt.Endpoint.AddNode(remoteEndpointNodeID, remoteNode)
+		rpt.Topologies[report.Endpoint] = rpt.Topologies[report.Endpoint].AddNode(localEndpointNodeID, localNode)
+		rpt.Topologies[report.Endpoint] = rpt.Topologies[report.Endpoint].AddNode(remoteEndpointNodeID, remoteNode)
+	}
+}
+
+// addListeners adds a node to the endpoint topology for every socket
+// listening for connections, so servers show up even when they have no
+// clients.
+func (r *Reporter) addListeners(rpt *report.Report, listeners []Listener) {
+	var (
+		hostNodeID = report.MakeHostNodeID(r.hostID)
+		transports = map[string][]string{} // node ID -> transports
+		nodes      = map[string]report.Node{}
+	)
+	for _, l := range listeners {
+		var (
+			addr   = l.Address.String()
+			port   = strconv.Itoa(int(l.Port))
+			nodeID = report.MakeEndpointNodeID(r.hostID, addr, port)
+			node   = report.MakeNodeWith(map[string]string{
+				Addr:              addr,
+				Port:              port,
+				Procspied:         "true",
+				report.HostNodeID: hostNodeID,
+			})
+		)
+		if l.PID > 0 {
+			node.Metadata = node.Metadata.Set(process.PID, strconv.Itoa(l.PID))
+		}
+		if existing, ok := nodes[nodeID]; ok {
+			node = existing.Merge(node)
+		}
+		nodes[nodeID] = node
+		transports[nodeID] = append(transports[nodeID], l.Transport)
+	}
+	for nodeID, node := range nodes {
+		ts := report.MakeIDList(transports[nodeID]...)
+		node.Metadata = node.Metadata.Set(Listening, strings.Join(ts, " "))
+		rpt.Topologies[report.Endpoint] = rpt.Topologies[report.Endpoint].AddNode(nodeID, node)
+	}
+}
+
+// remoteName returns the name a client used to look up the address, if the
+// DNS snooper saw it, or else the reverse resolution of the address.
+func (r *Reporter) remoteName(addr string) (string, error) {
+	if r.dnsSnooper != nil {
+		if name, err := r.dnsSnooper.Get(addr); err == nil {
+			return name, nil
+		}
+	}
+	if r.revResolver != nil {
+		return r.revResolver.Get(addr)
+	}
+	return "", errNotFound
+}
+
+// normalizeAddr returns the canonical textual form of an IP address, so that
+// the same IPv6 address (or IPv4-mapped IPv6 address) always produces the
+// same node IDs, whichever source it was read from.
+func normalizeAddr(addr string) string {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String()
 	}
+	return addr
 }
 
 func newu64(i uint64) *uint64 {
@@ -2,13 +2,19 @@ package endpoint_test
 
 import (
 	"net"
+	"os"
+	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/google/gopacket/layers"
 	"github.com/weaveworks/procspy"
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
 )
 
 var (
@@ -37,6 +43,35 @@ var (
 		},
 	}
 
+	fixLocalAddress6  = net.ParseIP("2001:db8::1")
+	fixRemoteAddress6 = net.ParseIP("2001:db8::2")
+	fixMappedAddress  = net.ParseIP("::ffff:192.168.1.3")
+
+	fixConnections6 = []procspy.Connection{
+		{
+			Transport:     "tcp",
+			LocalAddress:  fixLocalAddress6,
+			LocalPort:     fixLocalPort,
+			RemoteAddress: fixRemoteAddress6,
+			RemotePort:    fixRemotePort,
+			Proc: procspy.Proc{
+				PID:  fixProcessPID,
+				Name: fixProcessName,
+			},
+		},
+		{
+			Transport:     "tcp",
+			LocalAddress:  fixLocalAddress6,
+			LocalPort:     fixLocalPort,
+			RemoteAddress: fixMappedAddress,
+			RemotePort:    fixRemotePortB,
+			Proc: procspy.Proc{
+				PID:  fixProcessPID,
+				Name: fixProcessName,
+			},
+		},
+	}
+
 	fixConnectionsWithProcesses = []procspy.Connection{
 		{
 			Transport:     "tcp",
@@ -71,13 +106,13 @@ func TestSpyNoProcesses(t *testing.T) {
 		nodeName = "frenchs-since-1904"   // TODO rename to hostNmae
 	)
 
-	reporter := endpoint.NewReporter(nodeID, nodeName, false, false)
+	reporter := endpoint.NewReporter(nodeID, nodeName, false, false, "/nonexistent", nil, nil)
 	r, _ := reporter.Report()
 	//buf, _ := json.MarshalIndent(r, "", "    ")
 	//t.Logf("\n%s\n", buf)
 
 	// No process nodes, please
-	if want, have := 0, len(r.Endpoint.Nodes); want != have {
+	if want, have := 0, r.Topologies[report.Endpoint].Nodes.Size(); want != have {
 		t.Fatalf("want %d, have %d", want, have)
 	}
 
@@ -86,15 +121,15 @@ func TestSpyNoProcesses(t *testing.T) {
 		scopedRemote = report.MakeAddressNodeID(nodeID, fixRemoteAddress.String())
 	)
 
-	if want, have := nodeName, r.Address.Nodes[scopedLocal].Metadata[docker.Name]; want != have {
+	if want, have := nodeName, r.Topologies[report.Address].Nodes.Get(scopedLocal).Metadata.Get(docker.Name); want != have {
 		t.Fatalf("want %q, have %q", want, have)
 	}
 
-	if want, have := 1, len(r.Address.Nodes[scopedRemote].Adjacency); want != have {
+	if want, have := 1, len(r.Topologies[report.Address].Nodes.Get(scopedRemote).Adjacency); want != have {
 		t.Fatalf("want %d, have %d", want, have)
 	}
 
-	if want, have := scopedLocal, r.Address.Nodes[scopedRemote].Adjacency[0]; want != have {
+	if want, have := scopedLocal, r.Topologies[report.Address].Nodes.Get(scopedRemote).Adjacency[0]; want != have {
 		t.Fatalf("want %q, have %q", want, have)
 	}
 }
@@ -107,7 +142,7 @@ func TestSpyWithProcesses(t *testing.T) {
 		nodeName = "fishermans-friend" // TODO rename to hostNmae
 	)
 
-	reporter := endpoint.NewReporter(nodeID, nodeName, true, false)
+	reporter := endpoint.NewReporter(nodeID, nodeName, true, false, "/nonexistent", nil, nil)
 	r, _ := reporter.Report()
 	// buf, _ := json.MarshalIndent(r, "", "    ") ; t.Logf("\n%s\n", buf)
 
@@ -116,19 +151,189 @@ func TestSpyWithProcesses(t *testing.T) {
 		scopedRemote = report.MakeEndpointNodeID(nodeID, fixRemoteAddress.String(), strconv.Itoa(int(fixRemotePort)))
 	)
 
-	if want, have := 1, len(r.Endpoint.Nodes[scopedRemote].Adjacency); want != have {
+	if want, have := 1, len(r.Topologies[report.Endpoint].Nodes.Get(scopedRemote).Adjacency); want != have {
 		t.Fatalf("want %d, have %d", want, have)
 	}
 
-	if want, have := scopedLocal, r.Endpoint.Nodes[scopedRemote].Adjacency[0]; want != have {
+	if want, have := scopedLocal, r.Topologies[report.Endpoint].Nodes.Get(scopedRemote).Adjacency[0]; want != have {
 		t.Fatalf("want %q, have %q", want, have)
 	}
 
 	for key, want := range map[string]string{
 		"pid": strconv.FormatUint(uint64(fixProcessPID), 10),
 	} {
-		if have := r.Endpoint.Nodes[scopedLocal].Metadata[key]; want != have {
-			t.Errorf("Process.Nodes[%q][%q]: want %q, have %q", scopedLocal, key, want, have)
+		if have := r.Topologies[report.Endpoint].Nodes.Get(scopedLocal).Metadata.Get(key); want != have {
+			t.Errorf("Process.Nodes.Get(%q)[%q]: want %q, have %q", scopedLocal, key, want, have)
+		}
+	}
+}
+
+func TestSpyIPv6(t *testing.T) {
+	procspy.SetFixtures(fixConnections6)
+
+	const (
+		nodeID   = "heinz-tomato-ketchup"
+		nodeName = "frenchs-since-1904"
+	)
+
+	reporter := endpoint.NewReporter(nodeID, nodeName, true, false, "/nonexistent", nil, nil)
+	r, _ := reporter.Report()
+
+	var (
+		scopedLocal  = report.MakeEndpointNodeID(nodeID, "2001:db8::1", strconv.Itoa(int(fixLocalPort)))
+		scopedRemote = report.MakeEndpointNodeID(nodeID, "2001:db8::2", strconv.Itoa(int(fixRemotePort)))
+		scopedMapped = report.MakeEndpointNodeID(nodeID, "192.168.1.3", strconv.Itoa(int(fixRemotePortB)))
+	)
+
+	if want, have := "2001:db8::1", r.Topologies[report.Endpoint].Nodes.Get(scopedLocal).Metadata.Get(endpoint.Addr); want != have {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+
+	if want, have := report.MakeIDList(scopedLocal), r.Topologies[report.Endpoint].Nodes.Get(scopedRemote).Adjacency; !reflect.DeepEqual(want, have) {
+		t.Fatalf("want %v, have %v", want, have)
+	}
+
+	// IPv4-mapped IPv6 addresses are reported as plain IPv4 addresses.
+	if want, have := "192.168.1.3", r.Topologies[report.Endpoint].Nodes.Get(scopedMapped).Metadata.Get(endpoint.Addr); want != have {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+}
+
+func TestSpyListening(t *testing.T) {
+	procspy.SetFixtures(nil)
+	procRoot := makeProcRoot(t)
+	defer os.RemoveAll(procRoot)
+
+	const nodeID = "heinz-tomato-ketchup"
+	reporter := endpoint.NewReporter(nodeID, "frenchs-since-1904", true, false, procRoot, nil, nil)
+	r, _ := reporter.Report()
+
+	for id, want := range map[string]map[string]string{
+		report.MakeEndpointNodeID(nodeID, "0.0.0.0", "80"): {
+			endpoint.Addr:      "0.0.0.0",
+			endpoint.Port:      "80",
+			endpoint.Listening: "tcp",
+			process.PID:        "42",
+		},
+		report.MakeEndpointNodeID(nodeID, "0.0.0.0", "53"): {
+			endpoint.Listening: "udp",
+			process.PID:        "42",
+		},
+		report.MakeEndpointNodeID(nodeID, "2001:db8::1", "443"): {
+			endpoint.Addr:      "2001:db8::1",
+			endpoint.Listening: "tcp",
+			process.PID:        "43",
+		},
+	} {
+		node, ok := r.Topologies[report.Endpoint].Nodes.Lookup(id)
+		if !ok {
+			t.Errorf("%q: missing", id)
+			continue
 		}
+		for key, value := range want {
+			if have := node.Metadata.Get(key); value != have {
+				t.Errorf("%q[%q]: want %q, have %q", id, key, value, have)
+			}
+		}
+	}
+
+	// Established connections aren't listeners
+	if _, ok := r.Topologies[report.Endpoint].Nodes.Lookup(report.MakeEndpointNodeID(nodeID, "192.168.1.1", "80")); ok {
+		t.Errorf("unexpected node for established connection")
+	}
+}
+
+func TestSpyDirection(t *testing.T) {
+	procRoot := makeProcRoot(t) // listening on 0.0.0.0:80 and 127.0.0.1:8080
+	defer os.RemoveAll(procRoot)
+
+	procspy.SetFixtures([]procspy.Connection{
+		{
+			// A client with a low port, connecting to a local server
+			Transport:     "tcp",
+			LocalAddress:  net.ParseIP("127.0.0.1"),
+			LocalPort:     1024,
+			RemoteAddress: net.ParseIP("127.0.0.1"),
+			RemotePort:    8080,
+		},
+		{
+			// A remote client connecting to a listening socket
+			Transport:     "tcp",
+			LocalAddress:  fixLocalAddress,
+			LocalPort:     fixLocalPort,
+			RemoteAddress: fixRemoteAddress,
+			RemotePort:    fixRemotePort,
+		},
+		{
+			// Nothing known about either end
+			Transport:     "tcp",
+			LocalAddress:  fixLocalAddress,
+			LocalPort:     2000,
+			RemoteAddress: fixRemoteAddress,
+			RemotePort:    1000,
+		},
+	})
+
+	const nodeID = "heinz-tomato-ketchup"
+	reporter := endpoint.NewReporter(nodeID, "frenchs-since-1904", true, false, procRoot, nil, nil)
+	r, _ := reporter.Report()
+
+	for _, c := range []struct {
+		src, dst     string
+		inferredFrom string
+	}{
+		{
+			src:          report.MakeEndpointNodeID(nodeID, "127.0.0.1", "1024"),
+			dst:          report.MakeEndpointNodeID(nodeID, "127.0.0.1", "8080"),
+			inferredFrom: report.DirectionFromListening,
+		},
+		{
+			src:          report.MakeEndpointNodeID(nodeID, fixRemoteAddress.String(), strconv.Itoa(int(fixRemotePort))),
+			dst:          report.MakeEndpointNodeID(nodeID, fixLocalAddress.String(), strconv.Itoa(int(fixLocalPort))),
+			inferredFrom: report.DirectionFromListening,
+		},
+		{
+			src:          report.MakeEndpointNodeID(nodeID, fixLocalAddress.String(), "2000"),
+			dst:          report.MakeEndpointNodeID(nodeID, fixRemoteAddress.String(), "1000"),
+			inferredFrom: report.DirectionFromPorts,
+		},
+	} {
+		if want, have := report.MakeIDList(c.dst), r.Topologies[report.Endpoint].Nodes.Get(c.src).Adjacency; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want adjacency %v, have %v", c.src, want, have)
+		}
+		if adj := r.Topologies[report.Endpoint].Nodes.Get(c.dst).Adjacency; len(adj) != 0 {
+			t.Errorf("%s: want no adjacency, have %v", c.dst, adj)
+		}
+		if want, have := c.inferredFrom, r.Topologies[report.Endpoint].Nodes.Get(c.src).Edges.Get(c.dst).DirectionInferredFrom; want != have {
+			t.Errorf("%s: want direction inferred from %q, have %q", c.src, want, have)
+		}
+	}
+}
+
+func TestSpyDNSSnooping(t *testing.T) {
+	procspy.SetFixtures(fixConnections)
+
+	snooper := endpoint.NewDNSSnooperFromSources(newMockSource(
+		dnsResponse(t, layers.DNSResponseCodeNoErr, "db.example.com", layers.DNSResourceRecord{
+			Name: []byte("db.example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, IP: fixRemoteAddress.To4(),
+		}),
+	))
+	test.Poll(t, 100*time.Millisecond, "db.example.com", func() interface{} {
+		name, _ := snooper.Get(fixRemoteAddress.String())
+		return name
+	})
+
+	const nodeID = "heinz-tomato-ketchup"
+	reporter := endpoint.NewReporter(nodeID, "frenchs-since-1904", true, false, "/nonexistent", nil, snooper)
+	defer reporter.Stop()
+	r, _ := reporter.Report()
+
+	scopedRemote := report.MakeEndpointNodeID(nodeID, fixRemoteAddress.String(), strconv.Itoa(int(fixRemotePort)))
+	if want, have := "db.example.com", r.Topologies[report.Endpoint].Nodes.Get(scopedRemote).Metadata.Get("name"); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	remoteAddress := report.MakeAddressNodeID(nodeID, fixRemoteAddress.String())
+	if want, have := "db.example.com", r.Topologies[report.Address].Nodes.Get(remoteAddress).Metadata.Get("name"); want != have {
+		t.Errorf("want %q, have %q", want, have)
 	}
 }
@@ -1,79 +1,198 @@
 package endpoint
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluele/gcache"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
-	rAddrCacheLen        = 500 // Default cache length
-	rAddrBacklog         = 1000
-	rAddrCacheExpiration = 30 * time.Minute
+	rAddrCacheLen           = 500 // Default cache length
+	rAddrBacklog            = 1000
+	rAddrCacheExpiration    = 30 * time.Minute
+	rAddrNegativeExpiration = 5 * time.Minute
+	rAddrRate               = 10 // Default lookups per second
+	rAddrLookupTimeout      = 5 * time.Second
 )
 
 var errNotFound = fmt.Errorf("Not found")
 
+// ReverseResolverRequests is an exported prometheus metric
+var ReverseResolverRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "scope",
+		Subsystem: "probe",
+		Name:      "reverse_resolver_requests_total",
+		Help:      "Requests to the reverse resolver, by result: hit (cached), miss (lookup queued) or dropped (backlog full).",
+	},
+	[]string{"result"},
+)
+
+// ReverseResolverLookupDuration is an exported prometheus metric
+var ReverseResolverLookupDuration = prometheus.NewSummaryVec(
+	prometheus.SummaryOpts{
+		Namespace: "scope",
+		Subsystem: "probe",
+		Name:      "reverse_resolver_lookup_time_nanoseconds",
+		Help:      "Time spent on reverse DNS lookups, by result: success or failure.",
+		MaxAge:    10 * time.Second, // like statsd
+	},
+	[]string{"result"},
+)
+
 type revResFunc func(addr string) (names []string, err error)
 
+// ReverseResolverConfig configures a ReverseResolver. Fields left as zero
+// values get the defaults.
+type ReverseResolverConfig struct {
+	Servers     []string      // DNS servers as host[:port]; the system resolver if empty
+	CacheSize   int           // Maximum number of cached addresses
+	PositiveTTL time.Duration // How long to cache names for
+	NegativeTTL time.Duration // How long to cache failed lookups for
+	Backlog     int           // Maximum number of queued lookups
+	Rate        int           // Maximum number of lookups per second
+}
+
+func (c ReverseResolverConfig) withDefaults() ReverseResolverConfig {
+	if c.CacheSize <= 0 {
+		c.CacheSize = rAddrCacheLen
+	}
+	if c.PositiveTTL <= 0 {
+		c.PositiveTTL = rAddrCacheExpiration
+	}
+	if c.NegativeTTL <= 0 {
+		c.NegativeTTL = rAddrNegativeExpiration
+	}
+	if c.Backlog <= 0 {
+		c.Backlog = rAddrBacklog
+	}
+	if c.Rate <= 0 {
+		c.Rate = rAddrRate
+	}
+	return c
+}
+
+// cacheEntry is a cached lookup; an empty name means the lookup failed.
+type cacheEntry struct {
+	name    string
+	expires time.Time
+}
+
 // ReverseResolver is a caching, reverse resolver.
 type ReverseResolver struct {
-	addresses chan string
-	cache     gcache.Cache
-	Throttle  <-chan time.Time // Made public for mocking
-	Resolver  revResFunc
+	addresses   chan string
+	cache       gcache.Cache
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	Throttle    <-chan time.Time // Made public for mocking
+	Resolver    revResFunc
 }
 
 // NewReverseResolver starts a new reverse resolver that performs reverse
 // resolutions and caches the result.
-func NewReverseResolver() *ReverseResolver {
+func NewReverseResolver(config ReverseResolverConfig) *ReverseResolver {
+	config = config.withDefaults()
+	expiration := config.PositiveTTL
+	if config.NegativeTTL > expiration {
+		expiration = config.NegativeTTL
+	}
 	r := ReverseResolver{
-		addresses: make(chan string, rAddrBacklog),
-		cache:     gcache.New(rAddrCacheLen).LRU().Expiration(rAddrCacheExpiration).Build(),
-		Throttle:  time.Tick(time.Second / 10),
-		Resolver:  net.LookupAddr,
+		addresses:   make(chan string, config.Backlog),
+		cache:       gcache.New(config.CacheSize).LRU().Expiration(expiration).Build(),
+		positiveTTL: config.PositiveTTL,
+		negativeTTL: config.NegativeTTL,
+		Throttle:    time.Tick(time.Second / time.Duration(config.Rate)),
+		Resolver:    lookupAddrFunc(config.Servers),
 	}
 	go r.loop()
 	return &r
 }
 
-// Get the reverse resolution for an IP address if already in the cache, a
-// gcache.NotFoundKeyError error otherwise. Note: it returns one of the
-// possible names that can be obtained for that IP.
-func (r *ReverseResolver) Get(address string) (string, error) {
-	val, err := r.cache.Get(address)
-	if hostname, ok := val.(string); err == nil && ok {
-		return hostname, nil
+// lookupAddrFunc returns a revResFunc which queries the given DNS servers in
+// turn, or the system resolver if there are none.
+func lookupAddrFunc(servers []string) revResFunc {
+	if len(servers) == 0 {
+		return net.LookupAddr
 	}
-	if _, ok := val.(struct{}); err == nil && ok {
-		return "", errNotFound
+	addrs := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		addrs = append(addrs, server)
 	}
-	if err == gcache.NotFoundKeyError {
-		// We trigger a asynchronous reverse resolution when not cached
-		select {
-		case r.addresses <- address:
-		default:
+	var (
+		next     uint32
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addrs[atomic.AddUint32(&next, 1)%uint32(len(addrs))])
+			},
 		}
+	)
+	return func(addr string) ([]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), rAddrLookupTimeout)
+		defer cancel()
+		return resolver.LookupAddr(ctx, addr)
+	}
+}
+
+// Get the reverse resolution for an IP address if already in the cache, an
+// error otherwise. Note: it returns one of the possible names that can be
+// obtained for that IP.
+func (r *ReverseResolver) Get(address string) (string, error) {
+	if entry, ok := r.cached(address); ok {
+		ReverseResolverRequests.WithLabelValues("hit").Inc()
+		if entry.name == "" {
+			return "", errNotFound
+		}
+		return entry.name, nil
+	}
+	// We trigger a asynchronous reverse resolution when not cached
+	select {
+	case r.addresses <- address:
+		ReverseResolverRequests.WithLabelValues("miss").Inc()
+	default:
+		ReverseResolverRequests.WithLabelValues("dropped").Inc()
 	}
 	return "", errNotFound
 }
 
+func (r *ReverseResolver) cached(address string) (cacheEntry, bool) {
+	val, err := r.cache.Get(address)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	entry, ok := val.(cacheEntry)
+	if !ok || time.Now().After(entry.expires) {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
 func (r *ReverseResolver) loop() {
 	for request := range r.addresses {
 		// check if the answer is already in the cache
-		if _, err := r.cache.Get(request); err == nil {
+		if _, ok := r.cached(request); ok {
 			continue
 		}
 		<-r.Throttle // rate limit our DNS resolutions
+		begin := time.Now()
 		names, err := r.Resolver(request)
 		if err == nil && len(names) > 0 {
+			ReverseResolverLookupDuration.WithLabelValues("success").Observe(float64(time.Since(begin)))
 			name := strings.TrimRight(names[0], ".")
-			r.cache.Set(request, name)
+			r.cache.Set(request, cacheEntry{name: name, expires: time.Now().Add(r.positiveTTL)})
 		} else {
-			r.cache.Set(request, struct{}{})
+			ReverseResolverLookupDuration.WithLabelValues("failure").Observe(float64(time.Since(begin)))
+			r.cache.Set(request, cacheEntry{expires: time.Now().Add(r.negativeTTL)})
 		}
 	}
 }
@@ -2,9 +2,14 @@ package endpoint_test
 
 import (
 	"errors"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	dto "github.com/prometheus/client_model/go"
+
 	. "github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/test"
 )
@@ -15,7 +20,7 @@ func TestReverseResolver(t *testing.T) {
 		"4.3.2.1": "im.a.little.tea.pot",
 	}
 
-	revRes := NewReverseResolver()
+	revRes := NewReverseResolver(ReverseResolverConfig{})
 	defer revRes.Stop()
 
 	// Use a mocked resolver function.
@@ -36,3 +41,100 @@ func TestReverseResolver(t *testing.T) {
 		})
 	}
 }
+
+func TestReverseResolverNegativeTTL(t *testing.T) {
+	revRes := NewReverseResolver(ReverseResolverConfig{NegativeTTL: 10 * time.Millisecond})
+	defer revRes.Stop()
+
+	// The first lookup fails; later ones succeed.
+	failed := false
+	revRes.Resolver = func(addr string) ([]string, error) {
+		if !failed {
+			failed = true
+			return nil, errors.New("timeout")
+		}
+		return []string{"test.domain.name."}, nil
+	}
+	revRes.Throttle = time.Tick(time.Millisecond)
+
+	test.Poll(t, 100*time.Millisecond, "test.domain.name", func() interface{} {
+		result, _ := revRes.Get("1.2.3.4")
+		return result
+	})
+}
+
+func TestReverseResolverBacklog(t *testing.T) {
+	revRes := NewReverseResolver(ReverseResolverConfig{Backlog: 1})
+	defer revRes.Stop()
+	revRes.Throttle = make(chan time.Time) // never resolve anything
+
+	before := droppedRequests(t)
+	for _, ip := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4"} {
+		if _, err := revRes.Get(ip); err == nil {
+			t.Errorf("%s: expected error", ip)
+		}
+	}
+	// At most one is being resolved and one is queued; the rest are dropped.
+	if dropped := droppedRequests(t) - before; dropped < 2 || dropped > 3 {
+		t.Errorf("want 2 or 3 dropped requests, have %v", dropped)
+	}
+}
+
+func droppedRequests(t *testing.T) float64 {
+	var m dto.Metric
+	if err := ReverseResolverRequests.WithLabelValues("dropped").Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestReverseResolverServers(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go serveFakePTR(conn, "4.3.2.1.in-addr.arpa", "im.a.little.tea.pot.")
+
+	revRes := NewReverseResolver(ReverseResolverConfig{Servers: []string{conn.LocalAddr().String()}})
+	defer revRes.Stop()
+	revRes.Throttle = time.Tick(time.Millisecond)
+
+	test.Poll(t, time.Second, "im.a.little.tea.pot", func() interface{} {
+		result, _ := revRes.Get("1.2.3.4")
+		return result
+	})
+}
+
+// serveFakePTR answers every PTR query for name with ptr.
+func serveFakePTR(conn net.PacketConn, name, ptr string) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var query layers.DNS
+		if err := query.DecodeFromBytes(buf[:n], gopacket.NilDecodeFeedback); err != nil || len(query.Questions) == 0 {
+			continue
+		}
+		response := query
+		response.QR = true
+		response.RA = true
+		response.Answers = nil
+		response.Authorities = nil
+		response.Additionals = nil
+		if q := query.Questions[0]; q.Type == layers.DNSTypePTR && string(q.Name) == name {
+			response.Answers = []layers.DNSResourceRecord{{
+				Name: q.Name, Type: layers.DNSTypePTR, Class: layers.DNSClassIN, TTL: 60, PTR: []byte(ptr),
+			}}
+		} else {
+			response.ResponseCode = layers.DNSResponseCodeNXDomain
+		}
+		out := gopacket.NewSerializeBuffer()
+		if err := response.SerializeTo(out, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+			continue
+		}
+		conn.WriteTo(out.Bytes(), addr)
+	}
+}
@@ -17,6 +17,8 @@ const (
 	Load          = "load"
 	KernelVersion = "kernel_version"
 	Uptime        = "uptime"
+
+	EphemeralPorts = "ephemeral_ports" // e.g. "32768-60999"
 )
 
 // Exposed for testing.
@@ -68,7 +70,7 @@ func (r *Reporter) Report() (report.Report, error) {
 		return rep, err
 	}
 
-	rep.Host.AddNode(report.MakeHostNodeID(r.hostID), report.MakeNodeWith(map[string]string{
+	node := report.MakeNodeWith(map[string]string{
 		Timestamp:     Now(),
 		HostName:      r.hostName,
 		LocalNetworks: strings.Join(localCIDRs, " "),
@@ -76,7 +78,15 @@ func (r *Reporter) Report() (report.Report, error) {
 		Load:          GetLoad(),
 		KernelVersion: kernel,
 		Uptime:        uptime.String(),
-	}))
+	})
+
+	// Not knowing the ephemeral port range isn't fatal; the renderer falls
+	// back to a default.
+	if ports, err := GetEphemeralPorts(); err == nil {
+		node.Metadata = node.Metadata.Set(EphemeralPorts, ports)
+	}
+
+	rep.Topologies[report.Host] = rep.Topologies[report.Host].AddNode(report.MakeHostNodeID(r.hostID), node)
 
 	return rep, nil
 }
@@ -23,6 +23,7 @@ func TestReporter(t *testing.T) {
 		load        = "0.59 0.36 0.29"
 		uptime      = "278h55m43s"
 		kernel      = "release version"
+		ephemeral   = "32768-60999"
 		_, ipnet, _ = net.ParseCIDR(network)
 		localNets   = report.Networks([]*net.IPNet{ipnet})
 	)
@@ -32,27 +33,31 @@ func TestReporter(t *testing.T) {
 		oldGetLoad          = host.GetLoad
 		oldGetUptime        = host.GetUptime
 		oldNow              = host.Now
+		oldGetEphemeral     = host.GetEphemeralPorts
 	)
 	defer func() {
 		host.GetKernelVersion = oldGetKernelVersion
 		host.GetLoad = oldGetLoad
 		host.GetUptime = oldGetUptime
 		host.Now = oldNow
+		host.GetEphemeralPorts = oldGetEphemeral
 	}()
 	host.GetKernelVersion = func() (string, error) { return release + " " + version, nil }
 	host.GetLoad = func() string { return load }
 	host.GetUptime = func() (time.Duration, error) { return time.ParseDuration(uptime) }
 	host.Now = func() string { return now }
+	host.GetEphemeralPorts = func() (string, error) { return ephemeral, nil }
 
 	want := report.MakeReport()
-	want.Host.AddNode(report.MakeHostNodeID(hostID), report.MakeNodeWith(map[string]string{
-		host.Timestamp:     now,
-		host.HostName:      hostname,
-		host.LocalNetworks: network,
-		host.OS:            runtime.GOOS,
-		host.Load:          load,
-		host.Uptime:        uptime,
-		host.KernelVersion: kernel,
+	want.Topologies[report.Host] = want.Topologies[report.Host].AddNode(report.MakeHostNodeID(hostID), report.MakeNodeWith(map[string]string{
+		host.Timestamp:      now,
+		host.HostName:       hostname,
+		host.LocalNetworks:  network,
+		host.OS:             runtime.GOOS,
+		host.Load:           load,
+		host.Uptime:         uptime,
+		host.KernelVersion:  kernel,
+		host.EphemeralPorts: ephemeral,
 	}))
 	have, _ := host.NewReporter(hostID, hostname, localNets).Report()
 	if !reflect.DeepEqual(want, have) {
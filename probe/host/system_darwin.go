@@ -5,6 +5,7 @@ import (
 	"os/exec"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -64,3 +65,17 @@ var GetUptime = func() (time.Duration, error) {
 	}
 	return (time.Duration(d) * 24 * time.Hour) + (time.Duration(h) * time.Hour) + (time.Duration(m) * time.Minute), nil
 }
+
+// GetEphemeralPorts returns the range of ports the kernel picks local ports
+// from, e.g. "49152-65535".
+var GetEphemeralPorts = func() (string, error) {
+	out, err := exec.Command("sysctl", "-n", "net.inet.ip.portrange.first", "net.inet.ip.portrange.last").Output()
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return "", fmt.Errorf("invalid format: %s", string(out))
+	}
+	return fmt.Sprintf("%s-%s", fields[0], fields[1]), nil
+}
@@ -77,3 +77,17 @@ var GetUptime = func() (time.Duration, error) {
 
 	return time.Duration(uptime) * time.Second, nil
 }
+
+// GetEphemeralPorts returns the range of ports the kernel picks local ports
+// from, e.g. "32768-60999".
+var GetEphemeralPorts = func() (string, error) {
+	buf, err := ioutil.ReadFile("/proc/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(buf))
+	if len(fields) != 2 {
+		return "", fmt.Errorf("invalid format: %s", string(buf))
+	}
+	return fmt.Sprintf("%s-%s", fields[0], fields[1]), nil
+}
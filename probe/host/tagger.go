@@ -21,10 +21,12 @@ func (t Tagger) Tag(r report.Report) (report.Report, error) {
 
 	// Explicity don't tag Endpoints and Addresses - These topologies include pseudo nodes,
 	// and as such do their own host tagging
-	for _, topology := range []report.Topology{r.Process, r.Container, r.ContainerImage, r.Host, r.Overlay} {
-		for id := range topology.Nodes {
-			topology.AddNode(id, other)
-		}
+	for _, name := range []string{report.Process, report.Container, report.ContainerImage, report.Host, report.Overlay} {
+		topology := r.Topologies[name]
+		topology.Nodes.ForEach(func(id string, _ report.Node) {
+			topology = topology.AddNode(id, other)
+		})
+		r.Topologies[name] = topology
 	}
 	return r, nil
 }
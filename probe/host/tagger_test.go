@@ -17,12 +17,12 @@ func TestTagger(t *testing.T) {
 	)
 
 	r := report.MakeReport()
-	r.Process.AddNode(endpointNodeID, nodeMetadata)
+	r.Topologies[report.Process] = r.Topologies[report.Process].AddNode(endpointNodeID, nodeMetadata)
 	want := nodeMetadata.Merge(report.MakeNodeWith(map[string]string{
 		report.HostNodeID: report.MakeHostNodeID(hostID),
 	}))
 	rpt, _ := host.NewTagger(hostID).Tag(r)
-	have := rpt.Process.Nodes[endpointNodeID].Copy()
+	have := rpt.Topologies[report.Process].Nodes.Get(endpointNodeID).Copy()
 	if !reflect.DeepEqual(want, have) {
 		t.Error(test.Diff(want, have))
 	}
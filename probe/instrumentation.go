@@ -23,5 +23,7 @@ var (
 func makePrometheusHandler() http.Handler {
 	prometheus.MustRegister(publishTicks)
 	prometheus.MustRegister(endpoint.SpyDuration)
+	prometheus.MustRegister(endpoint.ReverseResolverRequests)
+	prometheus.MustRegister(endpoint.ReverseResolverLookupDuration)
 	return prometheus.Handler()
 }
@@ -0,0 +1,153 @@
+package kubernetes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Paths of the service account credentials mounted into every pod, used
+// when the probe runs inside the cluster.
+const (
+	serviceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCA    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// Client keeps track of the pods and services in a Kubernetes cluster.
+type Client interface {
+	Stop()
+	WalkPods(f func(Pod))
+	WalkServices(f func(Service))
+}
+
+type client struct {
+	sync.RWMutex
+	quit     chan struct{}
+	interval time.Duration
+	url      string
+	token    string
+	http     *http.Client
+
+	pods     []Pod
+	services []Service
+}
+
+// DefaultAPIServer returns the address of the API server of the cluster the
+// probe is running in, as advertised to every pod through its environment,
+// or the address of a local, insecure API server otherwise.
+func DefaultAPIServer() string {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return "http://localhost:8080"
+	}
+	return "https://" + net.JoinHostPort(host, port)
+}
+
+// NewClient returns a Client which lists the pods and services known to the
+// API server at addr every interval. When running in a pod, the pod's
+// service account is used to authenticate. Don't forget to Stop it.
+func NewClient(addr string, interval time.Duration) (Client, error) {
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		return nil, fmt.Errorf("invalid Kubernetes API server address %q", addr)
+	}
+
+	c := &client{
+		quit:     make(chan struct{}),
+		interval: interval,
+		url:      strings.TrimRight(addr, "/"),
+		http:     &http.Client{Timeout: interval},
+	}
+	if token, err := ioutil.ReadFile(serviceAccountToken); err == nil {
+		c.token = strings.TrimSpace(string(token))
+	}
+	if ca, err := ioutil.ReadFile(serviceAccountCA); err == nil {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		c.http.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+
+	go c.loop()
+	return c, nil
+}
+
+func (c *client) Stop() {
+	close(c.quit)
+}
+
+func (c *client) loop() {
+	c.update()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.update()
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+func (c *client) update() {
+	var pods podList
+	if err := c.get("/api/v1/pods", &pods); err != nil {
+		log.Printf("kubernetes: %v", err)
+		return
+	}
+	var services serviceList
+	if err := c.get("/api/v1/services", &services); err != nil {
+		log.Printf("kubernetes: %v", err)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.pods = pods.Items
+	c.services = services.Items
+}
+
+func (c *client) get(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Add("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: got %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *client) WalkPods(f func(Pod)) {
+	c.RLock()
+	defer c.RUnlock()
+	for _, pod := range c.pods {
+		f(pod)
+	}
+}
+
+func (c *client) WalkServices(f func(Service)) {
+	c.RLock()
+	defer c.RUnlock()
+	for _, service := range c.services {
+		f(service)
+	}
+}
@@ -0,0 +1,111 @@
+package kubernetes
+
+import (
+	"strings"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Metadata.
+const (
+	PodID           = "kubernetes_pod_id"
+	PodName         = "kubernetes_pod_name"
+	PodCreated      = "kubernetes_pod_created"
+	PodIP           = "kubernetes_pod_ip"
+	PodState        = "kubernetes_pod_state"
+	PodContainerIDs = "kubernetes_pod_container_ids"
+	ServiceIDs      = "kubernetes_service_ids"
+	Namespace       = "kubernetes_namespace"
+	PodLabelPrefix  = "kubernetes_pod_label_" // followed by the label's key
+)
+
+// ObjectMeta is the metadata common to all Kubernetes objects.
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace"`
+	UID               string            `json:"uid,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	CreationTimestamp string            `json:"creationTimestamp,omitempty"`
+}
+
+// Pod is the subset of a Kubernetes pod, as returned by the API server, that
+// the probe reports.
+type Pod struct {
+	ObjectMeta `json:"metadata"`
+	Status     PodStatus `json:"status"`
+}
+
+// PodStatus is the observed state of a pod.
+type PodStatus struct {
+	Phase             string            `json:"phase,omitempty"`
+	PodIP             string            `json:"podIP,omitempty"`
+	ContainerStatuses []ContainerStatus `json:"containerStatuses,omitempty"`
+}
+
+// ContainerStatus is the observed state of a container in a pod. The
+// container ID is prefixed with the runtime, e.g. "docker://".
+type ContainerStatus struct {
+	Name        string `json:"name"`
+	ContainerID string `json:"containerID,omitempty"`
+}
+
+type podList struct {
+	Items []Pod `json:"items"`
+}
+
+// ID returns the node ID of the pod in the Pod topology.
+func (p Pod) ID() string {
+	return report.MakePodNodeID(p.Namespace, p.Name)
+}
+
+// ContainerIDs returns the (Docker) IDs of the containers in the pod.
+func (p Pod) ContainerIDs() []string {
+	ids := []string{}
+	for _, status := range p.Status.ContainerStatuses {
+		if i := strings.Index(status.ContainerID, "://"); i >= 0 {
+			ids = append(ids, status.ContainerID[i+3:])
+		}
+	}
+	return ids
+}
+
+// GetNode returns the Node representing the pod, given the services which
+// select it.
+func (p Pod) GetNode(services []Service) report.Node {
+	serviceIDs := report.MakeIDList()
+	for _, s := range services {
+		if s.Namespace == p.Namespace && s.Selects(p) {
+			serviceIDs = serviceIDs.Add(s.ID())
+		}
+	}
+
+	nmd := report.MakeNodeWith(map[string]string{
+		PodID:           p.ID(),
+		PodName:         p.Name,
+		Namespace:       p.Namespace,
+		PodCreated:      p.CreationTimestamp,
+		PodState:        p.Status.Phase,
+		PodContainerIDs: strings.Join(p.ContainerIDs(), " "),
+	})
+	if p.Status.PodIP != "" {
+		nmd.Metadata = nmd.Metadata.Set(PodIP, p.Status.PodIP)
+	}
+	if len(serviceIDs) > 0 {
+		nmd.Metadata = nmd.Metadata.Set(ServiceIDs, strings.Join(serviceIDs, " "))
+	}
+	for key, value := range p.Labels {
+		nmd.Metadata = nmd.Metadata.Set(PodLabelPrefix+key, value)
+	}
+	return nmd
+}
+
+// ExtractPodLabels returns the labels of the pod given its Node.
+func ExtractPodLabels(nmd report.Node) map[string]string {
+	result := map[string]string{}
+	nmd.Metadata.ForEach(func(key, value string) {
+		if strings.HasPrefix(key, PodLabelPrefix) {
+			result[key[len(PodLabelPrefix):]] = value
+		}
+	})
+	return result
+}
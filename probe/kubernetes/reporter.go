@@ -0,0 +1,45 @@
+package kubernetes
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// Reporter generate Reports containing Pod, Service and Namespace topologies
+type Reporter struct {
+	client Client
+}
+
+// NewReporter makes a new Reporter
+func NewReporter(client Client) *Reporter {
+	return &Reporter{
+		client: client,
+	}
+}
+
+// Report generates a Report containing Pod, Service and Namespace topologies
+func (r *Reporter) Report() (report.Report, error) {
+	result := report.MakeReport()
+
+	services := []Service{}
+	r.client.WalkServices(func(s Service) {
+		services = append(services, s)
+	})
+
+	for _, s := range services {
+		result.Topologies[report.Service] = result.Topologies[report.Service].AddNode(s.ID(), s.GetNode())
+		result.Topologies[report.Namespace] = addNamespace(result.Topologies[report.Namespace], s.Namespace)
+	}
+
+	r.client.WalkPods(func(p Pod) {
+		result.Topologies[report.Pod] = result.Topologies[report.Pod].AddNode(p.ID(), p.GetNode(services))
+		result.Topologies[report.Namespace] = addNamespace(result.Topologies[report.Namespace], p.Namespace)
+	})
+
+	return result, nil
+}
+
+func addNamespace(t report.Topology, namespace string) report.Topology {
+	return t.AddNode(report.MakeNamespaceNodeID(namespace), report.MakeNodeWith(map[string]string{
+		Namespace: namespace,
+	}))
+}
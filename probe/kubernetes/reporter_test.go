@@ -0,0 +1,166 @@
+package kubernetes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+type mockClient struct {
+	pods     []kubernetes.Pod
+	services []kubernetes.Service
+}
+
+func (c *mockClient) Stop() {}
+
+func (c *mockClient) WalkPods(f func(kubernetes.Pod)) {
+	for _, p := range c.pods {
+		f(p)
+	}
+}
+
+func (c *mockClient) WalkServices(f func(kubernetes.Service)) {
+	for _, s := range c.services {
+		f(s)
+	}
+}
+
+var (
+	pod1 = kubernetes.Pod{
+		ObjectMeta: kubernetes.ObjectMeta{
+			Name:              "pong-a",
+			Namespace:         "ping",
+			Labels:            map[string]string{"ponger": "true"},
+			CreationTimestamp: "2015-09-01T12:00:00Z",
+		},
+		Status: kubernetes.PodStatus{
+			Phase: "Running",
+			PodIP: "10.10.10.10",
+			ContainerStatuses: []kubernetes.ContainerStatus{
+				{Name: "pong", ContainerID: "docker://container1"},
+				{Name: "sidecar", ContainerID: "docker://container2"},
+			},
+		},
+	}
+	pod2 = kubernetes.Pod{
+		ObjectMeta: kubernetes.ObjectMeta{
+			Name:      "pong-b",
+			Namespace: "ping",
+			Labels:    map[string]string{"ponger": "false"},
+		},
+		Status: kubernetes.PodStatus{Phase: "Pending"},
+	}
+	service1 = kubernetes.Service{
+		ObjectMeta: kubernetes.ObjectMeta{
+			Name:      "pongservice",
+			Namespace: "ping",
+		},
+		Spec: kubernetes.ServiceSpec{
+			Selector:  map[string]string{"ponger": "true"},
+			ClusterIP: "10.0.0.1",
+			Ports:     []kubernetes.ServicePort{{Port: 80}},
+		},
+	}
+	mockClientInstance = &mockClient{
+		pods:     []kubernetes.Pod{pod1, pod2},
+		services: []kubernetes.Service{service1},
+	}
+
+	pod1ID     = report.MakePodNodeID("ping", "pong-a")
+	pod2ID     = report.MakePodNodeID("ping", "pong-b")
+	service1ID = report.MakeServiceNodeID("ping", "pongservice")
+)
+
+func TestReporter(t *testing.T) {
+	want := report.MakeReport()
+	want.Topologies[report.Pod] = report.Topology{
+		Nodes: report.MakeNodes(map[string]report.Node{
+			pod1ID: report.MakeNodeWith(map[string]string{
+				kubernetes.PodID:                     pod1ID,
+				kubernetes.PodName:                   "pong-a",
+				kubernetes.Namespace:                 "ping",
+				kubernetes.PodCreated:                "2015-09-01T12:00:00Z",
+				kubernetes.PodState:                  "Running",
+				kubernetes.PodIP:                     "10.10.10.10",
+				kubernetes.PodContainerIDs:           "container1 container2",
+				kubernetes.ServiceIDs:                service1ID,
+				kubernetes.PodLabelPrefix + "ponger": "true",
+			}),
+			pod2ID: report.MakeNodeWith(map[string]string{
+				kubernetes.PodID:                     pod2ID,
+				kubernetes.PodName:                   "pong-b",
+				kubernetes.Namespace:                 "ping",
+				kubernetes.PodCreated:                "",
+				kubernetes.PodState:                  "Pending",
+				kubernetes.PodContainerIDs:           "",
+				kubernetes.PodLabelPrefix + "ponger": "false",
+			}),
+		}),
+	}
+	want.Topologies[report.Service] = report.Topology{
+		Nodes: report.MakeNodes(map[string]report.Node{
+			service1ID: report.MakeNodeWith(map[string]string{
+				kubernetes.ServiceID:       service1ID,
+				kubernetes.ServiceName:     "pongservice",
+				kubernetes.Namespace:       "ping",
+				kubernetes.ServiceCreated:  "",
+				kubernetes.ServiceSelector: "ponger=true",
+				kubernetes.ServiceIP:       "10.0.0.1",
+				kubernetes.ServicePorts:    "80/TCP",
+			}),
+		}),
+	}
+	want.Topologies[report.Namespace] = report.Topology{
+		Nodes: report.MakeNodes(map[string]report.Node{
+			report.MakeNamespaceNodeID("ping"): report.MakeNodeWith(map[string]string{
+				kubernetes.Namespace: "ping",
+			}),
+		}),
+	}
+
+	reporter := kubernetes.NewReporter(mockClientInstance)
+	have, _ := reporter.Report()
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("%s", test.Diff(want, have))
+	}
+}
+
+func TestClient(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items interface{}
+		switch r.URL.Path {
+		case "/api/v1/pods":
+			items = []kubernetes.Pod{pod1, pod2}
+		case "/api/v1/services":
+			items = []kubernetes.Service{service1}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"items": items}); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer s.Close()
+
+	client, err := kubernetes.NewClient(s.URL, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+
+	walk := func() interface{} {
+		have := &mockClient{}
+		client.WalkPods(func(p kubernetes.Pod) { have.pods = append(have.pods, p) })
+		client.WalkServices(func(s kubernetes.Service) { have.services = append(have.services, s) })
+		return have
+	}
+	test.Poll(t, time.Second, mockClientInstance, walk)
+}
@@ -0,0 +1,91 @@
+package kubernetes
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Metadata.
+const (
+	ServiceID       = "kubernetes_service_id"
+	ServiceName     = "kubernetes_service_name"
+	ServiceCreated  = "kubernetes_service_created"
+	ServiceIP       = "kubernetes_service_ip"
+	ServicePorts    = "kubernetes_service_ports"
+	ServiceSelector = "kubernetes_service_selector"
+)
+
+// Service is the subset of a Kubernetes service, as returned by the API
+// server, that the probe reports.
+type Service struct {
+	ObjectMeta `json:"metadata"`
+	Spec       ServiceSpec `json:"spec"`
+}
+
+// ServiceSpec describes the pods behind a service, and how they're exposed.
+type ServiceSpec struct {
+	Selector  map[string]string `json:"selector,omitempty"`
+	ClusterIP string            `json:"clusterIP,omitempty"`
+	Ports     []ServicePort     `json:"ports,omitempty"`
+}
+
+// ServicePort is a port exposed by a service.
+type ServicePort struct {
+	Protocol string `json:"protocol,omitempty"`
+	Port     int    `json:"port"`
+}
+
+type serviceList struct {
+	Items []Service `json:"items"`
+}
+
+// ID returns the node ID of the service in the Service topology.
+func (s Service) ID() string {
+	return report.MakeServiceNodeID(s.Namespace, s.Name)
+}
+
+// Selects returns true if the pod is one of the service's endpoints, i.e.
+// it has all the labels of the service's selector. Services without a
+// selector don't select any pods.
+func (s Service) Selects(p Pod) bool {
+	if len(s.Spec.Selector) == 0 {
+		return false
+	}
+	for key, value := range s.Spec.Selector {
+		if p.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// GetNode returns the Node representing the service.
+func (s Service) GetNode() report.Node {
+	selector := report.MakeIDList()
+	for key, value := range s.Spec.Selector {
+		selector = selector.Add(key + "=" + value)
+	}
+	ports := []string{}
+	for _, port := range s.Spec.Ports {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = "TCP"
+		}
+		ports = append(ports, strconv.Itoa(port.Port)+"/"+protocol)
+	}
+
+	nmd := report.MakeNodeWith(map[string]string{
+		ServiceID:       s.ID(),
+		ServiceName:     s.Name,
+		Namespace:       s.Namespace,
+		ServiceCreated:  s.CreationTimestamp,
+		ServiceSelector: strings.Join(selector, ","),
+		ServicePorts:    strings.Join(ports, " "),
+	})
+	if s.Spec.ClusterIP != "" && s.Spec.ClusterIP != "None" {
+		nmd.Metadata = nmd.Metadata.Set(ServiceIP, s.Spec.ClusterIP)
+	}
+	return nmd
+}
@@ -0,0 +1,57 @@
+package kubernetes
+
+import (
+	"strings"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+// Docker labels set by the kubelet on the containers it starts. Older
+// kubelets only set the pod name label, as "namespace/name".
+const (
+	PodNameLabel      = "io.kubernetes.pod.name"
+	PodNamespaceLabel = "io.kubernetes.pod.namespace"
+)
+
+// Tagger is a tagger that tags container nodes started by Kubernetes with
+// the ID of their pod. It only needs the containers' Docker labels, so it
+// works without access to the API server.
+type Tagger struct{}
+
+// NewTagger returns a usable Tagger.
+func NewTagger() *Tagger {
+	return &Tagger{}
+}
+
+// Tag implements Tagger.
+func (Tagger) Tag(r report.Report) (report.Report, error) {
+	topology := r.Topologies[report.Container]
+	topology.Nodes.ForEach(func(nodeID string, node report.Node) {
+		namespace, name, ok := podOf(node)
+		if !ok {
+			return
+		}
+		topology = topology.AddNode(nodeID, report.MakeNodeWith(map[string]string{
+			PodID:     report.MakePodNodeID(namespace, name),
+			PodName:   name,
+			Namespace: namespace,
+		}))
+	})
+	r.Topologies[report.Container] = topology
+	return r, nil
+}
+
+func podOf(node report.Node) (namespace, name string, ok bool) {
+	name, ok = node.Metadata.Lookup(docker.LabelPrefix + PodNameLabel)
+	if !ok || name == "" {
+		return "", "", false
+	}
+	if namespace, ok := node.Metadata.Lookup(docker.LabelPrefix + PodNamespaceLabel); ok {
+		return namespace, name, true
+	}
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[:i], name[i+1:], true
+	}
+	return "default", name, true
+}
@@ -0,0 +1,54 @@
+package kubernetes_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestTagger(t *testing.T) {
+	var (
+		container1NodeID = report.MakeContainerNodeID("somehost.com", "container1")
+		container2NodeID = report.MakeContainerNodeID("somehost.com", "container2")
+		container3NodeID = report.MakeContainerNodeID("somehost.com", "container3")
+		container1Node   = report.MakeNodeWith(map[string]string{
+			docker.ContainerID:                                "container1",
+			docker.LabelPrefix + kubernetes.PodNameLabel:      "pong-a",
+			docker.LabelPrefix + kubernetes.PodNamespaceLabel: "ping",
+		})
+		container2Node = report.MakeNodeWith(map[string]string{
+			docker.ContainerID:                           "container2",
+			docker.LabelPrefix + kubernetes.PodNameLabel: "ping/pong-a",
+		})
+		container3Node = report.MakeNodeWith(map[string]string{
+			docker.ContainerID: "container3",
+		})
+		podNode = report.MakeNodeWith(map[string]string{
+			kubernetes.PodID:     pod1ID,
+			kubernetes.PodName:   "pong-a",
+			kubernetes.Namespace: "ping",
+		})
+	)
+
+	input := report.MakeReport()
+	input.Topologies[report.Container] = input.Topologies[report.Container].AddNode(container1NodeID, container1Node.Copy())
+	input.Topologies[report.Container] = input.Topologies[report.Container].AddNode(container2NodeID, container2Node.Copy())
+	input.Topologies[report.Container] = input.Topologies[report.Container].AddNode(container3NodeID, container3Node.Copy())
+
+	want := report.MakeReport()
+	want.Topologies[report.Container] = want.Topologies[report.Container].AddNode(container1NodeID, container1Node.Merge(podNode))
+	want.Topologies[report.Container] = want.Topologies[report.Container].AddNode(container2NodeID, container2Node.Merge(podNode))
+	want.Topologies[report.Container] = want.Topologies[report.Container].AddNode(container3NodeID, container3Node)
+
+	have, err := kubernetes.NewTagger().Tag(input)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("%s", test.Diff(want, have))
+	}
+}
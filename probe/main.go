@@ -17,7 +17,9 @@ import (
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/probe/overlay"
+	"github.com/weaveworks/scope/probe/plugins"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/xfer"
@@ -37,11 +39,24 @@ func main() {
 		dockerEnabled      = flag.Bool("docker", false, "collect Docker-related attributes for processes")
 		dockerInterval     = flag.Duration("docker.interval", 10*time.Second, "how often to update Docker attributes")
 		dockerBridge       = flag.String("docker.bridge", "docker0", "the docker bridge name")
+		kubernetesEnabled  = flag.Bool("kubernetes", false, "collect pods, services and namespaces from the Kubernetes API server")
+		kubernetesAPI      = flag.String("kubernetes.api", kubernetes.DefaultAPIServer(), "address of the Kubernetes API server")
+		kubernetesInterval = flag.Duration("kubernetes.interval", 10*time.Second, "how often to list pods and services")
 		weaveRouterAddr    = flag.String("weave.router.addr", "", "IP address or FQDN of the Weave router")
+		pluginsRoot        = flag.String("plugins.root", "/var/run/scope/plugins", "directory in which plugins listen on Unix sockets")
+		pluginsTimeout     = flag.Duration("plugins.timeout", 500*time.Millisecond, "maximum time for plugins to answer each request")
 		procRoot           = flag.String("proc.root", "/proc", "location of the proc filesystem")
 		printVersion       = flag.Bool("version", false, "print version number and exit")
 		useConntrack       = flag.Bool("conntrack", true, "also use conntrack to track connections")
 		logPrefix          = flag.String("log.prefix", "<probe>", "prefix for each log line")
+		reverseResolve     = flag.Bool("dns.reverse", true, "reverse-resolve remote addresses, to name remote endpoints")
+		reverseServers     = flag.String("dns.reverse.servers", "", "comma-separated DNS servers (host[:port]) for reverse resolutions; the system resolver if empty")
+		reverseCacheSize   = flag.Int("dns.reverse.cache.size", 500, "maximum number of cached reverse resolutions")
+		reverseTTL         = flag.Duration("dns.reverse.ttl", 30*time.Minute, "how long to cache reverse resolutions for")
+		reverseNegativeTTL = flag.Duration("dns.reverse.negative.ttl", 5*time.Minute, "how long to cache failed reverse resolutions for")
+		reverseBacklog     = flag.Int("dns.reverse.backlog", 1000, "maximum number of queued reverse resolutions; any more are dropped")
+		reverseRate        = flag.Int("dns.reverse.rate", 10, "maximum number of reverse resolutions per second")
+		dnsSnoopInterfaces = flag.String("dns.snoop.interfaces", "", "comma-separated network interfaces on which to snoop DNS responses, to name remote endpoints (needs root)")
 	)
 	flag.Parse()
 
@@ -99,7 +114,30 @@ func main() {
 	resolver := newStaticResolver(targets, publishers.Set)
 	defer resolver.Stop()
 
-	endpointReporter := endpoint.NewReporter(hostID, hostName, *spyProcs, *useConntrack)
+	var dnsSnooper *endpoint.DNSSnooper
+	if *dnsSnoopInterfaces != "" {
+		dnsSnooper, err = endpoint.NewDNSSnooper(strings.Split(*dnsSnoopInterfaces, ","))
+		if err != nil {
+			log.Printf("Failed to start DNS snooper: %v", err)
+		}
+	}
+
+	var revResolver *endpoint.ReverseResolver
+	if *reverseResolve {
+		config := endpoint.ReverseResolverConfig{
+			CacheSize:   *reverseCacheSize,
+			PositiveTTL: *reverseTTL,
+			NegativeTTL: *reverseNegativeTTL,
+			Backlog:     *reverseBacklog,
+			Rate:        *reverseRate,
+		}
+		if *reverseServers != "" {
+			config.Servers = strings.Split(*reverseServers, ",")
+		}
+		revResolver = endpoint.NewReverseResolver(config)
+	}
+
+	endpointReporter := endpoint.NewReporter(hostID, hostName, *spyProcs, *useConntrack, *procRoot, revResolver, dnsSnooper)
 	defer endpointReporter.Stop()
 
 	processCache := process.NewCachingWalker(process.NewWalker(*procRoot))
@@ -126,7 +164,8 @@ func main() {
 		return docker.NewTagger(registry, processCache), docker.NewReporter(registry, hostID), registry
 	}()
 	if dockerTagger != nil {
-		taggers = append(taggers, dockerTagger)
+		// Kubernetes pods are found from the labels of their containers.
+		taggers = append(taggers, dockerTagger, kubernetes.NewTagger())
 	}
 	if dockerReporter != nil {
 		reporters = append(reporters, dockerReporter)
@@ -135,6 +174,15 @@ func main() {
 		defer dockerRegistry.Stop()
 	}
 
+	if *kubernetesEnabled {
+		client, err := kubernetes.NewClient(*kubernetesAPI, *kubernetesInterval)
+		if err != nil {
+			log.Fatalf("Kubernetes: %v", err)
+		}
+		defer client.Stop()
+		reporters = append(reporters, kubernetes.NewReporter(client))
+	}
+
 	if *weaveRouterAddr != "" {
 		weave := overlay.NewWeave(hostID, *weaveRouterAddr)
 		tickers = append(tickers, weave)
@@ -142,6 +190,11 @@ func main() {
 		reporters = append(reporters, weave)
 	}
 
+	pluginRegistry := plugins.NewRegistry(*pluginsRoot, hostID, *pluginsTimeout)
+	tickers = append(tickers, pluginRegistry)
+	reporters = append(reporters, pluginRegistry)
+	taggers = append(taggers, pluginRegistry)
+
 	if *httpListen != "" {
 		go func() {
 			log.Printf("Profiling data being exported to %s", *httpListen)
@@ -150,13 +150,16 @@ func (w *Weave) Tag(r report.Report) (report.Report, error) {
 			continue
 		}
 		nodeID := report.MakeContainerNodeID(w.hostID, entry.ContainerID)
-		node, ok := r.Container.Nodes[nodeID]
+		topology := r.Topologies[report.Container]
+		node, ok := topology.Nodes.Lookup(nodeID)
 		if !ok {
 			continue
 		}
-		hostnames := report.IDList(strings.Fields(node.Metadata[WeaveDNSHostname]))
+		hostnames := report.IDList(strings.Fields(node.Metadata.Get(WeaveDNSHostname)))
 		hostnames = hostnames.Add(strings.TrimSuffix(entry.Hostname, "."))
-		node.Metadata[WeaveDNSHostname] = strings.Join(hostnames, " ")
+		node.Metadata = node.Metadata.Set(WeaveDNSHostname, strings.Join(hostnames, " "))
+		topology.Nodes = topology.Nodes.Set(nodeID, node)
+		r.Topologies[report.Container] = topology
 	}
 
 	// Put information from weave ps on the container nodes
@@ -164,22 +167,26 @@ func (w *Weave) Tag(r report.Report) (report.Report, error) {
 	if err != nil {
 		return r, nil
 	}
-	containersByPrefix := map[string]report.Node{}
-	for _, node := range r.Container.Nodes {
-		prefix := node.Metadata[docker.ContainerID][:12]
-		containersByPrefix[prefix] = node
-	}
+	topology := r.Topologies[report.Container]
+	containersByPrefix := map[string]string{}
+	topology.Nodes.ForEach(func(nodeID string, node report.Node) {
+		prefix := node.Metadata.Get(docker.ContainerID)[:12]
+		containersByPrefix[prefix] = nodeID
+	})
 	for _, e := range psEntries {
-		node, ok := containersByPrefix[e.containerIDPrefix]
+		nodeID, ok := containersByPrefix[e.containerIDPrefix]
 		if !ok {
 			continue
 		}
+		node, _ := topology.Nodes.Lookup(nodeID)
 
 		existingIPs := report.MakeIDList(docker.ExtractContainerIPs(node)...)
 		existingIPs = existingIPs.Add(e.ips...)
-		node.Metadata[docker.ContainerIPs] = strings.Join(existingIPs, " ")
-		node.Metadata[WeaveMACAddress] = e.macAddress
+		node.Metadata = node.Metadata.Set(docker.ContainerIPs, strings.Join(existingIPs, " "))
+		node.Metadata = node.Metadata.Set(WeaveMACAddress, e.macAddress)
+		topology.Nodes = topology.Nodes.Set(nodeID, node)
 	}
+	r.Topologies[report.Container] = topology
 	return r, nil
 }
 
@@ -190,7 +197,7 @@ func (w *Weave) Report() (report.Report, error) {
 
 	r := report.MakeReport()
 	for _, peer := range w.status.Router.Peers {
-		r.Overlay.AddNode(report.MakeOverlayNodeID(peer.Name), report.MakeNodeWith(map[string]string{
+		r.Topologies[report.Overlay] = r.Topologies[report.Overlay].AddNode(report.MakeOverlayNodeID(peer.Name), report.MakeNodeWith(map[string]string{
 			WeavePeerName:     peer.Name,
 			WeavePeerNickName: peer.NickName,
 		}))
@@ -34,40 +34,40 @@ func TestWeaveTaggerOverlayTopology(t *testing.T) {
 			t.Fatal(err)
 		}
 		if want, have := (report.Topology{
-			Nodes: report.Nodes{
+			Nodes: report.MakeNodes(map[string]report.Node{
 				report.MakeOverlayNodeID(mockWeavePeerName): report.MakeNodeWith(map[string]string{
 					overlay.WeavePeerName:     mockWeavePeerName,
 					overlay.WeavePeerNickName: mockWeavePeerNickName,
 				}),
-			},
-		}), have.Overlay; !reflect.DeepEqual(want, have) {
+			}),
+		}), have.Topologies[report.Overlay]; !reflect.DeepEqual(want, have) {
 			t.Error(test.Diff(want, have))
 		}
 	}
 
 	{
 		nodeID := report.MakeContainerNodeID(mockHostID, mockContainerID)
-		want := report.Report{
-			Container: report.Topology{
-				Nodes: report.Nodes{
+		want := report.Report{Topologies: map[string]report.Topology{
+			report.Container: report.Topology{
+				Nodes: report.MakeNodes(map[string]report.Node{
 					nodeID: report.MakeNodeWith(map[string]string{
 						docker.ContainerID:       mockContainerID,
 						overlay.WeaveDNSHostname: mockHostname,
 						overlay.WeaveMACAddress:  mockContainerMAC,
 						docker.ContainerIPs:      mockContainerIP,
 					}),
-				},
+				}),
 			},
-		}
-		have, err := w.Tag(report.Report{
-			Container: report.Topology{
-				Nodes: report.Nodes{
+		}}
+		have, err := w.Tag(report.Report{Topologies: map[string]report.Topology{
+			report.Container: report.Topology{
+				Nodes: report.MakeNodes(map[string]report.Node{
 					nodeID: report.MakeNodeWith(map[string]string{
 						docker.ContainerID: mockContainerID,
 					}),
-				},
+				}),
 			},
-		})
+		}})
 		if err != nil {
 			t.Fatal(err)
 		}
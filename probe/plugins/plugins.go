@@ -0,0 +1,387 @@
+// Package plugins lets external processes add to the probe's reports, so
+// app-specific data (queue depths, feature flags, connection pool stats...)
+// can be shown without changing the probe.
+//
+// A plugin is an HTTP server listening on a Unix socket, named *.sock, in
+// the plugins directory. The probe discovers new sockets every tick, and
+// speaks the following protocol to them, with JSON bodies:
+//
+//	GET  /        returns the plugin's Spec
+//	GET  /report  returns a report.Report to be merged into the probe's
+//	              report (plugins implementing "reporter")
+//	POST /tag     is given the probe's current report.Report, and returns a
+//	              report.Report of additional nodes and metadata, to be
+//	              merged into it (plugins implementing "tagger")
+//
+// Reports may contain any of the well-known topologies, and extra ones of
+// the plugin's own, and must be valid. Plugins are called concurrently, and
+// every request has a timeout; a plugin which fails one, or returns an
+// invalid report, is marked unhealthy, and isn't used again until it answers
+// a GET / again. The status of every plugin is reported in the plugin
+// topology.
+package plugins
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// Interfaces a plugin may implement.
+const (
+	Reporter = "reporter"
+	Tagger   = "tagger"
+)
+
+// APIVersion is the version of the protocol spoken by the probe.
+const APIVersion = "1"
+
+// TopologyName is the name of the topology reporting the plugins, and their
+// health, on each host.
+const TopologyName = "plugin"
+
+// Keys for use in Node.Metadata.
+const (
+	PluginID         = "plugin_id"
+	PluginLabel      = "plugin_label"
+	PluginInterfaces = "plugin_interfaces"
+	PluginStatus     = "plugin_status"
+	PluginError      = "plugin_error"
+)
+
+// Statuses of a plugin.
+const (
+	StatusOK        = "ok"
+	StatusUnhealthy = "unhealthy"
+)
+
+// Spec describes a plugin. It's returned by the plugin from GET /.
+type Spec struct {
+	ID          string   `json:"id"`
+	Label       string   `json:"label"`
+	Description string   `json:"description,omitempty"`
+	Interfaces  []string `json:"interfaces"`
+	APIVersion  string   `json:"api_version"`
+}
+
+// Implements returns true if the plugin implements the named interface.
+func (s Spec) Implements(iface string) bool {
+	for _, i := range s.Interfaces {
+		if i == iface {
+			return true
+		}
+	}
+	return false
+}
+
+type plugin struct {
+	socket    string
+	client    *http.Client
+	transport *http.Transport
+
+	mtx    sync.Mutex
+	spec   Spec
+	status string
+	err    error
+}
+
+func newPlugin(socket string, timeout time.Duration) *plugin {
+	transport := &http.Transport{
+		Dial: func(_, _ string) (net.Conn, error) {
+			return net.DialTimeout("unix", socket, timeout)
+		},
+	}
+	return &plugin{
+		socket:    socket,
+		client:    &http.Client{Timeout: timeout, Transport: transport},
+		transport: transport,
+		status:    StatusUnhealthy,
+		err:       fmt.Errorf("not yet contacted"),
+	}
+}
+
+func (p *plugin) healthy() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.status == StatusOK
+}
+
+// implements returns true if the plugin is healthy, and implements the
+// named interface.
+func (p *plugin) implements(iface string) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.status == StatusOK && p.spec.Implements(iface)
+}
+
+// state returns the spec, status and last error of the plugin.
+func (p *plugin) state() (Spec, string, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.spec, p.status, p.err
+}
+
+// handshake fetches the spec of the plugin, and marks it as healthy if it's
+// one the probe can use.
+func (p *plugin) handshake() {
+	var spec Spec
+	if err := p.do("GET", "/", nil, &spec); err != nil {
+		p.fail(err)
+		return
+	}
+	if spec.APIVersion != APIVersion {
+		p.fail(fmt.Errorf("unsupported API version %q", spec.APIVersion))
+		return
+	}
+	if spec.ID == "" || strings.Contains(spec.ID, report.ScopeDelim) {
+		p.fail(fmt.Errorf("invalid ID %q", spec.ID))
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.spec, p.status, p.err = spec, StatusOK, nil
+}
+
+func (p *plugin) fail(err error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.status == StatusOK {
+		log.Printf("plugin %s: %v", p.socket, err)
+	}
+	p.status, p.err = StatusUnhealthy, err
+}
+
+// getReport gets a report from the plugin, by GET or by POSTing in, and
+// checks it's valid.
+func (p *plugin) getReport(method, path string, in interface{}) (report.Report, bool) {
+	var rpt report.Report
+	if err := p.do(method, path, in, &rpt); err != nil {
+		p.fail(err)
+		return rpt, false
+	}
+	if err := rpt.Validate(); err != nil {
+		p.fail(fmt.Errorf("invalid report: %v", err))
+		return rpt, false
+	}
+	return rpt, true
+}
+
+func (p *plugin) do(method, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buf := &bytes.Buffer{}
+		if err := json.NewEncoder(buf).Encode(in); err != nil {
+			return err
+		}
+		body = buf
+	}
+	req, err := http.NewRequest(method, "http://plugin"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+	if in != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: got %d", method, path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Registry keeps track of the plugins in a directory. It is a Ticker,
+// Reporter and Tagger, delegating to the plugins implementing each. The
+// plugins are called concurrently, without holding the registry's lock, and
+// each of its methods waits at most the timeout for them.
+type Registry struct {
+	root    string
+	hostID  string
+	timeout time.Duration
+
+	mtx     sync.Mutex
+	plugins map[string]*plugin // by socket path
+}
+
+// NewRegistry returns a Registry of the plugins listening on sockets in root.
+// Every request to a plugin is given timeout to complete.
+func NewRegistry(root, hostID string, timeout time.Duration) *Registry {
+	return &Registry{
+		root:    root,
+		hostID:  hostID,
+		timeout: timeout,
+		plugins: map[string]*plugin{},
+	}
+}
+
+// Tick implements Ticker. It discovers new plugins, forgets those whose
+// sockets have gone, and tries to contact the unhealthy ones.
+func (r *Registry) Tick() error {
+	sockets, err := filepath.Glob(filepath.Join(r.root, "*.sock"))
+	if err != nil {
+		return err
+	}
+
+	r.mtx.Lock()
+	found := map[string]struct{}{}
+	for _, socket := range sockets {
+		found[socket] = struct{}{}
+		if _, ok := r.plugins[socket]; !ok {
+			r.plugins[socket] = newPlugin(socket, r.timeout)
+		}
+	}
+	removed := []*plugin{}
+	for socket, p := range r.plugins {
+		if _, ok := found[socket]; !ok {
+			removed = append(removed, p)
+			delete(r.plugins, socket)
+		}
+	}
+	plugins := r.sorted()
+	r.mtx.Unlock()
+
+	for _, p := range removed {
+		p.transport.CloseIdleConnections()
+	}
+	r.each(plugins, func(_ int, p *plugin) {
+		if !p.healthy() {
+			p.handshake()
+		}
+	})
+	return nil
+}
+
+// sorted returns the plugins in a stable order, so their reports are
+// merged deterministically. Call with the lock held.
+func (r *Registry) sorted() []*plugin {
+	sockets := make([]string, 0, len(r.plugins))
+	for socket := range r.plugins {
+		sockets = append(sockets, socket)
+	}
+	sort.Strings(sockets)
+	result := make([]*plugin, 0, len(sockets))
+	for _, socket := range sockets {
+		result = append(result, r.plugins[socket])
+	}
+	return result
+}
+
+// snapshot returns the current plugins, in a stable order.
+func (r *Registry) snapshot() []*plugin {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.sorted()
+}
+
+// each calls f for every plugin concurrently, waiting for them for at most
+// the registry's timeout. It returns whether each call finished in time;
+// plugins whose calls didn't are marked unhealthy.
+func (r *Registry) each(plugins []*plugin, f func(i int, p *plugin)) []bool {
+	var (
+		finished = make([]bool, len(plugins))
+		done     = make(chan int, len(plugins))
+		timer    = time.NewTimer(r.timeout)
+	)
+	defer timer.Stop()
+	for i, p := range plugins {
+		go func(i int, p *plugin) {
+			f(i, p)
+			done <- i
+		}(i, p)
+	}
+	for n := 0; n < len(plugins); n++ {
+		select {
+		case i := <-done:
+			finished[i] = true
+		case <-timer.C:
+			for i, p := range plugins {
+				if !finished[i] {
+					p.fail(fmt.Errorf("timed out after %v", r.timeout))
+				}
+			}
+			return finished
+		}
+	}
+	return finished
+}
+
+// Report implements Reporter. It merges the reports of all the healthy
+// reporter plugins, and reports the status of every plugin.
+func (r *Registry) Report() (report.Report, error) {
+	var (
+		plugins = r.snapshot()
+		reports = make([]report.Report, len(plugins))
+		ok      = make([]bool, len(plugins))
+	)
+	finished := r.each(plugins, func(i int, p *plugin) {
+		if p.implements(Reporter) {
+			reports[i], ok[i] = p.getReport("GET", "/report", nil)
+		}
+	})
+
+	result := report.MakeReport()
+	for i := range plugins {
+		if finished[i] && ok[i] {
+			result = result.Merge(reports[i])
+		}
+	}
+
+	topology := report.MakeTopology()
+	for _, p := range plugins {
+		spec, status, err := p.state()
+		id := spec.ID
+		if id == "" {
+			id = filepath.Base(p.socket)
+		}
+		nmd := report.MakeNodeWith(map[string]string{
+			PluginID:          id,
+			PluginLabel:       spec.Label,
+			PluginInterfaces:  strings.Join(spec.Interfaces, " "),
+			PluginStatus:      status,
+			report.HostNodeID: report.MakeHostNodeID(r.hostID),
+		})
+		if err != nil {
+			nmd.Metadata = nmd.Metadata.Set(PluginError, err.Error())
+		}
+		topology = topology.AddNode(report.MakePluginNodeID(r.hostID, id), nmd)
+	}
+	return result.WithTopology(TopologyName, topology), nil
+}
+
+// Tag implements Tagger. Every healthy tagger plugin is given the report,
+// and what they return is merged into it.
+func (r *Registry) Tag(rpt report.Report) (report.Report, error) {
+	var (
+		plugins = r.snapshot()
+		tags    = make([]report.Report, len(plugins))
+		ok      = make([]bool, len(plugins))
+	)
+	finished := r.each(plugins, func(i int, p *plugin) {
+		if p.implements(Tagger) {
+			tags[i], ok[i] = p.getReport("POST", "/tag", rpt)
+		}
+	})
+
+	for i := range plugins {
+		if finished[i] && ok[i] {
+			rpt = rpt.Merge(tags[i])
+		}
+	}
+	return rpt, nil
+}
@@ -0,0 +1,266 @@
+package plugins_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/plugins"
+	"github.com/weaveworks/scope/probe/plugins/plugintest"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+const (
+	hostID  = "somehost.com"
+	timeout = 100 * time.Millisecond
+)
+
+var (
+	queueNode = report.MakeNodeWith(map[string]string{"queue_depth": "42"})
+	flagsNode = report.MakeNodeWith(map[string]string{"feature_flags": "new-ui"})
+
+	queues = plugintest.Plugin{
+		Spec: plugins.Spec{
+			ID:         "queues",
+			Label:      "Queues",
+			Interfaces: []string{plugins.Reporter},
+			APIVersion: plugins.APIVersion,
+		},
+		Report: func() (report.Report, error) {
+			queue := report.MakeTopology().AddNode("broker;jobs", queueNode)
+			return report.MakeReport().WithTopology("queue", queue), nil
+		},
+	}
+	flags = plugintest.Plugin{
+		Spec: plugins.Spec{
+			ID:         "flags",
+			Label:      "Feature flags",
+			Interfaces: []string{plugins.Tagger},
+			APIVersion: plugins.APIVersion,
+		},
+		Tag: func(r report.Report) (report.Report, error) {
+			result := report.MakeReport()
+			r.Topologies[report.Process].Nodes.ForEach(func(id string, _ report.Node) {
+				result.Topologies[report.Process] = result.Topologies[report.Process].AddNode(id, flagsNode)
+			})
+			return result, nil
+		},
+	}
+)
+
+func serve(t *testing.T, root, name string, p plugintest.Plugin) *plugintest.Server {
+	s, err := plugintest.NewServer(filepath.Join(root, name+".sock"), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func statuses(t *testing.T, r *plugins.Registry) map[string]string {
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topology, ok := rpt.Topology(plugins.TopologyName)
+	if !ok {
+		t.Fatal("no plugin topology")
+	}
+	result := map[string]string{}
+	topology.Nodes.ForEach(func(_ string, node report.Node) {
+		result[node.Metadata.Get(plugins.PluginID)] = node.Metadata.Get(plugins.PluginStatus)
+	})
+	return result
+}
+
+func TestRegistry(t *testing.T) {
+	root, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	defer serve(t, root, "queues", queues).Close()
+	defer serve(t, root, "flags", flags).Close()
+
+	registry := plugins.NewRegistry(root, hostID, timeout)
+	if err := registry.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	rpt, err := registry.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue, _ := rpt.Topology("queue")
+	have, ok := queue.Nodes.Lookup("broker;jobs")
+	if want := queueNode; !ok || !reflect.DeepEqual(want.Metadata, have.Metadata) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	pluginTopology, _ := rpt.Topology(plugins.TopologyName)
+	if want, have := (report.MakeMetadata(map[string]string{
+		plugins.PluginID:         "queues",
+		plugins.PluginLabel:      "Queues",
+		plugins.PluginInterfaces: plugins.Reporter,
+		plugins.PluginStatus:     plugins.StatusOK,
+		report.HostNodeID:        report.MakeHostNodeID(hostID),
+	})), pluginTopology.Nodes.Get(report.MakePluginNodeID(hostID, "queues")).Metadata; !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	processNodeID := report.MakeProcessNodeID(hostID, "1")
+	input := report.MakeReport()
+	input.Topologies[report.Process] = input.Topologies[report.Process].AddNode(processNodeID, report.MakeNodeWith(map[string]string{"pid": "1"}))
+	tagged, err := registry.Tag(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := (report.MakeMetadata(map[string]string{
+		"pid":           "1",
+		"feature_flags": "new-ui",
+	})), tagged.Topologies[report.Process].Nodes.Get(processNodeID).Metadata; !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestRegistryHealth(t *testing.T) {
+	root, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	var (
+		slow    = queues
+		old     = queues
+		failing = queues
+		fail    = true
+	)
+	slow.Spec.ID, slow.Delay = "slow", 2*timeout
+	old.Spec.ID, old.Spec.APIVersion = "old", "0"
+	failing.Spec.ID = "failing"
+	failing.Report = func() (report.Report, error) {
+		if fail {
+			return report.Report{}, fmt.Errorf("broken")
+		}
+		return report.MakeReport(), nil
+	}
+	defer serve(t, root, "slow", slow).Close()
+	defer serve(t, root, "old", old).Close()
+	defer serve(t, root, "failing", failing).Close()
+
+	registry := plugins.NewRegistry(root, hostID, timeout)
+	if err := registry.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failing plugin handshakes, but fails to report; the others never
+	// handshake, so are only known by their sockets.
+	if want, have := map[string]string{
+		"slow.sock": plugins.StatusUnhealthy,
+		"old.sock":  plugins.StatusUnhealthy,
+		"failing":   plugins.StatusUnhealthy,
+	}, statuses(t, registry); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// Unhealthy plugins are retried on every tick.
+	fail = false
+	if err := registry.Tick(); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := plugins.StatusOK, statuses(t, registry)["failing"]; want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+func TestRegistryForgetsPlugins(t *testing.T) {
+	root, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	server := serve(t, root, "queues", queues)
+	registry := plugins.NewRegistry(root, hostID, timeout)
+	if err := registry.Tick(); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 1, len(statuses(t, registry)); want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+
+	server.Close()
+	if err := registry.Tick(); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 0, len(statuses(t, registry)); want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+}
+
+func TestRegistryInvalidReports(t *testing.T) {
+	root, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	invalid := queues
+	invalid.Report = func() (report.Report, error) {
+		queue := report.MakeTopology().AddNode("broker;jobs", queueNode.WithAdjacent("broker;gone"))
+		return report.MakeReport().WithTopology("queue", queue), nil
+	}
+	defer serve(t, root, "queues", invalid).Close()
+
+	registry := plugins.NewRegistry(root, hostID, timeout)
+	if err := registry.Tick(); err != nil {
+		t.Fatal(err)
+	}
+	rpt, err := registry.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue, ok := rpt.Topology("queue"); ok && queue.Nodes.Size() > 0 {
+		t.Errorf("invalid report merged: %v", queue)
+	}
+	if want, have := plugins.StatusUnhealthy, statuses(t, registry)["queues"]; want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	root, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	const n = 4
+	for i := 0; i < n; i++ {
+		p := queues
+		p.Spec.ID, p.Delay = fmt.Sprintf("queues%d", i), timeout/2
+		defer serve(t, root, p.Spec.ID, p).Close()
+	}
+
+	registry := plugins.NewRegistry(root, hostID, timeout)
+	begin := time.Now()
+	if err := registry.Tick(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Report(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed >= n*timeout/2 {
+		t.Errorf("plugins called in turn: took %v", elapsed)
+	}
+	for id, status := range statuses(t, registry) {
+		if status != plugins.StatusOK {
+			t.Errorf("%s: want %s, have %s", id, plugins.StatusOK, status)
+		}
+	}
+}
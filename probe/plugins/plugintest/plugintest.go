@@ -0,0 +1,82 @@
+// Package plugintest is a harness for probe plugins, serving the plugin
+// protocol on a Unix socket from Go functions. It's used to test the probe's
+// side of the protocol, and is an example for plugin authors.
+package plugintest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/weaveworks/scope/probe/plugins"
+	"github.com/weaveworks/scope/report"
+)
+
+// Plugin is a plugin, as served by the harness. Report and Tag are only
+// called if the spec says the plugin implements the corresponding interface.
+type Plugin struct {
+	Spec   plugins.Spec
+	Report func() (report.Report, error)
+	Tag    func(report.Report) (report.Report, error)
+
+	// Delay, if set, is added to every response, to test timeouts.
+	Delay time.Duration
+}
+
+// Server serves a Plugin on a Unix socket.
+type Server struct {
+	listener net.Listener
+	socket   string
+}
+
+// NewServer serves the plugin on a Unix socket at the given path, which is
+// removed first if it exists. Don't forget to Close it.
+func NewServer(socket string, p Plugin) (*Server, error) {
+	os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	go http.Serve(listener, p)
+	return &Server{listener: listener, socket: socket}, nil
+}
+
+// Close stops serving the plugin, and removes its socket.
+func (s *Server) Close() {
+	s.listener.Close()
+	os.Remove(s.socket)
+}
+
+// ServeHTTP implements http.Handler, speaking the plugin protocol.
+func (p Plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(p.Delay)
+
+	var (
+		result interface{}
+		err    error
+	)
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/":
+		result = p.Spec
+	case r.Method == "GET" && r.URL.Path == "/report" && p.Spec.Implements(plugins.Reporter):
+		result, err = p.Report()
+	case r.Method == "POST" && r.URL.Path == "/tag" && p.Spec.Implements(plugins.Tagger):
+		var rpt report.Report
+		if err := json.NewDecoder(r.Body).Decode(&rpt); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err = p.Tag(rpt)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -36,7 +36,7 @@ func (r *Reporter) Report() (report.Report, error) {
 	if err != nil {
 		return result, err
 	}
-	result.Process = result.Process.Merge(processes)
+	result.Topologies[report.Process] = result.Topologies[report.Process].Merge(processes)
 	return result, nil
 }
 
@@ -53,13 +53,13 @@ func (r *Reporter) processTopology() (report.Topology, error) {
 			{Threads, strconv.Itoa(p.Threads)},
 		} {
 			if tuple.value != "" {
-				node.Metadata[tuple.key] = tuple.value
+				node.Metadata = node.Metadata.Set(tuple.key, tuple.value)
 			}
 		}
 		if p.PPID > 0 {
-			node.Metadata[PPID] = strconv.Itoa(p.PPID)
+			node.Metadata = node.Metadata.Set(PPID, strconv.Itoa(p.PPID))
 		}
-		t.AddNode(nodeID, node)
+		t = t.AddNode(nodeID, node)
 	})
 
 	return t, err
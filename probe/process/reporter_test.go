@@ -33,8 +33,8 @@ func TestReporter(t *testing.T) {
 
 	reporter := process.NewReporter(walker, "")
 	want := report.MakeReport()
-	want.Process = report.Topology{
-		Nodes: report.Nodes{
+	want.Topologies[report.Process] = report.Topology{
+		Nodes: report.MakeNodes(map[string]report.Node{
 			report.MakeProcessNodeID("", "1"): report.MakeNodeWith(map[string]string{
 				process.PID:     "1",
 				process.Comm:    "init",
@@ -65,7 +65,7 @@ func TestReporter(t *testing.T) {
 				process.Cmdline: "tail -f /var/log/syslog",
 				process.Threads: "0",
 			}),
-		},
+		}),
 	}
 
 	have, err := reporter.Report()
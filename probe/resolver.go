@@ -63,7 +63,10 @@ func prepare(strs []string) []target {
 	var targets []target
 	for _, s := range strs {
 		var host, port string
-		if strings.Contains(s, ":") {
+		if ip := net.ParseIP(strings.Trim(s, "[]")); ip != nil {
+			// A bare IPv6 address contains colons but no port.
+			host, port = ip.String(), strconv.Itoa(xfer.AppPort)
+		} else if strings.Contains(s, ":") {
 			var err error
 			host, port, err = net.SplitHostPort(s)
 			if err != nil {
@@ -105,10 +108,6 @@ func resolveOne(t target) []string {
 	}
 	endpoints := make([]string, 0, len(addrs))
 	for _, addr := range addrs {
-		// For now, ignore IPv6
-		if addr.To4() == nil {
-			continue
-		}
 		endpoints = append(endpoints, net.JoinHostPort(addr.String(), t.port))
 	}
 	return endpoints
@@ -46,7 +46,8 @@ func TestResolver(t *testing.T) {
 		}
 	}
 
-	r := newStaticResolver([]string{"symbolic.name" + port, "namewithnoport", ip1 + port, ip2}, set)
+	ip6 := "2001:db8::1"
+	r := newStaticResolver([]string{"symbolic.name" + port, "namewithnoport", ip1 + port, ip2, "[" + ip6 + "]" + port, "fe80::2"}, set)
 
 	assertAdd := func(want ...string) {
 		remaining := map[string]struct{}{}
@@ -69,23 +70,30 @@ func TestResolver(t *testing.T) {
 		}
 	}
 
+	var (
+		ip2WithPort = fmt.Sprintf("%s:%d", ip2, xfer.AppPort)
+		ip6WithPort = "[" + ip6 + "]" + port
+		ip7WithPort = fmt.Sprintf("[fe80::2]:%d", xfer.AppPort)
+	)
+
 	// Initial resolve should just give us IPs
-	assertAdd(ip1+port, fmt.Sprintf("%s:%d", ip2, xfer.AppPort))
+	assertAdd(ip1+port, ip2WithPort, ip6WithPort, ip7WithPort)
 
 	// Trigger another resolve with a tick; again,
 	// just want ips.
 	c <- time.Now()
-	assertAdd(ip1+port, fmt.Sprintf("%s:%d", ip2, xfer.AppPort))
+	assertAdd(ip1+port, ip2WithPort, ip6WithPort, ip7WithPort)
 
 	ip3 := "1.2.3.4"
 	updateIPs("symbolic.name", makeIPs(ip3))
 	c <- time.Now() // trigger a resolve
-	assertAdd(ip3+port, ip1+port, fmt.Sprintf("%s:%d", ip2, xfer.AppPort))
+	assertAdd(ip3+port, ip1+port, ip2WithPort, ip6WithPort, ip7WithPort)
 
 	ip4 := "10.10.10.10"
-	updateIPs("symbolic.name", makeIPs(ip3, ip4))
-	c <- time.Now() // trigger another resolve, this time with 2 adds
-	assertAdd(ip3+port, ip4+port, ip1+port, fmt.Sprintf("%s:%d", ip2, xfer.AppPort))
+	ip5 := "2001:db8::5"
+	updateIPs("symbolic.name", makeIPs(ip3, ip4, ip5))
+	c <- time.Now() // trigger another resolve, this time with 3 adds
+	assertAdd(ip3+port, ip4+port, "["+ip5+"]"+port, ip1+port, ip2WithPort, ip6WithPort, ip7WithPort)
 
 	done := make(chan struct{})
 	go func() { r.Stop(); close(done) }()
@@ -48,19 +48,11 @@ func newTopologyTagger() Tagger {
 
 // Tag implements Tagger
 func (topologyTagger) Tag(r report.Report) (report.Report, error) {
-	for val, topology := range map[string]*report.Topology{
-		"endpoint":        &(r.Endpoint),
-		"address":         &(r.Address),
-		"process":         &(r.Process),
-		"container":       &(r.Container),
-		"container_image": &(r.ContainerImage),
-		"host":            &(r.Host),
-		"overlay":         &(r.Overlay),
-	} {
-		other := report.MakeNodeWith(map[string]string{Topology: val})
-		for id := range topology.Nodes {
-			topology.AddNode(id, other)
-		}
-	}
+	r.WalkTopologies(func(name string, topology *report.Topology) {
+		other := report.MakeNodeWith(map[string]string{Topology: name})
+		topology.Nodes.ForEach(func(id string, _ report.Node) {
+			*topology = topology.AddNode(id, other)
+		})
+	})
 	return r, nil
 }
@@ -13,22 +13,28 @@ func TestApply(t *testing.T) {
 		addressNodeID  = "d"
 		endpointNode   = report.MakeNodeWith(map[string]string{"5": "6"})
 		addressNode    = report.MakeNodeWith(map[string]string{"7": "8"})
+		pluginNodeID   = "e"
+		pluginNode     = report.MakeNodeWith(map[string]string{"9": "10"})
 	)
 
 	r := report.MakeReport()
-	r.Endpoint.AddNode(endpointNodeID, endpointNode)
-	r.Address.AddNode(addressNodeID, addressNode)
+	r.Topologies[report.Endpoint] = r.Topologies[report.Endpoint].AddNode(endpointNodeID, endpointNode)
+	r.Topologies[report.Address] = r.Topologies[report.Address].AddNode(addressNodeID, addressNode)
+	r = r.WithTopology("plugin", report.MakeTopology().AddNode(pluginNodeID, pluginNode))
 	r = Apply(r, []Tagger{newTopologyTagger()})
+	plugin, _ := r.Topology("plugin")
 
 	for _, tuple := range []struct {
 		want report.Node
 		from report.Topology
 		via  string
 	}{
-		{endpointNode.Merge(report.MakeNodeWith(map[string]string{"topology": "endpoint"})), r.Endpoint, endpointNodeID},
-		{addressNode.Merge(report.MakeNodeWith(map[string]string{"topology": "address"})), r.Address, addressNodeID},
+		{endpointNode.Merge(report.MakeNodeWith(map[string]string{"topology": "endpoint"})), r.Topologies[report.Endpoint], endpointNodeID},
+		{addressNode.Merge(report.MakeNodeWith(map[string]string{"topology": "address"})), r.Topologies[report.Address], addressNodeID},
+		{pluginNode.Merge(report.MakeNodeWith(map[string]string{"topology": "plugin"})), plugin, pluginNodeID},
 	} {
-		if want, have := tuple.want, tuple.from.Nodes[tuple.via]; !reflect.DeepEqual(want, have) {
+		have, _ := tuple.from.Nodes.Lookup(tuple.via)
+		if want := tuple.want; !reflect.DeepEqual(want, have) {
 			t.Errorf("want %+v, have %+v", want, have)
 		}
 	}
@@ -39,7 +45,7 @@ func TestTagMissingID(t *testing.T) {
 	r := report.MakeReport()
 	want := report.MakeNode()
 	rpt, _ := newTopologyTagger().Tag(r)
-	have := rpt.Endpoint.Nodes[nodeID].Copy()
+	have := rpt.Topologies[report.Endpoint].Nodes.Get(nodeID).Copy()
 	if !reflect.DeepEqual(want, have) {
 		t.Error("TopologyTagger erroneously tagged a missing node ID")
 	}
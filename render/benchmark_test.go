@@ -0,0 +1,132 @@
+package render_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+const benchmarkHosts = 10000
+
+var (
+	benchmarkOnce   sync.Once
+	benchmarkReport report.Report
+)
+
+// scaledReport repeats the fixture once per client and server pair of hosts,
+// with their own addresses, containers and pods. The internet, and unknown
+// clients, are shared.
+func scaledReport(hosts int) report.Report {
+	rpt := report.MakeReport()
+	rpt.Sampling = test.Report.Sampling
+	rpt.Window = test.Report.Window
+	for i := 0; i < hosts/2; i++ {
+		r := strings.NewReplacer(
+			test.ClientHostID, fmt.Sprintf("client-%d.hostname.com", i),
+			test.ServerHostID, fmt.Sprintf("server-%d.hostname.com", i),
+			test.ClientIP, fmt.Sprintf("10.%d.%d.20", i/250, i%250),
+			test.ServerIP, fmt.Sprintf("192.168.%d.%d", i/250, i%250+1),
+			test.ClientContainerID, fmt.Sprintf("%s-%d", test.ClientContainerID, i),
+			test.ServerContainerID, fmt.Sprintf("%s-%d", test.ServerContainerID, i),
+			"pong-a", fmt.Sprintf("pong-a-%d", i),
+			"pong-b", fmt.Sprintf("pong-b-%d", i),
+		)
+		rpt.WalkTopologies(func(name string, t *report.Topology) {
+			fixture, _ := test.Report.Topology(name)
+			fixture.Nodes.ForEach(func(id string, node report.Node) {
+				t.Nodes = t.Nodes.Set(r.Replace(id), rekeyNode(r, node))
+			})
+		})
+	}
+	return rpt
+}
+
+func rekeyNode(r *strings.Replacer, node report.Node) report.Node {
+	result := report.MakeNode()
+	node.Metadata.ForEach(func(k, v string) {
+		result.Metadata = result.Metadata.Set(k, r.Replace(v))
+	})
+	result.Counters = node.Counters
+	for _, id := range node.Adjacency {
+		result.Adjacency = result.Adjacency.Add(r.Replace(id))
+	}
+	node.Edges.ForEach(func(id string, md report.EdgeMetadata) {
+		result.Edges = result.Edges.Set(r.Replace(id), md)
+	})
+	return result
+}
+
+// fresh returns a copy of the report sharing its nodes, but not their
+// topologies' maps, so memoised renderers render it again.
+func fresh(rpt report.Report) report.Report {
+	rpt = rpt.Copy()
+	rpt.WalkTopologies(func(_ string, t *report.Topology) {
+		nodes := report.Nodes{}
+		t.Nodes.ForEach(func(id string, node report.Node) {
+			nodes = nodes.Set(id, node)
+		})
+		t.Nodes = nodes
+	})
+	return rpt
+}
+
+func TestParallelRender(t *testing.T) {
+	defer func(workers int) { render.Workers = workers }(render.Workers)
+	rpt := scaledReport(200)
+
+	for _, renderer := range []render.Renderer{
+		render.ProcessRenderer,
+		render.ContainerRenderer,
+		render.PodRenderer,
+		render.HostRenderer,
+	} {
+		render.Workers = 1
+		want := renderer.Render(fresh(rpt)).Prune()
+		render.Workers = 4
+		have := renderer.Render(fresh(rpt)).Prune()
+		if !reflect.DeepEqual(want, have) {
+			t.Error(test.Diff(want, have))
+		}
+	}
+}
+
+func benchmarkRender(b *testing.B, r render.Renderer, workers int) {
+	benchmarkOnce.Do(func() { benchmarkReport = scaledReport(benchmarkHosts) })
+	if workers > 0 {
+		defer func(workers int) { render.Workers = workers }(render.Workers)
+		render.Workers = workers
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		rpt := fresh(benchmarkReport)
+		b.StartTimer()
+		r.Render(rpt)
+	}
+}
+
+func BenchmarkProcessRender(b *testing.B)   { benchmarkRender(b, render.ProcessRenderer, 0) }
+func BenchmarkContainerRender(b *testing.B) { benchmarkRender(b, render.ContainerRenderer, 0) }
+func BenchmarkPodRender(b *testing.B)       { benchmarkRender(b, render.PodRenderer, 0) }
+func BenchmarkHostRender(b *testing.B)      { benchmarkRender(b, render.HostRenderer, 0) }
+
+func BenchmarkProcessRenderSequential(b *testing.B) {
+	benchmarkRender(b, render.ProcessRenderer, 1)
+}
+func BenchmarkContainerRenderSequential(b *testing.B) {
+	benchmarkRender(b, render.ContainerRenderer, 1)
+}
+func BenchmarkPodRenderSequential(b *testing.B) {
+	benchmarkRender(b, render.PodRenderer, 1)
+}
+func BenchmarkHostRenderSequential(b *testing.B) {
+	benchmarkRender(b, render.HostRenderer, 1)
+}
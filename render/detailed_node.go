@@ -2,11 +2,15 @@ package render
 
 import (
 	"fmt"
+	"net"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/probe/overlay"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/report"
@@ -14,9 +18,12 @@ import (
 
 const (
 	mb                 = 1 << 20
+	serviceRank        = 6
+	podRank            = 5
 	containerImageRank = 4
 	containerRank      = 3
 	processRank        = 2
+	listeningRank      = processRank // straight after the process table
 	hostRank           = 1
 	connectionsRank    = 0 // keep connections at the bottom until they are expandable in the UI
 )
@@ -83,14 +90,15 @@ func MakeDetailedNode(r report.Report, n RenderableNode) DetailedNode {
 	// multiple origins. The ultimate goal here is to generate tables to view
 	// in the UI, so we skip the intermediate representations, but we could
 	// add them later.
-	connections := []Row{}
+	connections, listening := []Row{}, []Row{}
 	for _, id := range n.Origins {
 		if table, ok := OriginTable(r, id, multiHost, multiContainer); ok {
 			tables = append(tables, table)
-		} else if _, ok := r.Endpoint.Nodes[id]; ok {
-			connections = append(connections, connectionDetailsRows(r.Endpoint, id)...)
-		} else if _, ok := r.Address.Nodes[id]; ok {
-			connections = append(connections, connectionDetailsRows(r.Address, id)...)
+		} else if nmd, ok := r.Topologies[report.Endpoint].Nodes.Lookup(id); ok {
+			connections = append(connections, connectionDetailsRows(r.Topologies[report.Endpoint], id)...)
+			listening = append(listening, listeningRows(nmd)...)
+		} else if _, ok := r.Topologies[report.Address].Nodes.Lookup(id); ok {
+			connections = append(connections, connectionDetailsRows(r.Topologies[report.Address], id)...)
 		}
 	}
 
@@ -98,8 +106,18 @@ func MakeDetailedNode(r report.Report, n RenderableNode) DetailedNode {
 		tables = append(tables, table)
 	}
 
-	// Sort tables by rank
-	sort.Sort(tables)
+	if len(listening) > 0 {
+		sort.Sort(sortableRows(listening))
+		tables = append(tables, Table{
+			Title:   "Listening on",
+			Numeric: false,
+			Rank:    listeningRank,
+			Rows:    listening,
+		})
+	}
+
+	// Sort tables by rank, keeping tables of equal rank in the order added
+	sort.Stable(tables)
 
 	return DetailedNode{
 		ID:         n.ID,
@@ -116,10 +134,10 @@ func getRenderingContext(r report.Report, n RenderableNode) (multiContainer, mul
 		originContainers = map[string]struct{}{}
 	)
 	for _, id := range n.Origins {
-		for _, topology := range r.Topologies() {
-			if nmd, ok := topology.Nodes[id]; ok {
+		for _, topology := range r.Topologies {
+			if nmd, ok := topology.Nodes.Lookup(id); ok {
 				originHosts[report.ExtractHostID(nmd)] = struct{}{}
-				if id, ok := nmd.Metadata[docker.ContainerID]; ok {
+				if id, ok := nmd.Metadata.Lookup(docker.ContainerID); ok {
 					originContainers[id] = struct{}{}
 				}
 			}
@@ -193,42 +211,50 @@ func connectionsTable(connections []Row, r report.Report, n RenderableNode) (Tab
 // OriginTable produces a table (to be consumed directly by the UI) based on
 // an origin ID, which is (optimistically) a node ID in one of our topologies.
 func OriginTable(r report.Report, originID string, addHostTags bool, addContainerTags bool) (Table, bool) {
-	if nmd, ok := r.Process.Nodes[originID]; ok {
+	if nmd, ok := r.Topologies[report.Process].Nodes.Lookup(originID); ok {
 		return processOriginTable(nmd, addHostTags, addContainerTags)
 	}
-	if nmd, ok := r.Container.Nodes[originID]; ok {
+	if nmd, ok := r.Topologies[report.Container].Nodes.Lookup(originID); ok {
 		return containerOriginTable(nmd, addHostTags)
 	}
-	if nmd, ok := r.ContainerImage.Nodes[originID]; ok {
+	if nmd, ok := r.Topologies[report.ContainerImage].Nodes.Lookup(originID); ok {
 		return containerImageOriginTable(nmd)
 	}
-	if nmd, ok := r.Host.Nodes[originID]; ok {
+	if nmd, ok := r.Topologies[report.Host].Nodes.Lookup(originID); ok {
 		return hostOriginTable(nmd)
 	}
+	if nmd, ok := r.Topologies[report.Pod].Nodes.Lookup(originID); ok {
+		return podOriginTable(nmd)
+	}
+	if nmd, ok := r.Topologies[report.Service].Nodes.Lookup(originID); ok {
+		return serviceOriginTable(nmd)
+	}
 	return Table{}, false
 }
 
 func connectionDetailsRows(topology report.Topology, originID string) []Row {
 	rows := []Row{}
-	labeler := func(nodeID string, meta map[string]string) (string, bool) {
+	labeler := func(nodeID string, meta report.Metadata) (string, bool) {
 		if _, addr, port, ok := report.ParseEndpointNodeID(nodeID); ok {
-			if name, ok := meta["name"]; ok {
-				return fmt.Sprintf("%s:%s", name, port), true
+			if name, ok := meta.Lookup("name"); ok {
+				return net.JoinHostPort(name, port), true
 			}
-			return fmt.Sprintf("%s:%s", addr, port), true
+			return net.JoinHostPort(addr, port), true
 		}
 		if _, addr, ok := report.ParseAddressNodeID(nodeID); ok {
 			return addr, true
 		}
 		return "", false
 	}
-	local, ok := labeler(originID, topology.Nodes[originID].Metadata)
+	origin, _ := topology.Nodes.Lookup(originID)
+	local, ok := labeler(originID, origin.Metadata)
 	if !ok {
 		return rows
 	}
 	// Firstly, collection outgoing connections from this node.
-	for _, serverNodeID := range topology.Nodes[originID].Adjacency {
-		remote, ok := labeler(serverNodeID, topology.Nodes[serverNodeID].Metadata)
+	for _, serverNodeID := range origin.Adjacency {
+		server, _ := topology.Nodes.Lookup(serverNodeID)
+		remote, ok := labeler(serverNodeID, server.Metadata)
 		if !ok {
 			continue
 		}
@@ -239,17 +265,17 @@ func connectionDetailsRows(topology report.Topology, originID string) []Row {
 		})
 	}
 	// Next, scan the topology for incoming connections to this node.
-	for clientNodeID, clientNode := range topology.Nodes {
+	topology.Nodes.ForEach(func(clientNodeID string, clientNode report.Node) {
 		if clientNodeID == originID {
-			continue
+			return
 		}
 		serverNodeIDs := clientNode.Adjacency
 		if !serverNodeIDs.Contains(originID) {
-			continue
+			return
 		}
 		remote, ok := labeler(clientNodeID, clientNode.Metadata)
 		if !ok {
-			continue
+			return
 		}
 		rows = append(rows, Row{
 			Key:        remote,
@@ -257,6 +283,19 @@ func connectionDetailsRows(topology report.Topology, originID string) []Row {
 			ValueMinor: "",
 			Expandable: true,
 		})
+	})
+	return rows
+}
+
+func listeningRows(nmd report.Node) []Row {
+	transports, ok := nmd.Metadata.Lookup(endpoint.Listening)
+	if !ok {
+		return []Row{}
+	}
+	rows := []Row{}
+	addr := net.JoinHostPort(nmd.Metadata.Get(endpoint.Addr), nmd.Metadata.Get(endpoint.Port))
+	for _, transport := range strings.Fields(transports) {
+		rows = append(rows, Row{Key: strings.ToUpper(transport), ValueMajor: addr})
 	}
 	return rows
 }
@@ -268,12 +307,12 @@ func processOriginTable(nmd report.Node, addHostTag bool, addContainerTag bool)
 		{process.Cmdline, "Command"},
 		{process.Threads, "# Threads"},
 	} {
-		if val, ok := nmd.Metadata[tuple.key]; ok {
+		if val, ok := nmd.Metadata.Lookup(tuple.key); ok {
 			rows = append(rows, Row{Key: tuple.human, ValueMajor: val, ValueMinor: ""})
 		}
 	}
 
-	if containerID, ok := nmd.Metadata[docker.ContainerID]; ok && addContainerTag {
+	if containerID, ok := nmd.Metadata.Lookup(docker.ContainerID); ok && addContainerTag {
 		rows = append([]Row{{Key: "Container ID", ValueMajor: containerID}}, rows...)
 	}
 
@@ -283,8 +322,8 @@ func processOriginTable(nmd report.Node, addHostTag bool, addContainerTag bool)
 
 	var (
 		title           = "Process"
-		name, commFound = nmd.Metadata[process.Comm]
-		pid, pidFound   = nmd.Metadata[process.PID]
+		name, commFound = nmd.Metadata.Lookup(process.Comm)
+		pid, pidFound   = nmd.Metadata.Lookup(process.PID)
 	)
 	if commFound {
 		title += ` "` + name + `"`
@@ -311,7 +350,7 @@ func containerOriginTable(nmd report.Node, addHostTag bool) (Table, bool) {
 		{overlay.WeaveMACAddress, "Weave MAC"},
 		{overlay.WeaveDNSHostname, "Weave DNS Hostname"},
 	} {
-		if val, ok := nmd.Metadata[tuple.key]; ok && val != "" {
+		if val, ok := nmd.Metadata.Lookup(tuple.key); ok && val != "" {
 			rows = append(rows, Row{Key: tuple.human, ValueMajor: val, ValueMinor: ""})
 		}
 	}
@@ -321,7 +360,7 @@ func containerOriginTable(nmd report.Node, addHostTag bool) (Table, bool) {
 	}
 	rows = append(rows, getDockerLabelRows(nmd)...)
 
-	if val, ok := nmd.Metadata[docker.MemoryUsage]; ok {
+	if val, ok := nmd.Metadata.Lookup(docker.MemoryUsage); ok {
 		memory, err := strconv.ParseFloat(val, 64)
 		if err == nil {
 			memoryStr := fmt.Sprintf("%0.2f", memory/float64(mb))
@@ -353,7 +392,7 @@ func containerImageOriginTable(nmd report.Node) (Table, bool) {
 	for _, tuple := range []struct{ key, human string }{
 		{docker.ImageID, "Image ID"},
 	} {
-		if val, ok := nmd.Metadata[tuple.key]; ok {
+		if val, ok := nmd.Metadata.Lookup(tuple.key); ok {
 			rows = append(rows, Row{Key: tuple.human, ValueMajor: val, ValueMinor: ""})
 		}
 	}
@@ -363,7 +402,7 @@ func containerImageOriginTable(nmd report.Node) (Table, bool) {
 		nameFound bool
 		name      string
 	)
-	if name, nameFound = nmd.Metadata[docker.ImageName]; nameFound {
+	if name, nameFound = nmd.Metadata.Lookup(docker.ImageName); nameFound {
 		title += ` "` + name + `"`
 	}
 	return Table{
@@ -397,7 +436,7 @@ func hostOriginTable(nmd report.Node) (Table, bool) {
 		{host.KernelVersion, "Kernel version"},
 		{host.Uptime, "Uptime"},
 	} {
-		if val, ok := nmd.Metadata[tuple.key]; ok {
+		if val, ok := nmd.Metadata.Lookup(tuple.key); ok {
 			rows = append(rows, Row{Key: tuple.human, ValueMajor: val, ValueMinor: ""})
 		}
 	}
@@ -407,7 +446,7 @@ func hostOriginTable(nmd report.Node) (Table, bool) {
 		name      string
 		foundName bool
 	)
-	if name, foundName = nmd.Metadata[host.HostName]; foundName {
+	if name, foundName = nmd.Metadata.Lookup(host.HostName); foundName {
 		title += ` "` + name + `"`
 	}
 	return Table{
@@ -417,3 +456,56 @@ func hostOriginTable(nmd report.Node) (Table, bool) {
 		Rank:    hostRank,
 	}, len(rows) > 0 || foundName
 }
+
+func podOriginTable(nmd report.Node) (Table, bool) {
+	rows := []Row{}
+	for _, tuple := range []struct{ key, human string }{
+		{kubernetes.Namespace, "Namespace"},
+		{kubernetes.PodState, "State"},
+		{kubernetes.PodIP, "IP Address"},
+		{kubernetes.PodCreated, "Created"},
+	} {
+		if val, ok := nmd.Metadata.Lookup(tuple.key); ok && val != "" {
+			rows = append(rows, Row{Key: tuple.human, ValueMajor: val, ValueMinor: ""})
+		}
+	}
+
+	title := "Pod"
+	name, nameFound := nmd.Metadata.Lookup(kubernetes.PodName)
+	if nameFound {
+		title += ` "` + name + `"`
+	}
+	return Table{
+		Title:   title,
+		Numeric: false,
+		Rows:    rows,
+		Rank:    podRank,
+	}, len(rows) > 0 || nameFound
+}
+
+func serviceOriginTable(nmd report.Node) (Table, bool) {
+	rows := []Row{}
+	for _, tuple := range []struct{ key, human string }{
+		{kubernetes.Namespace, "Namespace"},
+		{kubernetes.ServiceIP, "Cluster IP"},
+		{kubernetes.ServicePorts, "Ports"},
+		{kubernetes.ServiceSelector, "Selector"},
+		{kubernetes.ServiceCreated, "Created"},
+	} {
+		if val, ok := nmd.Metadata.Lookup(tuple.key); ok && val != "" {
+			rows = append(rows, Row{Key: tuple.human, ValueMajor: val, ValueMinor: ""})
+		}
+	}
+
+	title := "Service"
+	name, nameFound := nmd.Metadata.Lookup(kubernetes.ServiceName)
+	if nameFound {
+		title += ` "` + name + `"`
+	}
+	return Table{
+		Title:   title,
+		Numeric: false,
+		Rows:    rows,
+		Rank:    serviceRank,
+	}, len(rows) > 0 || nameFound
+}
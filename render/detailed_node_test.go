@@ -5,7 +5,10 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test"
 )
 
@@ -231,3 +234,39 @@ func TestMakeDetailedContainerNode(t *testing.T) {
 		t.Errorf("%s", test.Diff(want, have))
 	}
 }
+
+func TestMakeDetailedListeningNode(t *testing.T) {
+	var (
+		listeningNodeID = report.MakeEndpointNodeID(test.ServerHostID, "0.0.0.0", "8080")
+		rpt             = test.Report.Copy()
+	)
+	rpt.Topologies[report.Endpoint] = rpt.Topologies[report.Endpoint].AddNode(listeningNodeID, report.MakeNodeWith(map[string]string{
+		endpoint.Addr:      "0.0.0.0",
+		endpoint.Port:      "8080",
+		endpoint.Listening: "tcp udp",
+		endpoint.Procspied: test.True,
+		process.PID:        test.ServerPID,
+		report.HostNodeID:  test.ServerHostNodeID,
+	}))
+
+	renderableNode := render.ProcessRenderer.Render(rpt)[render.MakeProcessID(test.ServerHostID, test.ServerPID)]
+	have := render.MakeDetailedNode(rpt, renderableNode)
+
+	var titles []string
+	for _, table := range have.Tables {
+		titles = append(titles, table.Title)
+		if table.Title != "Listening on" {
+			continue
+		}
+		want := []render.Row{
+			{Key: "TCP", ValueMajor: "0.0.0.0:8080"},
+			{Key: "UDP", ValueMajor: "0.0.0.0:8080"},
+		}
+		if !reflect.DeepEqual(want, table.Rows) {
+			t.Error(test.Diff(want, table.Rows))
+		}
+	}
+	if want := []string{fmt.Sprintf(`Process "apache" (%s)`, test.ServerPID), "Listening on", `Host "server.hostname.com"`, "Connections"}; !reflect.DeepEqual(want, titles) {
+		t.Error(test.Diff(want, titles))
+	}
+}
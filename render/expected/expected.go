@@ -307,6 +307,106 @@ var (
 		render.TheInternetID: theInternetNode(test.ServerContainerImageName),
 	}).Prune()
 
+	RenderedPods = (render.RenderableNodes{
+		test.ClientPodNodeID: {
+			ID:         test.ClientPodNodeID,
+			LabelMajor: "pong-a",
+			LabelMinor: test.KubernetesNamespace,
+			Rank:       test.KubernetesNamespace,
+			Pseudo:     false,
+			Origins: report.MakeIDList(
+				test.ClientPodNodeID,
+				test.ClientContainerImageNodeID,
+				test.ClientContainerNodeID,
+				test.Client54001NodeID,
+				test.Client54002NodeID,
+				test.ClientProcess1NodeID,
+				test.ClientProcess2NodeID,
+				test.ClientHostNodeID,
+			),
+			Node: report.MakeNode().WithAdjacent(test.ServerPodNodeID),
+			EdgeMetadata: report.EdgeMetadata{
+				EgressPacketCount: newu64(30),
+				EgressByteCount:   newu64(300),
+			},
+		},
+		test.ServerPodNodeID: {
+			ID:         test.ServerPodNodeID,
+			LabelMajor: "pong-b",
+			LabelMinor: test.KubernetesNamespace,
+			Rank:       test.KubernetesNamespace,
+			Pseudo:     false,
+			Origins: report.MakeIDList(
+				test.ServerPodNodeID,
+				test.ServerContainerImageNodeID,
+				test.ServerContainerNodeID,
+				test.Server80NodeID,
+				test.ServerProcessNodeID,
+				test.ServerHostNodeID,
+			),
+			Node: report.MakeNode(),
+			EdgeMetadata: report.EdgeMetadata{
+				IngressPacketCount: newu64(210),
+				IngressByteCount:   newu64(2100),
+			},
+		},
+		uncontainedServerID: {
+			ID:         uncontainedServerID,
+			LabelMajor: render.UncontainedMajor,
+			LabelMinor: test.ServerHostName,
+			Rank:       "",
+			Pseudo:     true,
+			Origins: report.MakeIDList(
+				test.NonContainerProcessNodeID,
+				test.ServerHostNodeID,
+				test.NonContainerNodeID,
+			),
+			Node:         report.MakeNode().WithAdjacent(render.TheInternetID),
+			EdgeMetadata: report.EdgeMetadata{},
+		},
+		render.TheInternetID: theInternetNode(test.ServerPodNodeID),
+	}).Prune()
+
+	RenderedServices = (render.RenderableNodes{
+		test.ServiceNodeID: {
+			ID:         test.ServiceNodeID,
+			LabelMajor: "pongservice",
+			LabelMinor: "1 pod",
+			Rank:       test.KubernetesNamespace,
+			Pseudo:     false,
+			Origins: report.MakeIDList(
+				test.ServiceNodeID,
+				test.ServerPodNodeID,
+				test.ServerContainerImageNodeID,
+				test.ServerContainerNodeID,
+				test.Server80NodeID,
+				test.ServerProcessNodeID,
+				test.ServerHostNodeID,
+			),
+			Node: report.MakeNode().WithAdjacent(test.ServerPodNodeID),
+			EdgeMetadata: report.EdgeMetadata{
+				IngressPacketCount: newu64(210),
+				IngressByteCount:   newu64(2100),
+			},
+		},
+		test.ServerPodNodeID: RenderedPods[test.ServerPodNodeID],
+		uncontainedServerID: {
+			ID:         uncontainedServerID,
+			LabelMajor: render.UncontainedMajor,
+			LabelMinor: test.ServerHostName,
+			Rank:       "",
+			Pseudo:     true,
+			Origins: report.MakeIDList(
+				test.NonContainerProcessNodeID,
+				test.ServerHostNodeID,
+				test.NonContainerNodeID,
+			),
+			Node:         report.MakeNode().WithAdjacent(render.TheInternetID),
+			EdgeMetadata: report.EdgeMetadata{},
+		},
+		render.TheInternetID: theInternetNode(test.ServiceNodeID),
+	}).Prune()
+
 	ServerHostRenderedID = render.MakeHostID(test.ServerHostID)
 	ClientHostRenderedID = render.MakeHostID(test.ClientHostID)
 	pseudoHostID1        = render.MakePseudoNodeID(test.UnknownClient1IP, test.ServerIP)
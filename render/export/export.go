@@ -0,0 +1,282 @@
+// Package export writes rendered topologies in the formats of other graph
+// tools: Graphviz DOT, GraphML and JSON Graph Format, or draws them as SVG or PNG.
+// It also describes them as Prometheus metrics, and writes network policies
+// generated from their flows.
+package export
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// EdgeFunc returns the metadata of the edge between two nodes.
+type EdgeFunc func(from, to string) report.EdgeMetadata
+
+// Exporter writes nodes, and the edges between them, to w.
+type Exporter func(w io.Writer, nodes render.RenderableNodes, edge EdgeFunc) error
+
+// Format is an export format.
+type Format struct {
+	ContentType string
+	Export      Exporter
+}
+
+// Formats are the export formats, by name.
+var Formats = map[string]Format{
+	"dot":       {"text/vnd.graphviz; charset=utf-8", DOT},
+	"graphml":   {"application/graphml+xml", GraphML},
+	"jsongraph": {"application/vnd.jgf+json", JSONGraph},
+	"png":       {"image/png", PNG},
+	"svg":       {"image/svg+xml", SVG},
+}
+
+// edgeAttrs returns the set attributes of edge metadata, by name, in the
+// order of the names.
+func edgeAttrs(md report.EdgeMetadata) ([]string, map[string]string) {
+	attrs := map[string]string{}
+	for name, value := range map[string]*uint64{
+		"egress_packet_count":  md.EgressPacketCount,
+		"ingress_packet_count": md.IngressPacketCount,
+		"egress_byte_count":    md.EgressByteCount,
+		"ingress_byte_count":   md.IngressByteCount,
+		"max_conn_count_tcp":   md.MaxConnCountTCP,
+	} {
+		if value != nil {
+			attrs[name] = strconv.FormatUint(*value, 10)
+		}
+	}
+	if md.DirectionInferredFrom != "" {
+		attrs["direction_inferred_from"] = md.DirectionInferredFrom
+	}
+	return sortedKeys(attrs), attrs
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedNodes returns the nodes in the order of their IDs, so the output is
+// stable.
+func sortedNodes(nodes render.RenderableNodes) []render.RenderableNode {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := make([]render.RenderableNode, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, nodes[id])
+	}
+	return result
+}
+
+// edges calls f for every edge between the nodes, skipping those to nodes
+// which aren't there.
+func edges(nodes render.RenderableNodes, f func(from, to string)) {
+	for _, node := range sortedNodes(nodes) {
+		adjacency := append(report.IDList{}, node.Adjacency...)
+		sort.Strings(adjacency)
+		for _, to := range adjacency {
+			if _, ok := nodes[to]; ok {
+				f(node.ID, to)
+			}
+		}
+	}
+}
+
+// DOT writes the nodes as a Graphviz digraph.
+func DOT(w io.Writer, nodes render.RenderableNodes, edge EdgeFunc) error {
+	ew := &errWriter{w: w}
+	ew.printf("digraph G {\n")
+	for _, node := range sortedNodes(nodes) {
+		ew.printf("\t%q [label=%q, label_minor=%q, node_rank=%q", node.ID, node.LabelMajor, node.LabelMinor, node.Rank)
+		if node.Pseudo {
+			ew.printf(", pseudo=true, style=dashed")
+		}
+		ew.printf("];\n")
+	}
+	edges(nodes, func(from, to string) {
+		ew.printf("\t%q -> %q", from, to)
+		names, attrs := edgeAttrs(edge(from, to))
+		for i, name := range names {
+			sep := ", "
+			if i == 0 {
+				sep = " ["
+			}
+			ew.printf("%s%s=%q", sep, name, attrs[name])
+		}
+		if len(names) > 0 {
+			ew.printf("]")
+		}
+		ew.printf(";\n")
+	})
+	ew.printf("}\n")
+	return ew.err
+}
+
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+var graphMLKeys = []graphMLKey{
+	{"label_major", "node", "label_major", "string"},
+	{"label_minor", "node", "label_minor", "string"},
+	{"rank", "node", "rank", "string"},
+	{"pseudo", "node", "pseudo", "boolean"},
+	{"egress_packet_count", "edge", "egress_packet_count", "long"},
+	{"ingress_packet_count", "edge", "ingress_packet_count", "long"},
+	{"egress_byte_count", "edge", "egress_byte_count", "long"},
+	{"ingress_byte_count", "edge", "ingress_byte_count", "long"},
+	{"max_conn_count_tcp", "edge", "max_conn_count_tcp", "long"},
+	{"direction_inferred_from", "edge", "direction_inferred_from", "string"},
+}
+
+// GraphML writes the nodes as a GraphML document.
+func GraphML(w io.Writer, nodes render.RenderableNodes, edge EdgeFunc) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys:  graphMLKeys,
+		Graph: graphMLGraph{ID: "G", EdgeDefault: "directed"},
+	}
+	for _, node := range sortedNodes(nodes) {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: node.ID,
+			Data: []graphMLData{
+				{"label_major", node.LabelMajor},
+				{"label_minor", node.LabelMinor},
+				{"rank", node.Rank},
+				{"pseudo", strconv.FormatBool(node.Pseudo)},
+			},
+		})
+	}
+	edges(nodes, func(from, to string) {
+		e := graphMLEdge{ID: from + "->" + to, Source: from, Target: to}
+		names, attrs := edgeAttrs(edge(from, to))
+		for _, name := range names {
+			e.Data = append(e.Data, graphMLData{name, attrs[name]})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, e)
+	})
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+type jsonGraph struct {
+	Graph jsonGraphGraph `json:"graph"`
+}
+
+type jsonGraphGraph struct {
+	Directed bool            `json:"directed"`
+	Nodes    []jsonGraphNode `json:"nodes"`
+	Edges    []jsonGraphEdge `json:"edges"`
+}
+
+type jsonGraphNode struct {
+	ID       string            `json:"id"`
+	Label    string            `json:"label"`
+	Metadata jsonGraphNodeMeta `json:"metadata"`
+}
+
+type jsonGraphNodeMeta struct {
+	LabelMinor string `json:"label_minor,omitempty"`
+	Rank       string `json:"rank,omitempty"`
+	Pseudo     bool   `json:"pseudo"`
+}
+
+type jsonGraphEdge struct {
+	Source   string              `json:"source"`
+	Target   string              `json:"target"`
+	Directed bool                `json:"directed"`
+	Metadata report.EdgeMetadata `json:"metadata"`
+}
+
+// JSONGraph writes the nodes in JSON Graph Format.
+func JSONGraph(w io.Writer, nodes render.RenderableNodes, edge EdgeFunc) error {
+	doc := jsonGraph{Graph: jsonGraphGraph{
+		Directed: true,
+		Nodes:    []jsonGraphNode{},
+		Edges:    []jsonGraphEdge{},
+	}}
+	for _, node := range sortedNodes(nodes) {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, jsonGraphNode{
+			ID:    node.ID,
+			Label: node.LabelMajor,
+			Metadata: jsonGraphNodeMeta{
+				LabelMinor: node.LabelMinor,
+				Rank:       node.Rank,
+				Pseudo:     node.Pseudo,
+			},
+		})
+	}
+	edges(nodes, func(from, to string) {
+		doc.Graph.Edges = append(doc.Graph.Edges, jsonGraphEdge{
+			Source:   from,
+			Target:   to,
+			Directed: true,
+			Metadata: edge(from, to),
+		})
+	})
+	return json.NewEncoder(w).Encode(doc)
+}
@@ -0,0 +1,179 @@
+package export_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/export"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+func newu64(value uint64) *uint64 { return &value }
+
+var (
+	nodes = render.RenderableNodes{
+		"client":      {ID: "client", LabelMajor: "curl", LabelMinor: "host-a", Rank: "curl", Node: report.MakeNode().WithAdjacent("server")},
+		"server":      {ID: "server", LabelMajor: "apache", LabelMinor: "host-b", Rank: "apache", Node: report.MakeNode().WithAdjacent("gone")},
+		"theinternet": {ID: "theinternet", LabelMajor: "The Internet", Pseudo: true, Node: report.MakeNode().WithAdjacent("server")},
+	}
+	edge = func(from, to string) report.EdgeMetadata {
+		if from == "client" {
+			return report.EdgeMetadata{EgressPacketCount: newu64(10), MaxConnCountTCP: newu64(2)}
+		}
+		return report.EdgeMetadata{}
+	}
+)
+
+func TestDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.DOT(&buf, nodes, edge); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph G {
+	"client" [label="curl", label_minor="host-a", node_rank="curl"];
+	"server" [label="apache", label_minor="host-b", node_rank="apache"];
+	"theinternet" [label="The Internet", label_minor="", node_rank="", pseudo=true, style=dashed];
+	"client" -> "server" [egress_packet_count="10", max_conn_count_tcp="2"];
+	"theinternet" -> "server";
+}
+`
+	if have := buf.String(); want != have {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.GraphML(&buf, nodes, edge); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID string `xml:"id,attr"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+				Data   []struct {
+					Key   string `xml:"key,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"data"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 3, len(doc.Graph.Nodes); want != have {
+		t.Fatalf("want %d nodes, have %d", want, have)
+	}
+	if want, have := 2, len(doc.Graph.Edges); want != have {
+		t.Fatalf("want %d edges, have %d", want, have)
+	}
+	e := doc.Graph.Edges[0]
+	if e.Source != "client" || e.Target != "server" || len(e.Data) != 2 || e.Data[0].Key != "egress_packet_count" || e.Data[0].Value != "10" {
+		t.Errorf("bad edge: %+v", e)
+	}
+}
+
+func TestJSONGraph(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.JSONGraph(&buf, nodes, edge); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Graph struct {
+			Directed bool `json:"directed"`
+			Nodes    []struct {
+				ID       string `json:"id"`
+				Label    string `json:"label"`
+				Metadata struct {
+					Pseudo bool `json:"pseudo"`
+				} `json:"metadata"`
+			} `json:"nodes"`
+			Edges []struct {
+				Source   string              `json:"source"`
+				Target   string              `json:"target"`
+				Metadata report.EdgeMetadata `json:"metadata"`
+			} `json:"edges"`
+		} `json:"graph"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !doc.Graph.Directed || len(doc.Graph.Nodes) != 3 || len(doc.Graph.Edges) != 2 {
+		t.Fatalf("bad graph: %+v", doc.Graph)
+	}
+	if n := doc.Graph.Nodes[2]; n.ID != "theinternet" || n.Label != "The Internet" || !n.Metadata.Pseudo {
+		t.Errorf("bad node: %+v", n)
+	}
+	if e := doc.Graph.Edges[0]; e.Source != "client" || e.Target != "server" || *e.Metadata.MaxConnCountTCP != 2 {
+		t.Errorf("bad edge: %+v", e)
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	nodes := render.RenderableNodes{
+		"client": {ID: "client", LabelMajor: "curl", Rank: "curl", Node: report.MakeNodeWith(map[string]string{
+			"docker_label_app": "front\"end",
+			"docker_label_a-b": "dashed",
+		}).WithAdjacent("server")},
+		"server": {ID: "server", LabelMajor: "apache", Node: report.MakeNodeWith(map[string]string{
+			"docker_label_a.b": "dotted", // clashes with a-b, so left out
+		}).WithCounters(map[string]int{"containers": 2}).WithAdjacent("client")},
+		"theinternet": {ID: "theinternet", LabelMajor: "The Internet", Pseudo: true, Node: report.MakeNode().WithAdjacent("server")},
+	}
+	var buf bytes.Buffer
+	if err := export.Prometheus(&buf, "containers", nodes, edge, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP scope_topology_nodes Nodes in the topology.
+# TYPE scope_topology_nodes gauge
+scope_topology_nodes{topology="containers"} 3
+# HELP scope_topology_pseudo_nodes Pseudo nodes in the topology, such as the internet or unknown hosts.
+# TYPE scope_topology_pseudo_nodes gauge
+scope_topology_pseudo_nodes{topology="containers"} 1
+# HELP scope_topology_edges Edges between nodes of the topology.
+# TYPE scope_topology_edges gauge
+scope_topology_edges{topology="containers"} 3
+# HELP scope_topology_truncated Nodes and edges left out, over the limit on series.
+# TYPE scope_topology_truncated gauge
+scope_topology_truncated{topology="containers",kind="nodes"} 1
+scope_topology_truncated{topology="containers",kind="edges"} 1
+# HELP scope_node Nodes of the topology, with their docker labels; always 1.
+# TYPE scope_node gauge
+scope_node{topology="containers",id="client",name="curl",rank="curl",pseudo="false",label_a_b="dashed",label_app="front\"end"} 1
+scope_node{topology="containers",id="server",name="apache",pseudo="false"} 1
+# HELP scope_node_members Nodes each node is made of, such as the containers of an image, by kind.
+# TYPE scope_node_members gauge
+scope_node_members{topology="containers",id="server",name="apache",kind="containers"} 2
+# HELP scope_edge Edges between nodes of the topology; always 1.
+# TYPE scope_edge gauge
+scope_edge{topology="containers",from="client",from_name="curl",to="server",to_name="apache"} 1
+scope_edge{topology="containers",from="server",from_name="apache",to="client",to_name="curl"} 1
+# HELP scope_edge_connections TCP connections along an edge, at most.
+# TYPE scope_edge_connections gauge
+scope_edge_connections{topology="containers",from="client",from_name="curl",to="server",to_name="apache"} 2
+scope_edge_connections{topology="containers",from="server",from_name="apache",to="client",to_name="curl"} 0
+# HELP scope_edge_packets Packets sent along an edge, by direction.
+# TYPE scope_edge_packets gauge
+scope_edge_packets{topology="containers",from="client",from_name="curl",to="server",to_name="apache",direction="egress"} 10
+scope_edge_packets{topology="containers",from="client",from_name="curl",to="server",to_name="apache",direction="ingress"} 0
+scope_edge_packets{topology="containers",from="server",from_name="apache",to="client",to_name="curl",direction="egress"} 0
+scope_edge_packets{topology="containers",from="server",from_name="apache",to="client",to_name="curl",direction="ingress"} 0
+# HELP scope_edge_bytes Bytes sent along an edge, by direction.
+# TYPE scope_edge_bytes gauge
+scope_edge_bytes{topology="containers",from="client",from_name="curl",to="server",to_name="apache",direction="egress"} 0
+scope_edge_bytes{topology="containers",from="client",from_name="curl",to="server",to_name="apache",direction="ingress"} 0
+scope_edge_bytes{topology="containers",from="server",from_name="apache",to="client",to_name="curl",direction="egress"} 0
+scope_edge_bytes{topology="containers",from="server",from_name="apache",to="client",to_name="curl",direction="ingress"} 0
+`
+	if have := buf.String(); want != have {
+		t.Error(test.Diff(want, have))
+	}
+}
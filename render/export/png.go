@@ -0,0 +1,177 @@
+package export
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/layout"
+)
+
+// Sizes of the arrowheads and dashes, in pixels.
+const (
+	arrowLength = 10.0
+	arrowWidth  = 8.0
+	dashLength  = 4.0
+	dashGap     = 3.0
+	circleSteps = 48
+
+	// maxImageSize bounds the width and height of images, as layers of
+	// many nodes are laid out in a single row. Larger layouts are cut off.
+	maxImageSize = 4096
+)
+
+var (
+	edgeColor         = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	nodeFillColor     = color.RGBA{0xe8, 0xee, 0xf8, 0xff}
+	nodeStrokeColor   = color.RGBA{0x3d, 0x5a, 0x98, 0xff}
+	pseudoStrokeColor = color.RGBA{0x66, 0x66, 0x66, 0xff}
+	labelMinorColor   = pseudoStrokeColor
+)
+
+// PNG draws the nodes as a PNG image, as SVG does, for clients which can't
+// show SVG, such as chat services. Labels are drawn in a fixed-size bitmap
+// font.
+func PNG(w io.Writer, nodes render.RenderableNodes, edge EdgeFunc) error {
+	l := layout.Layered(nodes)
+	c := newCanvas(
+		int(math.Min(math.Ceil(l.Width), maxImageSize)),
+		int(math.Min(math.Ceil(l.Height), maxImageSize)),
+	)
+
+	for _, e := range l.Edges {
+		from, to := l.Nodes[e.From], l.Nodes[e.To]
+		dx, dy := to.X-from.X, to.Y-from.Y
+		length := math.Hypot(dx, dy)
+		if length <= 2*nodeRadius+arrowLength {
+			continue
+		}
+		ux, uy := dx/length, dy/length
+		tipX, tipY := to.X-ux*nodeRadius, to.Y-uy*nodeRadius
+		baseX, baseY := tipX-ux*arrowLength, tipY-uy*arrowLength
+		c.line(from.X+ux*nodeRadius, from.Y+uy*nodeRadius, baseX, baseY, edgeWidth(edge(e.From, e.To)), edgeColor)
+		c.polygon(edgeColor,
+			tipX, tipY,
+			baseX-uy*arrowWidth/2, baseY+ux*arrowWidth/2,
+			baseX+uy*arrowWidth/2, baseY-ux*arrowWidth/2,
+		)
+	}
+
+	for _, layer := range l.Layers {
+		for _, id := range layer {
+			node, p := nodes[id], l.Nodes[id]
+			if node.Pseudo {
+				c.polygon(color.White, p.X-nodeRadius, p.Y-nodeRadius, p.X+nodeRadius, p.Y-nodeRadius, p.X+nodeRadius, p.Y+nodeRadius, p.X-nodeRadius, p.Y+nodeRadius)
+				c.dashedSquare(p.X, p.Y, nodeRadius, pseudoStrokeColor)
+			} else {
+				c.circle(p.X, p.Y, nodeRadius+1, nodeStrokeColor)
+				c.circle(p.X, p.Y, nodeRadius-1, nodeFillColor)
+			}
+			c.text(p.X, p.Y+nodeRadius+14, truncate(node.LabelMajor), color.Black)
+			if node.LabelMinor != "" {
+				c.text(p.X, p.Y+nodeRadius+28, truncate(node.LabelMinor), labelMinorColor)
+			}
+		}
+	}
+	return png.Encode(w, c.img)
+}
+
+// canvas draws antialiased shapes on an image.
+type canvas struct {
+	img *image.RGBA
+	z   *vector.Rasterizer
+}
+
+func newCanvas(width, height int) *canvas {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	return &canvas{img: img, z: vector.NewRasterizer(0, 0)}
+}
+
+// polygon fills the polygon through the points, given as x, y pairs. Only
+// the polygon's bounds are rasterized, so small shapes are cheap to draw,
+// however big the image.
+func (c *canvas) polygon(col color.Color, points ...float64) {
+	minX, minY, maxX, maxY := points[0], points[1], points[0], points[1]
+	for i := 2; i+1 < len(points); i += 2 {
+		minX, maxX = math.Min(minX, points[i]), math.Max(maxX, points[i])
+		minY, maxY = math.Min(minY, points[i+1]), math.Max(maxY, points[i+1])
+	}
+	bounds := image.Rect(
+		int(math.Floor(minX)), int(math.Floor(minY)),
+		int(math.Ceil(maxX)), int(math.Ceil(maxY)),
+	).Intersect(c.img.Bounds())
+	if bounds.Empty() {
+		return
+	}
+
+	c.z.Reset(bounds.Dx(), bounds.Dy())
+	ox, oy := float64(bounds.Min.X), float64(bounds.Min.Y)
+	c.z.MoveTo(float32(points[0]-ox), float32(points[1]-oy))
+	for i := 2; i+1 < len(points); i += 2 {
+		c.z.LineTo(float32(points[i]-ox), float32(points[i+1]-oy))
+	}
+	c.z.ClosePath()
+	c.z.Draw(c.img, bounds, image.NewUniform(col), image.Point{})
+}
+
+func (c *canvas) line(x1, y1, x2, y2, width float64, col color.Color) {
+	length := math.Hypot(x2-x1, y2-y1)
+	if length == 0 {
+		return
+	}
+	// Offset the ends by half the width, perpendicular to the line.
+	nx, ny := -(y2-y1)/length*width/2, (x2-x1)/length*width/2
+	c.polygon(col, x1+nx, y1+ny, x2+nx, y2+ny, x2-nx, y2-ny, x1-nx, y1-ny)
+}
+
+func (c *canvas) circle(x, y, r float64, col color.Color) {
+	points := make([]float64, 0, 2*circleSteps)
+	for i := 0; i < circleSteps; i++ {
+		a := 2 * math.Pi * float64(i) / circleSteps
+		points = append(points, x+r*math.Cos(a), y+r*math.Sin(a))
+	}
+	c.polygon(col, points...)
+}
+
+// dashedSquare outlines the square centered on x, y with dashes, as SVG
+// draws pseudo nodes.
+func (c *canvas) dashedSquare(x, y, r float64, col color.Color) {
+	corners := [][2]float64{{x - r, y - r}, {x + r, y - r}, {x + r, y + r}, {x - r, y + r}}
+	for i, from := range corners {
+		to := corners[(i+1)%len(corners)]
+		length := math.Hypot(to[0]-from[0], to[1]-from[1])
+		ux, uy := (to[0]-from[0])/length, (to[1]-from[1])/length
+		for d := 0.0; d < length; d += dashLength + dashGap {
+			end := math.Min(d+dashLength, length)
+			c.line(from[0]+ux*d, from[1]+uy*d, from[0]+ux*end, from[1]+uy*end, 1, col)
+		}
+	}
+}
+
+// text draws s centered on x, with its baseline at y.
+func (c *canvas) text(x, y float64, s string, col color.Color) {
+	// The bitmap font has no ellipsis.
+	s = strings.Replace(s, "…", "...", -1)
+	d := font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(col),
+		Face: basicfont.Face7x13,
+	}
+	width := d.MeasureString(s)
+	d.Dot = fixed.Point26_6{
+		X: fixed.Int26_6(x*64) - width/2,
+		Y: fixed.Int26_6(y * 64),
+	}
+	d.DrawString(s)
+}
@@ -0,0 +1,72 @@
+package export_test
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/export"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.PNG(&buf, nodes, edge); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As big as the SVG, with something drawn on it.
+	var svg bytes.Buffer
+	if err := export.SVG(&svg, nodes, edge); err != nil {
+		t.Fatal(err)
+	}
+	var width, height int
+	if _, err := fmt.Sscanf(svg.String(), `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d"`, &width, &height); err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != width || size.Y != height {
+		t.Errorf("want %dx%d, have %v", width, height, size)
+	}
+	drawn := 0
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			if r, g, b, _ := img.At(x, y).RGBA(); r&g&b != 0xffff {
+				drawn++
+			}
+		}
+	}
+	if drawn == 0 {
+		t.Errorf("nothing drawn")
+	}
+}
+
+func TestPNGManyNodes(t *testing.T) {
+	// Unconnected nodes are laid out in a single row, wider than the image.
+	many := render.RenderableNodes{}
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("node-%d", i)
+		many[id] = render.RenderableNode{ID: id, LabelMajor: id, Pseudo: i%2 == 0, Node: report.MakeNode()}
+	}
+	begin := time.Now()
+	var buf bytes.Buffer
+	if err := export.PNG(&buf, many, edge); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(begin); took > time.Second {
+		t.Errorf("drawing %d nodes took %v", len(many), took)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X > 4096 || size.Y > 4096 {
+		t.Errorf("image too big: %v", size)
+	}
+}
@@ -0,0 +1,241 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/render"
+)
+
+// PolicyWriter writes the rules of a generated network policy to w.
+type PolicyWriter func(w io.Writer, rules []render.GeneratedRule) error
+
+// PolicyFormat is a format for network policies.
+type PolicyFormat struct {
+	ContentType string
+	Write       PolicyWriter
+}
+
+// PolicyFormats are the formats for network policies, by name.
+var PolicyFormats = map[string]PolicyFormat{
+	"json":       {"application/json", PolicyJSON},
+	"kubernetes": {"application/x-yaml", KubernetesNetworkPolicies},
+	"iptables":   {"text/plain; charset=utf-8", IPTables},
+}
+
+// PolicyJSON writes the rules as a render.Policy, which the app can audit.
+func PolicyJSON(w io.Writer, rules []render.GeneratedRule) error {
+	policy := render.Policy{Allow: []render.PolicyRule{}}
+	for _, rule := range rules {
+		policy.Allow = append(policy.Allow, rule.PolicyRule)
+	}
+	return json.NewEncoder(w).Encode(policy)
+}
+
+// namespaceNameLabel is the label Kubernetes gives namespaces, with their
+// name.
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// KubernetesNetworkPolicies writes the rules as Kubernetes NetworkPolicies
+// in YAML, one per destination, allowing ingress from the rules' sources.
+// Pods are selected by their labels, so only rules between containers
+// selected by pod label (grouped by pod_label.<name>), or from addresses, can
+// be expressed; the rest are left as comments.
+func KubernetesNetworkPolicies(w io.Writer, rules []render.GeneratedRule) error {
+	var (
+		ew      = &errWriter{w: w}
+		byDest  = map[string][]render.GeneratedRule{}
+		dests   = []string{}
+		names   = map[string]int{}
+		skipped = []string{}
+		byLabel = func(s render.PolicySelector) bool { return len(s.PodLabels) > 0 && len(s.Labels) == 0 }
+	)
+	for _, rule := range rules {
+		switch {
+		case !byLabel(rule.To):
+			skipped = append(skipped, describeRule(rule.PolicyRule)+" (destination not selected by pod label)")
+		case !byLabel(rule.From) && rule.From.CIDR == "":
+			skipped = append(skipped, describeRule(rule.PolicyRule)+" (source not selected by pod label)")
+		default:
+			key := rule.To.String()
+			if _, ok := byDest[key]; !ok {
+				dests = append(dests, key)
+			}
+			byDest[key] = append(byDest[key], rule)
+		}
+	}
+	sort.Strings(dests)
+
+	ew.printf("# Network policies generated by Scope from observed flows.\n")
+	for _, line := range skipped {
+		ew.printf("# Not expressible: %s\n", line)
+	}
+	for _, key := range dests {
+		rules := byDest[key]
+		to := rules[0].To
+		name := policyName(to)
+		if names[to.Namespace+"/"+name]++; names[to.Namespace+"/"+name] > 1 {
+			name += "-" + strconv.Itoa(names[to.Namespace+"/"+name])
+		}
+
+		ew.printf("---\napiVersion: networking.k8s.io/v1\nkind: NetworkPolicy\nmetadata:\n")
+		ew.printf("  name: %s\n", yamlString(name))
+		if to.Namespace != "" {
+			ew.printf("  namespace: %s\n", yamlString(to.Namespace))
+		}
+		ew.printf("spec:\n  podSelector:\n")
+		writeMatchLabels(ew, "    ", to.PodLabels)
+		ew.printf("  policyTypes:\n  - Ingress\n  ingress:\n")
+		for _, rule := range rules {
+			ew.printf("  # %s\n", describeRule(rule.PolicyRule))
+			ew.printf("  - from:\n")
+			if rule.From.CIDR != "" {
+				ew.printf("    - ipBlock:\n        cidr: %s\n", yamlString(rule.From.CIDR))
+			} else {
+				ew.printf("    - podSelector:\n")
+				writeMatchLabels(ew, "        ", rule.From.PodLabels)
+				if rule.From.Namespace != "" && rule.From.Namespace != to.Namespace {
+					ew.printf("      namespaceSelector:\n")
+					writeMatchLabels(ew, "        ", map[string]string{namespaceNameLabel: rule.From.Namespace})
+				}
+			}
+			if len(rule.Ports) > 0 {
+				ew.printf("    ports:\n")
+			}
+			for _, port := range rule.Ports {
+				ew.printf("    - protocol: TCP\n      port: %d\n", port)
+			}
+		}
+	}
+	return ew.err
+}
+
+func writeMatchLabels(ew *errWriter, indent string, labels map[string]string) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ew.printf("%smatchLabels:\n", indent)
+	for _, k := range keys {
+		ew.printf("%s  %s: %s\n", indent, yamlString(k), yamlString(labels[k]))
+	}
+}
+
+// yamlString quotes s for YAML, whose double-quoted strings are a superset
+// of JSON's.
+func yamlString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// policyName makes a name for the policy of the pods selected by s, valid
+// as the name of a Kubernetes object.
+func policyName(s render.PolicySelector) string {
+	parts := []string{"scope"}
+	keys := make([]string, 0, len(s.PodLabels))
+	for k := range s.PodLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, k, s.PodLabels[k])
+	}
+	name := strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, strings.Join(parts, "-")), "-")
+	if len(name) > 56 { // leaves room for a suffix, within 63
+		name = strings.TrimRight(name[:56], "-")
+	}
+	return name
+}
+
+func describeRule(rule render.PolicyRule) string {
+	ports := make([]string, 0, len(rule.Ports))
+	for _, port := range rule.Ports {
+		ports = append(ports, strconv.Itoa(port))
+	}
+	return rule.From.String() + " -> " + rule.To.String() + " on " + strings.Join(ports, ",")
+}
+
+const (
+	// policyChain is the iptables chain the generated rules are in.
+	policyChain = "SCOPE-POLICY"
+
+	// maxMultiport is the most ports the multiport match takes.
+	maxMultiport = 15
+)
+
+// IPTables writes the rules as iptables rules, in the format of
+// iptables-restore, accepting TCP connections between the addresses the
+// rules' ends were observed at, and dropping other TCP connections. Flows
+// are only observed over TCP, so other protocols, such as DNS over UDP, are
+// left alone. The rules are in their own chain, to jump to from others, e.g.
+// with -A DOCKER-USER -j SCOPE-POLICY, and are to be loaded with
+// iptables-restore --noflush, which replaces that chain and leaves the rest
+// of the table be. Only IPv4 addresses are included.
+func IPTables(w io.Writer, rules []render.GeneratedRule) error {
+	ew := &errWriter{w: w}
+	ew.printf("# Network policy generated by Scope from observed flows.\n")
+	ew.printf("# Load with iptables-restore --noflush, to keep the table's other chains.\n")
+	ew.printf("*filter\n:%s - [0:0]\n", policyChain)
+	ew.printf("-A %s -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT\n", policyChain)
+	for _, rule := range rules {
+		ew.printf("# %s\n", describeRule(rule.PolicyRule))
+		matches := portMatches(rule.Ports)
+		for _, src := range ipv4Addrs(rule.FromAddrs) {
+			for _, dst := range ipv4Addrs(rule.ToAddrs) {
+				for _, match := range matches {
+					ew.printf("-A %s -s %s/32 -d %s/32 -p tcp%s -j ACCEPT\n", policyChain, src, dst, match)
+				}
+			}
+		}
+	}
+	ew.printf("-A %s -p tcp -j DROP\nCOMMIT\n", policyChain)
+	return ew.err
+}
+
+// portMatches returns the iptables matches for the ports, in as many rules
+// as multiport needs.
+func portMatches(ports []int) []string {
+	switch len(ports) {
+	case 0:
+		return []string{""}
+	case 1:
+		return []string{" --dport " + strconv.Itoa(ports[0])}
+	}
+	result := []string{}
+	for len(ports) > 0 {
+		n := len(ports)
+		if n > maxMultiport {
+			n = maxMultiport
+		}
+		batch := make([]string, 0, n)
+		for _, port := range ports[:n] {
+			batch = append(batch, strconv.Itoa(port))
+		}
+		result = append(result, " -m multiport --dports "+strings.Join(batch, ","))
+		ports = ports[n:]
+	}
+	return result
+}
+
+func ipv4Addrs(addrs []string) []string {
+	result := []string{}
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+			result = append(result, ip.To4().String())
+		}
+	}
+	return result
+}
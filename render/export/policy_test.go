@@ -0,0 +1,140 @@
+package export_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/export"
+	"github.com/weaveworks/scope/test"
+)
+
+var rules = []render.GeneratedRule{
+	{
+		PolicyRule: render.PolicyRule{
+			From:  render.PolicySelector{CIDR: "51.52.53.54/32"},
+			To:    render.PolicySelector{PodLabels: map[string]string{"app": "db"}, Namespace: "prod"},
+			Ports: []int{5432},
+		},
+		FromAddrs: []string{"51.52.53.54"},
+		ToAddrs:   []string{"10.0.0.9"},
+	},
+	{
+		PolicyRule: render.PolicyRule{
+			From:  render.PolicySelector{PodLabels: map[string]string{"app": "web"}, Namespace: "front"},
+			To:    render.PolicySelector{PodLabels: map[string]string{"app": "db"}, Namespace: "prod"},
+			Ports: []int{5432, 5433},
+		},
+		FromAddrs: []string{"10.0.0.1", "fe80::1"},
+		ToAddrs:   []string{"10.0.0.9"},
+	},
+	{
+		PolicyRule: render.PolicyRule{
+			From:  render.PolicySelector{Image: "curl"},
+			To:    render.PolicySelector{CIDR: "8.8.8.8/32"},
+			Ports: []int{53},
+		},
+		FromAddrs: []string{"10.0.0.2"},
+		ToAddrs:   []string{"8.8.8.8"},
+	},
+	{
+		PolicyRule: render.PolicyRule{
+			From:  render.PolicySelector{Image: "scanner"},
+			To:    render.PolicySelector{CIDR: "10.0.0.9/32"},
+			Ports: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17},
+		},
+		FromAddrs: []string{"10.0.0.3"},
+		ToAddrs:   []string{"10.0.0.9"},
+	},
+}
+
+func TestPolicyJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.PolicyJSON(&buf, rules); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := render.ReadPolicy(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Allow) != len(rules) {
+		t.Errorf("want %d rules, have %d", len(rules), len(policy.Allow))
+	}
+}
+
+func TestKubernetesNetworkPolicies(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.KubernetesNetworkPolicies(&buf, rules); err != nil {
+		t.Fatal(err)
+	}
+	want := `# Network policies generated by Scope from observed flows.
+# Not expressible: image=curl -> cidr=8.8.8.8/32 on 53 (destination not selected by pod label)
+# Not expressible: image=scanner -> cidr=10.0.0.9/32 on 1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17 (destination not selected by pod label)
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: "scope-app-db"
+  namespace: "prod"
+spec:
+  podSelector:
+    matchLabels:
+      "app": "db"
+  policyTypes:
+  - Ingress
+  ingress:
+  # cidr=51.52.53.54/32 -> pod_label.app=db namespace=prod on 5432
+  - from:
+    - ipBlock:
+        cidr: "51.52.53.54/32"
+    ports:
+    - protocol: TCP
+      port: 5432
+  # pod_label.app=web namespace=front -> pod_label.app=db namespace=prod on 5432,5433
+  - from:
+    - podSelector:
+        matchLabels:
+          "app": "web"
+      namespaceSelector:
+        matchLabels:
+          "kubernetes.io/metadata.name": "front"
+    ports:
+    - protocol: TCP
+      port: 5432
+    - protocol: TCP
+      port: 5433
+`
+	if have := buf.String(); want != have {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestIPTables(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.IPTables(&buf, rules); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"# Network policy generated by Scope from observed flows.",
+		"# Load with iptables-restore --noflush, to keep the table's other chains.",
+		"*filter",
+		":SCOPE-POLICY - [0:0]",
+		"-A SCOPE-POLICY -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+		"# cidr=51.52.53.54/32 -> pod_label.app=db namespace=prod on 5432",
+		"-A SCOPE-POLICY -s 51.52.53.54/32 -d 10.0.0.9/32 -p tcp --dport 5432 -j ACCEPT",
+		"# pod_label.app=web namespace=front -> pod_label.app=db namespace=prod on 5432,5433",
+		"-A SCOPE-POLICY -s 10.0.0.1/32 -d 10.0.0.9/32 -p tcp -m multiport --dports 5432,5433 -j ACCEPT",
+		"# image=curl -> cidr=8.8.8.8/32 on 53",
+		"-A SCOPE-POLICY -s 10.0.0.2/32 -d 8.8.8.8/32 -p tcp --dport 53 -j ACCEPT",
+		"# image=scanner -> cidr=10.0.0.9/32 on 1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17",
+		"-A SCOPE-POLICY -s 10.0.0.3/32 -d 10.0.0.9/32 -p tcp -m multiport --dports 1,2,3,4,5,6,7,8,9,10,11,12,13,14,15 -j ACCEPT",
+		"-A SCOPE-POLICY -s 10.0.0.3/32 -d 10.0.0.9/32 -p tcp -m multiport --dports 16,17 -j ACCEPT",
+		"-A SCOPE-POLICY -p tcp -j DROP",
+		"COMMIT",
+		"",
+	}, "\n")
+	if have := buf.String(); want != have {
+		t.Error(test.Diff(want, have))
+	}
+}
@@ -0,0 +1,184 @@
+package export
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// PrometheusContentType is the content type of the Prometheus text format.
+const PrometheusContentType = "text/plain; version=0.0.4"
+
+// Limits on the series exported to Prometheus, which copes badly with many
+// series, or with labels coming and going.
+const (
+	DefaultMaxSeries = 1000 // nodes, and edges, per topology
+	maxNodeLabels    = 10   // docker labels per node
+)
+
+// Prometheus writes gauges describing the nodes and edges of a topology, in
+// the Prometheus text format. Series are labelled with the topology and the
+// nodes' IDs and names; node series also carry the nodes' docker labels, as
+// chosen by nodeLabelKeys. Beyond maxSeries nodes, or edges, the rest are
+// left out, in the order of their IDs, and counted in
+// scope_topology_truncated.
+func Prometheus(w io.Writer, topology string, nodes render.RenderableNodes, edge EdgeFunc, maxSeries int) error {
+	type edgeSeries struct {
+		from, to render.RenderableNode
+		md       report.EdgeMetadata
+	}
+	var (
+		exported = sortedNodes(nodes)
+		keys     = nodeLabelKeys(nodes)
+		pseudo   = 0
+		allEdges = 0
+		series   = []edgeSeries{}
+		pw       = &promWriter{ew: &errWriter{w: w}}
+	)
+	for _, node := range exported {
+		if node.Pseudo {
+			pseudo++
+		}
+	}
+	edges(nodes, func(from, to string) {
+		allEdges++
+		if len(series) < maxSeries {
+			series = append(series, edgeSeries{nodes[from], nodes[to], edge(from, to)})
+		}
+	})
+	if len(exported) > maxSeries {
+		exported = exported[:maxSeries]
+	}
+
+	topo := []string{"topology", topology}
+	pw.family("scope_topology_nodes", "Nodes in the topology.")
+	pw.sample(topo, float64(len(nodes)))
+	pw.family("scope_topology_pseudo_nodes", "Pseudo nodes in the topology, such as the internet or unknown hosts.")
+	pw.sample(topo, float64(pseudo))
+	pw.family("scope_topology_edges", "Edges between nodes of the topology.")
+	pw.sample(topo, float64(allEdges))
+	pw.family("scope_topology_truncated", "Nodes and edges left out, over the limit on series.")
+	pw.sample(append(topo, "kind", "nodes"), float64(len(nodes)-len(exported)))
+	pw.sample(append(topo, "kind", "edges"), float64(allEdges-len(series)))
+
+	nodeLabels := func(node render.RenderableNode) []string {
+		return []string{"topology", topology, "id", node.ID, "name", node.LabelMajor}
+	}
+	pw.family("scope_node", "Nodes of the topology, with their docker labels; always 1.")
+	for _, node := range exported {
+		labels := append(nodeLabels(node), "minor", node.LabelMinor, "rank", node.Rank, "pseudo", strconv.FormatBool(node.Pseudo))
+		for _, key := range keys {
+			labels = append(labels, key.name, node.Node.Metadata.Get(key.key))
+		}
+		pw.sample(labels, 1)
+	}
+	pw.family("scope_node_members", "Nodes each node is made of, such as the containers of an image, by kind.")
+	for _, node := range exported {
+		kinds := make([]string, 0, node.Node.Counters.Size())
+		node.Node.Counters.ForEach(func(kind string, _ int) {
+			kinds = append(kinds, kind)
+		})
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			pw.sample(append(nodeLabels(node), "kind", kind), float64(node.Node.Counters.Get(kind)))
+		}
+	}
+
+	edgeLabels := func(e edgeSeries) []string {
+		return []string{
+			"topology", topology,
+			"from", e.from.ID, "from_name", e.from.LabelMajor,
+			"to", e.to.ID, "to_name", e.to.LabelMajor,
+		}
+	}
+	pw.family("scope_edge", "Edges between nodes of the topology; always 1.")
+	for _, e := range series {
+		pw.sample(edgeLabels(e), 1)
+	}
+	pw.family("scope_edge_connections", "TCP connections along an edge, at most.")
+	for _, e := range series {
+		pw.sample(edgeLabels(e), value(e.md.MaxConnCountTCP))
+	}
+	pw.family("scope_edge_packets", "Packets sent along an edge, by direction.")
+	for _, e := range series {
+		pw.sample(append(edgeLabels(e), "direction", "egress"), value(e.md.EgressPacketCount))
+		pw.sample(append(edgeLabels(e), "direction", "ingress"), value(e.md.IngressPacketCount))
+	}
+	pw.family("scope_edge_bytes", "Bytes sent along an edge, by direction.")
+	for _, e := range series {
+		pw.sample(append(edgeLabels(e), "direction", "egress"), value(e.md.EgressByteCount))
+		pw.sample(append(edgeLabels(e), "direction", "ingress"), value(e.md.IngressByteCount))
+	}
+	return pw.ew.err
+}
+
+func value(v *uint64) float64 {
+	if v == nil {
+		return 0
+	}
+	return float64(*v)
+}
+
+// promWriter writes metric families, and their samples, in the text format.
+type promWriter struct {
+	ew   *errWriter
+	name string
+}
+
+func (p *promWriter) family(name, help string) {
+	p.name = name
+	p.ew.printf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// sample writes a sample of the current family. Labels are name, value
+// pairs; those with empty values are left out, as Prometheus would.
+func (p *promWriter) sample(labels []string, value float64) {
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		if labels[i+1] != "" {
+			pairs = append(pairs, labels[i]+`="`+labelValueEscaper.Replace(labels[i+1])+`"`)
+		}
+	}
+	p.ew.printf("%s{%s} %s\n", p.name, strings.Join(pairs, ","), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type labelKey struct{ key, name string }
+
+// nodeLabelKeys returns the metadata keys of the nodes' docker labels, and
+// the Prometheus label names for them, up to maxNodeLabels. Of keys with the
+// same label name, e.g. a.b and a-b, only the first is kept.
+func nodeLabelKeys(nodes render.RenderableNodes) []labelKey {
+	var (
+		result = []labelKey{}
+		names  = map[string]struct{}{}
+	)
+	for _, key := range render.GroupingKeys(nodes) {
+		name := "label_" + labelName(strings.TrimPrefix(key, docker.LabelPrefix))
+		if _, ok := names[name]; ok {
+			continue
+		}
+		names[name] = struct{}{}
+		if result = append(result, labelKey{key, name}); len(result) == maxNodeLabels {
+			break
+		}
+	}
+	return result
+}
+
+// labelName makes a valid Prometheus label name of s.
+func labelName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
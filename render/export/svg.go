@@ -0,0 +1,99 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/layout"
+	"github.com/weaveworks/scope/report"
+)
+
+// Sizes of the drawing, in pixels.
+const (
+	nodeRadius     = 24.0
+	maxEdgeWidth   = 8.0
+	maxLabelLength = 20
+)
+
+// SVG draws the nodes as an SVG image, laid out in layers. Pseudo nodes are
+// drawn as dashed boxes, and edges are thicker the more connections or
+// packets they carry.
+func SVG(w io.Writer, nodes render.RenderableNodes, edge EdgeFunc) error {
+	l := layout.Layered(nodes)
+	ew := &errWriter{w: w}
+	ew.printf(`<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif">`+"\n",
+		l.Width, l.Height, l.Width, l.Height)
+	ew.printf(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto">` +
+		`<path d="M 0 0 L 10 5 L 0 10 z" fill="#999"/></marker></defs>` + "\n")
+
+	for _, e := range l.Edges {
+		from, to := l.Nodes[e.From], l.Nodes[e.To]
+		// Stop at the edge of the nodes, not their centers.
+		dx, dy := to.X-from.X, to.Y-from.Y
+		length := math.Hypot(dx, dy)
+		if length <= 2*nodeRadius {
+			continue
+		}
+		ux, uy := dx/length, dy/length
+		ew.printf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#999" stroke-width="%.1f" marker-end="url(#arrow)"/>`+"\n",
+			from.X+ux*nodeRadius, from.Y+uy*nodeRadius, to.X-ux*nodeRadius, to.Y-uy*nodeRadius,
+			edgeWidth(edge(e.From, e.To)))
+	}
+
+	for _, layer := range l.Layers {
+		for _, id := range layer {
+			node, p := nodes[id], l.Nodes[id]
+			ew.printf(`<g id="%s">`, escape(id))
+			if node.Pseudo {
+				ew.printf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="6" fill="#fff" stroke="#666" stroke-dasharray="4,3"/>`,
+					p.X-nodeRadius, p.Y-nodeRadius, 2*nodeRadius, 2*nodeRadius)
+			} else {
+				ew.printf(`<circle cx="%.1f" cy="%.1f" r="%.1f" fill="#e8eef8" stroke="#3d5a98" stroke-width="2"/>`,
+					p.X, p.Y, nodeRadius)
+			}
+			ew.printf(`<text x="%.1f" y="%.1f" text-anchor="middle" font-size="12">%s</text>`,
+				p.X, p.Y+nodeRadius+14, escape(truncate(node.LabelMajor)))
+			if node.LabelMinor != "" {
+				ew.printf(`<text x="%.1f" y="%.1f" text-anchor="middle" font-size="10" fill="#666">%s</text>`,
+					p.X, p.Y+nodeRadius+26, escape(truncate(node.LabelMinor)))
+			}
+			ew.printf("</g>\n")
+		}
+	}
+	ew.printf("</svg>\n")
+	return ew.err
+}
+
+// edgeWidth grows logarithmically with the connections, or failing that the
+// packets, on an edge.
+func edgeWidth(md report.EdgeMetadata) float64 {
+	var weight uint64
+	switch {
+	case md.MaxConnCountTCP != nil:
+		weight = *md.MaxConnCountTCP
+	case md.EgressPacketCount != nil || md.IngressPacketCount != nil:
+		if md.EgressPacketCount != nil {
+			weight += *md.EgressPacketCount
+		}
+		if md.IngressPacketCount != nil {
+			weight += *md.IngressPacketCount
+		}
+	}
+	return math.Min(1+math.Log2(1+float64(weight)), maxEdgeWidth)
+}
+
+func truncate(label string) string {
+	if runes := []rune(label); len(runes) > maxLabelLength {
+		return string(runes[:maxLabelLength]) + "…"
+	}
+	return label
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
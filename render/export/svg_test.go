@@ -0,0 +1,51 @@
+package export_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/render/export"
+)
+
+func TestSVG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.SVG(&buf, nodes, edge); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		XMLName xml.Name `xml:"svg"`
+		Lines   []struct {
+			Width float64 `xml:"stroke-width,attr"`
+		} `xml:"line"`
+		Groups []struct {
+			ID      string     `xml:"id,attr"`
+			Circles []struct{} `xml:"circle"`
+			Rects   []struct{} `xml:"rect"`
+			Texts   []string   `xml:"text"`
+		} `xml:"g"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if want, have := 3, len(doc.Groups); want != have {
+		t.Fatalf("want %d nodes, have %d", want, have)
+	}
+	for _, g := range doc.Groups {
+		pseudo := g.ID == "theinternet"
+		if pseudo != (len(g.Rects) == 1) || pseudo == (len(g.Circles) == 1) {
+			t.Errorf("%s: wrong shape", g.ID)
+		}
+	}
+	if want, have := 2, len(doc.Lines); want != have {
+		t.Fatalf("want %d edges, have %d", want, have)
+	}
+	// The client's edge carries connections, so it's thicker.
+	if doc.Lines[0].Width <= doc.Lines[1].Width {
+		t.Errorf("edge widths: %v", doc.Lines)
+	}
+	if !strings.Contains(buf.String(), ">curl</text>") {
+		t.Errorf("no label in %s", buf.String())
+	}
+}
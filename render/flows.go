@@ -0,0 +1,257 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+)
+
+// maxFlowAddrs bounds the addresses kept for each end of a flow record, as
+// containers get new ones when they're replaced.
+const maxFlowAddrs = 64
+
+// FlowEnd identifies an end of a flow by what outlives its containers:
+// their image, and Kubernetes pod labels and namespace. Ends which aren't
+// containers, such as the internet, are identified by their address.
+// Docker labels are left out, as some, such as the number compose gives
+// a container, change whenever a container is replaced.
+type FlowEnd struct {
+	Image     string            `json:"image,omitempty"`
+	PodLabels map[string]string `json:"pod_labels,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	Address   string            `json:"address,omitempty"`
+}
+
+// Flow is a kind of TCP connection between nodes: from a client to a port
+// of a server.
+type Flow struct {
+	From FlowEnd `json:"from"`
+	To   FlowEnd `json:"to"`
+	Port int     `json:"port"`
+}
+
+// Key identifies the flow.
+func (f Flow) Key() string {
+	// Maps are encoded in the order of their keys.
+	key, _ := json.Marshal(f)
+	return string(key)
+}
+
+// FlowRecord is a flow, when it was observed, the addresses its ends were
+// observed at, and the Docker labels of its ends when last observed.
+type FlowRecord struct {
+	Flow
+	FromAddrs  []string          `json:"from_addrs"`
+	ToAddrs    []string          `json:"to_addrs"`
+	FromLabels map[string]string `json:"from_labels,omitempty"`
+	ToLabels   map[string]string `json:"to_labels,omitempty"`
+	FirstSeen  time.Time         `json:"first_seen"`
+	LastSeen   time.Time         `json:"last_seen"`
+}
+
+// Merge merges two records of the same flow. The labels are those of the
+// record last seen.
+func (r FlowRecord) Merge(other FlowRecord) FlowRecord {
+	result := r
+	result.FromAddrs = mergeAddrs(r.FromAddrs, other.FromAddrs)
+	result.ToAddrs = mergeAddrs(r.ToAddrs, other.ToAddrs)
+	if other.FirstSeen.Before(r.FirstSeen) {
+		result.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen.After(r.LastSeen) {
+		result.LastSeen = other.LastSeen
+		result.FromLabels, result.ToLabels = other.FromLabels, other.ToLabels
+	}
+	return result
+}
+
+// mergeAddrs returns the sorted union of two lists of addresses, keeping
+// the first maxFlowAddrs.
+func mergeAddrs(a, b []string) []string {
+	set := map[string]struct{}{}
+	for _, addrs := range [][]string{a, b} {
+		for _, addr := range addrs {
+			set[addr] = struct{}{}
+		}
+	}
+	result := make([]string, 0, len(set))
+	for addr := range set {
+		result = append(result, addr)
+	}
+	sort.Strings(result)
+	if len(result) > maxFlowAddrs {
+		result = result[:maxFlowAddrs]
+	}
+	return result
+}
+
+// ObservedFlows returns the flows along the edges between nodes, as told by
+// the connections between their endpoints, keyed by Flow.Key. They're
+// recorded as seen at now.
+func ObservedFlows(rpt report.Report, nodes RenderableNodes, now time.Time) map[string]FlowRecord {
+	result := map[string]FlowRecord{}
+	for _, from := range nodes {
+		for _, id := range from.Adjacency {
+			to, ok := nodes[id]
+			if !ok {
+				continue
+			}
+			edgeConnections(rpt, from, to, func(fromAddr, toAddr, port string) {
+				p, err := strconv.Atoi(port)
+				if err != nil {
+					return
+				}
+				flow := Flow{From: flowEnd(rpt, from, fromAddr), To: flowEnd(rpt, to, toAddr), Port: p}
+				record := FlowRecord{
+					Flow:       flow,
+					FromAddrs:  []string{fromAddr},
+					ToAddrs:    []string{toAddr},
+					FromLabels: dockerLabels(from),
+					ToLabels:   dockerLabels(to),
+					FirstSeen:  now,
+					LastSeen:   now,
+				}
+				key := flow.Key()
+				if existing, ok := result[key]; ok {
+					record = existing.Merge(record)
+				}
+				result[key] = record
+			})
+		}
+	}
+	return result
+}
+
+func flowEnd(rpt report.Report, n RenderableNode, addr string) FlowEnd {
+	if n.Pseudo {
+		return FlowEnd{Address: addr}
+	}
+	end := FlowEnd{
+		Image:     n.Metadata.Get(docker.ImageName),
+		Namespace: n.Metadata.Get(kubernetes.Namespace),
+	}
+	if labels := podLabels(rpt, n); len(labels) > 0 {
+		end.PodLabels = labels
+	}
+	if end.Image == "" {
+		end.Image = n.Metadata.Get(docker.ImageID)
+	}
+	return end
+}
+
+// dockerLabels returns the Docker labels of a node, or nil if it has none.
+func dockerLabels(n RenderableNode) map[string]string {
+	var labels map[string]string
+	n.Metadata.ForEach(func(k, v string) {
+		if strings.HasPrefix(k, docker.LabelPrefix) {
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[strings.TrimPrefix(k, docker.LabelPrefix)] = v
+		}
+	})
+	return labels
+}
+
+// GeneratedRule is a rule of a policy generated from flows, with the
+// addresses its ends were observed at.
+type GeneratedRule struct {
+	PolicyRule
+	FromAddrs []string `json:"from_addrs"`
+	ToAddrs   []string `json:"to_addrs"`
+}
+
+// GeneratePolicy returns the fewest rules allowing the flows, one per pair
+// of ends, with containers selected by groupBy: "image", "label.<name>" for
+// a Docker label, or "pod_label.<name>" for a Kubernetes pod label.
+// Containers without the label are selected by image, and other ends by
+// address. Selectors include the containers' Kubernetes namespace, if any.
+// The rules are to be written out, and read back with ReadPolicy to audit
+// them.
+func GeneratePolicy(records []FlowRecord, groupBy string) ([]GeneratedRule, error) {
+	var label, podLabel string
+	switch {
+	case groupBy == "image":
+	case strings.HasPrefix(groupBy, "label.") && groupBy != "label.":
+		label = strings.TrimPrefix(groupBy, "label.")
+	case strings.HasPrefix(groupBy, "pod_label.") && groupBy != "pod_label.":
+		podLabel = strings.TrimPrefix(groupBy, "pod_label.")
+	default:
+		return nil, fmt.Errorf("invalid grouping %q: want image, label.<name> or pod_label.<name>", groupBy)
+	}
+
+	rules := map[string]GeneratedRule{}
+	for _, record := range records {
+		var (
+			from = flowSelector(record.From, record.FromLabels, label, podLabel)
+			to   = flowSelector(record.To, record.ToLabels, label, podLabel)
+		)
+		key := PolicyRule{From: from, To: to}
+		k, _ := json.Marshal(key)
+		rule, ok := rules[string(k)]
+		if !ok {
+			rule = GeneratedRule{PolicyRule: key}
+		}
+		rule.Ports = addPort(rule.Ports, record.Port)
+		rule.FromAddrs = mergeAddrs(rule.FromAddrs, record.FromAddrs)
+		rule.ToAddrs = mergeAddrs(rule.ToAddrs, record.ToAddrs)
+		rules[string(k)] = rule
+	}
+
+	keys := make([]string, 0, len(rules))
+	for k := range rules {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := make([]GeneratedRule, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, rules[k])
+	}
+	return result, nil
+}
+
+// flowSelector selects an end of a flow by the Docker label, as found in
+// labels, or pod label, if it has it, or else by image; or by address, for
+// ends which aren't containers.
+func flowSelector(end FlowEnd, labels map[string]string, label, podLabel string) PolicySelector {
+	if end.Address != "" {
+		ip := net.ParseIP(end.Address)
+		if ip == nil {
+			return PolicySelector{}
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		network := net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		return PolicySelector{CIDR: network.String()}
+	}
+	selector := PolicySelector{Namespace: end.Namespace}
+	if v, ok := end.PodLabels[podLabel]; ok && podLabel != "" {
+		selector.PodLabels = map[string]string{podLabel: v}
+	} else if v, ok := labels[label]; ok && label != "" {
+		selector.Labels = map[string]string{label: v}
+	} else {
+		selector.Image = end.Image
+	}
+	return selector
+}
+
+func addPort(ports []int, port int) []int {
+	for _, p := range ports {
+		if p == port {
+			return ports
+		}
+	}
+	ports = append(ports, port)
+	sort.Ints(ports)
+	return ports
+}
@@ -0,0 +1,165 @@
+package render_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+var (
+	clientEnd = render.FlowEnd{Image: test.ClientContainerImageID, Namespace: "ping"}
+	serverEnd = render.FlowEnd{
+		Image:     test.ServerContainerImageID,
+		PodLabels: map[string]string{"app": "pong"},
+		Namespace: "ping",
+	}
+	serverLabels = map[string]string{"com.amazonaws.ecs.container-name": "server", "foo1": "bar1", "foo2": "bar2"}
+)
+
+func TestObservedFlows(t *testing.T) {
+	var (
+		now   = time.Unix(1, 0)
+		nodes = render.ContainerWithImageNameRenderer.Render(test.Report)
+		want  = []render.FlowRecord{
+			{
+				Flow:      render.Flow{From: clientEnd, To: serverEnd, Port: 80},
+				FromAddrs: []string{test.ClientIP},
+				ToAddrs:   []string{test.ServerIP},
+				ToLabels:  serverLabels,
+			},
+			{
+				Flow:      render.Flow{From: render.FlowEnd{Address: test.ServerIP}, To: render.FlowEnd{Address: test.GoogleIP}, Port: 80},
+				FromAddrs: []string{test.ServerIP},
+				ToAddrs:   []string{test.GoogleIP},
+			},
+			{
+				Flow:      render.Flow{From: render.FlowEnd{Address: test.RandomClientIP}, To: serverEnd, Port: 80},
+				FromAddrs: []string{test.RandomClientIP},
+				ToAddrs:   []string{test.ServerIP},
+				ToLabels:  serverLabels,
+			},
+		}
+	)
+	have := render.ObservedFlows(test.Report, nodes, now)
+	if len(have) != len(want) {
+		t.Fatalf("want %d flows, have %d", len(want), len(have))
+	}
+	for _, record := range want {
+		record.FirstSeen, record.LastSeen = now, now
+		if h := have[record.Key()]; !reflect.DeepEqual(record, h) {
+			t.Error(test.Diff(record, h))
+		}
+	}
+}
+
+func TestObservedFlowsOutliveContainers(t *testing.T) {
+	// A replacement container, numbered differently by compose.
+	rpt := test.Report.Copy()
+	containers := rpt.Topologies[report.Container]
+	server := containers.Nodes.Get(test.ServerContainerNodeID)
+	containers.Nodes = containers.Nodes.Set(test.ServerContainerNodeID, server.WithMetadata(map[string]string{
+		docker.LabelPrefix + "com.docker.compose.container-number": "2",
+	}))
+	rpt.Topologies[report.Container] = containers
+
+	var (
+		nodes  = render.ContainerWithImageNameRenderer.Render(test.Report)
+		before = render.ObservedFlows(test.Report, nodes, time.Unix(1, 0))
+		after  = render.ObservedFlows(rpt, render.ContainerWithImageNameRenderer.Render(rpt), time.Unix(2, 0))
+	)
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			t.Errorf("new flow %s", key)
+		}
+	}
+}
+
+func TestFlowRecordMerge(t *testing.T) {
+	var (
+		flow = render.Flow{From: clientEnd, To: serverEnd, Port: 80}
+		a    = render.FlowRecord{Flow: flow, FromAddrs: []string{"10.0.0.2"}, ToAddrs: []string{"10.0.0.9"}, ToLabels: map[string]string{"n": "1"}, FirstSeen: time.Unix(1, 0), LastSeen: time.Unix(2, 0)}
+		b    = render.FlowRecord{Flow: flow, FromAddrs: []string{"10.0.0.1", "10.0.0.2"}, ToAddrs: []string{"10.0.0.9"}, ToLabels: map[string]string{"n": "2"}, FirstSeen: time.Unix(2, 0), LastSeen: time.Unix(3, 0)}
+		want = render.FlowRecord{Flow: flow, FromAddrs: []string{"10.0.0.1", "10.0.0.2"}, ToAddrs: []string{"10.0.0.9"}, ToLabels: map[string]string{"n": "2"}, FirstSeen: time.Unix(1, 0), LastSeen: time.Unix(3, 0)}
+	)
+	for _, have := range []render.FlowRecord{a.Merge(b), b.Merge(a)} {
+		if !reflect.DeepEqual(want, have) {
+			t.Error(test.Diff(want, have))
+		}
+	}
+}
+
+func TestGeneratePolicy(t *testing.T) {
+	records := []render.FlowRecord{
+		{Flow: render.Flow{From: clientEnd, To: serverEnd, Port: 80}, FromAddrs: []string{"10.0.0.1"}, ToAddrs: []string{"10.0.0.9"}, ToLabels: serverLabels},
+		{Flow: render.Flow{From: clientEnd, To: serverEnd, Port: 443}, FromAddrs: []string{"10.0.0.2"}, ToAddrs: []string{"10.0.0.9"}, ToLabels: serverLabels},
+		{Flow: render.Flow{From: render.FlowEnd{Address: "51.52.53.54"}, To: serverEnd, Port: 80}, FromAddrs: []string{"51.52.53.54"}, ToAddrs: []string{"10.0.0.9"}, ToLabels: serverLabels},
+	}
+
+	for _, groupBy := range []string{"", "label", "label.", "labels.foo1", "pod_label.", "name"} {
+		if _, err := render.GeneratePolicy(records, groupBy); err == nil {
+			t.Errorf("%q: expected error", groupBy)
+		}
+	}
+
+	want := []render.PolicyRule{
+		{
+			From:  render.PolicySelector{CIDR: "51.52.53.54/32"},
+			To:    render.PolicySelector{Labels: map[string]string{"foo1": "bar1"}, Namespace: "ping"},
+			Ports: []int{80},
+		},
+		{
+			From:  render.PolicySelector{Image: test.ClientContainerImageID, Namespace: "ping"},
+			To:    render.PolicySelector{Labels: map[string]string{"foo1": "bar1"}, Namespace: "ping"},
+			Ports: []int{80, 443},
+		},
+	}
+	rules, _ := render.GeneratePolicy(records, "label.foo1")
+	have := []render.PolicyRule{}
+	for _, rule := range rules {
+		have = append(have, rule.PolicyRule)
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if want, have := []string{"10.0.0.1", "10.0.0.2"}, rules[1].FromAddrs; !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestGeneratedPolicyAllowsFlows(t *testing.T) {
+	var (
+		nodes     = render.ContainerWithImageNameRenderer.Render(test.Report)
+		records   = []render.FlowRecord{}
+		generated = render.Policy{}
+	)
+	for _, record := range render.ObservedFlows(test.Report, nodes, time.Now()) {
+		records = append(records, record)
+	}
+	rules, err := render.GeneratePolicy(records, "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range rules {
+		generated.Allow = append(generated.Allow, rule.PolicyRule)
+	}
+
+	// As read back from JSON, as the app would.
+	buf, err := json.Marshal(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := render.ReadPolicy(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := policy.Violations(test.Report, nodes); len(have) != 0 {
+		t.Errorf("expected no violations, have %v", have)
+	}
+}
@@ -0,0 +1,115 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+)
+
+const groupMembersKey = "group_members"
+
+// Nouns name the nodes of a topology, for counting them in labels, e.g.
+// "container" and "containers".
+type Nouns struct {
+	Singular, Plural string
+}
+
+// Count returns a count of nodes, e.g. "1 container" or "2 containers".
+func (n Nouns) Count(count int) string {
+	if count == 1 {
+		return "1 " + n.Singular
+	}
+	return fmt.Sprintf("%d %s", count, n.Plural)
+}
+
+// MakeGroupID makes a group node ID for rendered nodes, for nodes grouped
+// by the value of a metadata key.
+func MakeGroupID(key, value string) string {
+	return fmt.Sprintf("group:%s:%s", key, value)
+}
+
+// MapGroupBy returns a MapFunc which maps nodes to a node per distinct value
+// of the metadata key. Pseudo nodes are passed straight through, and nodes
+// without the key are grouped into a single pseudo node.
+func MapGroupBy(key string) MapFunc {
+	return func(n RenderableNode, _ report.Networks) RenderableNodes {
+		if n.Pseudo {
+			return RenderableNodes{n.ID: n}
+		}
+
+		value, ok := n.Node.Metadata.Lookup(key)
+		if !ok {
+			id := MakePseudoNodeID("group", key)
+			node := newDerivedPseudoNode(id, "Other", n)
+			node.LabelMinor = "no " + GroupingName(key)
+			return RenderableNodes{id: node}
+		}
+
+		// Add the group members key, which will later be counted to produce
+		// the minor label
+		id := MakeGroupID(key, value)
+		node := NewDerivedNode(id, n)
+		node.LabelMajor = value
+		node.Rank = key
+		node.Node.Counters = node.Node.Counters.Set(groupMembersKey, 1)
+		return RenderableNodes{id: node}
+	}
+}
+
+// MapCountGroup returns a MapFunc which maps 1:1 group nodes, counting the
+// number of members grouped together and putting that info in the minor
+// label.
+func MapCountGroup(nouns Nouns) MapFunc {
+	return func(n RenderableNode, _ report.Networks) RenderableNodes {
+		if n.Pseudo {
+			return RenderableNodes{n.ID: n}
+		}
+
+		n.LabelMinor = nouns.Count(n.Node.Counters.Get(groupMembersKey))
+		return RenderableNodes{n.ID: n}
+	}
+}
+
+// GroupBy returns a Renderer which groups the nodes of r by the value of the
+// metadata key, e.g. containers by a Docker label, counting the members of
+// each group.
+func GroupBy(key string, nouns Nouns, r Renderer) Renderer {
+	return Map{
+		MapFunc: MapCountGroup(nouns),
+		Renderer: Map{
+			MapFunc:  MapGroupBy(key),
+			Renderer: r,
+		},
+	}
+}
+
+// GroupingKeys returns the metadata keys nodes can usefully be grouped by:
+// the Docker labels present on any of the (non-pseudo) nodes, sorted.
+func GroupingKeys(nodes RenderableNodes) []string {
+	keys := map[string]struct{}{}
+	for _, n := range nodes {
+		if n.Pseudo {
+			continue
+		}
+		n.Node.Metadata.ForEach(func(key, _ string) {
+			if strings.HasPrefix(key, docker.LabelPrefix) {
+				keys[key] = struct{}{}
+			}
+		})
+	}
+	result := make([]string, 0, len(keys))
+	for key := range keys {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// GroupingName returns the human-readable name of a grouping key, i.e. the
+// name of the Docker label for label keys, and the key itself otherwise.
+func GroupingName(key string) string {
+	return strings.TrimPrefix(key, docker.LabelPrefix)
+}
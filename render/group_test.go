@@ -0,0 +1,64 @@
+package render_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestGroupBy(t *testing.T) {
+	var (
+		key      = "docker_label_foo1"
+		groupID  = render.MakeGroupID(key, "bar1")
+		otherID  = render.MakePseudoNodeID("group", key)
+		rendered = render.GroupBy(key, render.Nouns{Singular: "container", Plural: "containers"}, render.ContainerRenderer).Render(test.Report)
+	)
+
+	ids := []string{}
+	for id := range rendered {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	want := []string{groupID, otherID, render.MakePseudoNodeID(render.UncontainedID, test.ServerHostName), render.TheInternetID}
+	sort.Strings(want)
+	if !reflect.DeepEqual(want, ids) {
+		t.Fatal(test.Diff(want, ids))
+	}
+
+	// The client container, without the label, connects to the server
+	// container, with it.
+	if want, have := []string{groupID}, []string(rendered[otherID].Adjacency); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if want, have := "bar1", rendered[groupID].LabelMajor; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := "1 container", rendered[groupID].LabelMinor; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestGroupingKeys(t *testing.T) {
+	want := []string{
+		docker.LabelPrefix + render.AmazonECSContainerNameLabel,
+		docker.LabelPrefix + "foo1",
+		docker.LabelPrefix + "foo2",
+	}
+	have := render.GroupingKeys(render.ContainerRenderer.Render(test.Report))
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestNounsCount(t *testing.T) {
+	nouns := render.Nouns{Singular: "process", Plural: "processes"}
+	for n, want := range map[int]string{0: "0 processes", 1: "1 process", 2: "2 processes"} {
+		if have := nouns.Count(n); want != have {
+			t.Errorf("%d: want %q, have %q", n, want, have)
+		}
+	}
+}
@@ -2,12 +2,13 @@ package render
 
 import (
 	"fmt"
+	"net"
 	"strings"
 )
 
 // MakeEndpointID makes an endpoint node ID for rendered nodes.
 func MakeEndpointID(hostID, addr, port string) string {
-	return fmt.Sprintf("endpoint:%s:%s:%s", hostID, addr, port)
+	return fmt.Sprintf("endpoint:%s:%s", hostID, net.JoinHostPort(addr, port))
 }
 
 // MakeProcessID makes a process node ID for rendered nodes.
@@ -17,7 +18,7 @@ func MakeProcessID(hostID, pid string) string {
 
 // MakeAddressID makes an address node ID for rendered nodes.
 func MakeAddressID(hostID, addr string) string {
-	return fmt.Sprintf("address:%s:%s", hostID, addr)
+	return fmt.Sprintf("address:%s:%s", hostID, formatAddr(addr))
 }
 
 // MakeHostID makes a host node ID for rendered nodes.
@@ -30,3 +31,12 @@ func MakeHostID(hostID string) string {
 func MakePseudoNodeID(parts ...string) string {
 	return strings.Join(append([]string{"pseudo"}, parts...), ":")
 }
+
+// formatAddr brackets IPv6 addresses, so they can be safely joined with
+// other colon-separated parts, like ports, in IDs and labels.
+func formatAddr(addr string) string {
+	if strings.Contains(addr, ":") {
+		return "[" + addr + "]"
+	}
+	return addr
+}
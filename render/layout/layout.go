@@ -0,0 +1,266 @@
+// Package layout places rendered topologies on a plane, so they can be
+// drawn without a browser.
+package layout
+
+import (
+	"sort"
+
+	"github.com/weaveworks/scope/render"
+)
+
+// Spacing of the layout, in pixels.
+const (
+	NodeSpacing  = 140.0
+	LayerSpacing = 120.0
+	Margin       = 80.0
+)
+
+// orderingSweeps is how many times the order of nodes within layers is
+// improved, going down and up the layers.
+const orderingSweeps = 8
+
+// Point is a position on the plane.
+type Point struct {
+	X, Y float64
+}
+
+// Edge is an edge between two laid out nodes.
+type Edge struct {
+	From, To string
+}
+
+// Layout is the position of every node of a topology.
+type Layout struct {
+	Width, Height float64
+	Nodes         map[string]Point
+	Layers        [][]string // node IDs by layer, top to bottom, in order
+	Edges         []Edge
+}
+
+// Layered lays out nodes in layers, such that edges point downwards, where
+// possible, and nodes of the same rank share a layer, where that doesn't
+// make edges point upwards. Within layers, nodes are ordered to reduce edge
+// crossings. This is a simple take on the Sugiyama method.
+func Layered(nodes render.RenderableNodes) Layout {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	edges := []Edge{}
+	for _, id := range ids {
+		adjacency := append([]string{}, nodes[id].Adjacency...)
+		sort.Strings(adjacency)
+		for _, to := range adjacency {
+			if _, ok := nodes[to]; ok && to != id {
+				edges = append(edges, Edge{From: id, To: to})
+			}
+		}
+	}
+
+	layers := assignLayers(ids, nodes, acyclic(ids, edges))
+	order := orderLayers(layers, edges)
+
+	layout := Layout{Nodes: map[string]Point{}, Layers: order, Edges: edges}
+	widest := 0
+	for _, layer := range order {
+		if len(layer) > widest {
+			widest = len(layer)
+		}
+	}
+	layout.Width = 2*Margin + float64(maxInt(widest-1, 0))*NodeSpacing
+	layout.Height = 2*Margin + float64(maxInt(len(order)-1, 0))*LayerSpacing
+	for l, layer := range order {
+		// Center each layer.
+		offset := (layout.Width - float64(len(layer)-1)*NodeSpacing) / 2
+		for i, id := range layer {
+			layout.Nodes[id] = Point{
+				X: offset + float64(i)*NodeSpacing,
+				Y: Margin + float64(l)*LayerSpacing,
+			}
+		}
+	}
+	return layout
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// acyclic returns the edges with those closing cycles reversed, found by a
+// depth first search.
+func acyclic(ids []string, edges []Edge) []Edge {
+	out := map[string][]string{}
+	for _, e := range edges {
+		out[e.From] = append(out[e.From], e.To)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		state    = map[string]int{}
+		reversed = map[Edge]bool{}
+		visit    func(id string)
+	)
+	visit = func(id string) {
+		state[id] = visiting
+		for _, to := range out[id] {
+			switch state[to] {
+			case unvisited:
+				visit(to)
+			case visiting:
+				reversed[Edge{From: id, To: to}] = true
+			}
+		}
+		state[id] = visited
+	}
+	for _, id := range ids {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+
+	result := make([]Edge, 0, len(edges))
+	for _, e := range edges {
+		if reversed[e] {
+			e = Edge{From: e.To, To: e.From}
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// assignLayers puts every node in the layer below all its predecessors, then
+// moves nodes of the same rank down to the same layer, as long as it keeps
+// converging.
+func assignLayers(ids []string, nodes render.RenderableNodes, dag []Edge) [][]string {
+	layer := map[string]int{}
+	propagate := func() bool {
+		changed := false
+		// Longest path layering; at most len(ids) rounds on a DAG.
+		for round := 0; round < len(ids); round++ {
+			roundChanged := false
+			for _, e := range dag {
+				if layer[e.To] < layer[e.From]+1 {
+					layer[e.To] = layer[e.From] + 1
+					roundChanged = true
+				}
+			}
+			if !roundChanged {
+				break
+			}
+			changed = true
+		}
+		return changed
+	}
+	propagate()
+
+	ranks := map[string][]string{}
+	for _, id := range ids {
+		if rank := nodes[id].Rank; rank != "" {
+			ranks[rank] = append(ranks[rank], id)
+		}
+	}
+	for round := 0; round < len(ids); round++ {
+		aligned := false
+		for _, members := range ranks {
+			deepest := 0
+			for _, id := range members {
+				if layer[id] > deepest {
+					deepest = layer[id]
+				}
+			}
+			for _, id := range members {
+				if layer[id] != deepest {
+					layer[id] = deepest
+					aligned = true
+				}
+			}
+		}
+		if !aligned || !propagate() {
+			break
+		}
+	}
+	// Ranks may have pulled nodes above their predecessors.
+	propagate()
+
+	layers := [][]string{}
+	for _, id := range ids {
+		for len(layers) <= layer[id] {
+			layers = append(layers, []string{})
+		}
+		layers[layer[id]] = append(layers[layer[id]], id)
+	}
+	// Drop any empty layers left by moving ranks.
+	result := [][]string{}
+	for _, l := range layers {
+		if len(l) > 0 {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+// orderLayers orders the nodes within each layer by the average position
+// of their neighbours, sweeping down and up the layers.
+func orderLayers(layers [][]string, edges []Edge) [][]string {
+	neighbours := map[string][]string{}
+	for _, e := range edges {
+		neighbours[e.From] = append(neighbours[e.From], e.To)
+		neighbours[e.To] = append(neighbours[e.To], e.From)
+	}
+	position := map[string]float64{}
+	for _, layer := range layers {
+		for i, id := range layer {
+			position[id] = float64(i)
+		}
+	}
+
+	reorder := func(layer []string) {
+		barycenter := map[string]float64{}
+		for _, id := range layer {
+			if len(neighbours[id]) == 0 {
+				barycenter[id] = position[id]
+				continue
+			}
+			sum := 0.0
+			for _, n := range neighbours[id] {
+				sum += position[n]
+			}
+			barycenter[id] = sum / float64(len(neighbours[id]))
+		}
+		sort.Stable(byBarycenter{layer, barycenter})
+		for i, id := range layer {
+			position[id] = float64(i)
+		}
+	}
+
+	for sweep := 0; sweep < orderingSweeps; sweep++ {
+		if sweep%2 == 0 {
+			for l := 1; l < len(layers); l++ {
+				reorder(layers[l])
+			}
+		} else {
+			for l := len(layers) - 2; l >= 0; l-- {
+				reorder(layers[l])
+			}
+		}
+	}
+	return layers
+}
+
+type byBarycenter struct {
+	ids        []string
+	barycenter map[string]float64
+}
+
+func (b byBarycenter) Len() int           { return len(b.ids) }
+func (b byBarycenter) Swap(i, j int)      { b.ids[i], b.ids[j] = b.ids[j], b.ids[i] }
+func (b byBarycenter) Less(i, j int) bool { return b.barycenter[b.ids[i]] < b.barycenter[b.ids[j]] }
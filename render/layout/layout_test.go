@@ -0,0 +1,83 @@
+package layout_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/render/layout"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+func node(id, rank string, adjacent ...string) render.RenderableNode {
+	n := render.RenderableNode{ID: id, Rank: rank, Node: report.MakeNode()}
+	for _, a := range adjacent {
+		n.Node = n.Node.WithAdjacent(a)
+	}
+	return n
+}
+
+func TestLayeredEdgesPointDown(t *testing.T) {
+	nodes := render.RenderableNodes{
+		"a": node("a", "", "b", "c"),
+		"b": node("b", "", "d"),
+		"c": node("c", "", "d"),
+		"d": node("d", "", "a"), // closes a cycle
+		"e": node("e", ""),
+	}
+	l := layout.Layered(nodes)
+	if want, have := len(nodes), len(l.Nodes); want != have {
+		t.Fatalf("want %d nodes, have %d", want, have)
+	}
+	upwards := 0
+	for _, e := range l.Edges {
+		if l.Nodes[e.From].Y >= l.Nodes[e.To].Y {
+			upwards++
+		}
+	}
+	// Only the edge closing the cycle can't point down.
+	if upwards != 1 {
+		t.Errorf("want 1 upward edge, have %d", upwards)
+	}
+	want := [][]string{{"a", "e"}, {"b", "c"}, {"d"}}
+	if !reflect.DeepEqual(want, l.Layers) {
+		t.Error(test.Diff(want, l.Layers))
+	}
+	for id, p := range l.Nodes {
+		if p.X < 0 || p.X > l.Width || p.Y < 0 || p.Y > l.Height {
+			t.Errorf("%s out of bounds: %v", id, p)
+		}
+	}
+}
+
+func TestLayeredRanks(t *testing.T) {
+	// Both apaches share a layer, although only one has a client.
+	nodes := render.RenderableNodes{
+		"curl":     node("curl", "curl", "apache-1"),
+		"apache-1": node("apache-1", "apache"),
+		"apache-2": node("apache-2", "apache", "db"),
+		"db":       node("db", "db"),
+	}
+	l := layout.Layered(nodes)
+	if a, b := l.Nodes["apache-1"].Y, l.Nodes["apache-2"].Y; a != b {
+		t.Errorf("apaches in different layers: %v, %v", a, b)
+	}
+	if l.Nodes["apache-2"].Y >= l.Nodes["db"].Y {
+		t.Errorf("db not below apache-2")
+	}
+}
+
+func TestLayeredOrdering(t *testing.T) {
+	// Without reordering, a1 -> b2 and a2 -> b1 cross.
+	nodes := render.RenderableNodes{
+		"a1": node("a1", "", "b2"),
+		"a2": node("a2", "", "b1"),
+		"b1": node("b1", ""),
+		"b2": node("b2", ""),
+	}
+	l := layout.Layered(nodes)
+	if (l.Nodes["a1"].X < l.Nodes["a2"].X) != (l.Nodes["b2"].X < l.Nodes["b1"].X) {
+		t.Errorf("edges cross: %v", l.Nodes)
+	}
+}
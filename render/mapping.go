@@ -9,6 +9,7 @@ import (
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/report"
 )
@@ -23,6 +24,7 @@ const (
 
 	containersKey = "containers"
 	processesKey  = "processes"
+	podsKey       = "pods"
 
 	AmazonECSContainerNameLabel = "com.amazonaws.ecs.container-name"
 )
@@ -37,57 +39,59 @@ type MapFunc func(RenderableNode, report.Networks) RenderableNodes
 // renderable node. As it is only ever run on endpoint topology nodes, we
 // expect that certain keys are present.
 func MapEndpointIdentity(m RenderableNode, local report.Networks) RenderableNodes {
-	addr, ok := m.Metadata[endpoint.Addr]
+	addr, ok := m.Metadata.Lookup(endpoint.Addr)
 	if !ok {
 		return RenderableNodes{}
 	}
 
-	port, ok := m.Metadata[endpoint.Port]
+	port, ok := m.Metadata.Lookup(endpoint.Port)
 	if !ok {
 		return RenderableNodes{}
 	}
 
 	// We only show nodes found through procspy in this view.
-	_, procspied := m.Metadata[endpoint.Procspied]
+	_, procspied := m.Metadata.Lookup(endpoint.Procspied)
 	if !procspied {
 		return RenderableNodes{}
 	}
 
 	// Nodes without a hostid are treated as psuedo nodes
-	if _, ok = m.Metadata[report.HostNodeID]; !ok {
+	if _, ok = m.Metadata.Lookup(report.HostNodeID); !ok {
 		// If the dstNodeAddr is not in a network local to this report, we emit an
 		// internet node
 		if ip := net.ParseIP(addr); ip != nil && !local.Contains(ip) {
-			return RenderableNodes{TheInternetID: newDerivedPseudoNode(TheInternetID, TheInternetMajor, m)}
+			return theInternetNode(m)
 		}
 
-		// We are a 'client' pseudo node if the port is in the ephemeral port range.
-		// Linux uses 32768 to 61000, IANA suggests 49152 to 65535.
-		if p, err := strconv.Atoi(port); err == nil && len(m.Adjacency) > 0 && p >= 32768 && p < 65535 {
-			// We only exist if there is something in our adjacency
+		// We are a 'client' pseudo node if we have an edge to a server.
+		if len(m.Adjacency) > 0 && isClientPort(m, port) {
 			// Generate a single pseudo node for every (client ip, server ip, server port)
 			dstNodeID := m.Adjacency[0]
 			serverIP, serverPort := trySplitAddr(dstNodeID)
-			outputID := MakePseudoNodeID(addr, serverIP, serverPort)
+			outputID := MakePseudoNodeID(formatAddr(addr), formatAddr(serverIP), serverPort)
 			return RenderableNodes{outputID: newDerivedPseudoNode(outputID, addr, m)}
 		}
 
 		// Otherwise (the server node is missing), generate a pseudo node for every (server ip, server port)
-		outputID := MakePseudoNodeID(addr, port)
+		outputID := MakePseudoNodeID(formatAddr(addr), port)
 		if port != "" {
-			return RenderableNodes{outputID: newDerivedPseudoNode(outputID, addr+":"+port, m)}
+			major := net.JoinHostPort(addr, port)
+			if service, ok := KnownServices[port]; ok {
+				major = fmt.Sprintf("%s (%s)", service, major)
+			}
+			return RenderableNodes{outputID: newDerivedPseudoNode(outputID, major, m)}
 		}
 		return RenderableNodes{outputID: newDerivedPseudoNode(outputID, addr, m)}
 	}
 
 	var (
 		id    = MakeEndpointID(report.ExtractHostID(m.Node), addr, port)
-		major = fmt.Sprintf("%s:%s", addr, port)
+		major = net.JoinHostPort(addr, port)
 		minor = report.ExtractHostID(m.Node)
 		rank  = major
 	)
 
-	pid, pidOK := m.Metadata[process.PID]
+	pid, pidOK := m.Metadata.Lookup(process.PID)
 	if pidOK {
 		minor = fmt.Sprintf("%s (%s)", minor, pid)
 	}
@@ -95,20 +99,40 @@ func MapEndpointIdentity(m RenderableNode, local report.Networks) RenderableNode
 	return RenderableNodes{id: NewRenderableNodeWith(id, major, minor, rank, m)}
 }
 
+// isClientPort returns true if the edges of a pseudo node can be trusted to
+// point from client to server. If the probe only guessed the direction from
+// the port numbers, we also require the port to be in the ephemeral port
+// range of the host the node is on, if known, or else the default range.
+func isClientPort(m RenderableNode, port string) bool {
+	if md, ok := m.Edges.Lookup(m.Adjacency[0]); ok && md.DirectionInferredFrom != "" &&
+		md.DirectionInferredFrom != report.DirectionFromPorts {
+		return true
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	}
+	ephemeral, err := ParsePortRange(m.Metadata.Get(host.EphemeralPorts))
+	if err != nil {
+		ephemeral = DefaultEphemeralPorts
+	}
+	return ephemeral.Contains(p)
+}
+
 // MapProcessIdentity maps a process topology node to a process renderable
 // node. As it is only ever run on process topology nodes, we expect that
 // certain keys are present.
 func MapProcessIdentity(m RenderableNode, _ report.Networks) RenderableNodes {
-	pid, ok := m.Metadata[process.PID]
+	pid, ok := m.Metadata.Lookup(process.PID)
 	if !ok {
 		return RenderableNodes{}
 	}
 
 	var (
 		id    = MakeProcessID(report.ExtractHostID(m.Node), pid)
-		major = m.Metadata["comm"]
+		major = m.Metadata.Get("comm")
 		minor = fmt.Sprintf("%s (%s)", report.ExtractHostID(m.Node), pid)
-		rank  = m.Metadata["comm"]
+		rank  = m.Metadata.Get("comm")
 	)
 
 	return RenderableNodes{id: NewRenderableNodeWith(id, major, minor, rank, m)}
@@ -118,7 +142,7 @@ func MapProcessIdentity(m RenderableNode, _ report.Networks) RenderableNodes {
 // renderable node. As it is only ever run on container topology nodes, we
 // expect that certain keys are present.
 func MapContainerIdentity(m RenderableNode, _ report.Networks) RenderableNodes {
-	id, ok := m.Metadata[docker.ContainerID]
+	id, ok := m.Metadata.Lookup(docker.ContainerID)
 	if !ok {
 		return RenderableNodes{}
 	}
@@ -126,11 +150,11 @@ func MapContainerIdentity(m RenderableNode, _ report.Networks) RenderableNodes {
 	var (
 		major, _ = GetRenderableContainerName(m.Node)
 		minor    = report.ExtractHostID(m.Node)
-		rank     = m.Metadata[docker.ImageID]
+		rank     = m.Metadata.Get(docker.ImageID)
 	)
 
 	node := NewRenderableNodeWith(id, major, minor, rank, m)
-	if imageID, ok := m.Metadata[docker.ImageID]; ok {
+	if imageID, ok := m.Metadata.Lookup(docker.ImageID); ok {
 		hostID, _, _ := report.ParseContainerNodeID(m.ID)
 		node.Origins = node.Origins.Add(report.MakeContainerNodeID(hostID, imageID))
 	}
@@ -145,11 +169,11 @@ func GetRenderableContainerName(nmd report.Node) (string, bool) {
 	//
 	// However, the ecs-agent provides a label containing the original Container
 	// Definition name.
-	if labelValue, ok := nmd.Metadata[docker.LabelPrefix+AmazonECSContainerNameLabel]; ok {
+	if labelValue, ok := nmd.Metadata.Lookup(docker.LabelPrefix + AmazonECSContainerNameLabel); ok {
 		return labelValue, true
 	}
 
-	name, ok := nmd.Metadata[docker.ContainerName]
+	name, ok := nmd.Metadata.Lookup(docker.ContainerName)
 	return name, ok
 }
 
@@ -157,14 +181,49 @@ func GetRenderableContainerName(nmd report.Node) (string, bool) {
 // image renderable node. As it is only ever run on container image topology
 // nodes, we expect that certain keys are present.
 func MapContainerImageIdentity(m RenderableNode, _ report.Networks) RenderableNodes {
-	id, ok := m.Metadata[docker.ImageID]
+	id, ok := m.Metadata.Lookup(docker.ImageID)
+	if !ok {
+		return RenderableNodes{}
+	}
+
+	var (
+		major = m.Metadata.Get(docker.ImageName)
+		rank  = m.Metadata.Get(docker.ImageID)
+	)
+
+	return RenderableNodes{id: NewRenderableNodeWith(id, major, "", rank, m)}
+}
+
+// MapPodIdentity maps a pod topology node to pod renderable node. As it is
+// only ever run on pod topology nodes, we expect that certain keys are
+// present.
+func MapPodIdentity(m RenderableNode, _ report.Networks) RenderableNodes {
+	id, ok := m.Metadata.Lookup(kubernetes.PodID)
 	if !ok {
 		return RenderableNodes{}
 	}
 
 	var (
-		major = m.Metadata[docker.ImageName]
-		rank  = m.Metadata[docker.ImageID]
+		major = m.Metadata.Get(kubernetes.PodName)
+		minor = m.Metadata.Get(kubernetes.Namespace)
+		rank  = m.Metadata.Get(kubernetes.Namespace)
+	)
+
+	return RenderableNodes{id: NewRenderableNodeWith(id, major, minor, rank, m)}
+}
+
+// MapServiceIdentity maps a service topology node to service renderable
+// node. As it is only ever run on service topology nodes, we expect that
+// certain keys are present.
+func MapServiceIdentity(m RenderableNode, _ report.Networks) RenderableNodes {
+	id, ok := m.Metadata.Lookup(kubernetes.ServiceID)
+	if !ok {
+		return RenderableNodes{}
+	}
+
+	var (
+		major = m.Metadata.Get(kubernetes.ServiceName)
+		rank  = m.Metadata.Get(kubernetes.Namespace)
 	)
 
 	return RenderableNodes{id: NewRenderableNodeWith(id, major, "", rank, m)}
@@ -174,7 +233,7 @@ func MapContainerImageIdentity(m RenderableNode, _ report.Networks) RenderableNo
 // node. As it is only ever run on address topology nodes, we expect that
 // certain keys are present.
 func MapAddressIdentity(m RenderableNode, local report.Networks) RenderableNodes {
-	addr, ok := m.Metadata[endpoint.Addr]
+	addr, ok := m.Metadata.Lookup(endpoint.Addr)
 	if !ok {
 		return RenderableNodes{}
 	}
@@ -182,8 +241,8 @@ func MapAddressIdentity(m RenderableNode, local report.Networks) RenderableNodes
 	// Conntracked connections don't have a host id unless
 	// they were merged with a procspied connection.  Filter
 	// out those that weren't.
-	_, hasHostID := m.Metadata[report.HostNodeID]
-	_, conntracked := m.Metadata[endpoint.Conntracked]
+	_, hasHostID := m.Metadata.Lookup(report.HostNodeID)
+	_, conntracked := m.Metadata.Lookup(endpoint.Conntracked)
 	if !hasHostID && conntracked {
 		return RenderableNodes{}
 	}
@@ -193,14 +252,14 @@ func MapAddressIdentity(m RenderableNode, local report.Networks) RenderableNodes
 		// If the addr is not in a network local to this report, we emit an
 		// internet node
 		if !local.Contains(net.ParseIP(addr)) {
-			return RenderableNodes{TheInternetID: newDerivedPseudoNode(TheInternetID, TheInternetMajor, m)}
+			return theInternetNode(m)
 		}
 
 		// Otherwise generate a pseudo node for every
-		outputID := MakePseudoNodeID(addr, "")
+		outputID := MakePseudoNodeID(formatAddr(addr), "")
 		if len(m.Adjacency) > 0 {
 			_, dstAddr, _ := report.ParseAddressNodeID(m.Adjacency[0])
-			outputID = MakePseudoNodeID(addr, dstAddr)
+			outputID = MakePseudoNodeID(formatAddr(addr), formatAddr(dstAddr))
 		}
 		return RenderableNodes{outputID: newDerivedPseudoNode(outputID, addr, m)}
 	}
@@ -221,7 +280,7 @@ func MapAddressIdentity(m RenderableNode, local report.Networks) RenderableNodes
 func MapHostIdentity(m RenderableNode, _ report.Networks) RenderableNodes {
 	var (
 		id                 = MakeHostID(report.ExtractHostID(m.Node))
-		hostname           = m.Metadata[host.HostName]
+		hostname           = m.Metadata.Get(host.HostName)
 		parts              = strings.SplitN(hostname, ".", 2)
 		major, minor, rank = "", "", ""
 	)
@@ -240,16 +299,16 @@ func MapHostIdentity(m RenderableNode, _ report.Networks) RenderableNodes {
 // will be joined to containers through the process topology, and we
 // don't want to double count edges.
 func MapEndpoint2IP(m RenderableNode, local report.Networks) RenderableNodes {
-	_, ok := m.Metadata[process.PID]
+	_, ok := m.Metadata.Lookup(process.PID)
 	if ok {
 		return RenderableNodes{}
 	}
-	addr, ok := m.Metadata[endpoint.Addr]
+	addr, ok := m.Metadata.Lookup(endpoint.Addr)
 	if !ok {
 		return RenderableNodes{}
 	}
 	if !local.Contains(net.ParseIP(addr)) {
-		return RenderableNodes{TheInternetID: newDerivedPseudoNode(TheInternetID, TheInternetMajor, m)}
+		return theInternetNode(m)
 	}
 	return RenderableNodes{addr: NewRenderableNodeWith(addr, "", "", "", m)}
 }
@@ -259,13 +318,13 @@ func MapEndpoint2IP(m RenderableNode, local report.Networks) RenderableNodes {
 // the endpoint topology.
 func MapContainer2IP(m RenderableNode, _ report.Networks) RenderableNodes {
 	result := RenderableNodes{}
-	addrs, ok := m.Metadata[docker.ContainerIPs]
+	addrs, ok := m.Metadata.Lookup(docker.ContainerIPs)
 	if !ok {
 		return result
 	}
 	for _, addr := range strings.Fields(addrs) {
 		n := NewRenderableNodeWith(addr, "", "", "", m)
-		n.Node.Counters[containersKey] = 1
+		n.Node.Counters = n.Node.Counters.Set(containersKey, 1)
 		result[addr] = n
 	}
 	return result
@@ -277,19 +336,19 @@ func MapContainer2IP(m RenderableNode, _ report.Networks) RenderableNodes {
 func MapIP2Container(n RenderableNode, _ report.Networks) RenderableNodes {
 	// If an IP is shared between multiple containers, we can't
 	// reliably attribute an connection based on its IP
-	if n.Node.Counters[containersKey] > 1 {
+	if n.Node.Counters.Get(containersKey) > 1 {
 		return RenderableNodes{}
 	}
 
 	// Propogate the internet pseudo node.
-	if n.ID == TheInternetID {
+	if IsTheInternet(n.ID) {
 		return RenderableNodes{n.ID: n}
 	}
 
 	// If this node is not a container, exclude it.
 	// This excludes all the nodes we've dragged in from endpoint
 	// that we failed to join to a container.
-	id, ok := n.Node.Metadata[docker.ContainerID]
+	id, ok := n.Node.Metadata.Lookup(docker.ContainerID)
 	if !ok {
 		return RenderableNodes{}
 	}
@@ -313,7 +372,7 @@ func MapEndpoint2Process(n RenderableNode, _ report.Networks) RenderableNodes {
 		return RenderableNodes{n.ID: n}
 	}
 
-	pid, ok := n.Node.Metadata[process.PID]
+	pid, ok := n.Node.Metadata.Lookup(process.PID)
 	if !ok {
 		return RenderableNodes{}
 	}
@@ -335,7 +394,7 @@ func MapEndpoint2Process(n RenderableNode, _ report.Networks) RenderableNodes {
 // must be merged with a container graph to get that info.
 func MapProcess2Container(n RenderableNode, _ report.Networks) RenderableNodes {
 	// Propogate the internet pseudo node
-	if n.ID == TheInternetID {
+	if IsTheInternet(n.ID) {
 		return RenderableNodes{n.ID: n}
 	}
 
@@ -348,7 +407,7 @@ func MapProcess2Container(n RenderableNode, _ report.Networks) RenderableNodes {
 	// into an per-host "Uncontained" node.  If for whatever reason
 	// this node doesn't have a host id in their nodemetadata, it'll
 	// all get grouped into a single uncontained node.
-	id, ok := n.Node.Metadata[docker.ContainerID]
+	id, ok := n.Node.Metadata.Lookup(docker.ContainerID)
 	if !ok {
 		hostID := report.ExtractHostID(n.Node)
 		id = MakePseudoNodeID(UncontainedID, hostID)
@@ -371,7 +430,7 @@ func MapProcess2Name(n RenderableNode, _ report.Networks) RenderableNodes {
 		return RenderableNodes{n.ID: n}
 	}
 
-	name, ok := n.Node.Metadata["comm"]
+	name, ok := n.Node.Metadata.Lookup("comm")
 	if !ok {
 		return RenderableNodes{}
 	}
@@ -379,7 +438,7 @@ func MapProcess2Name(n RenderableNode, _ report.Networks) RenderableNodes {
 	node := NewDerivedNode(name, n)
 	node.LabelMajor = name
 	node.Rank = name
-	node.Node.Counters[processesKey] = 1
+	node.Node.Counters = node.Node.Counters.Set(processesKey, 1)
 	return RenderableNodes{name: node}
 }
 
@@ -391,7 +450,7 @@ func MapCountProcessName(n RenderableNode, _ report.Networks) RenderableNodes {
 		return RenderableNodes{n.ID: n}
 	}
 
-	processes := n.Node.Counters[processesKey]
+	processes := n.Node.Counters.Get(processesKey)
 	if processes == 1 {
 		n.LabelMinor = "1 process"
 	} else {
@@ -419,14 +478,14 @@ func MapContainer2ContainerImage(n RenderableNode, _ report.Networks) Renderable
 
 	// Otherwise, if some some reason the container doesn't have a image_id
 	// (maybe slightly out of sync reports), just drop it
-	id, ok := n.Node.Metadata[docker.ImageID]
+	id, ok := n.Node.Metadata.Lookup(docker.ImageID)
 	if !ok {
 		return RenderableNodes{}
 	}
 
 	// Add container-<id> key to NMD, which will later be counted to produce the minor label
 	result := NewDerivedNode(id, n)
-	result.Node.Counters[containersKey] = 1
+	result.Node.Counters = result.Node.Counters.Set(containersKey, 1)
 	return RenderableNodes{id: result}
 }
 
@@ -449,7 +508,7 @@ func MapContainerImage2Name(n RenderableNode, _ report.Networks) RenderableNodes
 		return RenderableNodes{n.ID: n}
 	}
 
-	name, ok := n.Node.Metadata[docker.ImageName]
+	name, ok := n.Node.Metadata.Lookup(docker.ImageName)
 	if !ok {
 		return RenderableNodes{}
 	}
@@ -471,7 +530,7 @@ func MapCountContainers(n RenderableNode, _ report.Networks) RenderableNodes {
 		return RenderableNodes{n.ID: n}
 	}
 
-	containers := n.Node.Counters[containersKey]
+	containers := n.Node.Counters.Get(containersKey)
 	if containers == 1 {
 		n.LabelMinor = "1 container"
 	} else {
@@ -480,6 +539,79 @@ func MapCountContainers(n RenderableNode, _ report.Networks) RenderableNodes {
 	return RenderableNodes{n.ID: n}
 }
 
+// MapContainer2Pod maps container RenderableNodes to pod
+// RenderableNodes.
+//
+// Pseudo nodes are passed straight through, and containers without a pod
+// id (those not started by Kubernetes) are dropped.
+//
+// Otherwise, this function will produce a node with the correct ID format
+// for a pod, labelled with the pod name and namespace the container was
+// tagged with. The resulting graph must be merged with a pod graph to get
+// the rest of the pod's info.
+func MapContainer2Pod(n RenderableNode, _ report.Networks) RenderableNodes {
+	// Propogate all pseudo nodes
+	if n.Pseudo {
+		return RenderableNodes{n.ID: n}
+	}
+
+	// Otherwise, if the container wasn't started by Kubernetes, just
+	// drop it
+	id, ok := n.Node.Metadata.Lookup(kubernetes.PodID)
+	if !ok {
+		return RenderableNodes{}
+	}
+
+	result := NewDerivedNode(id, n)
+	result.LabelMajor = n.Node.Metadata.Get(kubernetes.PodName)
+	result.LabelMinor = n.Node.Metadata.Get(kubernetes.Namespace)
+	result.Rank = n.Node.Metadata.Get(kubernetes.Namespace)
+	return RenderableNodes{id: result}
+}
+
+// MapPod2Service maps pod RenderableNodes to service RenderableNodes, one
+// for each of the services selecting the pod.
+//
+// Pseudo nodes are passed straight through, and pods which aren't selected
+// by any service are dropped.
+//
+// Otherwise, this function will produce nodes with the correct ID format
+// for a service, but without any Major or Minor labels. It does not have
+// enough info to do that, and the resulting graph must be merged with a
+// service graph to get that info.
+func MapPod2Service(n RenderableNode, _ report.Networks) RenderableNodes {
+	// Propogate all pseudo nodes
+	if n.Pseudo {
+		return RenderableNodes{n.ID: n}
+	}
+
+	result := RenderableNodes{}
+	for _, id := range strings.Fields(n.Node.Metadata.Get(kubernetes.ServiceIDs)) {
+		// Add the pods key, which will later be counted to produce the
+		// minor label
+		node := NewDerivedNode(id, n)
+		node.Node.Counters = node.Node.Counters.Set(podsKey, 1)
+		result[id] = node
+	}
+	return result
+}
+
+// MapCountPods maps 1:1 service nodes, counting the number of pods grouped
+// together and putting that info in the minor label.
+func MapCountPods(n RenderableNode, _ report.Networks) RenderableNodes {
+	if n.Pseudo {
+		return RenderableNodes{n.ID: n}
+	}
+
+	pods := n.Node.Counters.Get(podsKey)
+	if pods == 1 {
+		n.LabelMinor = "1 pod"
+	} else {
+		n.LabelMinor = fmt.Sprintf("%d pods", pods)
+	}
+	return RenderableNodes{n.ID: n}
+}
+
 // MapAddress2Host maps address RenderableNodes to host RenderableNodes.
 //
 // Otherthan pseudo nodes, we can assume all nodes have a HostID
@@ -6,6 +6,7 @@ import (
 
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/report"
@@ -28,6 +29,200 @@ func TestMapEndpointIdentity(t *testing.T) {
 	}
 }
 
+func TestMapEndpointIdentityIPv6(t *testing.T) {
+	_, local, _ := net.ParseCIDR("2001:db8::/32")
+	localNetworks := report.Networks([]*net.IPNet{local})
+
+	for _, c := range []struct {
+		node          report.Node
+		wantID, major string
+	}{
+		{
+			node: report.MakeNodeWith(map[string]string{
+				report.HostNodeID:  report.MakeHostNodeID("foo"),
+				endpoint.Addr:      "2001:db8::1",
+				endpoint.Port:      "80",
+				endpoint.Procspied: "true",
+			}),
+			wantID: "endpoint:foo:[2001:db8::1]:80",
+			major:  "[2001:db8::1]:80",
+		},
+		{
+			node: report.MakeNodeWith(map[string]string{
+				endpoint.Addr:      "2001:db8::2",
+				endpoint.Port:      "80",
+				endpoint.Procspied: "true",
+			}),
+			wantID: render.MakePseudoNodeID("[2001:db8::2]", "80"),
+			major:  "[2001:db8::2]:80",
+		},
+		{
+			node: report.MakeNodeWith(map[string]string{
+				endpoint.Addr:      "2001:db8::3",
+				endpoint.Port:      "40000",
+				endpoint.Procspied: "true",
+			}).WithAdjacent(report.MakeEndpointNodeID("bar", "2001:db8::1", "80")),
+			wantID: render.MakePseudoNodeID("[2001:db8::3]", "[2001:db8::1]", "80"),
+			major:  "2001:db8::3",
+		},
+		{
+			node: report.MakeNodeWith(map[string]string{
+				endpoint.Addr:      "2a00:1450::1",
+				endpoint.Port:      "443",
+				endpoint.Procspied: "true",
+			}),
+			wantID: render.TheInternetID,
+			major:  render.TheInternetMajor,
+		},
+	} {
+		have := render.MapEndpointIdentity(nrn(c.node), localNetworks)
+		node, ok := have[c.wantID]
+		if !ok || len(have) != 1 {
+			t.Errorf("%v: want %q, have %v", c.node, c.wantID, have)
+			continue
+		}
+		if node.LabelMajor != c.major {
+			t.Errorf("%v: want %q, have %q", c.node, c.major, node.LabelMajor)
+		}
+	}
+}
+
+func TestMapEndpointIdentityClientPseudoNode(t *testing.T) {
+	_, local, _ := net.ParseCIDR("10.0.0.0/8")
+	localNetworks := report.Networks([]*net.IPNet{local})
+	server := report.MakeEndpointNodeID("bar", "10.0.0.1", "8080")
+
+	for _, c := range []struct {
+		inferredFrom string
+		wantID       string
+	}{
+		// A client on a low port is only trusted if the probe knew the direction.
+		{report.DirectionFromListening, render.MakePseudoNodeID("10.0.0.2", "10.0.0.1", "8080")},
+		{report.DirectionFromConntrack, render.MakePseudoNodeID("10.0.0.2", "10.0.0.1", "8080")},
+		{report.DirectionFromPorts, render.MakePseudoNodeID("10.0.0.2", "1024")},
+		{"", render.MakePseudoNodeID("10.0.0.2", "1024")},
+	} {
+		node := report.MakeNodeWith(map[string]string{
+			endpoint.Addr:      "10.0.0.2",
+			endpoint.Port:      "1024",
+			endpoint.Procspied: "true",
+		}).WithEdge(server, report.EdgeMetadata{DirectionInferredFrom: c.inferredFrom})
+		have := render.MapEndpointIdentity(nrn(node), localNetworks)
+		if _, ok := have[c.wantID]; !ok || len(have) != 1 {
+			t.Errorf("%q: want %q, have %v", c.inferredFrom, c.wantID, have)
+		}
+	}
+}
+
+func TestMapEndpointIdentityEphemeralPorts(t *testing.T) {
+	_, local, _ := net.ParseCIDR("10.0.0.0/8")
+	localNetworks := report.Networks([]*net.IPNet{local})
+	server := report.MakeEndpointNodeID("bar", "10.0.0.1", "8080")
+
+	for _, c := range []struct {
+		port, ephemeral string
+		wantID          string
+	}{
+		{"40000", "", render.MakePseudoNodeID("10.0.0.2", "10.0.0.1", "8080")},
+		{"20000", "", render.MakePseudoNodeID("10.0.0.2", "20000")},
+		{"20000", "10000-30000", render.MakePseudoNodeID("10.0.0.2", "10.0.0.1", "8080")},
+		{"40000", "10000-30000", render.MakePseudoNodeID("10.0.0.2", "40000")},
+	} {
+		node := report.MakeNodeWith(map[string]string{
+			endpoint.Addr:      "10.0.0.2",
+			endpoint.Port:      c.port,
+			endpoint.Procspied: "true",
+		}).WithEdge(server, report.EdgeMetadata{DirectionInferredFrom: report.DirectionFromPorts})
+		if c.ephemeral != "" {
+			node.Metadata = node.Metadata.Set(host.EphemeralPorts, c.ephemeral)
+		}
+		have := render.MapEndpointIdentity(nrn(node), localNetworks)
+		if _, ok := have[c.wantID]; !ok || len(have) != 1 {
+			t.Errorf("%s in %q: want %q, have %v", c.port, c.ephemeral, c.wantID, have)
+		}
+	}
+}
+
+func TestMapEndpointIdentityServiceNames(t *testing.T) {
+	oldKnownServices := render.KnownServices
+	defer func() { render.KnownServices = oldKnownServices }()
+	render.KnownServices = render.ServiceNames{"5432": "postgres"}
+
+	_, local, _ := net.ParseCIDR("10.0.0.0/8")
+	localNetworks := report.Networks([]*net.IPNet{local})
+
+	for port, want := range map[string]string{
+		"5432": "postgres (10.0.0.5:5432)",
+		"6379": "10.0.0.5:6379",
+	} {
+		have := render.MapEndpointIdentity(nrn(report.MakeNodeWith(map[string]string{
+			endpoint.Addr:      "10.0.0.5",
+			endpoint.Port:      port,
+			endpoint.Procspied: "true",
+		})), localNetworks)
+		node, ok := have[render.MakePseudoNodeID("10.0.0.5", port)]
+		if !ok {
+			t.Errorf("%s: missing pseudo node, have %v", port, have)
+			continue
+		}
+		if node.LabelMajor != want {
+			t.Errorf("%s: want %q, have %q", port, want, node.LabelMajor)
+		}
+	}
+}
+
+func TestEndpointRendererEphemeralPorts(t *testing.T) {
+	var (
+		serverHostNodeID = report.MakeHostNodeID("server")
+		clientHostNodeID = report.MakeHostNodeID("client")
+		serverNodeID     = report.MakeEndpointNodeID("server", "10.0.0.1", "80")
+	)
+	for _, c := range []struct {
+		name, clientHostPorts string
+		wantID                string
+	}{
+		// The server's range doesn't apply to its remote clients.
+		{"client host not reporting", "", render.MakePseudoNodeID("10.0.0.2", "20000")},
+		{"client host reporting", "10000-30000", render.MakePseudoNodeID("10.0.0.2", "10.0.0.1", "80")},
+	} {
+		rpt := report.MakeReport()
+		rpt.Topologies[report.Host] = rpt.Topologies[report.Host].AddNode(serverHostNodeID, report.MakeNodeWith(map[string]string{
+			host.LocalNetworks:  "10.0.0.0/8",
+			host.EphemeralPorts: "10000-30000",
+		}))
+		rpt.Topologies[report.Endpoint] = rpt.Topologies[report.Endpoint].AddNode(serverNodeID, report.MakeNodeWith(map[string]string{
+			endpoint.Addr:      "10.0.0.1",
+			endpoint.Port:      "80",
+			endpoint.Procspied: "true",
+			report.HostNodeID:  serverHostNodeID,
+		}))
+		rpt.Topologies[report.Endpoint] = rpt.Topologies[report.Endpoint].AddNode(report.MakeEndpointNodeID("server", "10.0.0.2", "20000"), report.MakeNodeWith(map[string]string{
+			endpoint.Addr:      "10.0.0.2",
+			endpoint.Port:      "20000",
+			endpoint.Procspied: "true",
+		}).WithEdge(serverNodeID, report.EdgeMetadata{DirectionInferredFrom: report.DirectionFromPorts}))
+		if c.clientHostPorts != "" {
+			// The client's host reports its range, and another endpoint of
+			// its own at the client's address.
+			rpt.Topologies[report.Host] = rpt.Topologies[report.Host].AddNode(clientHostNodeID, report.MakeNodeWith(map[string]string{
+				host.LocalNetworks:  "10.0.0.0/8",
+				host.EphemeralPorts: c.clientHostPorts,
+			}))
+			rpt.Topologies[report.Endpoint] = rpt.Topologies[report.Endpoint].AddNode(report.MakeEndpointNodeID("client", "10.0.0.2", "22"), report.MakeNodeWith(map[string]string{
+				endpoint.Addr:      "10.0.0.2",
+				endpoint.Port:      "22",
+				endpoint.Procspied: "true",
+				report.HostNodeID:  clientHostNodeID,
+			}))
+		}
+
+		have := render.EndpointRenderer.Render(rpt)
+		if _, ok := have[c.wantID]; !ok {
+			t.Errorf("%s: want %q, have %v", c.name, c.wantID, have)
+		}
+	}
+}
+
 func TestMapProcessIdentity(t *testing.T) {
 	for _, input := range []testcase{
 		{nrn(report.MakeNode()), false},
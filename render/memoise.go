@@ -0,0 +1,142 @@
+package render
+
+import (
+	"sync"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// maxMemoEntries is how many reports a memoised renderer keeps the render
+// of, so reports derived from the current one, or renders of the next one
+// starting before those of the current one end, don't evict it.
+const maxMemoEntries = 4
+
+// Memoise wraps a renderer shared by several others, so it only renders
+// each report once, however many of them render it, concurrently or not.
+// Reports are told apart by the identity of their topologies; as those are
+// persistent, changing one gives it a new identity. The rendered nodes are
+// shared too, so renderers downstream must copy a node's lists, such as its
+// Adjacency, before changing them in place.
+func Memoise(r Renderer) Renderer {
+	return &memoise{Renderer: r}
+}
+
+type memoise struct {
+	Renderer
+
+	mtx     sync.Mutex
+	entries []*memoEntry // most recently used first
+}
+
+type memoEntry struct {
+	key    []report.Topology
+	rpt    report.Report
+	done   chan struct{}
+	output RenderableNodes
+	edges  map[string]report.EdgeMetadatas
+	failed bool // the render panicked
+}
+
+// Render implements Renderer. Every caller gets its own map, as renderers
+// modify their input; the nodes themselves are shared.
+func (m *memoise) Render(rpt report.Report) RenderableNodes {
+	output, _ := m.renderEdges(rpt)
+	return output
+}
+
+// EdgeMetadata implements Renderer.
+func (m *memoise) EdgeMetadata(rpt report.Report, localID, remoteID string) report.EdgeMetadata {
+	_, edges := m.renderEdges(rpt)
+	md, _ := edges[localID].Lookup(remoteID)
+	return md
+}
+
+// renderEdges returns the nodes and edges rendered for the report, which
+// are rendered together, as most renders of a view need both.
+func (m *memoise) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	entry, ok := m.entry(rpt)
+	if ok {
+		<-entry.done
+		if entry.failed {
+			// The render which failed panicked; so will this, most likely.
+			return m.renderEdges(rpt)
+		}
+	} else {
+		m.render(entry)
+	}
+
+	output := make(RenderableNodes, len(entry.output))
+	for id, node := range entry.output {
+		output[id] = node
+	}
+	return output, entry.edges
+}
+
+// entry returns the entry for a report, and whether it was there already,
+// in which case its render has started.
+func (m *memoise) entry(rpt report.Report) (*memoEntry, bool) {
+	key := reportKey(rpt)
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for i, entry := range m.entries {
+		if sameKey(entry.key, key) {
+			copy(m.entries[1:i+1], m.entries[:i])
+			m.entries[0] = entry
+			return entry, true
+		}
+	}
+	entry := &memoEntry{key: key, rpt: rpt, done: make(chan struct{})}
+	if len(m.entries) < maxMemoEntries {
+		m.entries = append(m.entries, nil)
+	}
+	copy(m.entries[1:], m.entries)
+	m.entries[0] = entry
+	return entry, false
+}
+
+// render renders an entry's report. If that panics, the entry is forgotten,
+// and those waiting for it render the report themselves.
+func (m *memoise) render(entry *memoEntry) {
+	defer close(entry.done)
+	defer func() {
+		if r := recover(); r != nil {
+			m.forget(entry)
+			panic(r)
+		}
+	}()
+	entry.output, entry.edges = renderEdges(m.Renderer, entry.rpt)
+}
+
+func (m *memoise) forget(entry *memoEntry) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	entry.failed = true
+	for i, e := range m.entries {
+		if e == entry {
+			m.entries = append(m.entries[:i], m.entries[i+1:]...)
+			break
+		}
+	}
+}
+
+// reportKey identifies a report by its topologies, in order of name.
+func reportKey(rpt report.Report) []report.Topology {
+	key := []report.Topology{}
+	for _, name := range rpt.TopologyNames() {
+		key = append(key, rpt.Topologies[name])
+	}
+	return key
+}
+
+// sameKey says whether two keys are of the same topologies.
+func sameKey(a, b []report.Topology) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Same(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package render
+
+import (
+	"sort"
+)
+
+// Paths returns up to maxPaths of the shortest simple paths, following
+// adjacencies, from one node to another with at most maxHops edges each, as
+// lists of node IDs. Shorter paths come first.
+//
+// The number of paths grows exponentially with maxHops, so paths are looked
+// for one length at a time, only through nodes close enough to the
+// destination, stopping once there are enough.
+func (rns RenderableNodes) Paths(from, to string, maxHops, maxPaths int) [][]string {
+	paths := [][]string{}
+	if _, ok := rns[from]; !ok {
+		return paths
+	}
+	hopsTo := rns.Dependants(to, Upstream, maxHops)
+	if _, ok := rns[to]; ok {
+		hopsTo[to] = 0
+	}
+	if _, ok := hopsTo[from]; !ok {
+		return paths
+	}
+
+	var (
+		path    = []string{from}
+		visited = map[string]bool{from: true}
+		walk    func(id string, length int)
+	)
+	walk = func(id string, length int) {
+		if id == to {
+			if len(path)-1 == length {
+				paths = append(paths, append([]string{}, path...))
+			}
+			return
+		}
+		for _, next := range rns[id].Adjacency {
+			if hops, ok := hopsTo[next]; !ok || visited[next] || len(path)+hops > length {
+				continue
+			}
+			if len(paths) >= maxPaths {
+				return
+			}
+			visited[next] = true
+			path = append(path, next)
+			walk(next, length)
+			path = path[:len(path)-1]
+			visited[next] = false
+		}
+	}
+	for length := hopsTo[from]; length <= maxHops && len(paths) < maxPaths; length++ {
+		walk(from, length)
+	}
+
+	sort.Sort(pathsByLength(paths))
+	return paths
+}
+
+type pathsByLength [][]string
+
+func (p pathsByLength) Len() int      { return len(p) }
+func (p pathsByLength) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p pathsByLength) Less(i, j int) bool {
+	if len(p[i]) != len(p[j]) {
+		return len(p[i]) < len(p[j])
+	}
+	for k := range p[i] {
+		if p[i][k] != p[j][k] {
+			return p[i][k] < p[j][k]
+		}
+	}
+	return false
+}
+
+// Direction is the direction of dependencies between nodes. Nodes depend on
+// those they're adjacent to.
+type Direction string
+
+// The directions of dependencies.
+const (
+	Upstream   Direction = "upstream"   // nodes depending on a node
+	Downstream Direction = "downstream" // nodes a node depends on
+)
+
+// Dependants returns the nodes transitively depending on a node (upstream),
+// or which it transitively depends on (downstream), at most maxHops edges
+// away, with the number of edges to each. The node itself isn't included.
+func (rns RenderableNodes) Dependants(id string, direction Direction, maxHops int) map[string]int {
+	next := func(id string) []string { return rns[id].Adjacency }
+	if direction == Upstream {
+		upstream := map[string][]string{}
+		for srcID, node := range rns {
+			for _, dstID := range node.Adjacency {
+				upstream[dstID] = append(upstream[dstID], srcID)
+			}
+		}
+		next = func(id string) []string { return upstream[id] }
+	}
+
+	hops := map[string]int{}
+	if _, ok := rns[id]; !ok {
+		return hops
+	}
+	frontier := []string{id}
+	for hop := 1; hop <= maxHops && len(frontier) > 0; hop++ {
+		nextFrontier := []string{}
+		for _, current := range frontier {
+			for _, neighbour := range next(current) {
+				if _, ok := rns[neighbour]; !ok || neighbour == id {
+					continue
+				}
+				if _, ok := hops[neighbour]; ok {
+					continue
+				}
+				hops[neighbour] = hop
+				nextFrontier = append(nextFrontier, neighbour)
+			}
+		}
+		frontier = nextFrontier
+	}
+	return hops
+}
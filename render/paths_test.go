@@ -0,0 +1,86 @@
+package render_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+// a -> b -> d, a -> c -> d -> e, d -> a, f
+var pathNodes = render.RenderableNodes{
+	"a": {ID: "a", Node: report.MakeNode().WithAdjacent("b").WithAdjacent("c")},
+	"b": {ID: "b", Node: report.MakeNode().WithAdjacent("d")},
+	"c": {ID: "c", Node: report.MakeNode().WithAdjacent("d")},
+	"d": {ID: "d", Node: report.MakeNode().WithAdjacent("e").WithAdjacent("a")},
+	"e": {ID: "e", Node: report.MakeNode()},
+	"f": {ID: "f", Node: report.MakeNode()},
+}
+
+func TestPaths(t *testing.T) {
+	for _, tc := range []struct {
+		from, to          string
+		maxHops, maxPaths int
+		want              [][]string
+	}{
+		{"a", "e", 3, 10, [][]string{{"a", "b", "d", "e"}, {"a", "c", "d", "e"}}},
+		{"a", "e", 3, 1, [][]string{{"a", "b", "d", "e"}}},
+		{"a", "e", 2, 10, [][]string{}},
+		{"a", "d", 2, 10, [][]string{{"a", "b", "d"}, {"a", "c", "d"}}},
+		{"d", "b", 5, 10, [][]string{{"d", "a", "b"}}},
+		{"e", "a", 5, 10, [][]string{}},
+		{"a", "f", 5, 10, [][]string{}},
+		{"a", "nope", 5, 10, [][]string{}},
+		{"a", "a", 5, 10, [][]string{{"a"}}},
+	} {
+		if have := pathNodes.Paths(tc.from, tc.to, tc.maxHops, tc.maxPaths); !reflect.DeepEqual(tc.want, have) {
+			t.Errorf("%s -> %s: %s", tc.from, tc.to, test.Diff(tc.want, have))
+		}
+	}
+}
+
+func TestPathsShortestFirst(t *testing.T) {
+	// A chain of diamonds, with a shortcut from the start to the end: the
+	// shortcut is found first, even if it's the last adjacency followed.
+	nodes := render.RenderableNodes{}
+	for i := 0; i < 20; i++ {
+		a, b, c, next := fmt.Sprint(i, "a"), fmt.Sprint(i, "b"), fmt.Sprint(i, "c"), fmt.Sprint(i+1, "a")
+		nodes[a] = render.RenderableNode{ID: a, Node: report.MakeNode().WithAdjacent(b).WithAdjacent(c)}
+		nodes[b] = render.RenderableNode{ID: b, Node: report.MakeNode().WithAdjacent(next)}
+		nodes[c] = render.RenderableNode{ID: c, Node: report.MakeNode().WithAdjacent(next)}
+	}
+	nodes["20a"] = render.RenderableNode{ID: "20a", Node: report.MakeNode()}
+	nodes["0a"] = render.RenderableNode{ID: "0a", Node: nodes["0a"].Node.WithAdjacent("z")}
+	nodes["z"] = render.RenderableNode{ID: "z", Node: report.MakeNode().WithAdjacent("20a")}
+
+	want := [][]string{{"0a", "z", "20a"}}
+	if have := nodes.Paths("0a", "20a", 40, 1); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if have := nodes.Paths("0a", "20a", 40, 100); len(have) != 100 {
+		t.Errorf("want 100 paths, have %d", len(have))
+	}
+}
+
+func TestDependants(t *testing.T) {
+	for _, tc := range []struct {
+		id        string
+		direction render.Direction
+		maxHops   int
+		want      map[string]int
+	}{
+		{"e", render.Upstream, 5, map[string]int{"d": 1, "b": 2, "c": 2, "a": 3}},
+		{"e", render.Upstream, 1, map[string]int{"d": 1}},
+		{"e", render.Downstream, 5, map[string]int{}},
+		{"b", render.Downstream, 5, map[string]int{"d": 1, "e": 2, "a": 2, "c": 3}},
+		{"f", render.Upstream, 5, map[string]int{}},
+		{"nope", render.Upstream, 5, map[string]int{}},
+	} {
+		if have := pathNodes.Dependants(tc.id, tc.direction, tc.maxHops); !reflect.DeepEqual(tc.want, have) {
+			t.Errorf("%s %s: %s", tc.id, tc.direction, test.Diff(tc.want, have))
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/report"
+)
+
+// PolicyViolations is the metadata key under which PolicyAudit lists the
+// destinations of a node's edges which the policy doesn't allow, separated
+// by spaces.
+const PolicyViolations = "policy_violations"
+
+// Policy is an allow-list of edges between nodes, e.g.
+//
+//	{"allow": [{
+//	  "from": {"labels": {"app": "frontend"}},
+//	  "to": {"image": "postgres*"},
+//	  "ports": [5432]
+//	}, {
+//	  "from": {"image": "weaveworks/*"},
+//	  "to": {"cidr": "8.8.8.0/24"}
+//	}]}
+//
+// An edge is allowed if, for each port it connects to, some rule's selectors
+// match both ends of it and the rule has no ports or includes the port. Edges
+// whose ports aren't known are only allowed by rules without ports.
+type Policy struct {
+	Allow []PolicyRule `json:"allow"`
+}
+
+// PolicyRule allows edges from nodes matching From to nodes matching To, on
+// Ports if given, or on any port.
+type PolicyRule struct {
+	From  PolicySelector `json:"from"`
+	To    PolicySelector `json:"to"`
+	Ports []int          `json:"ports,omitempty"`
+}
+
+// PolicySelector matches nodes by their Docker labels, or the labels of
+// their Kubernetes pods, all of which must match, their image name or ID, as
+// a glob, their Kubernetes namespace, one of their addresses, or their ID, as
+// a glob, e.g. "theinternet". Only the fields given are matched, so an empty
+// selector matches any node.
+type PolicySelector struct {
+	Labels    map[string]string `json:"labels,omitempty"`
+	PodLabels map[string]string `json:"pod_labels,omitempty"`
+	Image     string            `json:"image,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	CIDR      string            `json:"cidr,omitempty"`
+	ID        string            `json:"id,omitempty"`
+
+	network *net.IPNet
+}
+
+// PolicyViolation is an edge the policy doesn't allow.
+type PolicyViolation struct {
+	From      string   `json:"from"`
+	FromLabel string   `json:"from_label"`
+	To        string   `json:"to"`
+	ToLabel   string   `json:"to_label"`
+	Ports     []string `json:"ports,omitempty"` // the ports no rule allows, if the edge's ports are known
+}
+
+// ReadPolicy reads a policy, as JSON.
+func ReadPolicy(r io.Reader) (*Policy, error) {
+	var policy Policy
+	if err := json.NewDecoder(r).Decode(&policy); err != nil {
+		return nil, err
+	}
+	for i := range policy.Allow {
+		rule := &policy.Allow[i]
+		for _, s := range []*PolicySelector{&rule.From, &rule.To} {
+			if s.CIDR == "" {
+				continue
+			}
+			_, network, err := net.ParseCIDR(s.CIDR)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i, err)
+			}
+			s.network = network
+		}
+		for _, port := range rule.Ports {
+			if port < 1 || port > 65535 {
+				return nil, fmt.Errorf("rule %d: invalid port %d", i, port)
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// Check returns the violation of the policy by the edge between from and to,
+// if any. The report is the one the nodes were rendered from, and tells the
+// ports the edge connects to.
+func (p *Policy) Check(rpt report.Report, from, to RenderableNode) (PolicyViolation, bool) {
+	rules := []PolicyRule{}
+	for _, rule := range p.Allow {
+		if rule.From.match(rpt, from) && rule.To.match(rpt, to) {
+			rules = append(rules, rule)
+		}
+	}
+
+	violation := PolicyViolation{
+		From:      from.ID,
+		FromLabel: from.LabelMajor,
+		To:        to.ID,
+		ToLabel:   to.LabelMajor,
+	}
+	ports := edgePorts(rpt, from, to)
+	if len(ports) == 0 {
+		for _, rule := range rules {
+			if len(rule.Ports) == 0 {
+				return PolicyViolation{}, false
+			}
+		}
+		return violation, true
+	}
+	for _, port := range ports {
+		if !allowsPort(rules, port) {
+			violation.Ports = append(violation.Ports, port)
+		}
+	}
+	return violation, len(violation.Ports) > 0
+}
+
+// Violations returns the violations of the policy by the edges between
+// nodes, ordered by their ends.
+func (p *Policy) Violations(rpt report.Report, nodes RenderableNodes) []PolicyViolation {
+	violations := []PolicyViolation{}
+	for _, from := range nodes {
+		for _, id := range from.Adjacency {
+			to, ok := nodes[id]
+			if !ok {
+				continue
+			}
+			if violation, ok := p.Check(rpt, from, to); ok {
+				violations = append(violations, violation)
+			}
+		}
+	}
+	sort.Sort(violationsByEdge(violations))
+	return violations
+}
+
+type violationsByEdge []PolicyViolation
+
+func (v violationsByEdge) Len() int      { return len(v) }
+func (v violationsByEdge) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v violationsByEdge) Less(i, j int) bool {
+	if v[i].From != v[j].From {
+		return v[i].From < v[j].From
+	}
+	return v[i].To < v[j].To
+}
+
+func allowsPort(rules []PolicyRule, port string) bool {
+	for _, rule := range rules {
+		if len(rule.Ports) == 0 {
+			return true
+		}
+		for _, p := range rule.Ports {
+			if strconv.Itoa(p) == port {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s PolicySelector) match(rpt report.Report, n RenderableNode) bool {
+	for k, v := range s.Labels {
+		if value, ok := n.Metadata.Lookup(docker.LabelPrefix + k); !ok || value != v {
+			return false
+		}
+	}
+	if len(s.PodLabels) > 0 {
+		labels := podLabels(rpt, n)
+		for k, v := range s.PodLabels {
+			if value, ok := labels[k]; !ok || value != v {
+				return false
+			}
+		}
+	}
+	if s.Image != "" &&
+		!globMatch(s.Image, n.Metadata.Get(docker.ImageName)) &&
+		!globMatch(s.Image, n.Metadata.Get(docker.ImageID)) {
+		return false
+	}
+	if s.Namespace != "" && n.Metadata.Get(kubernetes.Namespace) != s.Namespace {
+		return false
+	}
+	if s.network != nil && !containsAny(s.network, addresses(n)) {
+		return false
+	}
+	if s.ID != "" && !globMatch(s.ID, n.ID) {
+		return false
+	}
+	return true
+}
+
+// String describes the selector, e.g. "label.app=db image=postgres*".
+func (s PolicySelector) String() string {
+	terms := []string{}
+	for k, v := range s.Labels {
+		terms = append(terms, "label."+k+"="+v)
+	}
+	for k, v := range s.PodLabels {
+		terms = append(terms, "pod_label."+k+"="+v)
+	}
+	sort.Strings(terms)
+	for _, field := range []struct{ name, value string }{
+		{"image", s.Image},
+		{"namespace", s.Namespace},
+		{"cidr", s.CIDR},
+		{"id", s.ID},
+	} {
+		if field.value != "" {
+			terms = append(terms, field.name+"="+field.value)
+		}
+	}
+	if len(terms) == 0 {
+		return "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+// podLabels returns the labels of the Kubernetes pod of a container node, if
+// it's in one. Pods are only labelled in the report's Pod topology.
+func podLabels(rpt report.Report, n RenderableNode) map[string]string {
+	id, ok := n.Metadata.Lookup(kubernetes.PodID)
+	if !ok {
+		return nil
+	}
+	pod, ok := rpt.Topologies[report.Pod].Nodes.Lookup(id)
+	if !ok {
+		return nil
+	}
+	return kubernetes.ExtractPodLabels(pod)
+}
+
+func containsAny(network *net.IPNet, addrs []string) bool {
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addresses returns the addresses of a node: those of its endpoints and
+// address nodes, and its containers' IPs.
+func addresses(n RenderableNode) []string {
+	result := strings.Fields(n.Metadata.Get(docker.ContainerIPs))
+	for _, id := range n.Origins {
+		if _, addr, _, ok := report.ParseEndpointNodeID(id); ok {
+			result = append(result, addr)
+		} else if _, addr, ok := report.ParseAddressNodeID(id); ok {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+// edgePorts returns the ports the edge from one node to another connects
+// to, as told by the connections between their endpoints.
+func edgePorts(rpt report.Report, from, to RenderableNode) []string {
+	ports := map[string]struct{}{}
+	edgeConnections(rpt, from, to, func(_, _, port string) {
+		ports[port] = struct{}{}
+	})
+	result := make([]string, 0, len(ports))
+	for port := range ports {
+		result = append(result, port)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// edgeConnections calls f with the addresses, and the server's port, of each
+// connection between the endpoints of one node and those of another.
+func edgeConnections(rpt report.Report, from, to RenderableNode, f func(fromAddr, toAddr, port string)) {
+	for _, src := range from.Origins {
+		endpoint, ok := rpt.Topologies[report.Endpoint].Nodes.Lookup(src)
+		if !ok {
+			continue
+		}
+		_, fromAddr, _, ok := report.ParseEndpointNodeID(src)
+		if !ok {
+			continue
+		}
+		for _, dst := range endpoint.Adjacency {
+			if !to.Origins.Contains(dst) {
+				continue
+			}
+			if _, toAddr, port, ok := report.ParseEndpointNodeID(dst); ok {
+				f(fromAddr, toAddr, port)
+			}
+		}
+	}
+}
+
+// PolicyAudit is a Renderer which flags the edges the policy doesn't allow,
+// listing their destinations under the PolicyViolations key of the source
+// nodes' metadata.
+type PolicyAudit struct {
+	Renderer
+	Policy *Policy
+}
+
+// Render implements Renderer.
+func (p PolicyAudit) Render(rpt report.Report) RenderableNodes {
+	return p.audit(rpt, p.Renderer.Render(rpt))
+}
+
+func (p PolicyAudit) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	nodes, edges := renderEdges(p.Renderer, rpt)
+	return p.audit(rpt, nodes), edges
+}
+
+func (p PolicyAudit) audit(rpt report.Report, nodes RenderableNodes) RenderableNodes {
+	for id, node := range nodes {
+		violations := []string{}
+		for _, dst := range node.Adjacency {
+			to, ok := nodes[dst]
+			if !ok {
+				continue
+			}
+			if _, ok := p.Policy.Check(rpt, node, to); ok {
+				violations = append(violations, dst)
+			}
+		}
+		if len(violations) == 0 {
+			continue
+		}
+		node.Metadata = node.Metadata.Set(PolicyViolations, strings.Join(violations, " "))
+		nodes[id] = node
+	}
+	return nodes
+}
+
+// Violates returns true if the node is flagged by PolicyAudit for its edge
+// to the given node.
+func Violates(node RenderableNode, to string) bool {
+	for _, id := range strings.Fields(node.Metadata.Get(PolicyViolations)) {
+		if id == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package render_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestReadPolicy(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`{"allow": [{"from": {"cidr": "10.0.0.0"}}]}`,
+		`{"allow": [{"ports": [0]}]}`,
+		`{"allow": [{"ports": [65536]}]}`,
+	} {
+		if _, err := render.ReadPolicy(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestPolicyAudit(t *testing.T) {
+	policy, err := render.ReadPolicy(strings.NewReader(`{"allow": [{
+		"from": {"image": "imageid123"},
+		"to": {"labels": {"foo1": "bar1"}, "pod_labels": {"app": "pong"}},
+		"ports": [80]
+	}, {
+		"from": {"id": "pseudo:uncontained:*"},
+		"to": {"cidr": "8.8.8.0/24"},
+		"ports": [443]
+	}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		uncontainedID = render.MakePseudoNodeID(render.UncontainedID, test.ServerHostName)
+		audit         = render.PolicyAudit{Renderer: render.ContainerWithImageNameRenderer, Policy: policy}
+		nodes         = audit.Render(test.Report)
+	)
+	for id, want := range map[string]string{
+		test.ClientContainerID: "",
+		test.ServerContainerID: "",
+		uncontainedID:          render.TheInternetID,
+		render.TheInternetID:   test.ServerContainerID,
+	} {
+		if have := nodes[id].Metadata.Get(render.PolicyViolations); want != have {
+			t.Errorf("%s: want %q, have %q", id, want, have)
+		}
+	}
+	if !render.Violates(nodes[render.TheInternetID], test.ServerContainerID) {
+		t.Errorf("expected the internet to violate the policy")
+	}
+	if render.Violates(nodes[test.ClientContainerID], test.ServerContainerID) {
+		t.Errorf("expected the client not to violate the policy")
+	}
+
+	want := []render.PolicyViolation{
+		{
+			From:      uncontainedID,
+			FromLabel: nodes[uncontainedID].LabelMajor,
+			To:        render.TheInternetID,
+			ToLabel:   render.TheInternetMajor,
+			Ports:     []string{test.GooglePort},
+		},
+		{
+			From:      render.TheInternetID,
+			FromLabel: render.TheInternetMajor,
+			To:        test.ServerContainerID,
+			ToLabel:   nodes[test.ServerContainerID].LabelMajor,
+			Ports:     []string{test.ServerPort},
+		},
+	}
+	if have := policy.Violations(test.Report, nodes); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// The rendered nodes of upstream renderers are left alone.
+	if _, ok := render.ContainerWithImageNameRenderer.Render(test.Report)[render.TheInternetID].Metadata.Lookup(render.PolicyViolations); ok {
+		t.Errorf("expected upstream nodes not to be flagged")
+	}
+}
@@ -0,0 +1,320 @@
+package render
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+// Query is a parsed filter expression, matching nodes for which all of its
+// terms hold. See ParseQuery.
+type Query []queryTerm
+
+type queryTerm struct {
+	field  string // empty for free text
+	op     string
+	value  string
+	negate bool
+}
+
+// Operators of query terms, longest first so they're found in this order.
+var queryOps = []string{"!=", ">=", "<=", "=", ":", ">", "<"}
+
+// queryFields are the shorthands for metadata keys a query can use. Any
+// other field is looked up as a metadata key as it is.
+var queryFields = map[string]string{
+	"image":     docker.ImageName,
+	"container": docker.ContainerName,
+	"process":   process.Comm,
+	"pod":       kubernetes.PodName,
+	"namespace": kubernetes.Namespace,
+	"cpu":       docker.CPUUsagePercent,
+	"memory":    docker.MemoryUsage,
+}
+
+// ParseQuery parses a filter expression, a list of space-separated terms,
+// all of which must hold for a node to match. Terms are one of
+//
+//	text          the node's labels or any metadata value contain text
+//	field:pattern the field matches pattern, where * matches anything,
+//	              or contains it, if it has no *
+//	field=value   the field is value (!= for isn't)
+//	field>number  the field is a number greater than number (also >=, <, <=)
+//
+// Fields are id, name (the major label), host, label.<docker label>, one of
+// the shorthands image, container, process, pod, namespace, cpu (a
+// container's usage, as a percentage of one CPU) or memory (in bytes), or
+// any metadata key. Text and patterns match regardless of case. Terms
+// prefixed with ! are negated, and values may be double quoted.
+func ParseQuery(expr string) (Query, error) {
+	words, err := splitQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	query := Query{}
+	for _, word := range words {
+		term := queryTerm{}
+		if strings.HasPrefix(word, "!") {
+			term.negate = true
+			word = word[1:]
+		}
+		term.field, term.op, term.value = splitTerm(word)
+		if term.op != "" && term.field == "" {
+			return nil, fmt.Errorf("query term %q has no field", word)
+		}
+		if term.value == "" {
+			return nil, fmt.Errorf("query term %q has no value", word)
+		}
+		switch term.op {
+		case ">", ">=", "<", "<=":
+			if _, err := strconv.ParseFloat(term.value, 64); err != nil {
+				return nil, fmt.Errorf("query term %q: %s needs a number", word, term.op)
+			}
+		}
+		query = append(query, term)
+	}
+	return query, nil
+}
+
+// splitQuery splits expr on spaces outside of double quotes, removing the
+// quotes.
+func splitQuery(expr string) ([]string, error) {
+	var (
+		words  []string
+		word   []rune
+		quoted bool
+		inWord bool
+	)
+	for _, r := range expr {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(r) && !quoted:
+			if inWord {
+				words = append(words, string(word))
+			}
+			word, inWord = word[:0], false
+		default:
+			word = append(word, r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in query %q", expr)
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
+
+func splitTerm(word string) (field, op, value string) {
+	best := -1
+	for _, candidate := range queryOps {
+		i := strings.Index(word, candidate)
+		if i >= 0 && (best < 0 || i < best) {
+			best, op = i, candidate
+		}
+	}
+	if best < 0 {
+		return "", "", word
+	}
+	return word[:best], op, word[best+len(op):]
+}
+
+// Match returns true if the node matches all terms of the query.
+func (q Query) Match(n RenderableNode) bool {
+	for _, term := range q {
+		if term.match(n) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (t queryTerm) match(n RenderableNode) bool {
+	if t.field == "" {
+		text := strings.ToLower(t.value)
+		if strings.Contains(strings.ToLower(n.LabelMajor), text) ||
+			strings.Contains(strings.ToLower(n.LabelMinor), text) {
+			return true
+		}
+		found := false
+		n.Metadata.ForEach(func(_, v string) {
+			if strings.Contains(strings.ToLower(v), text) {
+				found = true
+			}
+		})
+		return found
+	}
+
+	for _, v := range fieldValues(t.field, n) {
+		if t.matchValue(v) {
+			return true
+		}
+	}
+	// A field the node doesn't have isn't anything else either.
+	return t.op == "!=" && len(fieldValues(t.field, n)) == 0
+}
+
+func (t queryTerm) matchValue(v string) bool {
+	switch t.op {
+	case "=":
+		return v == t.value
+	case "!=":
+		return v != t.value
+	case ":":
+		pattern := strings.ToLower(t.value)
+		if !strings.Contains(pattern, "*") {
+			pattern = "*" + pattern + "*"
+		}
+		return globMatch(pattern, strings.ToLower(v))
+	}
+
+	have, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+	want, _ := strconv.ParseFloat(t.value, 64)
+	switch t.op {
+	case ">":
+		return have > want
+	case ">=":
+		return have >= want
+	case "<":
+		return have < want
+	case "<=":
+		return have <= want
+	}
+	return false
+}
+
+// fieldValues returns the values of a query field for a node.
+func fieldValues(field string, n RenderableNode) []string {
+	switch field {
+	case "id":
+		return []string{n.ID}
+	case "name":
+		return []string{n.LabelMajor}
+	case "host":
+		values := []string{}
+		if hostID := report.ExtractHostID(n.Node); hostID != "" {
+			values = append(values, hostID)
+		}
+		if hostName, ok := n.Metadata.Lookup(host.HostName); ok {
+			values = append(values, hostName)
+		}
+		return values
+	}
+	key := field
+	if strings.HasPrefix(field, "label.") {
+		key = docker.LabelPrefix + strings.TrimPrefix(field, "label.")
+	} else if k, ok := queryFields[field]; ok {
+		key = k
+	}
+	if v, ok := n.Metadata.Lookup(key); ok {
+		return []string{v}
+	}
+	return nil
+}
+
+// globMatch matches s against pattern, where * matches any string.
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 {
+			return strings.HasSuffix(s, part)
+		}
+		j := strings.Index(s, part)
+		if j < 0 {
+			return false
+		}
+		s = s[j+len(part):]
+	}
+	return s == ""
+}
+
+// QueryFilter is a Renderer which keeps the nodes matching a query, and
+// those up to Hops edges away from them, in either direction.
+type QueryFilter struct {
+	Renderer
+	Query Query
+	Hops  int
+}
+
+// Render implements Renderer
+func (f QueryFilter) Render(rpt report.Report) RenderableNodes {
+	nodes, _ := f.render(rpt)
+	return nodes
+}
+
+func (f QueryFilter) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	nodes, edges := renderEdges(f.Renderer, rpt)
+	nodes, _ = f.filter(nodes)
+	return nodes, edges
+}
+
+func (f QueryFilter) render(rpt report.Report) (RenderableNodes, int) {
+	return f.filter(f.Renderer.Render(rpt))
+}
+
+// filter keeps the nodes matching the query, and their neighbours, and
+// returns them with the number of nodes removed.
+func (f QueryFilter) filter(nodes RenderableNodes) (RenderableNodes, int) {
+	keep := map[string]struct{}{}
+	for id, node := range nodes {
+		if f.Query.Match(node) {
+			keep[id] = struct{}{}
+		}
+	}
+
+	if f.Hops > 0 {
+		neighbours := map[string][]string{}
+		for id, node := range nodes {
+			for _, dstID := range node.Adjacency {
+				neighbours[id] = append(neighbours[id], dstID)
+				neighbours[dstID] = append(neighbours[dstID], id)
+			}
+		}
+		frontier := keep
+		for hop := 0; hop < f.Hops && len(frontier) > 0; hop++ {
+			next := map[string]struct{}{}
+			for id := range frontier {
+				for _, neighbour := range neighbours[id] {
+					if _, ok := keep[neighbour]; !ok {
+						next[neighbour] = struct{}{}
+					}
+				}
+			}
+			for id := range next {
+				keep[id] = struct{}{}
+			}
+			frontier = next
+		}
+	}
+
+	return filterNodes(nodes, func(node RenderableNode) bool {
+		_, ok := keep[node.ID]
+		return ok
+	})
+}
+
+// Stats implements Renderer
+func (f QueryFilter) Stats(rpt report.Report) Stats {
+	_, filtered := f.render(rpt)
+	var upstream = f.Renderer.Stats(rpt)
+	upstream.FilteredNodes += filtered
+	return upstream
+}
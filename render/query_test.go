@@ -0,0 +1,121 @@
+package render_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestQueryMatch(t *testing.T) {
+	node := render.RenderableNode{
+		ID:         "abc",
+		LabelMajor: "nginx-frontend",
+		LabelMinor: "web-3",
+		Node: report.MakeNodeWith(map[string]string{
+			docker.ImageName:                "library/nginx:1.9",
+			docker.LabelPrefix + "team":     "payments",
+			docker.CPUUsagePercent:          "75",
+			report.HostNodeID:               report.MakeHostNodeID("web-3"),
+			docker.LabelPrefix + "env name": "production",
+		}),
+	}
+	for _, tc := range []struct {
+		expr  string
+		match bool
+	}{
+		{"", true},
+		{"nginx", true},
+		{"NGINX", true},
+		{"apache", false},
+		{"image:nginx*", false},
+		{"image:library/nginx*", true},
+		{"image:*nginx*", true},
+		{"image:NGINX", true},
+		{"image:*:1.9", true},
+		{"image:*:2.0", false},
+		{"image=library/nginx:1.9", true},
+		{"image=nginx", false},
+		{"image!=nginx", true},
+		{"host=web-3", true},
+		{"host=web-4", false},
+		{"host!=web-4", true},
+		{"label.team=payments", true},
+		{"label.team=billing", false},
+		{"label.owner!=someone", true},
+		{"label.owner=someone", false},
+		{`"label.env name=production"`, true},
+		{`label."env name"=production`, true},
+		{"cpu>50", true},
+		{"cpu>=75", true},
+		{"cpu<50", false},
+		{"cpu<=75", true},
+		{"memory>50", false},
+		{"id=abc", true},
+		{"name:frontend", true},
+		{"!name:frontend", false},
+		{"!apache", true},
+		{"nginx label.team=payments cpu>50", true},
+		{"nginx label.team=billing", false},
+	} {
+		query, err := render.ParseQuery(tc.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tc.expr, err)
+			continue
+		}
+		if have := query.Match(node); have != tc.match {
+			t.Errorf("%q: want %v, have %v", tc.expr, tc.match, have)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, expr := range []string{
+		"=foo",
+		"image=",
+		"cpu>lots",
+		`image="nginx`,
+		"!",
+	} {
+		if _, err := render.ParseQuery(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	// a -> b -> c -> d, e
+	renderer := mockRenderer{RenderableNodes: render.RenderableNodes{
+		"a": {ID: "a", LabelMajor: "a", Node: report.MakeNode().WithAdjacent("b")},
+		"b": {ID: "b", LabelMajor: "b", Node: report.MakeNode().WithAdjacent("c")},
+		"c": {ID: "c", LabelMajor: "c", Node: report.MakeNode().WithAdjacent("d")},
+		"d": {ID: "d", LabelMajor: "d", Node: report.MakeNode()},
+		"e": {ID: "e", LabelMajor: "e", Node: report.MakeNode()},
+	}}
+	query, err := render.ParseQuery("name=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hops, want := range [][]string{
+		{"b"},
+		{"a", "b", "c"},
+		{"a", "b", "c", "d"},
+	} {
+		filter := render.QueryFilter{Renderer: renderer, Query: query, Hops: hops}
+		have := []string{}
+		for id := range filter.Render(report.MakeReport()) {
+			have = append(have, id)
+		}
+		sort.Strings(have)
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("%d hops: %s", hops, test.Diff(want, have))
+		}
+		if want, have := 5-len(want), filter.Stats(report.MakeReport()).FilteredNodes; want != have {
+			t.Errorf("%d hops: want %d filtered, have %d", hops, want, have)
+		}
+	}
+}
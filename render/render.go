@@ -1,9 +1,12 @@
 package render
 
 import (
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -34,11 +37,25 @@ func MakeReduce(renderers ...Renderer) Renderer {
 	return Reduce(renderers)
 }
 
-// Render produces a set of RenderableNodes given a Report.
+// Workers is the number of goroutines used to render independent branches
+// of renderers, and to map nodes, concurrently. 1 renders sequentially.
+var Workers = runtime.GOMAXPROCS(0)
+
+// minNodesPerWorker is the least number of nodes worth mapping in another
+// goroutine.
+const minNodesPerWorker = 256
+
+// Render produces a set of RenderableNodes given a Report. The renderers
+// are run concurrently, and their outputs merged in order.
 func (r Reduce) Render(rpt report.Report) RenderableNodes {
+	outputs := make([]RenderableNodes, len(r))
+	r.each(func(i int, renderer Renderer) {
+		outputs[i] = renderer.Render(rpt)
+	})
+
 	result := RenderableNodes{}
-	for _, renderer := range r {
-		result = result.Merge(renderer.Render(rpt))
+	for _, output := range outputs {
+		result = result.Merge(output)
 	}
 	return result
 }
@@ -52,6 +69,45 @@ func (r Reduce) EdgeMetadata(rpt report.Report, localID, remoteID string) report
 	return metadata
 }
 
+func (r Reduce) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	var (
+		outputs = make([]RenderableNodes, len(r))
+		edges   = make([]map[string]report.EdgeMetadatas, len(r))
+	)
+	r.each(func(i int, renderer Renderer) {
+		outputs[i], edges[i] = renderEdges(renderer, rpt)
+	})
+
+	result := RenderableNodes{}
+	resultEdges := map[string]report.EdgeMetadatas{}
+	for i, output := range outputs {
+		result = result.Merge(output)
+		for srcID, e := range edges[i] {
+			resultEdges[srcID] = resultEdges[srcID].Merge(e)
+		}
+	}
+	return result, resultEdges
+}
+
+// each calls f for every renderer, concurrently unless Workers is 1.
+func (r Reduce) each(f func(i int, renderer Renderer)) {
+	if Workers <= 1 {
+		for i, renderer := range r {
+			f(i, renderer)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	for i, renderer := range r {
+		wg.Add(1)
+		go func(i int, renderer Renderer) {
+			defer wg.Done()
+			f(i, renderer)
+		}(i, renderer)
+	}
+	wg.Wait()
+}
+
 // Stats implements Renderer
 func (r Reduce) Stats(rpt report.Report) Stats {
 	var result Stats
@@ -71,7 +127,7 @@ type Map struct {
 // Render transforms a set of RenderableNodes produces by another Renderer.
 // using a map function
 func (m Map) Render(rpt report.Report) RenderableNodes {
-	output, _ := m.render(rpt)
+	output, _ := m.mapNodes(m.Renderer.Render(rpt), LocalNetworks(rpt))
 	return output
 }
 
@@ -83,18 +139,54 @@ func (m Map) Stats(rpt report.Report) Stats {
 	return Stats{}
 }
 
-func (m Map) render(rpt report.Report) (RenderableNodes, map[string]report.IDList) {
+// mapNodes maps the nodes rendered by m.Renderer, returning the output nodes
+// and the IDs each input node was mapped to.
+func (m Map) mapNodes(input RenderableNodes, localNetworks report.Networks) (RenderableNodes, map[string]report.IDList) {
 	var (
-		input         = m.Renderer.Render(rpt)
-		output        = RenderableNodes{}
-		mapped        = map[string]report.IDList{} // input node ID -> output node IDs
-		adjacencies   = map[string]report.IDList{} // output node ID -> input node Adjacencies
-		localNetworks = LocalNetworks(rpt)
+		output      = RenderableNodes{}
+		mapped      = map[string]report.IDList{} // input node ID -> output node IDs
+		adjacencies = map[string]report.IDList{} // output node ID -> input node Adjacencies
 	)
 
-	// Rewrite all the nodes according to the map function
+	// Rewrite all the nodes according to the map function, in parallel,
+	// then merge the results in one go.
+	inputs := make([]RenderableNode, 0, len(input))
 	for _, inRenderable := range input {
-		for _, outRenderable := range m.MapFunc(inRenderable, localNetworks) {
+		inputs = append(inputs, inRenderable)
+	}
+	results := make([]RenderableNodes, len(inputs))
+	mapRange := func(from, to int) {
+		for i := from; i < to; i++ {
+			results[i] = m.MapFunc(inputs[i], localNetworks)
+		}
+	}
+	workers := len(inputs) / minNodesPerWorker
+	if workers > Workers {
+		workers = Workers
+	}
+	if workers > 1 {
+		var (
+			wg    sync.WaitGroup
+			chunk = (len(inputs) + workers - 1) / workers
+		)
+		for from := 0; from < len(inputs); from += chunk {
+			to := from + chunk
+			if to > len(inputs) {
+				to = len(inputs)
+			}
+			wg.Add(1)
+			go func(from, to int) {
+				defer wg.Done()
+				mapRange(from, to)
+			}(from, to)
+		}
+		wg.Wait()
+	} else {
+		mapRange(0, len(inputs))
+	}
+
+	for i, inRenderable := range inputs {
+		for _, outRenderable := range results[i] {
 			existing, ok := output[outRenderable.ID]
 			if ok {
 				outRenderable = outRenderable.Merge(existing)
@@ -124,35 +216,62 @@ func (m Map) render(rpt report.Report) (RenderableNodes, map[string]report.IDLis
 
 // EdgeMetadata gives the metadata of an edge from the perspective of the
 // srcRenderableID. Since an edgeID can have multiple edges on the address
-// level, it uses the supplied mapping function to translate address IDs to
-// renderable node (mapped) IDs.
+// level, the metadata of all the edges mapped to it is merged.
 func (m Map) EdgeMetadata(rpt report.Report, srcRenderableID, dstRenderableID string) report.EdgeMetadata {
-	// First we need to map the ids in this layer into the ids in the underlying layer
-	_, mapped := m.render(rpt)        // this maps from old -> new
-	inverted := map[string][]string{} // this maps from new -> old(s)
-	for k, vs := range mapped {
-		for _, v := range vs {
-			existing := inverted[v]
-			existing = append(existing, k)
-			inverted[v] = existing
-		}
+	md, _ := EdgeMetadatas(m, rpt)[srcRenderableID].Lookup(dstRenderableID)
+	return md
+}
+
+// renderEdges maps the edges below along with their nodes, merging the
+// metadata of those mapped to the same edge.
+func (m Map) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	input, inputEdges := renderEdges(m.Renderer, rpt)
+	output, mapped := m.mapNodes(input, LocalNetworks(rpt))
+	edges := map[string]report.EdgeMetadatas{}
+	for srcID, e := range inputEdges {
+		e.ForEach(func(dstID string, metadata report.EdgeMetadata) {
+			for _, src := range mapped[srcID] {
+				for _, dst := range mapped[dstID] {
+					existing, _ := edges[src].Lookup(dst)
+					edges[src] = edges[src].Set(dst, existing.Merge(metadata))
+				}
+			}
+		})
 	}
+	return output, edges
+}
+
+// edgeRenderer is implemented by renderers which can work out the metadata
+// of all their edges as they render their nodes, rendering every layer below
+// them once, rather than once per edge.
+type edgeRenderer interface {
+	renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas)
+}
 
-	// Now work out a slice of edges this edge is constructed from
-	oldEdges := []struct{ src, dst string }{}
-	for _, oldSrcID := range inverted[srcRenderableID] {
-		for _, oldDstID := range inverted[dstRenderableID] {
-			oldEdges = append(oldEdges, struct{ src, dst string }{oldSrcID, oldDstID})
+// renderEdges renders the nodes of r, and the metadata of their edges, by
+// source and then destination node ID. Renderers which don't implement
+// edgeRenderer are asked for the metadata of each edge in turn. The edges
+// may be shared with other renders, so must not be modified.
+func renderEdges(r Renderer, rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	if r, ok := r.(edgeRenderer); ok {
+		return r.renderEdges(rpt)
+	}
+	nodes := r.Render(rpt)
+	edges := map[string]report.EdgeMetadatas{}
+	for srcID, node := range nodes {
+		for _, dstID := range node.Adjacency {
+			edges[srcID] = edges[srcID].Set(dstID, r.EdgeMetadata(rpt, srcID, dstID))
 		}
 	}
+	return nodes, edges
+}
 
-	// Now recurse for each old edge
-	output := report.EdgeMetadata{}
-	for _, edge := range oldEdges {
-		metadata := m.Renderer.EdgeMetadata(rpt, edge.src, edge.dst)
-		output = output.Merge(metadata)
-	}
-	return output
+// EdgeMetadatas returns the metadata of every edge rendered by r, by source
+// and then destination node ID. It works out all of them in one render of
+// each layer, rather than one per edge, as EdgeMetadata would.
+func EdgeMetadatas(r Renderer, rpt report.Report) map[string]report.EdgeMetadatas {
+	_, edges := renderEdges(r, rpt)
+	return edges
 }
 
 // CustomRenderer allow for mapping functions that recived the entire topology
@@ -168,6 +287,11 @@ func (c CustomRenderer) Render(rpt report.Report) RenderableNodes {
 	return c.RenderFunc(c.Renderer.Render(rpt))
 }
 
+func (c CustomRenderer) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	nodes, edges := renderEdges(c.Renderer, rpt)
+	return c.RenderFunc(nodes), edges
+}
+
 // ColorConnected colors nodes with the IsConnected key if
 // they have edges to or from them.
 func ColorConnected(r Renderer) Renderer {
@@ -190,7 +314,7 @@ func ColorConnected(r Renderer) Renderer {
 
 			for id := range connected {
 				node := input[id]
-				node.Metadata[IsConnected] = "true"
+				node.Metadata = node.Metadata.Set(IsConnected, "true")
 				input[id] = node
 			}
 			return input
@@ -211,11 +335,23 @@ func (f Filter) Render(rpt report.Report) RenderableNodes {
 }
 
 func (f Filter) render(rpt report.Report) (RenderableNodes, int) {
+	return filterNodes(f.Renderer.Render(rpt), f.FilterFunc)
+}
+
+func (f Filter) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	nodes, edges := renderEdges(f.Renderer, rpt)
+	nodes, _ = filterNodes(nodes, f.FilterFunc)
+	return nodes, edges
+}
+
+// filterNodes keeps the nodes for which keep returns true, and returns them
+// with the number of nodes removed.
+func filterNodes(nodes RenderableNodes, keep func(RenderableNode) bool) (RenderableNodes, int) {
 	output := RenderableNodes{}
 	inDegrees := map[string]int{}
 	filtered := 0
-	for id, node := range f.Renderer.Render(rpt) {
-		if f.FilterFunc(node) {
+	for id, node := range nodes {
+		if keep(node) {
 			output[id] = node
 			inDegrees[id] = 0
 		} else {
@@ -269,26 +405,40 @@ func FilterUnconnected(r Renderer) Renderer {
 	return Filter{
 		Renderer: ColorConnected(r),
 		FilterFunc: func(node RenderableNode) bool {
-			_, ok := node.Metadata[IsConnected]
+			_, ok := node.Metadata.Lookup(IsConnected)
 			return ok
 		},
 	}
 }
 
+// FilterUnconnectedExceptListening produces a renderer that filters
+// unconnected nodes from the given renderer, but keeps those which are
+// listening for connections, i.e. servers which are currently idle.
+func FilterUnconnectedExceptListening(r Renderer) Renderer {
+	return Filter{
+		Renderer: ColorConnected(r),
+		FilterFunc: func(node RenderableNode) bool {
+			_, connected := node.Metadata.Lookup(IsConnected)
+			_, listening := node.Metadata.Lookup(endpoint.Listening)
+			return connected || listening
+		},
+	}
+}
+
 // FilterSystem is a Renderer which filters out system nodes.
 func FilterSystem(r Renderer) Renderer {
 	return Filter{
 		Renderer: r,
 		FilterFunc: func(node RenderableNode) bool {
-			containerName := node.Metadata[docker.ContainerName]
+			containerName := node.Metadata.Get(docker.ContainerName)
 			if _, ok := systemContainerNames[containerName]; ok {
 				return false
 			}
-			imagePrefix := strings.SplitN(node.Metadata[docker.ImageName], ":", 2)[0] // :(
+			imagePrefix := strings.SplitN(node.Metadata.Get(docker.ImageName), ":", 2)[0] // :(
 			if _, ok := systemImagePrefixes[imagePrefix]; ok {
 				return false
 			}
-			if node.Metadata[docker.LabelPrefix+"works.weave.role"] == "system" {
+			if node.Metadata.Get(docker.LabelPrefix+"works.weave.role") == "system" {
 				return false
 			}
 			return true
@@ -3,7 +3,9 @@ package render_test
 import (
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test"
@@ -117,7 +119,7 @@ func TestMapRender3(t *testing.T) {
 func TestMapEdge(t *testing.T) {
 	selector := render.TopologySelector(func(_ report.Report) render.RenderableNodes {
 		return render.MakeRenderableNodes(report.Topology{
-			Nodes: report.Nodes{
+			Nodes: report.MakeNodes(map[string]report.Node{
 				"foo": report.MakeNode().WithMetadata(map[string]string{
 					"id": "foo",
 				}).WithEdge("bar", report.EdgeMetadata{
@@ -131,7 +133,7 @@ func TestMapEdge(t *testing.T) {
 					EgressPacketCount: newu64(3),
 					EgressByteCount:   newu64(4),
 				}),
-			},
+			}),
 		})
 	})
 
@@ -180,6 +182,61 @@ func TestMapEdge(t *testing.T) {
 	}
 }
 
+func TestEdgeMetadatas(t *testing.T) {
+	for name, r := range map[string]render.Renderer{
+		"endpoints":          render.EndpointRenderer,
+		"processes":          render.ProcessWithContainerNameRenderer,
+		"process names":      render.ProcessNameRenderer,
+		"containers":         render.ContainerWithImageNameRenderer,
+		"container images":   render.ContainerImageRenderer,
+		"pods":               render.PodRenderer,
+		"services":           render.ServiceRenderer,
+		"hosts":              render.HostRenderer,
+		"grouped containers": render.GroupBy("docker_label_foo1", render.Nouns{}, render.ContainerWithImageNameRenderer),
+		"internet domains":   render.SplitInternetByDomain(render.ContainerWithImageNameRenderer),
+	} {
+		all := render.EdgeMetadatas(r, test.Report)
+		for srcID, node := range r.Render(test.Report) {
+			for _, dstID := range node.Adjacency {
+				want := r.EdgeMetadata(test.Report, srcID, dstID)
+				if have := all[srcID].Get(dstID); !reflect.DeepEqual(want, have) {
+					t.Errorf("%s: %s -> %s: %s", name, srcID, dstID, test.Diff(want, have))
+				}
+			}
+		}
+	}
+}
+
+func TestEdgeMetadatasRendersOnce(t *testing.T) {
+	renders := 0
+	var renderer render.Renderer = countingMockRenderer{
+		mockRenderer: mockRenderer{
+			RenderableNodes: render.RenderableNodes{
+				"foo": {ID: "foo", Node: report.MakeNode().WithAdjacent("bar")},
+				"bar": {ID: "bar", Node: report.MakeNode()},
+			},
+			edgeMetadata: report.EdgeMetadata{EgressPacketCount: newu64(1)},
+		},
+		renders: &renders,
+	}
+	identity := func(n render.RenderableNode, _ report.Networks) render.RenderableNodes {
+		return render.RenderableNodes{n.ID: n}
+	}
+	for i := 0; i < 3; i++ {
+		renderer = render.FilterUnconnected(render.Map{MapFunc: identity, Renderer: renderer})
+	}
+
+	want := map[string]report.EdgeMetadatas{
+		"foo": report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{"bar": {EgressPacketCount: newu64(1)}}),
+	}
+	if have := render.EdgeMetadatas(renderer, report.MakeReport()); !reflect.DeepEqual(want, have) {
+		t.Errorf("%s", test.Diff(want, have))
+	}
+	if renders != 1 {
+		t.Errorf("want 1 render, have %d", renders)
+	}
+}
+
 func TestFilterRender(t *testing.T) {
 	renderer := render.FilterUnconnected(
 		mockRenderer{RenderableNodes: render.RenderableNodes{
@@ -281,3 +338,105 @@ func TestFilterUnconnectedPesudoNodes(t *testing.T) {
 }
 
 func newu64(value uint64) *uint64 { return &value }
+
+func TestFilterUnconnectedExceptListening(t *testing.T) {
+	renderer := render.FilterUnconnectedExceptListening(mockRenderer{RenderableNodes: render.RenderableNodes{
+		"foo":    {ID: "foo", Node: report.MakeNode().WithAdjacent("bar")},
+		"bar":    {ID: "bar", Node: report.MakeNode()},
+		"idle":   {ID: "idle", Node: report.MakeNodeWith(map[string]string{endpoint.Listening: "tcp"})},
+		"lonely": {ID: "lonely", Node: report.MakeNode()},
+	}})
+	have := report.MakeIDList()
+	for id := range renderer.Render(report.MakeReport()) {
+		have = have.Add(id)
+	}
+	if want := report.MakeIDList("foo", "bar", "idle"); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if want, have := 1, renderer.Stats(report.MakeReport()).FilteredNodes; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+}
+
+type countingMockRenderer struct {
+	mockRenderer
+	renders *int
+}
+
+func (c countingMockRenderer) Render(rpt report.Report) render.RenderableNodes {
+	*c.renders++
+	return c.mockRenderer.Render(rpt)
+}
+
+func TestMemoise(t *testing.T) {
+	renders := 0
+	renderer := render.Memoise(countingMockRenderer{
+		mockRenderer: mockRenderer{RenderableNodes: render.RenderableNodes{"foo": render.NewRenderableNode("foo")}},
+		renders:      &renders,
+	})
+
+	rpt := report.MakeReport()
+	first := renderer.Render(rpt)
+	delete(first, "foo")
+	if have := renderer.Render(rpt); len(have) != 1 {
+		t.Errorf("want a copy of the memoised render, have %v", have)
+	}
+	if renders != 1 {
+		t.Errorf("want 1 render, have %d", renders)
+	}
+
+	derived := rpt.Copy()
+	derived.Topologies[report.Host] = derived.Topologies[report.Host].AddNode("bar", report.MakeNode())
+	renderer.Render(derived)
+	if renders != 2 {
+		t.Errorf("want 2 renders, have %d", renders)
+	}
+
+	// Rendering a derived report doesn't evict the original.
+	renderer.Render(rpt)
+	if renders != 2 {
+		t.Errorf("want 2 renders, have %d", renders)
+	}
+}
+
+type panickingMockRenderer struct {
+	mockRenderer
+	panics *int
+}
+
+func (p panickingMockRenderer) Render(rpt report.Report) render.RenderableNodes {
+	if *p.panics > 0 {
+		*p.panics--
+		panic("render failed")
+	}
+	return p.mockRenderer.Render(rpt)
+}
+
+func TestMemoisePanic(t *testing.T) {
+	panics := 1
+	renderer := render.Memoise(panickingMockRenderer{
+		mockRenderer: mockRenderer{RenderableNodes: render.RenderableNodes{"foo": render.NewRenderableNode("foo")}},
+		panics:       &panics,
+	})
+	rpt := report.MakeReport()
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("want the render to panic")
+			}
+		}()
+		renderer.Render(rpt)
+	}()
+
+	done := make(chan render.RenderableNodes)
+	go func() { done <- renderer.Render(rpt) }()
+	select {
+	case have := <-done:
+		if len(have) != 1 {
+			t.Errorf("want a render, have %v", have)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("render hung after a panic")
+	}
+}
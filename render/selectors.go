@@ -15,18 +15,21 @@ func (t TopologySelector) Render(r report.Report) RenderableNodes {
 
 // EdgeMetadata implements Renderer
 func (t TopologySelector) EdgeMetadata(rpt report.Report, srcID, dstID string) report.EdgeMetadata {
+	md, _ := t(rpt)[srcID].Edges.Lookup(dstID)
+	return md
+}
+
+func (t TopologySelector) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
 	var (
-		nodes    = t(rpt)
-		metadata = report.EdgeMetadata{}
+		nodes = t(rpt)
+		edges = map[string]report.EdgeMetadatas{}
 	)
-	for src, node := range nodes {
-		for dst, edgeMeta := range node.Edges {
-			if src == srcID && dst == dstID {
-				return edgeMeta
-			}
+	for id, node := range nodes {
+		if node.Edges.Size() > 0 {
+			edges[id] = node.Edges
 		}
 	}
-	return metadata
+	return nodes, edges
 }
 
 // Stats implements Renderer
@@ -37,58 +40,64 @@ func (t TopologySelector) Stats(r report.Report) Stats {
 // MakeRenderableNodes converts a topology to a set of RenderableNodes
 func MakeRenderableNodes(t report.Topology) RenderableNodes {
 	result := RenderableNodes{}
-	for id, nmd := range t.Nodes {
+	t.Nodes.ForEach(func(id string, nmd report.Node) {
 		rn := NewRenderableNode(id).WithNode(nmd)
 		rn.Origins = report.MakeIDList(id)
-		if hostNodeID, ok := nmd.Metadata[report.HostNodeID]; ok {
+		if hostNodeID, ok := nmd.Metadata.Lookup(report.HostNodeID); ok {
 			rn.Origins = rn.Origins.Add(hostNodeID)
 		}
 		result[id] = rn
-	}
+	})
 
 	// Push EdgeMetadata to both ends of the edges
 	for srcID, srcNode := range result {
-		for dstID, emd := range srcNode.Edges {
+		srcNode.Edges.ForEach(func(dstID string, emd report.EdgeMetadata) {
 			srcNode.EdgeMetadata = srcNode.EdgeMetadata.Flatten(emd)
 
 			dstNode := result[dstID]
 			dstNode.EdgeMetadata = dstNode.EdgeMetadata.Flatten(emd.Reversed())
 			result[dstID] = dstNode
-		}
+		})
 
 		result[srcID] = srcNode
 	}
 	return result
 }
 
+// SelectTopology returns a TopologySelector which selects the named topology,
+// or nothing if the report doesn't have it.
+func SelectTopology(name string) TopologySelector {
+	return TopologySelector(func(r report.Report) RenderableNodes {
+		t, ok := r.Topology(name)
+		if !ok {
+			return RenderableNodes{}
+		}
+		return MakeRenderableNodes(t)
+	})
+}
+
 var (
 	// SelectEndpoint selects the endpoint topology.
-	SelectEndpoint = TopologySelector(func(r report.Report) RenderableNodes {
-		return MakeRenderableNodes(r.Endpoint)
-	})
+	SelectEndpoint = SelectTopology(report.Endpoint)
 
 	// SelectProcess selects the process topology.
-	SelectProcess = TopologySelector(func(r report.Report) RenderableNodes {
-		return MakeRenderableNodes(r.Process)
-	})
+	SelectProcess = SelectTopology(report.Process)
 
 	// SelectContainer selects the container topology.
-	SelectContainer = TopologySelector(func(r report.Report) RenderableNodes {
-		return MakeRenderableNodes(r.Container)
-	})
+	SelectContainer = SelectTopology(report.Container)
 
 	// SelectContainerImage selects the container image topology.
-	SelectContainerImage = TopologySelector(func(r report.Report) RenderableNodes {
-		return MakeRenderableNodes(r.ContainerImage)
-	})
+	SelectContainerImage = SelectTopology(report.ContainerImage)
 
 	// SelectAddress selects the address topology.
-	SelectAddress = TopologySelector(func(r report.Report) RenderableNodes {
-		return MakeRenderableNodes(r.Address)
-	})
+	SelectAddress = SelectTopology(report.Address)
+
+	// SelectPod selects the pod topology.
+	SelectPod = SelectTopology(report.Pod)
+
+	// SelectService selects the service topology.
+	SelectService = SelectTopology(report.Service)
 
 	// SelectHost selects the address topology.
-	SelectHost = TopologySelector(func(r report.Report) RenderableNodes {
-		return MakeRenderableNodes(r.Host)
-	})
+	SelectHost = SelectTopology(report.Host)
 )
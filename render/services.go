@@ -0,0 +1,111 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	Min, Max int
+}
+
+// DefaultEphemeralPorts is used for hosts which don't report their ephemeral
+// port range. Linux uses 32768 to 60999, IANA suggests 49152 to 65535.
+var DefaultEphemeralPorts = PortRange{32768, 65535}
+
+// ParsePortRange parses a port range as reported by the host probe, e.g.
+// "32768-60999".
+func ParsePortRange(s string) (PortRange, error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	first, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	last, err := strconv.Atoi(parts[1])
+	if err != nil || last < first {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return PortRange{first, last}, nil
+}
+
+// Contains returns true if the port is in the range.
+func (r PortRange) Contains(port int) bool {
+	return port >= r.Min && port <= r.Max
+}
+
+// ServiceNames maps (TCP) ports to the names of the services usually found
+// on them, e.g. "5432" -> "postgres".
+type ServiceNames map[string]string
+
+// KnownServices is used to label pseudo nodes for well-known ports. It is
+// empty unless populated at startup, before any rendering happens.
+var KnownServices = ServiceNames{}
+
+// ReadServiceNames reads a table of services in the format of /etc/services.
+// Only TCP services are included.
+func ReadServiceNames(r io.Reader) (ServiceNames, error) {
+	result := ServiceNames{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		// name port/protocol [aliases...]
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		parts := strings.SplitN(fields[1], "/", 2)
+		if len(parts) != 2 || parts[1] != "tcp" {
+			continue
+		}
+		if _, err := strconv.ParseUint(parts[0], 10, 16); err != nil {
+			continue
+		}
+		if _, ok := result[parts[0]]; !ok {
+			result[parts[0]] = fields[0]
+		}
+	}
+	return result, scanner.Err()
+}
+
+// ParseServiceNames parses a comma-separated list of name:port pairs, e.g.
+// "postgres:5432,redis:6379".
+func ParseServiceNames(s string) (ServiceNames, error) {
+	result := ServiceNames{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid service %q", pair)
+		}
+		if _, err := strconv.ParseUint(parts[1], 10, 16); err != nil {
+			return nil, fmt.Errorf("invalid service %q", pair)
+		}
+		result[parts[1]] = parts[0]
+	}
+	return result, nil
+}
+
+// Merge merges two tables of service names, preferring the other one in
+// case of conflict. Merge does not modify the receiver.
+func (s ServiceNames) Merge(other ServiceNames) ServiceNames {
+	result := make(ServiceNames, len(s)+len(other))
+	for port, name := range s {
+		result[port] = name
+	}
+	for port, name := range other {
+		result[port] = name
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package render_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestParsePortRange(t *testing.T) {
+	for input, want := range map[string]render.PortRange{
+		"32768-60999": {32768, 60999},
+		"1024-1024":   {1024, 1024},
+	} {
+		have, err := render.ParsePortRange(input)
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+		} else if want != have {
+			t.Errorf("%q: want %v, have %v", input, want, have)
+		}
+	}
+	for _, input := range []string{"", "32768", "32768-", "60999-32768", "a-b"} {
+		if _, err := render.ParsePortRange(input); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestReadServiceNames(t *testing.T) {
+	have, err := render.ReadServiceNames(strings.NewReader(`
+# Network services, Internet style
+ssh		22/tcp				# SSH Remote Login Protocol
+domain		53/tcp				# Domain Name Server
+domain		53/udp
+bootps		67/udp
+postgresql	5432/tcp	postgres	# PostgreSQL Database
+broken		99999/tcp
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := render.ServiceNames{
+		"22":   "ssh",
+		"53":   "domain",
+		"5432": "postgresql",
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestParseServiceNames(t *testing.T) {
+	have, err := render.ParseServiceNames("postgres:5432, redis:6379")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (render.ServiceNames{"5432": "postgres", "6379": "redis"}); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	for _, input := range []string{"postgres", ":5432", "postgres:http"} {
+		if _, err := render.ParseServiceNames(input); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
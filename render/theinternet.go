@@ -4,6 +4,9 @@ import (
 	"net"
 	"strings"
 
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/report"
 )
@@ -18,10 +21,10 @@ func LocalNetworks(r report.Report) report.Networks {
 		networks = map[string]struct{}{}
 	)
 
-	for _, md := range r.Host.Nodes {
-		val, ok := md.Metadata[host.LocalNetworks]
+	r.Topologies[report.Host].Nodes.ForEach(func(_ string, md report.Node) {
+		val, ok := md.Metadata.Lookup(host.LocalNetworks)
 		if !ok {
-			continue
+			return
 		}
 		for _, s := range strings.Fields(val) {
 			_, ipNet, err := net.ParseCIDR(s)
@@ -34,6 +37,245 @@ func LocalNetworks(r report.Report) report.Networks {
 				networks[ipNet.String()] = struct{}{}
 			}
 		}
-	}
+	})
 	return result
 }
+
+// InternetDomain and InternetNetwork are the metadata keys under which
+// internet pseudo nodes record the domain and the network of the remote
+// nodes they were made from, to be grouped by.
+const (
+	InternetDomain  = "internet_domain"
+	InternetNetwork = "internet_network"
+)
+
+// NamedNetwork is a network outside our infrastructure which gets its own
+// internet pseudo node, e.g. a payment provider.
+type NamedNetwork struct {
+	Name string
+	Net  *net.IPNet
+}
+
+// InternetNetworks is the list of networks used by SplitInternetByNetwork.
+// It is empty unless populated at startup, before any rendering happens.
+var InternetNetworks []NamedNetwork
+
+// ParseNamedNetworks parses a comma-separated list of networks, each an
+// optional name and a CIDR, e.g. "payments=203.0.113.0/24,198.51.100.0/24".
+// Networks without a name are named after their CIDR.
+func ParseNamedNetworks(s string) ([]NamedNetwork, error) {
+	var result []NamedNetwork
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, cidr := "", entry
+		if parts := strings.SplitN(entry, "=", 2); len(parts) == 2 {
+			name, cidr = parts[0], parts[1]
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			name = ipNet.String()
+		}
+		result = append(result, NamedNetwork{Name: name, Net: ipNet})
+	}
+	return result, nil
+}
+
+// SplitInternetByDomain splits the internet pseudo node into a pseudo node
+// per domain, e.g. "*.amazonaws.com", using the reverse-resolved names of
+// remote addresses. Addresses without a name stay in the internet node.
+func SplitInternetByDomain(r Renderer) Renderer {
+	return internetGroupRenderer{Renderer: r, key: InternetDomain}
+}
+
+// SplitInternetByNetwork splits the internet pseudo node into a pseudo node
+// per network in InternetNetworks. Addresses in none of them stay in the
+// internet node.
+func SplitInternetByNetwork(r Renderer) Renderer {
+	return internetGroupRenderer{Renderer: r, key: InternetNetwork}
+}
+
+// MergeTheInternet merges all the internet pseudo nodes into one. Views
+// which don't split the internet need it, as remote nodes are mapped to an
+// internet pseudo node per domain and network, for any view to group them.
+func MergeTheInternet(r Renderer) Renderer {
+	return internetGroupRenderer{Renderer: r}
+}
+
+// internetGroupRenderer groups the internet pseudo nodes rendered by
+// Renderer by the metadata key, or into one if it's empty. Only the pseudo
+// nodes are rewritten, so the layers below render the same whichever way
+// the internet is grouped.
+type internetGroupRenderer struct {
+	Renderer
+	key string
+}
+
+func (r internetGroupRenderer) Render(rpt report.Report) RenderableNodes {
+	output, _ := r.group(r.Renderer.Render(rpt))
+	return output
+}
+
+func (r internetGroupRenderer) EdgeMetadata(rpt report.Report, localID, remoteID string) report.EdgeMetadata {
+	md, _ := EdgeMetadatas(r, rpt)[localID].Lookup(remoteID)
+	return md
+}
+
+// renderEdges merges the edges to and from the internet nodes moved into a
+// group into those of the group.
+func (r internetGroupRenderer) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	input, inputEdges := renderEdges(r.Renderer, rpt)
+	output, groups := r.group(input)
+	group := func(id string) string {
+		if groupID, ok := groups[id]; ok {
+			return groupID
+		}
+		return id
+	}
+	edges := map[string]report.EdgeMetadatas{}
+	for srcID, e := range inputEdges {
+		src := group(srcID)
+		e.ForEach(func(dstID string, metadata report.EdgeMetadata) {
+			dst := group(dstID)
+			existing, _ := edges[src].Lookup(dst)
+			edges[src] = edges[src].Set(dst, existing.Merge(metadata))
+		})
+	}
+	return output, edges
+}
+
+// group returns the grouped nodes, and the group ID of each internet node
+// which was moved into a group.
+func (r internetGroupRenderer) group(input RenderableNodes) (RenderableNodes, map[string]string) {
+	groups := map[string]string{}
+	for id, n := range input {
+		if !IsTheInternet(id) {
+			continue
+		}
+		if groupID := r.groupID(n); groupID != id {
+			groups[id] = groupID
+		}
+	}
+	if len(groups) == 0 {
+		return input, groups
+	}
+
+	output := make(RenderableNodes, len(input))
+	for id, n := range input {
+		adjacency := make(report.IDList, 0, len(n.Adjacency))
+		for _, dstID := range n.Adjacency {
+			if groupID, ok := groups[dstID]; ok {
+				dstID = groupID
+			}
+			adjacency = adjacency.Add(dstID)
+		}
+		n.Adjacency = adjacency
+
+		if groupID, ok := groups[id]; ok {
+			id = groupID
+			n.ID, n.LabelMajor, n.LabelMinor = groupID, TheInternetMajor, ""
+			if group := n.Metadata.Get(r.key); r.key != "" && group != "" {
+				n.LabelMajor, n.LabelMinor = group, TheInternetMajor
+			}
+		}
+		if existing, ok := output[id]; ok {
+			n = n.Merge(existing)
+		}
+		output[id] = n
+	}
+	return output, groups
+}
+
+func (r internetGroupRenderer) groupID(n RenderableNode) string {
+	if group := n.Metadata.Get(r.key); r.key != "" && group != "" {
+		return MakePseudoNodeID(TheInternetID, group)
+	}
+	return TheInternetID
+}
+
+// networkGroup returns the name of the most specific of InternetNetworks
+// an address is in, or "" if it's in none of them.
+func networkGroup(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	var (
+		group string
+		best  = -1
+	)
+	for _, network := range InternetNetworks {
+		if ones, _ := network.Net.Mask.Size(); network.Net.Contains(ip) && ones > best {
+			group, best = network.Name, ones
+		}
+	}
+	return group
+}
+
+// domainGroup returns the group for a host name, which is the domain it's
+// registered under, e.g. "*.amazonaws.com" for "s3-1.amazonaws.com", or
+// "*.bbc.co.uk" for "www.bbc.co.uk".
+func domainGroup(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	suffix := icannSuffix(name)
+	if !strings.HasSuffix(name, "."+suffix) {
+		return ""
+	}
+	labels := strings.Split(strings.TrimSuffix(name, "."+suffix), ".")
+	for _, label := range labels {
+		if label == "" {
+			return ""
+		}
+	}
+	domain := labels[len(labels)-1] + "." + suffix
+	if len(labels) == 1 {
+		return domain
+	}
+	return "*." + domain
+}
+
+// icannSuffix returns the public suffix of a host name, such as "co.uk",
+// ignoring the suffixes the list has for the customers of hosting companies,
+// such as "compute.amazonaws.com", which would make a group per host.
+func icannSuffix(name string) string {
+	suffix, icann := publicsuffix.PublicSuffix(name)
+	for !icann {
+		i := strings.Index(suffix, ".")
+		if i < 0 {
+			break
+		}
+		suffix, icann = publicsuffix.PublicSuffix(suffix[i+1:])
+	}
+	return suffix
+}
+
+// theInternetNode returns the internet pseudo node for a remote node. Nodes
+// with a domain or a network get their own, tagged with them, which
+// internetGroupRenderer merges into the groups asked for.
+func theInternetNode(m RenderableNode) RenderableNodes {
+	domain, network := domainGroup(m.Metadata.Get("name")), networkGroup(m.Metadata.Get(endpoint.Addr))
+	if domain == "" && network == "" {
+		return RenderableNodes{TheInternetID: newDerivedPseudoNode(TheInternetID, TheInternetMajor, m)}
+	}
+	id := MakePseudoNodeID(TheInternetID, domain, network)
+	node := newDerivedPseudoNode(id, TheInternetMajor, m)
+	tags := map[string]string{}
+	if domain != "" {
+		tags[InternetDomain] = domain
+	}
+	if network != "" {
+		tags[InternetNetwork] = network
+	}
+	node.Node = node.Node.WithMetadata(tags)
+	return RenderableNodes{id: node}
+}
+
+// IsTheInternet returns true if the ID is of an internet pseudo node,
+// whether or not the internet was split into groups.
+func IsTheInternet(id string) bool {
+	return id == TheInternetID || strings.HasPrefix(id, MakePseudoNodeID(TheInternetID, ""))
+}
@@ -12,19 +12,21 @@ import (
 )
 
 func TestReportLocalNetworks(t *testing.T) {
-	r := report.MakeReport().Merge(report.Report{
-		Host: report.Topology{
-			Nodes: report.Nodes{
+	r := report.MakeReport().Merge(report.Report{Topologies: map[string]report.Topology{
+		report.Host: report.Topology{
+			Nodes: report.MakeNodes(map[string]report.Node{
 				"nonets": report.MakeNode(),
 				"foo": report.MakeNodeWith(map[string]string{
-					host.LocalNetworks: "10.0.0.1/8 192.168.1.1/24 10.0.0.1/8 badnet/33",
+					host.LocalNetworks: "10.0.0.1/8 192.168.1.1/24 10.0.0.1/8 badnet/33 2001:db8::1/64 fe80::1/64",
 				}),
-			},
+			}),
 		},
-	})
+	}})
 	want := report.Networks([]*net.IPNet{
 		mustParseCIDR("10.0.0.1/8"),
 		mustParseCIDR("192.168.1.1/24"),
+		mustParseCIDR("2001:db8::1/64"),
+		mustParseCIDR("fe80::1/64"),
 	})
 	have := render.LocalNetworks(r)
 	if !reflect.DeepEqual(want, have) {
@@ -32,6 +34,133 @@ func TestReportLocalNetworks(t *testing.T) {
 	}
 }
 
+// withEndpointName returns a copy of the report with the random client's
+// endpoint resolved to name.
+func withEndpointName(rpt report.Report, name string) report.Report {
+	endpoints := rpt.Topologies[report.Endpoint]
+	node := endpoints.Nodes.Get(test.RandomClientNodeID).WithMetadata(map[string]string{"name": name})
+	endpoints.Nodes = endpoints.Nodes.Set(test.RandomClientNodeID, node)
+	return rpt.WithTopology(report.Endpoint, endpoints)
+}
+
+func TestSplitInternetByDomain(t *testing.T) {
+	rpt := test.Report.Copy()
+	rpt = withEndpointName(rpt, "ec2-51-52-53-54.compute.amazonaws.com.")
+
+	var (
+		renderer        = render.SplitInternetByDomain(render.ProcessRenderer)
+		have            = renderer.Render(rpt)
+		groupID         = render.MakePseudoNodeID(render.TheInternetID, "*.amazonaws.com")
+		serverProcessID = render.MakeProcessID(test.ServerHostID, test.ServerPID)
+	)
+	group, ok := have[groupID]
+	if !ok {
+		t.Fatalf("want %q, have %v", groupID, have)
+	}
+	if want := "*.amazonaws.com"; group.LabelMajor != want || group.LabelMinor != render.TheInternetMajor || !group.Pseudo {
+		t.Errorf("want %q, have %+v", want, group)
+	}
+	if want, have := report.MakeIDList(serverProcessID), group.Adjacency; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := uint64(60), renderer.EdgeMetadata(rpt, groupID, serverProcessID).EgressPacketCount; have == nil || want != *have {
+		t.Errorf("want %d, have %v", want, have)
+	}
+
+	// Unnamed addresses stay in the internet node.
+	if !render.IsTheInternet(groupID) {
+		t.Errorf("%q should be an internet node", groupID)
+	}
+	if _, ok := have[render.TheInternetID]; !ok {
+		t.Errorf("want %q, have %v", render.TheInternetID, have)
+	}
+
+	// The report itself isn't modified.
+	if _, ok := rpt.Topologies[report.Endpoint].Nodes.Get(test.RandomClientNodeID).Metadata.Lookup(render.InternetDomain); ok {
+		t.Errorf("report was modified")
+	}
+}
+
+func TestMergeTheInternet(t *testing.T) {
+	rpt := test.Report.Copy()
+	rpt = withEndpointName(rpt, "ec2-51-52-53-54.compute.amazonaws.com.")
+
+	var (
+		serverProcessID = render.MakeProcessID(test.ServerHostID, test.ServerPID)
+		want            = render.ProcessRenderer.Render(test.Report)[render.TheInternetID]
+		renderer        = render.MergeTheInternet(render.ProcessRenderer)
+		have            = renderer.Render(rpt)
+	)
+	for id := range have {
+		if render.IsTheInternet(id) && id != render.TheInternetID {
+			t.Errorf("unexpected %q", id)
+		}
+	}
+	node := have[render.TheInternetID]
+	if node.LabelMajor != render.TheInternetMajor || node.LabelMinor != "" || !node.Pseudo {
+		t.Errorf("want %q, have %+v", render.TheInternetMajor, node)
+	}
+	if !reflect.DeepEqual(want.Adjacency, node.Adjacency) {
+		t.Errorf("want %v, have %v", want.Adjacency, node.Adjacency)
+	}
+	if want, have := renderer.EdgeMetadata(test.Report, render.TheInternetID, serverProcessID), renderer.EdgeMetadata(rpt, render.TheInternetID, serverProcessID); !reflect.DeepEqual(want, have) {
+		t.Errorf("%s", test.Diff(want, have))
+	}
+}
+
+func TestSplitInternetByDomainNames(t *testing.T) {
+	for name, want := range map[string]string{
+		"google.com.":     "google.com",
+		"www.bbc.co.uk.":  "*.bbc.co.uk",
+		"news.BBC.co.uk.": "*.bbc.co.uk",
+		"ec2-1-2-3-4.eu-west-1.compute.amazonaws.com.": "*.amazonaws.com",
+		"user.github.io.": "*.github.io",
+		"co.uk.":          "",
+		"localhost.":      "",
+		"db.corp.":        "db.corp",
+	} {
+		rpt := test.Report.Copy()
+		rpt = withEndpointName(rpt, name)
+		have := render.SplitInternetByDomain(render.ProcessRenderer).Render(rpt)
+
+		id := render.TheInternetID
+		if want != "" {
+			id = render.MakePseudoNodeID(render.TheInternetID, want)
+		}
+		if _, ok := have[id]; !ok {
+			t.Errorf("%s: want %q, have %v", name, id, have)
+		}
+	}
+}
+
+func TestSplitInternetByNetwork(t *testing.T) {
+	oldInternetNetworks := render.InternetNetworks
+	defer func() { render.InternetNetworks = oldInternetNetworks }()
+	var err error
+	render.InternetNetworks, err = render.ParseNamedNetworks("dns=8.8.0.0/16, 8.8.8.0/24, clients=51.52.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh report, so renders of it without the networks aren't reused.
+	have := render.SplitInternetByNetwork(render.ProcessRenderer).Render(fresh(test.Report))
+	for _, id := range []string{
+		render.MakePseudoNodeID(render.TheInternetID, "8.8.8.0/24"), // the most specific network wins
+		render.MakePseudoNodeID(render.TheInternetID, "clients"),
+	} {
+		if _, ok := have[id]; !ok {
+			t.Errorf("want %q, have %v", id, have)
+		}
+	}
+	if _, ok := have[render.TheInternetID]; ok {
+		t.Errorf("unexpected %q", render.TheInternetID)
+	}
+
+	if _, err := render.ParseNamedNetworks("foo=bar"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
 func mustParseCIDR(s string) *net.IPNet {
 	_, ipNet, err := net.ParseCIDR(s)
 	if err != nil {
@@ -2,21 +2,95 @@ package render
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/report"
 )
 
+// Topologies selected, and mapped, by several renderers, so they're only
+// rendered once per report.
+var (
+	endpointSelector          = Memoise(SelectEndpoint)
+	containerSelector         = Memoise(SelectContainer)
+	containerIdentityRenderer = Memoise(Map{
+		MapFunc:  MapContainerIdentity,
+		Renderer: containerSelector,
+	})
+)
+
 // EndpointRenderer is a Renderer which produces a renderable endpoint graph.
 var EndpointRenderer = Map{
 	MapFunc:  MapEndpointIdentity,
-	Renderer: SelectEndpoint,
+	Renderer: endpointWithEphemeralPortsRenderer{endpointSelector},
+}
+
+// endpointWithEphemeralPortsRenderer is a Renderer which copies the ephemeral
+// port range of the host each remote endpoint is on, if that host is in the
+// report too, onto it, so MapEndpointIdentity can tell clients from servers.
+// Endpoints on other hosts are left to the default range.
+type endpointWithEphemeralPortsRenderer struct {
+	Renderer
+}
+
+func (r endpointWithEphemeralPortsRenderer) Render(rpt report.Report) RenderableNodes {
+	return r.addPorts(rpt, r.Renderer.Render(rpt))
+}
+
+func (r endpointWithEphemeralPortsRenderer) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	endpoints, edges := renderEdges(r.Renderer, rpt)
+	return r.addPorts(rpt, endpoints), edges
+}
+
+func (r endpointWithEphemeralPortsRenderer) addPorts(rpt report.Report, endpoints RenderableNodes) RenderableNodes {
+	hosts := hostByAddress(rpt)
+	for id, e := range endpoints {
+		if _, ok := e.Metadata.Lookup(report.HostNodeID); ok || len(e.Adjacency) == 0 {
+			continue
+		}
+		h, ok := rpt.Topologies[report.Host].Nodes.Lookup(hosts[e.Metadata.Get(endpoint.Addr)])
+		if !ok {
+			continue
+		}
+		ports, ok := h.Metadata.Lookup(host.EphemeralPorts)
+		if !ok {
+			continue
+		}
+		e.Node = e.Node.WithMetadata(map[string]string{host.EphemeralPorts: ports})
+		endpoints[id] = e
+	}
+	return endpoints
+}
+
+// hostByAddress returns the ID of the host with local endpoints at each
+// address, or "" for addresses, such as loopback ones, on several hosts.
+func hostByAddress(rpt report.Report) map[string]string {
+	result := map[string]string{}
+	rpt.Topologies[report.Endpoint].Nodes.ForEach(func(_ string, n report.Node) {
+		addr, ok := n.Metadata.Lookup(endpoint.Addr)
+		if !ok {
+			return
+		}
+		hostID, ok := n.Metadata.Lookup(report.HostNodeID)
+		if !ok {
+			return
+		}
+		if existing, ok := result[addr]; !ok {
+			result[addr] = hostID
+		} else if existing != hostID {
+			result[addr] = ""
+		}
+	})
+	return result
 }
 
 // ProcessRenderer is a Renderer which produces a renderable process
 // graph by merging the endpoint graph and the process topology.
-var ProcessRenderer = MakeReduce(
+var ProcessRenderer = Memoise(MakeReduce(
 	Map{
 		MapFunc:  MapEndpoint2Process,
 		Renderer: EndpointRenderer,
@@ -25,7 +99,7 @@ var ProcessRenderer = MakeReduce(
 		MapFunc:  MapProcessIdentity,
 		Renderer: SelectProcess,
 	},
-)
+))
 
 // processWithContainerNameRenderer is a Renderer which produces a process
 // graph enriched with container names where appropriate
@@ -34,18 +108,23 @@ type processWithContainerNameRenderer struct {
 }
 
 func (r processWithContainerNameRenderer) Render(rpt report.Report) RenderableNodes {
-	processes := r.Renderer.Render(rpt)
-	containers := Map{
-		MapFunc:  MapContainerIdentity,
-		Renderer: SelectContainer,
-	}.Render(rpt)
+	return r.addContainers(rpt, r.Renderer.Render(rpt))
+}
+
+func (r processWithContainerNameRenderer) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	processes, edges := renderEdges(r.Renderer, rpt)
+	return r.addContainers(rpt, processes), edges
+}
+
+func (r processWithContainerNameRenderer) addContainers(rpt report.Report, processes RenderableNodes) RenderableNodes {
+	containers := containerIdentityRenderer.Render(rpt)
 
 	for id, p := range processes {
-		pid, ok := p.Node.Metadata[process.PID]
+		pid, ok := p.Node.Metadata.Lookup(process.PID)
 		if !ok {
 			continue
 		}
-		containerID, ok := p.Node.Metadata[docker.ContainerID]
+		containerID, ok := p.Node.Metadata.Lookup(docker.ContainerID)
 		if !ok {
 			continue
 		}
@@ -54,6 +133,14 @@ func (r processWithContainerNameRenderer) Render(rpt report.Report) RenderableNo
 			continue
 		}
 		p.LabelMinor = fmt.Sprintf("%s (%s:%s)", report.ExtractHostID(p.Node), container.LabelMajor, pid)
+
+		// Processes take on the labels of their containers, so they can be
+		// grouped by them.
+		labels := map[string]string{}
+		for key, value := range docker.ExtractLabels(container.Node) {
+			labels[docker.LabelPrefix+key] = value
+		}
+		p.Node = p.Node.WithMetadata(labels)
 		processes[id] = p
 	}
 
@@ -61,7 +148,7 @@ func (r processWithContainerNameRenderer) Render(rpt report.Report) RenderableNo
 }
 
 // ProcessWithContainerNameRenderer is a Renderer which produces a process
-// graph enriched with container names where appropriate
+// graph enriched with container names and labels where appropriate
 var ProcessWithContainerNameRenderer = processWithContainerNameRenderer{ProcessRenderer}
 
 // ProcessRenderer is a Renderer which produces a renderable process
@@ -76,7 +163,7 @@ var ProcessNameRenderer = Map{
 
 // ContainerRenderer is a Renderer which produces a renderable container
 // graph by merging the process graph and the container topology.
-var ContainerRenderer = MakeReduce(
+var ContainerRenderer = Memoise(MakeReduce(
 	Map{
 		MapFunc: MapProcess2Container,
 
@@ -85,18 +172,15 @@ var ContainerRenderer = MakeReduce(
 		// including the ProcessRenderer once.
 		Renderer: Filter{
 			FilterFunc: func(n RenderableNode) bool {
-				_, inContainer := n.Node.Metadata[docker.ContainerID]
-				_, isConnected := n.Node.Metadata[IsConnected]
+				_, inContainer := n.Node.Metadata.Lookup(docker.ContainerID)
+				_, isConnected := n.Node.Metadata.Lookup(IsConnected)
 				return inContainer || isConnected
 			},
 			Renderer: ColorConnected(ProcessRenderer),
 		},
 	},
 
-	Map{
-		MapFunc:  MapContainerIdentity,
-		Renderer: SelectContainer,
-	},
+	containerIdentityRenderer,
 
 	// This mapper brings in short lived connections by joining with container IPs.
 	// We need to be careful to ensure we only include each edge once.  Edges brought in
@@ -108,16 +192,16 @@ var ContainerRenderer = MakeReduce(
 			MakeReduce(
 				Map{
 					MapFunc:  MapContainer2IP,
-					Renderer: SelectContainer,
+					Renderer: containerSelector,
 				},
 				Map{
 					MapFunc:  MapEndpoint2IP,
-					Renderer: SelectEndpoint,
+					Renderer: endpointSelector,
 				},
 			),
 		),
 	},
-)
+))
 
 type containerWithImageNameRenderer struct {
 	Renderer
@@ -126,14 +210,22 @@ type containerWithImageNameRenderer struct {
 // Render produces a process graph where the minor labels contain the
 // container name, if found.
 func (r containerWithImageNameRenderer) Render(rpt report.Report) RenderableNodes {
-	containers := r.Renderer.Render(rpt)
+	return r.addImages(rpt, r.Renderer.Render(rpt))
+}
+
+func (r containerWithImageNameRenderer) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	containers, edges := renderEdges(r.Renderer, rpt)
+	return r.addImages(rpt, containers), edges
+}
+
+func (r containerWithImageNameRenderer) addImages(rpt report.Report, containers RenderableNodes) RenderableNodes {
 	images := Map{
 		MapFunc:  MapContainerImageIdentity,
 		Renderer: SelectContainerImage,
 	}.Render(rpt)
 
 	for id, c := range containers {
-		imageID, ok := c.Node.Metadata[docker.ImageID]
+		imageID, ok := c.Node.Metadata.Lookup(docker.ImageID)
 		if !ok {
 			continue
 		}
@@ -171,6 +263,103 @@ var ContainerImageRenderer = Map{
 	},
 }
 
+// PodRenderer is a Renderer which produces a renderable Kubernetes pod
+// graph by merging the container graph and the pod topology.
+var PodRenderer = Memoise(MakeReduce(
+	Map{
+		MapFunc:  MapContainer2Pod,
+		Renderer: ContainerRenderer,
+	},
+	Map{
+		MapFunc:  MapPodIdentity,
+		Renderer: SelectPod,
+	},
+))
+
+// ServiceRenderer is a Renderer which produces a renderable Kubernetes
+// service graph by merging the pod graph and the service topology. Edges
+// between services are those between the pods they select, and so are
+// ultimately derived from the connections between endpoints. Each service
+// also has an edge to each of the pods it selects which connections reach.
+var ServiceRenderer = servicePodsRenderer{
+	Renderer: Map{
+		MapFunc: MapCountPods,
+		Renderer: MakeReduce(
+			Map{
+				MapFunc:  MapPod2Service,
+				Renderer: PodRenderer,
+			},
+			Map{
+				MapFunc:  MapServiceIdentity,
+				Renderer: SelectService,
+			},
+		),
+	},
+	pods: PodRenderer,
+}
+
+// servicePodsRenderer adds the pods connected to by the services rendered
+// by Renderer, with an edge from each service selecting them, carrying the
+// metadata of the edges into the pod.
+type servicePodsRenderer struct {
+	Renderer
+	pods Renderer
+}
+
+func (r servicePodsRenderer) Render(rpt report.Report) RenderableNodes {
+	nodes, _ := r.renderEdges(rpt)
+	return nodes
+}
+
+func (r servicePodsRenderer) EdgeMetadata(rpt report.Report, localID, remoteID string) report.EdgeMetadata {
+	_, edges := r.renderEdges(rpt)
+	md, _ := edges[localID].Lookup(remoteID)
+	return md
+}
+
+func (r servicePodsRenderer) renderEdges(rpt report.Report) (RenderableNodes, map[string]report.EdgeMetadatas) {
+	var (
+		services, serviceEdges = renderEdges(r.Renderer, rpt)
+		pods, podEdges         = renderEdges(r.pods, rpt)
+		connected              = map[string]struct{}{}
+		ingress                = map[string]report.EdgeMetadata{}
+		edges                  = make(map[string]report.EdgeMetadatas, len(serviceEdges))
+	)
+	for _, pod := range pods {
+		for _, dstID := range pod.Adjacency {
+			connected[dstID] = struct{}{}
+		}
+	}
+	for _, e := range podEdges {
+		e.ForEach(func(dstID string, metadata report.EdgeMetadata) {
+			ingress[dstID] = ingress[dstID].Merge(metadata)
+		})
+	}
+	for srcID, e := range serviceEdges {
+		edges[srcID] = e
+	}
+
+	for podID, pod := range pods {
+		if _, ok := connected[podID]; !ok || pod.Pseudo {
+			continue
+		}
+		for _, serviceID := range strings.Fields(pod.Metadata.Get(kubernetes.ServiceIDs)) {
+			service, ok := services[serviceID]
+			if !ok {
+				continue
+			}
+			service.Adjacency = service.Adjacency.Merge(report.MakeIDList(podID))
+			services[serviceID] = service
+			existing, _ := edges[serviceID].Lookup(podID)
+			edges[serviceID] = edges[serviceID].Set(podID, existing.Merge(ingress[podID]))
+
+			pod.Adjacency = report.MakeIDList()
+			services[podID] = pod
+		}
+	}
+	return services, edges
+}
+
 // AddressRenderer is a Renderer which produces a renderable address
 // graph from the address topology.
 var AddressRenderer = Map{
@@ -7,6 +7,7 @@ import (
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/expected"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test"
 )
 
@@ -38,7 +39,12 @@ func TestContainerFilterRenderer(t *testing.T) {
 	// tag on of the containers in the topology and ensure
 	// it is filtered out correctly.
 	input := test.Report.Copy()
-	input.Container.Nodes[test.ClientContainerNodeID].Metadata[docker.LabelPrefix+"works.weave.role"] = "system"
+	containers := input.Topologies[report.Container]
+	client := containers.Nodes.Get(test.ClientContainerNodeID).WithMetadata(map[string]string{
+		docker.LabelPrefix + "works.weave.role": "system",
+	})
+	containers.Nodes = containers.Nodes.Set(test.ClientContainerNodeID, client)
+	input.Topologies[report.Container] = containers
 	have := render.FilterSystem(render.ContainerWithImageNameRenderer).Render(input).Prune()
 	want := expected.RenderedContainers.Copy()
 	delete(want, test.ClientContainerID)
@@ -55,6 +61,32 @@ func TestContainerImageRenderer(t *testing.T) {
 	}
 }
 
+func TestPodRenderer(t *testing.T) {
+	have := render.PodRenderer.Render(test.Report).Prune()
+	want := expected.RenderedPods
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestServiceRenderer(t *testing.T) {
+	have := render.ServiceRenderer.Render(test.Report).Prune()
+	want := expected.RenderedServices
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// The edge from a service to a pod carries the connections into the pod.
+	wantEdge := report.EdgeMetadata{}
+	for _, edges := range render.EdgeMetadatas(render.PodRenderer, test.Report) {
+		wantEdge = wantEdge.Merge(edges.Get(test.ServerPodNodeID))
+	}
+	haveEdge := render.ServiceRenderer.EdgeMetadata(test.Report, test.ServiceNodeID, test.ServerPodNodeID)
+	if wantEdge.EgressPacketCount == nil || !reflect.DeepEqual(wantEdge, haveEdge) {
+		t.Error(test.Diff(wantEdge, haveEdge))
+	}
+}
+
 func TestHostRenderer(t *testing.T) {
 	have := render.HostRenderer.Render(test.Report).Prune()
 	want := expected.RenderedHosts
@@ -0,0 +1,99 @@
+package report_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/weaveworks/scope/report"
+)
+
+const benchmarkNodes = 10000
+
+// probeReport is what a probe on one of hosts hosts might report: processes
+// and endpoints with a few pieces of metadata, and an edge each.
+func probeReport(host, hosts int, packets uint64) report.Report {
+	rpt := report.MakeReport()
+	hostNodeID := report.MakeHostNodeID(fmt.Sprintf("host-%d", host))
+	for i := 0; i < benchmarkNodes/hosts; i++ {
+		pid := fmt.Sprint(i)
+		rpt.Topologies[report.Process] = rpt.Topologies[report.Process].AddNode(report.MakeProcessNodeID(hostNodeID, pid), report.MakeNodeWith(map[string]string{
+			"pid":             pid,
+			"comm":            "apache",
+			report.HostNodeID: hostNodeID,
+		}))
+		local := report.MakeEndpointNodeID(hostNodeID, "10.0.0.1", pid)
+		remote := report.MakeEndpointNodeID("", "10.0.0.2", "80")
+		rpt.Topologies[report.Endpoint] = rpt.Topologies[report.Endpoint].AddNode(local, report.MakeNodeWith(map[string]string{
+			"addr":            "10.0.0.1",
+			"port":            pid,
+			"pid":             pid,
+			report.HostNodeID: hostNodeID,
+		}).WithEdge(remote, report.EdgeMetadata{EgressPacketCount: &packets}))
+	}
+	return rpt
+}
+
+// BenchmarkMergeWindow merges the reports of one probe over a window, which
+// mostly repeat themselves, as the collector does.
+func BenchmarkMergeWindow(b *testing.B) {
+	reports := []report.Report{}
+	for i := 0; i < 15; i++ {
+		reports = append(reports, probeReport(0, 1, uint64(i)))
+	}
+	benchmarkMerge(b, reports)
+}
+
+// BenchmarkMergeHosts merges the reports of many probes, which share no
+// nodes.
+func BenchmarkMergeHosts(b *testing.B) {
+	reports := []report.Report{}
+	for i := 0; i < 100; i++ {
+		reports = append(reports, probeReport(i, 100, 1))
+	}
+	benchmarkMerge(b, reports)
+}
+
+// BenchmarkMergeInto merges the report of one more probe into those of
+// many, as the collector does when a probe reports. It should allocate in
+// proportion to the one report, however many it's merged into.
+func BenchmarkMergeInto10(b *testing.B)   { benchmarkMergeInto(b, 10) }
+func BenchmarkMergeInto100(b *testing.B)  { benchmarkMergeInto(b, 100) }
+func BenchmarkMergeInto1000(b *testing.B) { benchmarkMergeInto(b, 1000) }
+
+func benchmarkMergeInto(b *testing.B, hosts int) {
+	rpt := report.MakeReport()
+	for i := 0; i < hosts; i++ {
+		rpt = rpt.Merge(probeReport(i, 100, 1))
+	}
+	next := probeReport(hosts, 100, 1)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rpt.Merge(next)
+	}
+}
+
+func benchmarkMerge(b *testing.B, reports []report.Report) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rpt := report.MakeReport()
+		for _, r := range reports {
+			rpt = rpt.Merge(r)
+		}
+	}
+}
+
+func BenchmarkNodeMergeUnchanged(b *testing.B) {
+	node := report.MakeNodeWith(map[string]string{"pid": "1", "comm": "apache"}).
+		WithCounters(map[string]int{"count": 1}).
+		WithAdjacent("foo")
+	other := report.MakeNodeWith(map[string]string{"pid": "1"}).WithAdjacent("foo")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		node.Merge(other)
+	}
+}
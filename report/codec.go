@@ -0,0 +1,259 @@
+package report
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// wireReport is how reports are encoded, as gob and as JSON. It's the layout
+// reports had when the well-known topologies were fields of their own, and
+// their maps were Go maps, so older probes and apps can still talk to newer
+// ones.
+type wireReport struct {
+	Endpoint       wireTopology
+	Address        wireTopology
+	Process        wireTopology
+	Container      wireTopology
+	ContainerImage wireTopology
+	Host           wireTopology
+	Overlay        wireTopology
+	Pod            wireTopology
+	Service        wireTopology
+	Namespace      wireTopology
+
+	// Extra topologies, by name. Nil unless there are any.
+	Extra map[string]wireTopology `json:",omitempty"`
+
+	Sampling Sampling
+	Window   time.Duration
+}
+
+type wireTopology struct {
+	Nodes map[string]wireNode
+}
+
+type wireNode struct {
+	Metadata  map[string]string       `json:"metadata,omitempty"`
+	Counters  map[string]int          `json:"counters,omitempty"`
+	Adjacency IDList                  `json:"adjacency"`
+	Edges     map[string]EdgeMetadata `json:"edges,omitempty"`
+}
+
+// fields returns the fields holding the well-known topologies, by name.
+func (w *wireReport) fields() map[string]*wireTopology {
+	return map[string]*wireTopology{
+		Endpoint:       &w.Endpoint,
+		Address:        &w.Address,
+		Process:        &w.Process,
+		Container:      &w.Container,
+		ContainerImage: &w.ContainerImage,
+		Host:           &w.Host,
+		Overlay:        &w.Overlay,
+		Pod:            &w.Pod,
+		Service:        &w.Service,
+		Namespace:      &w.Namespace,
+	}
+}
+
+func (r Report) wire() wireReport {
+	w := wireReport{
+		Sampling: r.Sampling,
+		Window:   r.Window,
+	}
+	fields := w.fields()
+	for name, t := range r.Topologies {
+		if field, ok := fields[name]; ok {
+			*field = t.wire()
+			continue
+		}
+		if w.Extra == nil {
+			w.Extra = map[string]wireTopology{}
+		}
+		w.Extra[name] = t.wire()
+	}
+	return w
+}
+
+func (w wireReport) report() Report {
+	r := Report{
+		Topologies: map[string]Topology{},
+		Sampling:   w.Sampling,
+		Window:     w.Window,
+	}
+	for name, t := range w.Extra {
+		r.Topologies[name] = t.topology()
+	}
+	for name, field := range w.fields() {
+		if _, ok := r.Topologies[name]; !ok || field.Nodes != nil {
+			r.Topologies[name] = field.topology()
+		}
+	}
+	return r
+}
+
+func (t Topology) wire() wireTopology {
+	w := wireTopology{Nodes: make(map[string]wireNode, t.Nodes.Size())}
+	t.Nodes.ForEach(func(id string, n Node) {
+		w.Nodes[id] = n.wire()
+	})
+	return w
+}
+
+func (w wireTopology) topology() Topology {
+	if w.Nodes == nil {
+		return Topology{}
+	}
+	t := MakeTopology()
+	for id, n := range w.Nodes {
+		t.Nodes = t.Nodes.Set(id, n.node())
+	}
+	return t
+}
+
+func (n Node) wire() wireNode {
+	return wireNode{
+		Metadata:  n.Metadata.Map(),
+		Counters:  n.Counters.Map(),
+		Adjacency: n.Adjacency,
+		Edges:     n.Edges.Map(),
+	}
+}
+
+func (w wireNode) node() Node {
+	return Node{
+		Metadata:  MakeMetadata(w.Metadata),
+		Counters:  MakeCounters(w.Counters),
+		Adjacency: w.Adjacency,
+		Edges:     MakeEdgeMetadatas(w.Edges),
+	}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.wire())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *Report) UnmarshalJSON(b []byte) error {
+	var w wireReport
+	if err := json.Unmarshal(b, &w); err != nil {
+		return err
+	}
+	*r = w.report()
+	return nil
+}
+
+// WriteBinary writes the report to w as gob, in the layout older apps
+// expect. Reports can't be encoded with gob directly.
+func (r Report) WriteBinary(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(r.wire())
+}
+
+// ReadBinary reads a report written by WriteBinary, or by an older probe,
+// from rd into the receiver.
+func (r *Report) ReadBinary(rd io.Reader) error {
+	var w wireReport
+	if err := gob.NewDecoder(rd).Decode(&w); err != nil {
+		return err
+	}
+	*r = w.report()
+	return nil
+}
+
+// Map returns the nodes as a Go map, which the caller owns.
+func (n Nodes) Map() map[string]Node {
+	m := make(map[string]Node, n.Size())
+	n.ForEach(func(id string, node Node) {
+		m[id] = node
+	})
+	return m
+}
+
+// MarshalJSON implements json.Marshaler.
+func (n Nodes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.Map())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (n *Nodes) UnmarshalJSON(b []byte) error {
+	var m map[string]Node
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*n = MakeNodes(m)
+	return nil
+}
+
+// Map returns the metadata as a Go map, which the caller owns.
+func (m Metadata) Map() map[string]string {
+	result := make(map[string]string, m.Size())
+	m.ForEach(func(k, v string) {
+		result[k] = v
+	})
+	return result
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Map())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *Metadata) UnmarshalJSON(b []byte) error {
+	var result map[string]string
+	if err := json.Unmarshal(b, &result); err != nil {
+		return err
+	}
+	*m = MakeMetadata(result)
+	return nil
+}
+
+// Map returns the counters as a Go map, which the caller owns.
+func (c Counters) Map() map[string]int {
+	result := make(map[string]int, c.Size())
+	c.ForEach(func(k string, v int) {
+		result[k] = v
+	})
+	return result
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Counters) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Map())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Counters) UnmarshalJSON(b []byte) error {
+	var result map[string]int
+	if err := json.Unmarshal(b, &result); err != nil {
+		return err
+	}
+	*c = MakeCounters(result)
+	return nil
+}
+
+// Map returns the edges' metadata as a Go map, which the caller owns.
+func (e EdgeMetadatas) Map() map[string]EdgeMetadata {
+	result := make(map[string]EdgeMetadata, e.Size())
+	e.ForEach(func(dst string, md EdgeMetadata) {
+		result[dst] = md
+	})
+	return result
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e EdgeMetadatas) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Map())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (e *EdgeMetadatas) UnmarshalJSON(b []byte) error {
+	var result map[string]EdgeMetadata
+	if err := json.Unmarshal(b, &result); err != nil {
+		return err
+	}
+	*e = MakeEdgeMetadatas(result)
+	return nil
+}
@@ -0,0 +1,365 @@
+package report
+
+import "sort"
+
+// hamt is a persistent map from strings to values: a hash array mapped trie.
+// Changing one returns a new map, which shares all but the path to the change
+// with the original, so changes allocate in proportion to their size rather
+// than the map's, and copies are free.
+//
+// The zero value is an empty map. Empty maps are always the zero value, and
+// maps with the same entries have the same shape, so they can be compared
+// with reflect.DeepEqual.
+type hamt struct {
+	root *hamtNode
+	size int
+}
+
+const (
+	hamtBits = 5 // of the hash, per level of the trie
+	hamtMask = 1<<hamtBits - 1
+)
+
+// hamtNode is either an interior node, with a child for each bit set in
+// bitmap, or a leaf, with the entries whose keys hash to hash. Leaves have
+// more than one entry only when their keys' hashes collide, and then they're
+// sorted by key. Each leaf is as near the root as the other keys' hashes
+// allow, so interior nodes never have a leaf as their only child.
+type hamtNode struct {
+	bitmap   uint32
+	children []*hamtNode
+	hash     uint32
+	entries  []hamtEntry
+}
+
+type hamtEntry struct {
+	key   string
+	value interface{}
+}
+
+// hamtHash is 32-bit FNV-1a.
+func hamtHash(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// popcount counts the bits set in x.
+func popcount(x uint32) int {
+	x -= (x >> 1) & 0x55555555
+	x = (x>>2)&0x33333333 + x&0x33333333
+	x = (x>>4 + x) & 0x0f0f0f0f
+	return int(x * 0x01010101 >> 24)
+}
+
+// newHAMTLeaf returns a leaf with a single entry, allocated along with it,
+// as most are.
+func newHAMTLeaf(hash uint32, key string, value interface{}) *hamtNode {
+	leaf := &struct {
+		node  hamtNode
+		entry [1]hamtEntry
+	}{entry: [1]hamtEntry{{key, value}}}
+	leaf.node = hamtNode{hash: hash, entries: leaf.entry[:]}
+	return &leaf.node
+}
+
+func (m hamt) get(key string) (interface{}, bool) {
+	return m.root.get(hamtHash(key), 0, key)
+}
+
+// get returns the value of key in the subtrie rooted at n, at the given
+// shift, and whether it's there.
+func (n *hamtNode) get(hash uint32, shift uint, key string) (interface{}, bool) {
+	for ; n != nil; shift += hamtBits {
+		if n.entries != nil {
+			if n.hash == hash {
+				for _, e := range n.entries {
+					if e.key == key {
+						return e.value, true
+					}
+				}
+			}
+			return nil, false
+		}
+		bit := uint32(1) << (hash >> shift & hamtMask)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+		n = n.children[popcount(n.bitmap&(bit-1))]
+	}
+	return nil, false
+}
+
+func (m hamt) set(key string, value interface{}) hamt {
+	root, added := m.root.set(hamtHash(key), 0, key, value)
+	m.root = root
+	if added {
+		m.size++
+	}
+	return m
+}
+
+// set returns a copy of the subtrie rooted at n, at the given shift, with
+// key set to value, and whether the key is new.
+func (n *hamtNode) set(hash uint32, shift uint, key string, value interface{}) (*hamtNode, bool) {
+	if n == nil {
+		return newHAMTLeaf(hash, key, value), true
+	}
+
+	if n.entries != nil {
+		if n.hash != hash {
+			// Push the leaf down a level, where the keys can be told apart.
+			interior := &hamtNode{
+				bitmap:   1 << (n.hash >> shift & hamtMask),
+				children: []*hamtNode{n},
+			}
+			return interior.set(hash, shift, key, value)
+		}
+		i := sort.Search(len(n.entries), func(i int) bool { return n.entries[i].key >= key })
+		if i < len(n.entries) && n.entries[i].key == key {
+			if len(n.entries) == 1 {
+				return newHAMTLeaf(hash, key, value), false
+			}
+			entries := make([]hamtEntry, len(n.entries))
+			copy(entries, n.entries)
+			entries[i].value = value
+			return &hamtNode{hash: hash, entries: entries}, false
+		}
+		entries := make([]hamtEntry, len(n.entries)+1)
+		copy(entries, n.entries[:i])
+		entries[i] = hamtEntry{key, value}
+		copy(entries[i+1:], n.entries[i:])
+		return &hamtNode{hash: hash, entries: entries}, true
+	}
+
+	var (
+		bit   = uint32(1) << (hash >> shift & hamtMask)
+		i     = popcount(n.bitmap & (bit - 1))
+		cp    = &hamtNode{bitmap: n.bitmap | bit}
+		added = true
+	)
+	if n.bitmap&bit == 0 {
+		cp.children = make([]*hamtNode, len(n.children)+1)
+		copy(cp.children, n.children[:i])
+		cp.children[i] = newHAMTLeaf(hash, key, value)
+		copy(cp.children[i+1:], n.children[i:])
+		return cp, added
+	}
+	cp.children = make([]*hamtNode, len(n.children))
+	copy(cp.children, n.children)
+	cp.children[i], added = n.children[i].set(hash, shift+hamtBits, key, value)
+	return cp, added
+}
+
+func (m hamt) delete(key string) hamt {
+	root, deleted := m.root.delete(hamtHash(key), 0, key)
+	if !deleted {
+		return m
+	}
+	return hamt{root: root, size: m.size - 1}
+}
+
+// delete returns a copy of the subtrie rooted at n, at the given shift,
+// without key, and whether it had the key. If it didn't, n is returned.
+func (n *hamtNode) delete(hash uint32, shift uint, key string) (*hamtNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+
+	if n.entries != nil {
+		if n.hash != hash {
+			return n, false
+		}
+		for i, e := range n.entries {
+			if e.key != key {
+				continue
+			}
+			if len(n.entries) == 1 {
+				return nil, true
+			}
+			entries := make([]hamtEntry, 0, len(n.entries)-1)
+			entries = append(entries, n.entries[:i]...)
+			entries = append(entries, n.entries[i+1:]...)
+			return &hamtNode{hash: hash, entries: entries}, true
+		}
+		return n, false
+	}
+
+	bit := uint32(1) << (hash >> shift & hamtMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := popcount(n.bitmap & (bit - 1))
+	child, deleted := n.children[i].delete(hash, shift+hamtBits, key)
+	if !deleted {
+		return n, false
+	}
+
+	if child == nil {
+		if len(n.children) == 1 {
+			return nil, true
+		}
+		children := make([]*hamtNode, 0, len(n.children)-1)
+		children = append(children, n.children[:i]...)
+		children = append(children, n.children[i+1:]...)
+		if len(children) == 1 && children[0].entries != nil {
+			return children[0], true // a leaf mustn't be an only child
+		}
+		return &hamtNode{bitmap: n.bitmap &^ bit, children: children}, true
+	}
+	if len(n.children) == 1 && child.entries != nil {
+		return child, true
+	}
+	cp := &hamtNode{bitmap: n.bitmap, children: make([]*hamtNode, len(n.children))}
+	copy(cp.children, n.children)
+	cp.children[i] = child
+	return cp, true
+}
+
+// forEach calls f with every entry of the map, in no particular order.
+func (m hamt) forEach(f func(key string, value interface{})) {
+	m.root.forEach(f)
+}
+
+func (n *hamtNode) forEach(f func(key string, value interface{})) {
+	if n == nil {
+		return
+	}
+	for _, e := range n.entries {
+		f(e.key, e.value)
+	}
+	for _, child := range n.children {
+		child.forEach(f)
+	}
+}
+
+// merge returns m with every entry of other set in it. Where both have a
+// key, its value is f(m's value, other's value), which is only set if it
+// differs from the value it replaces, as told by equal. The tries are merged
+// a subtrie at a time, sharing those only one side has, and those the merge
+// leaves unchanged, so merging allocates in proportion to the differences
+// between the two maps, not their size.
+func (m hamt) merge(other hamt, f func(mine, theirs interface{}) interface{}, equal func(a, b interface{}) bool) hamt {
+	root, added := m.root.merge(other.root, 0, f, equal)
+	return hamt{root: root, size: m.size + added}
+}
+
+// merge merges the subtries rooted at n and other, at the given shift, and
+// returns the result, and how many of other's keys weren't in n.
+func (n *hamtNode) merge(other *hamtNode, shift uint, f func(mine, theirs interface{}) interface{}, equal func(a, b interface{}) bool) (*hamtNode, int) {
+	switch {
+	case n == other || other == nil:
+		return n, 0
+	case n == nil:
+		return other, other.count()
+
+	case other.entries != nil:
+		result, added := n, 0
+		for _, e := range other.entries {
+			value := e.value
+			if mine, ok := n.get(other.hash, shift, e.key); ok {
+				if value = f(mine, e.value); equal(value, mine) {
+					continue
+				}
+			}
+			var isNew bool
+			if result, isNew = result.set(other.hash, shift, e.key, value); isNew {
+				added++
+			}
+		}
+		return result, added
+
+	case n.entries != nil:
+		// Set n's entries in other instead, still passing them to f first.
+		result, added := other, other.count()
+		for _, e := range n.entries {
+			value := e.value
+			if theirs, ok := other.get(n.hash, shift, e.key); ok {
+				added--
+				if value = f(e.value, theirs); equal(value, theirs) {
+					continue
+				}
+			}
+			result, _ = result.set(n.hash, shift, e.key, value)
+		}
+		return result, added
+	}
+
+	var (
+		bitmap   = n.bitmap | other.bitmap
+		children [1 << hamtBits]*hamtNode
+		count    = 0
+		added    = 0
+		changed  = bitmap != n.bitmap
+	)
+	for bit, i, j := uint32(1), 0, 0; bit != 0; bit <<= 1 {
+		if bitmap&bit == 0 {
+			continue
+		}
+		var mine, theirs *hamtNode
+		if n.bitmap&bit != 0 {
+			mine = n.children[i]
+			i++
+		}
+		if other.bitmap&bit != 0 {
+			theirs = other.children[j]
+			j++
+		}
+		child, childAdded := mine.merge(theirs, shift+hamtBits, f, equal)
+		changed = changed || child != mine
+		children[count] = child
+		count++
+		added += childAdded
+	}
+	if !changed {
+		return n, added
+	}
+	cp := &hamtNode{bitmap: bitmap, children: make([]*hamtNode, count)}
+	copy(cp.children, children[:count])
+	return cp, added
+}
+
+// count returns the number of entries in the subtrie rooted at n.
+func (n *hamtNode) count() int {
+	if n == nil {
+		return 0
+	}
+	result := len(n.entries)
+	for _, child := range n.children {
+		result += child.count()
+	}
+	return result
+}
+
+// equal says whether m and other have the same entries, with values equal
+// as told by eq. As maps with the same entries have the same shape, it only
+// compares the subtries they don't share.
+func (m hamt) equal(other hamt, eq func(a, b interface{}) bool) bool {
+	return m.size == other.size && m.root.equal(other.root, eq)
+}
+
+func (n *hamtNode) equal(other *hamtNode, eq func(a, b interface{}) bool) bool {
+	switch {
+	case n == other:
+		return true
+	case n == nil || other == nil:
+		return false
+	case n.bitmap != other.bitmap || n.hash != other.hash ||
+		len(n.children) != len(other.children) || len(n.entries) != len(other.entries):
+		return false
+	}
+	for i, e := range n.entries {
+		if e.key != other.entries[i].key || !eq(e.value, other.entries[i].value) {
+			return false
+		}
+	}
+	for i, child := range n.children {
+		if !child.equal(other.children[i], eq) {
+			return false
+		}
+	}
+	return true
+}
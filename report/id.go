@@ -64,12 +64,12 @@ func MakeEndpointNodeID(hostID, address, port string) string {
 func MakeAddressNodeID(hostID, address string) string {
 	var scope string
 
-	// Loopback addresses and addresses explicity marked as
-	// local get scoped by hostID
+	// Loopback addresses, unspecified (wildcard) addresses of listening
+	// sockets and addresses explicity marked as local get scoped by hostID
 	addressIP := net.ParseIP(address)
 	if addressIP != nil && LocalNetworks.Contains(addressIP) {
 		scope = hostID
-	} else if isLoopback(address) {
+	} else if isLoopback(address) || isUnspecified(address) {
 		scope = hostID
 	}
 
@@ -100,6 +100,30 @@ func MakeOverlayNodeID(peerName string) string {
 	return "#" + peerName
 }
 
+// MakePodNodeID produces a pod node ID from its composite parts. Pod names
+// are unique within their namespace.
+func MakePodNodeID(namespaceID, podName string) string {
+	return namespaceID + ScopeDelim + podName
+}
+
+// MakeServiceNodeID produces a service node ID from its composite parts.
+// Service names are unique within their namespace.
+func MakeServiceNodeID(namespaceID, serviceName string) string {
+	return namespaceID + ScopeDelim + serviceName
+}
+
+// MakeNamespaceNodeID produces a namespace node ID from a namespace name.
+func MakeNamespaceNodeID(namespaceID string) string {
+	// As with hosts, suffix something so namespace node IDs can't be
+	// confused with pod or service node IDs.
+	return namespaceID + ScopeDelim + "<namespace>"
+}
+
+// MakePluginNodeID produces a plugin node ID from its composite parts.
+func MakePluginNodeID(hostID, pluginID string) string {
+	return hostID + ScopeDelim + pluginID
+}
+
 // ParseNodeID produces the host ID and remainder (typically an address) from
 // a node ID. Note that hostID may be blank.
 func ParseNodeID(nodeID string) (hostID string, remainder string, ok bool) {
@@ -142,7 +166,7 @@ func ParseAddressNodeID(addressNodeID string) (hostID, address string, ok bool)
 
 // ExtractHostID extracts the host id from Node
 func ExtractHostID(m Node) string {
-	hostid, _, _ := ParseNodeID(m.Metadata[HostNodeID])
+	hostid, _, _ := ParseNodeID(m.Metadata.Get(HostNodeID))
 	return hostid
 }
 
@@ -150,3 +174,8 @@ func isLoopback(address string) bool {
 	ip := net.ParseIP(address)
 	return ip != nil && ip.IsLoopback()
 }
+
+func isUnspecified(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsUnspecified()
+}
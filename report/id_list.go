@@ -49,6 +49,9 @@ func (a IDList) Merge(b IDList) IDList {
 	if len(b) == 0 { // Optimise special case, to avoid allocating
 		return a // (note unit test DeepEquals breaks if we don't do this)
 	}
+	if a.containsAll(b) { // likewise when b adds nothing, as is common
+		return a
+	}
 	d := make(IDList, len(a)+len(b))
 	for i, j, k := 0, 0, 0; ; k++ {
 		switch {
@@ -72,6 +75,23 @@ func (a IDList) Merge(b IDList) IDList {
 	}
 }
 
+// containsAll says whether every id in b is in a; both are sorted.
+func (a IDList) containsAll(b IDList) bool {
+	if len(b) > len(a) {
+		return false
+	}
+	i := 0
+	for _, id := range b {
+		for i < len(a) && a[i] < id {
+			i++
+		}
+		if i == len(a) || a[i] != id {
+			return false
+		}
+	}
+	return true
+}
+
 // Contains returns true if id is in the list.
 func (a IDList) Contains(id string) bool {
 	i := sort.Search(len(a), func(i int) bool { return a[i] >= id })
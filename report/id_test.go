@@ -1,6 +1,7 @@
 package report_test
 
 import (
+	"net"
 	"testing"
 
 	"github.com/weaveworks/scope/report"
@@ -65,3 +66,27 @@ func TestEndpointNodeID(t *testing.T) {
 		}
 	}
 }
+
+func TestAddressNodeIDIPv6(t *testing.T) {
+	oldLocalNetworks := report.LocalNetworks
+	defer func() { report.LocalNetworks = oldLocalNetworks }()
+	_, local, _ := net.ParseCIDR("fd00::/8")
+	report.LocalNetworks = report.Networks{local}
+
+	for _, c := range []struct{ address, want string }{
+		{"::1", "host.com;::1"},                           // loopback is scoped
+		{"::", "host.com;::"},                             // as are wildcard addresses
+		{"fd00::1", "host.com;fd00::1"},                   // so are local networks
+		{"2001:db8::1", ";2001:db8::1"},                   // but nothing else
+		{"::ffff:127.0.0.1", "host.com;::ffff:127.0.0.1"}, // v4-mapped loopback
+	} {
+		if have := report.MakeAddressNodeID("host.com", c.address); c.want != have {
+			t.Errorf("%q: want %q, have %q", c.address, c.want, have)
+		}
+	}
+
+	hostID, address, port, ok := report.ParseEndpointNodeID(report.MakeEndpointNodeID("host.com", "2001:db8::1", "80"))
+	if !ok || hostID != "" || address != "2001:db8::1" || port != "80" {
+		t.Errorf("want {%q, %q, %q}, have {%q, %q, %q}", "", "2001:db8::1", "80", hostID, address, port)
+	}
+}
@@ -20,50 +20,50 @@ func TestMergeEdgeMetadatas(t *testing.T) {
 	}{
 		"Empty a": {
 			a: report.EdgeMetadatas{},
-			b: report.EdgeMetadatas{
+			b: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
 				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
 					EgressPacketCount: newu64(1),
 					MaxConnCountTCP:   newu64(2),
 				},
-			},
-			want: report.EdgeMetadatas{
+			}),
+			want: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
 				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
 					EgressPacketCount: newu64(1),
 					MaxConnCountTCP:   newu64(2),
 				},
-			},
+			}),
 		},
 		"Empty b": {
-			a: report.EdgeMetadatas{
+			a: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
 				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
 					EgressPacketCount: newu64(12),
 					EgressByteCount:   newu64(999),
 				},
-			},
+			}),
 			b: report.EdgeMetadatas{},
-			want: report.EdgeMetadatas{
+			want: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
 				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
 					EgressPacketCount: newu64(12),
 					EgressByteCount:   newu64(999),
 				},
-			},
+			}),
 		},
 		"Host merge": {
-			a: report.EdgeMetadatas{
+			a: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
 				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
 					EgressPacketCount: newu64(12),
 					EgressByteCount:   newu64(500),
 					MaxConnCountTCP:   newu64(4),
 				},
-			},
-			b: report.EdgeMetadatas{
+			}),
+			b: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
 				"hostQ|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
 					EgressPacketCount: newu64(1),
 					EgressByteCount:   newu64(2),
 					MaxConnCountTCP:   newu64(6),
 				},
-			},
-			want: report.EdgeMetadatas{
+			}),
+			want: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
 				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
 					EgressPacketCount: newu64(12),
 					EgressByteCount:   newu64(500),
@@ -74,32 +74,52 @@ func TestMergeEdgeMetadatas(t *testing.T) {
 					EgressByteCount:   newu64(2),
 					MaxConnCountTCP:   newu64(6),
 				},
-			},
+			}),
 		},
 		"Edge merge": {
-			a: report.EdgeMetadatas{
+			a: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
 				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
 					EgressPacketCount: newu64(12),
 					EgressByteCount:   newu64(1000),
 					MaxConnCountTCP:   newu64(7),
 				},
-			},
-			b: report.EdgeMetadatas{
+			}),
+			b: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
 				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
 					EgressPacketCount: newu64(1),
 					IngressByteCount:  newu64(123),
 					EgressByteCount:   newu64(2),
 					MaxConnCountTCP:   newu64(9),
 				},
-			},
-			want: report.EdgeMetadatas{
+			}),
+			want: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
 				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
 					EgressPacketCount: newu64(13),
 					IngressByteCount:  newu64(123),
 					EgressByteCount:   newu64(1002),
 					MaxConnCountTCP:   newu64(9),
 				},
-			},
+			}),
+		},
+		"Direction merge": {
+			a: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
+				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
+					MaxConnCountTCP:       newu64(1),
+					DirectionInferredFrom: report.DirectionFromPorts,
+				},
+			}),
+			b: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
+				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
+					MaxConnCountTCP:       newu64(1),
+					DirectionInferredFrom: report.DirectionFromListening,
+				},
+			}),
+			want: report.MakeEdgeMetadatas(map[string]report.EdgeMetadata{
+				"hostA|:192.168.1.1:12345|:192.168.1.2:80": report.EdgeMetadata{
+					MaxConnCountTCP:       newu64(1),
+					DirectionInferredFrom: report.DirectionFromListening,
+				},
+			}),
 		},
 	} {
 		if have := c.a.Merge(c.b); !reflect.DeepEqual(c.want, have) {
@@ -110,17 +130,20 @@ func TestMergeEdgeMetadatas(t *testing.T) {
 
 func TestFlattenEdgeMetadata(t *testing.T) {
 	have := (report.EdgeMetadata{
-		EgressPacketCount: newu64(1),
-		MaxConnCountTCP:   newu64(2),
+		EgressPacketCount:     newu64(1),
+		MaxConnCountTCP:       newu64(2),
+		DirectionInferredFrom: report.DirectionFromConntrack,
 	}).Flatten(report.EdgeMetadata{
-		EgressPacketCount: newu64(4),
-		EgressByteCount:   newu64(8),
-		MaxConnCountTCP:   newu64(16),
+		EgressPacketCount:     newu64(4),
+		EgressByteCount:       newu64(8),
+		MaxConnCountTCP:       newu64(16),
+		DirectionInferredFrom: report.DirectionFromPorts,
 	})
 	want := report.EdgeMetadata{
-		EgressPacketCount: newu64(1 + 4),
-		EgressByteCount:   newu64(8),
-		MaxConnCountTCP:   newu64(2 + 16), // flatten should sum MaxConnCountTCP
+		EgressPacketCount:     newu64(1 + 4),
+		EgressByteCount:       newu64(8),
+		MaxConnCountTCP:       newu64(2 + 16),            // flatten should sum MaxConnCountTCP
+		DirectionInferredFrom: report.DirectionFromPorts, // and keep the least reliable direction
 	}
 	if !reflect.DeepEqual(want, have) {
 		t.Error(test.Diff(want, have))
@@ -133,54 +156,54 @@ func TestMergeNodes(t *testing.T) {
 	}{
 		"Empty a": {
 			a: report.Nodes{},
-			b: report.Nodes{
+			b: report.MakeNodes(map[string]report.Node{
 				":192.168.1.1:12345": report.MakeNodeWith(map[string]string{
 					PID:    "23128",
 					Name:   "curl",
 					Domain: "node-a.local",
 				}),
-			},
-			want: report.Nodes{
+			}),
+			want: report.MakeNodes(map[string]report.Node{
 				":192.168.1.1:12345": report.MakeNodeWith(map[string]string{
 					PID:    "23128",
 					Name:   "curl",
 					Domain: "node-a.local",
 				}),
-			},
+			}),
 		},
 		"Empty b": {
-			a: report.Nodes{
+			a: report.MakeNodes(map[string]report.Node{
 				":192.168.1.1:12345": report.MakeNodeWith(map[string]string{
 					PID:    "23128",
 					Name:   "curl",
 					Domain: "node-a.local",
 				}),
-			},
+			}),
 			b: report.Nodes{},
-			want: report.Nodes{
+			want: report.MakeNodes(map[string]report.Node{
 				":192.168.1.1:12345": report.MakeNodeWith(map[string]string{
 					PID:    "23128",
 					Name:   "curl",
 					Domain: "node-a.local",
 				}),
-			},
+			}),
 		},
 		"Simple merge": {
-			a: report.Nodes{
+			a: report.MakeNodes(map[string]report.Node{
 				":192.168.1.1:12345": report.MakeNodeWith(map[string]string{
 					PID:    "23128",
 					Name:   "curl",
 					Domain: "node-a.local",
 				}),
-			},
-			b: report.Nodes{
+			}),
+			b: report.MakeNodes(map[string]report.Node{
 				":192.168.1.2:12345": report.MakeNodeWith(map[string]string{
 					PID:    "42",
 					Name:   "curl",
 					Domain: "node-a.local",
 				}),
-			},
-			want: report.Nodes{
+			}),
+			want: report.MakeNodes(map[string]report.Node{
 				":192.168.1.1:12345": report.MakeNodeWith(map[string]string{
 					PID:    "23128",
 					Name:   "curl",
@@ -191,54 +214,54 @@ func TestMergeNodes(t *testing.T) {
 					Name:   "curl",
 					Domain: "node-a.local",
 				}),
-			},
+			}),
 		},
 		"Merge conflict": {
-			a: report.Nodes{
+			a: report.MakeNodes(map[string]report.Node{
 				":192.168.1.1:12345": report.MakeNodeWith(map[string]string{
 					PID:    "23128",
 					Name:   "curl",
 					Domain: "node-a.local",
 				}),
-			},
-			b: report.Nodes{
+			}),
+			b: report.MakeNodes(map[string]report.Node{
 				":192.168.1.1:12345": report.MakeNodeWith(map[string]string{ // <-- same ID
 					PID:    "0",
 					Name:   "curl",
 					Domain: "node-a.local",
 				}),
-			},
-			want: report.Nodes{
+			}),
+			want: report.MakeNodes(map[string]report.Node{
 				":192.168.1.1:12345": report.MakeNodeWith(map[string]string{
 					PID:    "23128",
 					Name:   "curl",
 					Domain: "node-a.local",
 				}),
-			},
+			}),
 		},
 		"Counters": {
-			a: report.Nodes{
+			a: report.MakeNodes(map[string]report.Node{
 				"1": report.MakeNode().WithCounters(map[string]int{
 					"a": 13,
 					"b": 57,
 					"c": 89,
 				}),
-			},
-			b: report.Nodes{
+			}),
+			b: report.MakeNodes(map[string]report.Node{
 				"1": report.MakeNode().WithCounters(map[string]int{
 					"a": 78,
 					"b": 3,
 					"d": 47,
 				}),
-			},
-			want: report.Nodes{
+			}),
+			want: report.MakeNodes(map[string]report.Node{
 				"1": report.MakeNode().WithCounters(map[string]int{
 					"a": 91,
 					"b": 60,
 					"c": 89,
 					"d": 47,
 				}),
-			},
+			}),
 		},
 	} {
 		if have := c.a.Merge(c.b); !reflect.DeepEqual(c.want, have) {
@@ -247,4 +270,31 @@ func TestMergeNodes(t *testing.T) {
 	}
 }
 
+func TestMergeSharesUnchanged(t *testing.T) {
+	a := report.MakeReport()
+	a.Topologies[report.Process] = a.Topologies[report.Process].AddNode("1", report.MakeNodeWith(map[string]string{PID: "1", Name: "curl"}).WithAdjacent("2"))
+	a.Topologies[report.Process] = a.Topologies[report.Process].AddNode("2", report.MakeNodeWith(map[string]string{PID: "2"}))
+	b := report.MakeReport()
+	b.Topologies[report.Process] = b.Topologies[report.Process].AddNode("1", report.MakeNodeWith(map[string]string{PID: "1"}).WithAdjacent("2"))
+	b.Topologies[report.Process] = b.Topologies[report.Process].AddNode("3", report.MakeNodeWith(map[string]string{PID: "3"}))
+
+	merged := a.Merge(b)
+	if want, have := 3, merged.Topologies[report.Process].Nodes.Size(); want != have {
+		t.Fatalf("want %d nodes, have %d", want, have)
+	}
+	if !reflect.DeepEqual(a.Topologies[report.Process].Nodes.Get("1"), merged.Topologies[report.Process].Nodes.Get("1")) {
+		t.Error(test.Diff(a.Topologies[report.Process].Nodes.Get("1"), merged.Topologies[report.Process].Nodes.Get("1")))
+	}
+
+	// The merged topology is a fresh map; adding to it leaves the originals be.
+	merged.Topologies[report.Process] = merged.Topologies[report.Process].AddNode("1", report.MakeNodeWith(map[string]string{Domain: "node-a.local"}))
+	merged.Topologies[report.Process] = merged.Topologies[report.Process].AddNode("4", report.MakeNode())
+	if _, ok := a.Topologies[report.Process].Nodes.Get("1").Metadata.Lookup(Domain); ok {
+		t.Error("merge result shares a map with its receiver")
+	}
+	if _, ok := b.Topologies[report.Process].Nodes.Lookup("4"); ok {
+		t.Error("merge result shares a topology with its argument")
+	}
+}
+
 func newu64(value uint64) *uint64 { return &value }
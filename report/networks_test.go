@@ -13,6 +13,7 @@ func TestContains(t *testing.T) {
 	networks := report.Networks([]*net.IPNet{
 		mustParseCIDR("10.0.0.1/8"),
 		mustParseCIDR("192.168.1.1/24"),
+		mustParseCIDR("2001:db8::/32"),
 	})
 
 	if networks.Contains(net.ParseIP("52.52.52.52")) {
@@ -22,6 +23,14 @@ func TestContains(t *testing.T) {
 	if !networks.Contains(net.ParseIP("10.0.0.1")) {
 		t.Errorf("10.0.0.1 in %v", networks)
 	}
+
+	if networks.Contains(net.ParseIP("2a00:1450::1")) {
+		t.Errorf("2a00:1450::1 not in %v", networks)
+	}
+
+	if !networks.Contains(net.ParseIP("2001:db8::1")) {
+		t.Errorf("2001:db8::1 in %v", networks)
+	}
 }
 
 func mustParseCIDR(s string) *net.IPNet {
@@ -2,46 +2,64 @@ package report
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
 
+// Names of the well-known topologies, which every report made by MakeReport
+// has.
+const (
+	Endpoint       = "endpoint"
+	Address        = "address"
+	Process        = "process"
+	Container      = "container"
+	ContainerImage = "container_image"
+	Host           = "host"
+	Overlay        = "overlay"
+	Pod            = "pod"
+	Service        = "service"
+	Namespace      = "namespace"
+)
+
 // Report is the core data type. It's produced by probes, and consumed and
 // stored by apps. It's composed of multiple topologies, each representing
 // a different (related, but not equivalent) view of the network.
+//
+// The well-known topologies are:
+//
+//   - Endpoint nodes are individual (address, port) tuples on each host.
+//     They come from inspecting active connections and can (theoretically)
+//     be traced back to a process. Edges are present.
+//   - Address nodes are addresses (e.g. ifconfig) on each host. Certain
+//     information may be present in this topology that can't be mapped to
+//     endpoints (e.g. ICMP). Edges are present.
+//   - Process nodes are processes on each host. Edges are not present.
+//   - Container nodes represent all Docker containers on hosts running
+//     probes. Metadata includes things like containter id, name, image id
+//     etc. Edges are not present.
+//   - ContainerImage nodes represent all Docker containers images on hosts
+//     running probes. Metadata includes things like image id, name etc.
+//     Edges are not present.
+//   - Host nodes are physical hosts that run probes. Metadata includes
+//     things like operating system, load, etc. The information is scraped
+//     by the probes with each published report. Edges are not present.
+//   - Overlay nodes are active peers in any software-defined network that's
+//     overlaid on the infrastructure. The information is scraped by polling
+//     their status endpoints. Edges could be present, but aren't currently.
+//   - Pod nodes represent the Kubernetes pods in the cluster, as reported by
+//     its API server. Metadata includes things like pod name, namespace and
+//     IP, and the services selecting the pod. Edges are not present.
+//   - Service nodes represent the Kubernetes services in the cluster.
+//     Metadata includes things like service name, namespace and cluster IP.
+//     Edges are not present.
+//   - Namespace nodes represent the Kubernetes namespaces in the cluster.
+//     Edges are not present.
+//
+// Any others, e.g. those produced by plugins, are kept alongside them.
 type Report struct {
-	// Endpoint nodes are individual (address, port) tuples on each host.
-	// They come from inspecting active connections and can (theoretically)
-	// be traced back to a process. Edges are present.
-	Endpoint Topology
-
-	// Address nodes are addresses (e.g. ifconfig) on each host. Certain
-	// information may be present in this topology that can't be mapped to
-	// endpoints (e.g. ICMP). Edges are present.
-	Address Topology
-
-	// Process nodes are processes on each host. Edges are not present.
-	Process Topology
-
-	// Container nodes represent all Docker containers on hosts running probes.
-	// Metadata includes things like containter id, name, image id etc.
-	// Edges are not present.
-	Container Topology
-
-	// ContainerImages nodes represent all Docker containers images on
-	// hosts running probes. Metadata includes things like image id, name etc.
-	// Edges are not present.
-	ContainerImage Topology
-
-	// Host nodes are physical hosts that run probes. Metadata includes things
-	// like operating system, load, etc. The information is scraped by the
-	// probes with each published report. Edges are not present.
-	Host Topology
-
-	// Overlay nodes are active peers in any software-defined network that's
-	// overlaid on the infrastructure. The information is scraped by polling
-	// their status endpoints. Edges could be present, but aren't currently.
-	Overlay Topology
+	// Topologies, by name.
+	Topologies map[string]Topology
 
 	// Sampling data for this report.
 	Sampling Sampling
@@ -55,73 +73,143 @@ type Report struct {
 	Window time.Duration
 }
 
+// wellKnownTopologies are the names of the topologies every report has, in
+// the order they're walked.
+var wellKnownTopologies = []string{
+	Endpoint,
+	Address,
+	Process,
+	Container,
+	ContainerImage,
+	Host,
+	Overlay,
+	Pod,
+	Service,
+	Namespace,
+}
+
+func isWellKnown(name string) bool {
+	for _, wellKnown := range wellKnownTopologies {
+		if name == wellKnown {
+			return true
+		}
+	}
+	return false
+}
+
 // MakeReport makes a clean report, ready to Merge() other reports into.
 func MakeReport() Report {
-	return Report{
-		Endpoint:       MakeTopology(),
-		Address:        MakeTopology(),
-		Process:        MakeTopology(),
-		Container:      MakeTopology(),
-		ContainerImage: MakeTopology(),
-		Host:           MakeTopology(),
-		Overlay:        MakeTopology(),
-		Sampling:       Sampling{},
-		Window:         0,
+	r := Report{
+		Topologies: make(map[string]Topology, len(wellKnownTopologies)),
+		Sampling:   Sampling{},
+		Window:     0,
+	}
+	for _, name := range wellKnownTopologies {
+		r.Topologies[name] = MakeTopology()
+	}
+	return r
+}
+
+// TopologyNames returns the names of all the topologies in the report: the
+// well-known ones, followed by any others in alphabetical order.
+func (r Report) TopologyNames() []string {
+	names := make([]string, 0, len(wellKnownTopologies)+len(r.Topologies))
+	names = append(names, wellKnownTopologies...)
+	others := []string{}
+	for name := range r.Topologies {
+		if !isWellKnown(name) {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
+// Topology returns the named topology, and whether the report has it. The
+// well-known topologies are always present, if only as zero values.
+func (r Report) Topology(name string) (Topology, bool) {
+	t, ok := r.Topologies[name]
+	return t, ok || isWellKnown(name)
+}
+
+// WithTopology returns the report with the named topology replaced by t,
+// adding it if necessary. Other topologies are shared with the receiver,
+// which is not modified.
+func (r Report) WithTopology(name string, t Topology) Report {
+	topologies := make(map[string]Topology, len(r.Topologies)+1)
+	for n, other := range r.Topologies {
+		topologies[n] = other
+	}
+	topologies[name] = t
+	r.Topologies = topologies
+	return r
+}
+
+// WalkTopologies calls f with the name of, and a pointer to, every topology
+// in the report, in the order of TopologyNames. Topologies may be modified
+// or replaced through the pointer, so the report must not be in use by
+// anything else.
+func (r *Report) WalkTopologies(f func(name string, t *Topology)) {
+	if r.Topologies == nil {
+		r.Topologies = map[string]Topology{}
+	}
+	for _, name := range r.TopologyNames() {
+		t := r.Topologies[name]
+		f(name, &t)
+		r.Topologies[name] = t
+	}
+}
+
+// walk is the read-only version of WalkTopologies, safe to use on reports
+// which are shared.
+func (r Report) walk(f func(name string, t Topology)) {
+	for _, name := range r.TopologyNames() {
+		f(name, r.Topologies[name])
 	}
 }
 
 // Copy returns a value copy of the report.
 func (r Report) Copy() Report {
-	return Report{
-		Endpoint:       r.Endpoint.Copy(),
-		Address:        r.Address.Copy(),
-		Process:        r.Process.Copy(),
-		Container:      r.Container.Copy(),
-		ContainerImage: r.ContainerImage.Copy(),
-		Host:           r.Host.Copy(),
-		Overlay:        r.Overlay.Copy(),
-		Sampling:       r.Sampling,
-		Window:         r.Window,
+	cp := Report{
+		Topologies: make(map[string]Topology, len(r.Topologies)),
+		Sampling:   r.Sampling,
+		Window:     r.Window,
 	}
+	r.walk(func(name string, t Topology) {
+		cp.Topologies[name] = t.Copy()
+	})
+	return cp
 }
 
 // Merge merges another Report into the receiver and returns the result. The
-// original is not modified.
+// original is not modified. The topologies of the result share their nodes,
+// and the nodes' parts, with the originals where the merge leaves them
+// unchanged.
 func (r Report) Merge(other Report) Report {
-	cp := r.Copy()
-	cp.Endpoint = r.Endpoint.Merge(other.Endpoint)
-	cp.Address = r.Address.Merge(other.Address)
-	cp.Process = r.Process.Merge(other.Process)
-	cp.Container = r.Container.Merge(other.Container)
-	cp.ContainerImage = r.ContainerImage.Merge(other.ContainerImage)
-	cp.Host = r.Host.Merge(other.Host)
-	cp.Overlay = r.Overlay.Merge(other.Overlay)
-	cp.Sampling = r.Sampling.Merge(other.Sampling)
-	cp.Window += other.Window
-	return cp
-}
-
-// Topologies returns a slice of Topologies in this report
-func (r Report) Topologies() []Topology {
-	return []Topology{
-		r.Endpoint,
-		r.Address,
-		r.Process,
-		r.Container,
-		r.ContainerImage,
-		r.Host,
-		r.Overlay,
+	cp := Report{
+		Topologies: make(map[string]Topology, len(r.Topologies)),
+		Sampling:   r.Sampling.Merge(other.Sampling),
+		Window:     r.Window + other.Window,
 	}
+	r.walk(func(name string, t Topology) {
+		cp.Topologies[name] = t.Merge(other.Topologies[name])
+	})
+	other.walk(func(name string, t Topology) {
+		if _, ok := cp.Topologies[name]; !ok {
+			cp.Topologies[name] = MakeTopology().Merge(t)
+		}
+	})
+	return cp
 }
 
 // Validate checks the report for various inconsistencies.
 func (r Report) Validate() error {
 	var errs []string
-	for _, topology := range r.Topologies() {
-		if err := topology.Validate(); err != nil {
-			errs = append(errs, err.Error())
+	r.walk(func(name string, t Topology) {
+		if err := t.Validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
 		}
-	}
+	})
 	if r.Sampling.Count > r.Sampling.Total {
 		errs = append(errs, fmt.Sprintf("sampling count (%d) bigger than total (%d)", r.Sampling.Count, r.Sampling.Total))
 	}
@@ -1,46 +1,41 @@
 package report_test
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/weaveworks/scope/report"
 )
 
-// Make sure we don't add a topology and miss it in the Topologies method.
+// Make sure we don't add a well-known topology and miss it in MakeReport.
 func TestReportTopologies(t *testing.T) {
-	var (
-		reportType   = reflect.TypeOf(report.MakeReport())
-		topologyType = reflect.TypeOf(report.MakeTopology())
-	)
-
-	var want int
-	for i := 0; i < reportType.NumField(); i++ {
-		if reportType.Field(i).Type == topologyType {
-			want++
+	rpt := report.MakeReport()
+	for _, name := range rpt.TopologyNames() {
+		if _, ok := rpt.Topologies[name]; !ok {
+			t.Errorf("no %s topology", name)
 		}
 	}
-
-	if have := len(report.MakeReport().Topologies()); want != have {
-		t.Errorf("want %d, have %d", want, have)
-	}
 }
 
 func TestNode(t *testing.T) {
 	{
-		node := report.MakeNode().WithMetadata(report.Metadata{
+		node := report.MakeNode().WithMetadata(map[string]string{
 			"foo": "bar",
 		})
-		if node.Metadata["foo"] != "bar" {
-			t.Errorf("want foo, have %s", node.Metadata["foo"])
+		if node.Metadata.Get("foo") != "bar" {
+			t.Errorf("want foo, have %s", node.Metadata.Get("foo"))
 		}
 	}
 	{
-		node := report.MakeNode().WithCounters(report.Counters{
+		node := report.MakeNode().WithCounters(map[string]int{
 			"foo": 1,
 		})
-		if node.Counters["foo"] != 1 {
-			t.Errorf("want foo, have %d", node.Counters["foo"])
+		if node.Counters.Get("foo") != 1 {
+			t.Errorf("want foo, have %d", node.Counters.Get("foo"))
 		}
 	}
 	{
@@ -56,8 +51,155 @@ func TestNode(t *testing.T) {
 		if node.Adjacency[0] != "foo" {
 			t.Errorf("want foo, have %v", node.Adjacency)
 		}
-		if *node.Edges["foo"].EgressPacketCount != 13 {
+		if *node.Edges.Get("foo").EgressPacketCount != 13 {
 			t.Errorf("want 13, have %v", node.Edges)
 		}
 	}
 }
+
+func TestReportExtraTopologies(t *testing.T) {
+	var (
+		a = report.MakeTopology().AddNode("a;1", report.MakeNodeWith(map[string]string{"foo": "1"}))
+		b = report.MakeTopology().AddNode("a;2", report.MakeNodeWith(map[string]string{"foo": "2"}))
+	)
+
+	r1 := report.MakeReport().WithTopology("zebra", a).WithTopology("aardvark", a)
+	r2 := report.MakeReport().WithTopology("zebra", b)
+	r2.Topologies[report.Endpoint] = r2.Topologies[report.Endpoint].AddNode("b;1", report.MakeNode())
+
+	if _, ok := report.MakeReport().Topology("zebra"); ok {
+		t.Errorf("unexpected topology")
+	}
+
+	// Extra topologies come after the well-known ones, in order.
+	names := r1.TopologyNames()
+	if want, have := []string{report.Namespace, "aardvark", "zebra"}, names[len(names)-3:]; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := len(names), len(r1.Topologies); want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+
+	merged := r1.Merge(r2)
+	if want, have := a.Merge(b), mustTopology(t, merged, "zebra"); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := a, mustTopology(t, merged, "aardvark"); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := r2.Topologies[report.Endpoint], mustTopology(t, merged, report.Endpoint); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if err := merged.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// Copies and merges don't share topologies with the original.
+	cp := r1.Copy()
+	cp.Topologies["zebra"] = mustTopology(t, cp, "zebra").AddNode("a;3", report.MakeNode())
+	if _, ok := mustTopology(t, r1, "zebra").Nodes.Lookup("a;3"); ok {
+		t.Errorf("copy shares topology with original")
+	}
+
+	if err := report.MakeReport().WithTopology("extra", report.MakeTopology()).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func mustTopology(t *testing.T, r report.Report, name string) report.Topology {
+	topology, ok := r.Topology(name)
+	if !ok {
+		t.Fatalf("no %s topology", name)
+	}
+	return topology
+}
+
+// oldReport is the layout of reports from before their topologies were kept
+// in a single map, and their maps were Go maps.
+type oldReport struct {
+	Endpoint oldTopology
+	Host     oldTopology
+	Extra    map[string]oldTopology
+	Window   time.Duration
+}
+
+type oldTopology struct {
+	Nodes map[string]oldNode
+}
+
+type oldNode struct {
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Adjacency report.IDList     `json:"adjacency"`
+}
+
+var oldEndpoints = oldTopology{Nodes: map[string]oldNode{
+	"a;1": {Metadata: map[string]string{"foo": "bar"}},
+}}
+
+// Reports from older probes must still decode, and reports must decode in
+// older apps, with any extra topologies in Extra.
+func TestReportGobCompatibility(t *testing.T) {
+	endpoints := report.MakeTopology().AddNode("a;1", report.MakeNodeWith(map[string]string{"foo": "bar"}))
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(oldReport{Endpoint: oldEndpoints, Window: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	var have report.Report
+	if err := have.ReadBinary(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if have.Topologies[report.Endpoint].Nodes.Get("a;1").Metadata.Get("foo") != "bar" || have.Window != time.Second {
+		t.Errorf("bad decode of old report: %v", have)
+	}
+	if _, ok := have.Topologies[report.Host]; !ok {
+		t.Errorf("no host topology")
+	}
+
+	buf.Reset()
+	if err := report.MakeReport().WithTopology("extra", endpoints).WriteBinary(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var old oldReport
+	if err := gob.NewDecoder(&buf).Decode(&old); err != nil {
+		t.Fatal(err)
+	}
+	if old.Extra["extra"].Nodes["a;1"].Metadata["foo"] != "bar" {
+		t.Errorf("bad decode in old app: %v", old)
+	}
+}
+
+func TestReportJSONCompatibility(t *testing.T) {
+	endpoints := report.MakeTopology().AddNode("a;1", report.MakeNodeWith(map[string]string{"foo": "bar"}))
+	b, err := json.Marshal(oldReport{Endpoint: oldEndpoints, Extra: map[string]oldTopology{"extra": oldEndpoints}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have report.Report
+	if err := json.Unmarshal(b, &have); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{report.Endpoint, "extra"} {
+		if have.Topologies[name].Nodes.Get("a;1").Metadata.Get("foo") != "bar" {
+			t.Errorf("bad decode of old report's %s topology: %v", name, have.Topologies[name])
+		}
+	}
+
+	want := report.MakeReport().WithTopology("extra", endpoints)
+	if b, err = json.Marshal(want); err != nil {
+		t.Fatal(err)
+	}
+	var old oldReport
+	if err := json.Unmarshal(b, &old); err != nil {
+		t.Fatal(err)
+	}
+	if old.Extra["extra"].Nodes["a;1"].Metadata["foo"] != "bar" {
+		t.Errorf("bad decode in old app: %s", b)
+	}
+	have = report.Report{}
+	if err := json.Unmarshal(b, &have); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := len(want.Topologies), len(have.Topologies); want != have {
+		t.Errorf("want %d topologies, have %d", want, have)
+	}
+}
@@ -10,26 +10,24 @@ import (
 // EdgeMetadatas and Nodes respectively. Edges are directional, and embedded
 // in the Node struct.
 type Topology struct {
-	Nodes // TODO(pb): remove Nodes intermediate type
+	Nodes Nodes
 }
 
 // MakeTopology gives you a Topology.
 func MakeTopology() Topology {
 	return Topology{
-		Nodes: map[string]Node{},
+		Nodes: Nodes{},
 	}
 }
 
 // AddNode adds node to the topology under key nodeID; if a
 // node already exists for this key, nmd is merged with that node.
-// The same topology is returned to enable chaining.
-// This method is different from all the other similar methods
-// in that it mutates the Topology, to solve issues of GC pressure.
+// The original is not modified, so always reassign the result.
 func (t Topology) AddNode(nodeID string, nmd Node) Topology {
-	if existing, ok := t.Nodes[nodeID]; ok {
+	if existing, ok := t.Nodes.Lookup(nodeID); ok {
 		nmd = nmd.Merge(existing)
 	}
-	t.Nodes[nodeID] = nmd
+	t.Nodes = t.Nodes.Set(nodeID, nmd)
 	return t
 }
 
@@ -48,38 +46,88 @@ func (t Topology) Merge(other Topology) Topology {
 	}
 }
 
-// Nodes is a collection of nodes in a topology. Keys are node IDs.
-// TODO(pb): type Topology map[string]Node
-type Nodes map[string]Node
+// Same says whether two topologies are the same one, rather than merely
+// equal: whether one is a copy of the other, and neither has changed since.
+// It's much cheaper than comparing them.
+func (t Topology) Same(other Topology) bool {
+	return t.Nodes.root == other.Nodes.root
+}
 
-// Copy returns a value copy of the Nodes.
-func (n Nodes) Copy() Nodes {
-	cp := make(Nodes, len(n))
-	for k, v := range n {
-		cp[k] = v.Copy()
+// Nodes is a collection of nodes in a topology. Keys are node IDs. Like all
+// the maps of a report, it's persistent: changing it returns a new map,
+// sharing what's unchanged with the original, which is not modified. The
+// zero value is an empty map.
+type Nodes hamt
+
+// MakeNodes makes Nodes with the nodes in m.
+func MakeNodes(m map[string]Node) Nodes {
+	n := Nodes{}
+	for id, node := range m {
+		n = n.Set(id, node)
 	}
-	return cp
+	return n
+}
+
+// Lookup returns the node with the ID, and whether there is one.
+func (n Nodes) Lookup(id string) (Node, bool) {
+	v, ok := hamt(n).get(id)
+	if !ok {
+		return Node{}, false
+	}
+	return v.(Node), true
+}
+
+// Get returns the node with the ID, or an empty Node if there isn't one.
+func (n Nodes) Get(id string) Node {
+	node, _ := n.Lookup(id)
+	return node
+}
+
+// Set returns the Nodes with the node with the ID replaced by node.
+func (n Nodes) Set(id string, node Node) Nodes {
+	return Nodes(hamt(n).set(id, node))
+}
+
+// Delete returns the Nodes without the node with the ID.
+func (n Nodes) Delete(id string) Nodes {
+	return Nodes(hamt(n).delete(id))
+}
+
+// Size returns the number of nodes.
+func (n Nodes) Size() int {
+	return n.size
+}
+
+// ForEach calls f with every node, and its ID, in no particular order.
+func (n Nodes) ForEach(f func(id string, node Node)) {
+	hamt(n).forEach(func(id string, v interface{}) {
+		f(id, v.(Node))
+	})
+}
+
+// Copy returns a value copy of the Nodes. As they're persistent, that's
+// the Nodes themselves.
+func (n Nodes) Copy() Nodes {
+	return n
 }
 
 // Merge merges the other object into this one, and returns the result object.
-// The original is not modified.
+// The original is not modified. Nodes on only one side, and those the merge
+// leaves unchanged, are shared with the result rather than copied.
 func (n Nodes) Merge(other Nodes) Nodes {
-	cp := n.Copy()
-	for k, v := range other {
-		if n, ok := cp[k]; ok { // don't overwrite
-			v = v.Merge(n)
-		}
-		cp[k] = v
-	}
-	return cp
+	return Nodes(hamt(n).merge(hamt(other), func(mine, theirs interface{}) interface{} {
+		return theirs.(Node).Merge(mine.(Node))
+	}, func(a, b interface{}) bool {
+		return a.(Node).same(b.(Node))
+	}))
 }
 
 // Node describes a superset of the metadata that probes can collect about a
 // given node in a given topology, along with the edges emanating from the
 // node and metadata about those edges.
 type Node struct {
-	Metadata  `json:"metadata,omitempty"`
-	Counters  `json:"counters,omitempty"`
+	Metadata  Metadata      `json:"metadata,omitempty"`
+	Counters  Counters      `json:"counters,omitempty"`
 	Adjacency IDList        `json:"adjacency"`
 	Edges     EdgeMetadatas `json:"edges,omitempty"`
 }
@@ -102,14 +150,16 @@ func MakeNodeWith(m map[string]string) Node {
 // WithMetadata returns a fresh copy of n, with Metadata m merged in.
 func (n Node) WithMetadata(m map[string]string) Node {
 	result := n.Copy()
-	result.Metadata = result.Metadata.Merge(m)
+	for k, v := range m {
+		result.Metadata = result.Metadata.Set(k, v)
+	}
 	return result
 }
 
 // WithCounters returns a fresh copy of n, with Counters c merged in.
 func (n Node) WithCounters(c map[string]int) Node {
 	result := n.Copy()
-	result.Counters = result.Counters.Merge(c)
+	result.Counters = result.Counters.Merge(MakeCounters(c))
 	return result
 }
 
@@ -125,106 +175,258 @@ func (n Node) WithAdjacent(a string) Node {
 func (n Node) WithEdge(dst string, md EdgeMetadata) Node {
 	result := n.Copy()
 	result.Adjacency = result.Adjacency.Add(dst)
-	result.Edges[dst] = md
+	result.Edges = result.Edges.Set(dst, md)
 	return result
 }
 
-// Copy returns a value copy of the Node.
+// Copy returns a value copy of the Node. Only its Adjacency is copied; its
+// maps are persistent, so they're shared.
 func (n Node) Copy() Node {
-	cp := MakeNode()
-	cp.Metadata = n.Metadata.Copy()
-	cp.Counters = n.Counters.Copy()
+	cp := n
 	cp.Adjacency = n.Adjacency.Copy()
-	cp.Edges = n.Edges.Copy()
 	return cp
 }
 
 // Merge mergses the individual components of a node and returns a
-// fresh node.
+// fresh node. Components left unchanged by the merge are shared with the
+// originals.
 func (n Node) Merge(other Node) Node {
-	cp := n.Copy()
-	cp.Metadata = cp.Metadata.Merge(other.Metadata)
-	cp.Counters = cp.Counters.Merge(other.Counters)
-	cp.Adjacency = cp.Adjacency.Merge(other.Adjacency)
-	cp.Edges = cp.Edges.Merge(other.Edges)
-	return cp
+	return Node{
+		Metadata:  n.Metadata.Merge(other.Metadata),
+		Counters:  n.Counters.Merge(other.Counters),
+		Adjacency: n.Adjacency.Merge(other.Adjacency),
+		Edges:     n.Edges.Merge(other.Edges),
+	}
 }
 
-// Metadata is a string->string map.
-type Metadata map[string]string
+// same says whether two nodes are known to be equal. It compares their
+// metadata and adjacency, but only whether they share their counters and
+// edges, as merging those all but always changes them.
+func (n Node) same(other Node) bool {
+	if n.Counters.root != other.Counters.root || n.Edges.root != other.Edges.root ||
+		len(n.Adjacency) != len(other.Adjacency) {
+		return false
+	}
+	for i := range n.Adjacency {
+		if n.Adjacency[i] != other.Adjacency[i] {
+			return false
+		}
+	}
+	return hamt(n.Metadata).equal(hamt(other.Metadata), func(a, b interface{}) bool {
+		return a.(string) == b.(string)
+	})
+}
+
+// Metadata is a persistent string->string map. The zero value is empty.
+type Metadata hamt
+
+// MakeMetadata makes Metadata with the entries in m.
+func MakeMetadata(m map[string]string) Metadata {
+	result := Metadata{}
+	for k, v := range m {
+		result = result.Set(k, v)
+	}
+	return result
+}
+
+// Lookup returns the value of the key, and whether there is one.
+func (m Metadata) Lookup(key string) (string, bool) {
+	v, ok := hamt(m).get(key)
+	if !ok {
+		return "", false
+	}
+	return v.(string), true
+}
+
+// Get returns the value of the key, or "" if there isn't one.
+func (m Metadata) Get(key string) string {
+	v, _ := m.Lookup(key)
+	return v
+}
+
+// Set returns the Metadata with the key set to value. If it already is, the
+// receiver is returned.
+func (m Metadata) Set(key, value string) Metadata {
+	if v, ok := m.Lookup(key); ok && v == value {
+		return m
+	}
+	return Metadata(hamt(m).set(key, value))
+}
+
+// Delete returns the Metadata without the key.
+func (m Metadata) Delete(key string) Metadata {
+	return Metadata(hamt(m).delete(key))
+}
+
+// Size returns the number of keys.
+func (m Metadata) Size() int {
+	return m.size
+}
+
+// ForEach calls f with every key and value, in no particular order.
+func (m Metadata) ForEach(f func(key, value string)) {
+	hamt(m).forEach(func(k string, v interface{}) {
+		f(k, v.(string))
+	})
+}
 
 // Merge merges two node metadata maps together. In case of conflict, the
 // other (right-hand) side wins. Always reassign the result of merge to the
-// destination. Merge does not modify the receiver.
+// destination. Merge does not modify the receiver. If either side already
+// holds the result, as when reports repeat the same metadata, it is returned
+// rather than copied.
 func (m Metadata) Merge(other Metadata) Metadata {
-	result := m.Copy()
-	for k, v := range other {
-		result[k] = v // other takes precedence
-	}
-	return result
+	return Metadata(hamt(m).merge(hamt(other), func(_, theirs interface{}) interface{} {
+		return theirs
+	}, func(a, b interface{}) bool {
+		return a.(string) == b.(string)
+	}))
 }
 
-// Copy creates a deep copy of the Metadata.
+// Copy returns a value copy of the Metadata. As it's persistent, that's the
+// Metadata itself.
 func (m Metadata) Copy() Metadata {
-	result := Metadata{}
+	return m
+}
+
+// Counters is a persistent string->int map. The zero value is empty.
+type Counters hamt
+
+// MakeCounters makes Counters with the entries in m.
+func MakeCounters(m map[string]int) Counters {
+	result := Counters{}
 	for k, v := range m {
-		result[k] = v
+		result = result.Set(k, v)
 	}
 	return result
 }
 
-// Counters is a string->int map.
-type Counters map[string]int
+// Lookup returns the value of the key, and whether there is one.
+func (c Counters) Lookup(key string) (int, bool) {
+	v, ok := hamt(c).get(key)
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
+
+// Get returns the value of the key, or 0 if there isn't one.
+func (c Counters) Get(key string) int {
+	v, _ := c.Lookup(key)
+	return v
+}
+
+// Set returns the Counters with the key set to value.
+func (c Counters) Set(key string, value int) Counters {
+	if v, ok := c.Lookup(key); ok && v == value {
+		return c
+	}
+	return Counters(hamt(c).set(key, value))
+}
+
+// Size returns the number of keys.
+func (c Counters) Size() int {
+	return c.size
+}
+
+// ForEach calls f with every key and value, in no particular order.
+func (c Counters) ForEach(f func(key string, value int)) {
+	hamt(c).forEach(func(k string, v interface{}) {
+		f(k, v.(int))
+	})
+}
 
 // Merge merges two sets of counters into a fresh set of counters, summing
-// values where appropriate.
+// values where appropriate. If either side is empty, the other is returned
+// rather than copied.
 func (c Counters) Merge(other Counters) Counters {
-	result := c.Copy()
-	for k, v := range other {
-		result[k] = result[k] + v
-	}
-	return result
+	return Counters(hamt(c).merge(hamt(other), func(mine, theirs interface{}) interface{} {
+		return mine.(int) + theirs.(int)
+	}, func(a, b interface{}) bool {
+		return a.(int) == b.(int)
+	}))
 }
 
-// Copy creates a deep copy of the Counters.
+// Copy returns a value copy of the Counters. As they're persistent, that's
+// the Counters themselves.
 func (c Counters) Copy() Counters {
-	result := Counters{}
-	for k, v := range c {
-		result[k] = v
+	return c
+}
+
+// EdgeMetadatas collect metadata about each edge in a topology. Keys are the
+// remote node IDs, as in Adjacency. It's a persistent map, and the zero value
+// is empty.
+type EdgeMetadatas hamt
+
+// MakeEdgeMetadatas makes EdgeMetadatas with the entries in m.
+func MakeEdgeMetadatas(m map[string]EdgeMetadata) EdgeMetadatas {
+	result := EdgeMetadatas{}
+	for k, v := range m {
+		result = result.Set(k, v)
 	}
 	return result
 }
 
-// EdgeMetadatas collect metadata about each edge in a topology. Keys are the
-// remote node IDs, as in Adjacency.
-type EdgeMetadatas map[string]EdgeMetadata
+// Lookup returns the metadata of the edge to the remote node, and whether
+// there is any.
+func (e EdgeMetadatas) Lookup(dst string) (EdgeMetadata, bool) {
+	v, ok := hamt(e).get(dst)
+	if !ok {
+		return EdgeMetadata{}, false
+	}
+	return v.(EdgeMetadata), true
+}
+
+// Get returns the metadata of the edge to the remote node, or empty
+// metadata if there isn't any.
+func (e EdgeMetadatas) Get(dst string) EdgeMetadata {
+	md, _ := e.Lookup(dst)
+	return md
+}
+
+// Set returns the EdgeMetadatas with the metadata of the edge to the remote
+// node replaced by md.
+func (e EdgeMetadatas) Set(dst string, md EdgeMetadata) EdgeMetadatas {
+	return EdgeMetadatas(hamt(e).set(dst, md))
+}
+
+// Size returns the number of edges.
+func (e EdgeMetadatas) Size() int {
+	return e.size
+}
+
+// ForEach calls f with the metadata of every edge, and its remote node, in no
+// particular order.
+func (e EdgeMetadatas) ForEach(f func(dst string, md EdgeMetadata)) {
+	hamt(e).forEach(func(k string, v interface{}) {
+		f(k, v.(EdgeMetadata))
+	})
+}
 
-// Copy returns a value copy of the EdgeMetadatas.
+// Copy returns a value copy of the EdgeMetadatas. As they're persistent,
+// that's the EdgeMetadatas themselves.
 func (e EdgeMetadatas) Copy() EdgeMetadatas {
-	cp := make(EdgeMetadatas, len(e))
-	for k, v := range e {
-		cp[k] = v.Copy()
-	}
-	return cp
+	return e
 }
 
 // Merge merges the other object into this one, and returns the result object.
-// The original is not modified.
+// The original is not modified. If either side is empty, the other is
+// returned rather than copied.
 func (e EdgeMetadatas) Merge(other EdgeMetadatas) EdgeMetadatas {
-	cp := e.Copy()
-	for k, v := range other {
-		cp[k] = cp[k].Merge(v)
-	}
-	return cp
+	return EdgeMetadatas(hamt(e).merge(hamt(other), func(mine, theirs interface{}) interface{} {
+		return mine.(EdgeMetadata).Merge(theirs.(EdgeMetadata))
+	}, func(a, b interface{}) bool {
+		return false
+	}))
 }
 
 // Flatten flattens all the EdgeMetadatas in this set and returns the result.
 // The original is not modified.
 func (e EdgeMetadatas) Flatten() EdgeMetadata {
 	result := EdgeMetadata{}
-	for _, v := range e {
+	e.ForEach(func(_ string, v EdgeMetadata) {
 		result = result.Flatten(v)
-	}
+	})
 	return result
 }
 
@@ -236,6 +438,24 @@ type EdgeMetadata struct {
 	EgressByteCount    *uint64 `json:"egress_byte_count,omitempty"`  // Transport layer
 	IngressByteCount   *uint64 `json:"ingress_byte_count,omitempty"` // Transport layer
 	MaxConnCountTCP    *uint64 `json:"max_conn_count_tcp,omitempty"`
+
+	// DirectionInferredFrom says how the probe decided which end of the
+	// edge is the client; one of the DirectionFrom* constants.
+	DirectionInferredFrom string `json:"direction_inferred_from,omitempty"`
+}
+
+// Ways in which the direction of an edge can be inferred, from least to most
+// reliable.
+const (
+	DirectionFromPorts     = "ports"     // the higher port is assumed to be the client
+	DirectionFromListening = "listening" // one end is a listening socket
+	DirectionFromConntrack = "conntrack" // the original direction of the flow
+)
+
+var directionReliability = map[string]uint64{
+	DirectionFromPorts:     1,
+	DirectionFromListening: 2,
+	DirectionFromConntrack: 3,
 }
 
 // Copy returns a value copy of the EdgeMetadata.
@@ -246,6 +466,8 @@ func (e EdgeMetadata) Copy() EdgeMetadata {
 		EgressByteCount:    cpu64ptr(e.EgressByteCount),
 		IngressByteCount:   cpu64ptr(e.IngressByteCount),
 		MaxConnCountTCP:    cpu64ptr(e.MaxConnCountTCP),
+
+		DirectionInferredFrom: e.DirectionInferredFrom,
 	}
 }
 
@@ -257,6 +479,8 @@ func (e EdgeMetadata) Reversed() EdgeMetadata {
 		EgressByteCount:    cpu64ptr(e.IngressByteCount),
 		IngressByteCount:   cpu64ptr(e.EgressByteCount),
 		MaxConnCountTCP:    cpu64ptr(e.MaxConnCountTCP),
+
+		DirectionInferredFrom: e.DirectionInferredFrom,
 	}
 }
 
@@ -278,6 +502,7 @@ func (e EdgeMetadata) Merge(other EdgeMetadata) EdgeMetadata {
 	cp.EgressByteCount = merge(cp.EgressByteCount, other.EgressByteCount, sum)
 	cp.IngressByteCount = merge(cp.IngressByteCount, other.IngressByteCount, sum)
 	cp.MaxConnCountTCP = merge(cp.MaxConnCountTCP, other.MaxConnCountTCP, max)
+	cp.DirectionInferredFrom = mergeDirection(cp.DirectionInferredFrom, other.DirectionInferredFrom, max)
 	return cp
 }
 
@@ -293,6 +518,8 @@ func (e EdgeMetadata) Flatten(other EdgeMetadata) EdgeMetadata {
 	// Note that summing of two maximums doesn't always give us the true
 	// maximum. But it's a best effort.
 	cp.MaxConnCountTCP = merge(cp.MaxConnCountTCP, other.MaxConnCountTCP, sum)
+	// A set of edges is only as reliable as its least reliable member.
+	cp.DirectionInferredFrom = mergeDirection(cp.DirectionInferredFrom, other.DirectionInferredFrom, min)
 	return cp
 }
 
@@ -300,30 +527,26 @@ func (e EdgeMetadata) Flatten(other EdgeMetadata) EdgeMetadata {
 func (t Topology) Validate() error {
 	errs := []string{}
 
-	// Check all node metadatas are valid, and the keys are parseable, i.e.
-	// contain a scope.
-	for nodeID, nmd := range t.Nodes {
-		if nmd.Metadata == nil {
-			errs = append(errs, fmt.Sprintf("node ID %q has nil metadata", nodeID))
-		}
+	// Check all node keys are parseable, i.e. contain a scope.
+	t.Nodes.ForEach(func(nodeID string, nmd Node) {
 		if _, _, ok := ParseNodeID(nodeID); !ok {
 			errs = append(errs, fmt.Sprintf("invalid node ID %q", nodeID))
 		}
 
 		// Check all adjancency keys has entries in Node.
 		for _, dstNodeID := range nmd.Adjacency {
-			if _, ok := t.Nodes[dstNodeID]; !ok {
+			if _, ok := t.Nodes.Lookup(dstNodeID); !ok {
 				errs = append(errs, fmt.Sprintf("node metadata missing from adjacency %q -> %q", nodeID, dstNodeID))
 			}
 		}
 
 		// Check all the edge metadatas have entries in adjacencies
-		for dstNodeID := range nmd.Edges {
-			if _, ok := t.Nodes[dstNodeID]; !ok {
+		nmd.Edges.ForEach(func(dstNodeID string, _ EdgeMetadata) {
+			if _, ok := t.Nodes.Lookup(dstNodeID); !ok {
 				errs = append(errs, fmt.Sprintf("node %s metadatas missing for edge %q", dstNodeID, nodeID))
 			}
-		}
-	}
+		})
+	})
 
 	if len(errs) > 0 {
 		return fmt.Errorf("%d error(s): %s", len(errs), strings.Join(errs, "; "))
@@ -353,3 +576,26 @@ func max(dst, src uint64) uint64 {
 	}
 	return src
 }
+
+func min(dst, src uint64) uint64 {
+	if dst < src {
+		return dst
+	}
+	return src
+}
+
+// mergeDirection picks one of two DirectionFrom* values by comparing their
+// reliability with op. An empty value means the direction is unknown, and
+// is ignored.
+func mergeDirection(dst, src string, op func(uint64, uint64) uint64) string {
+	if src == "" {
+		return dst
+	}
+	if dst == "" {
+		return src
+	}
+	if op(directionReliability[dst], directionReliability[src]) == directionReliability[dst] {
+		return dst
+	}
+	return src
+}
@@ -0,0 +1,121 @@
+package report_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+// These keys' hashes collide.
+const (
+	collidingKey1 = "key-901258"
+	collidingKey2 = "key-1540052"
+)
+
+func TestMetadataPersistent(t *testing.T) {
+	const n = 1000
+	all := report.Metadata{}
+	for i := 0; i < n; i++ {
+		before := all
+		all = all.Set(fmt.Sprint(i), fmt.Sprint(i))
+		if _, ok := before.Lookup(fmt.Sprint(i)); ok || before.Size() != i {
+			t.Fatalf("setting %d changed the original", i)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if v, ok := all.Lookup(fmt.Sprint(i)); !ok || v != fmt.Sprint(i) {
+			t.Errorf("want %d, have %q", i, v)
+		}
+	}
+	if all.Set("1", "1") != all {
+		t.Errorf("setting an unchanged value changed the map")
+	}
+
+	some := all
+	for i := 0; i < n; i += 2 {
+		some = some.Delete(fmt.Sprint(i))
+	}
+	if want, have := n/2, some.Size(); want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if _, ok := some.Lookup("2"); ok {
+		t.Errorf("deleted key still there")
+	}
+	if _, ok := all.Lookup("2"); !ok || all.Size() != n {
+		t.Errorf("deleting changed the original")
+	}
+	for i := 1; i < n; i += 2 {
+		some = some.Delete(fmt.Sprint(i))
+	}
+	if want, have := (report.Metadata{}), some; !reflect.DeepEqual(want, have) {
+		t.Errorf("want empty, have %v", have)
+	}
+}
+
+// Maps with the same entries have the same shape, however they were made,
+// so they're DeepEqual.
+func TestMetadataShape(t *testing.T) {
+	var (
+		forwards  = report.Metadata{}
+		backwards = report.Metadata{}
+		merged    = report.Metadata{}
+		deleted   = report.MakeMetadata(map[string]string{"extra": "x", collidingKey2: "x"})
+	)
+	for i := 0; i < 100; i++ {
+		forwards = forwards.Set(fmt.Sprint(i), "v")
+		backwards = backwards.Set(fmt.Sprint(99-i), "v")
+		merged = merged.Merge(report.MakeMetadata(map[string]string{fmt.Sprint(i): "v"}))
+		deleted = deleted.Set(fmt.Sprint(i), "v")
+	}
+	deleted = deleted.Delete("extra").Delete(collidingKey2)
+	for _, have := range []report.Metadata{backwards, merged, deleted} {
+		if !reflect.DeepEqual(forwards, have) {
+			t.Error(test.Diff(forwards, have))
+		}
+	}
+}
+
+func TestMetadataCollisions(t *testing.T) {
+	m := report.Metadata{}.Set(collidingKey1, "1").Set(collidingKey2, "2").Set("other", "3")
+	for key, want := range map[string]string{collidingKey1: "1", collidingKey2: "2", "other": "3"} {
+		if have := m.Get(key); want != have {
+			t.Errorf("%s: want %q, have %q", key, want, have)
+		}
+	}
+	m = m.Set(collidingKey1, "4").Delete(collidingKey2)
+	if want, have := map[string]string{collidingKey1: "4", "other": "3"}, m.Map(); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if want, have := report.MakeMetadata(map[string]string{collidingKey1: "4", "other": "3"}), m; !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
+
+func TestCountersMerge(t *testing.T) {
+	a := report.MakeCounters(map[string]int{"a": 1, "b": 2})
+	b := report.MakeCounters(map[string]int{"b": 3, "c": 4})
+	if want, have := map[string]int{"a": 1, "b": 5, "c": 4}, a.Merge(b).Map(); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+	if want, have := map[string]int{"a": 1, "b": 2}, a.Map(); !reflect.DeepEqual(want, have) {
+		t.Errorf("merge changed the original: %v", have)
+	}
+}
+
+// Merging nodes a topology already has leaves it as it is.
+func TestNodesMergeUnchanged(t *testing.T) {
+	nodes := report.Nodes{}
+	for i := 0; i < 100; i++ {
+		nodes = nodes.Set(fmt.Sprint(i), report.MakeNodeWith(map[string]string{"pid": fmt.Sprint(i)}))
+	}
+	again := report.MakeTopology().AddNode("1", report.MakeNodeWith(map[string]string{"pid": "1"}))
+	if have := (report.Topology{Nodes: nodes}).Merge(again); !have.Same(report.Topology{Nodes: nodes}) {
+		t.Errorf("merging unchanged nodes changed the topology")
+	}
+	if have := nodes.Merge(report.MakeNodes(map[string]report.Node{"100": report.MakeNode()})); have.Size() != 101 || nodes.Size() != 100 {
+		t.Errorf("want 101 and 100 nodes, have %d and %d", have.Size(), nodes.Size())
+	}
+}
@@ -5,13 +5,15 @@ import (
 
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/endpoint"
+	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/probe/process"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/report"
 )
 
 // This is an example Report:
-//   2 hosts with probes installed - client & server.
+//
+//	2 hosts with probes installed - client & server.
 var (
 	ClientHostID  = "client.hostname.com"
 	ServerHostID  = "server.hostname.com"
@@ -80,6 +82,11 @@ var (
 	ClientContainerImageName   = "image/client"
 	ServerContainerImageName   = "image/server"
 
+	KubernetesNamespace = "ping"
+	ClientPodNodeID     = report.MakePodNodeID(KubernetesNamespace, "pong-a")
+	ServerPodNodeID     = report.MakePodNodeID(KubernetesNamespace, "pong-b")
+	ServiceNodeID       = report.MakeServiceNodeID(KubernetesNamespace, "pongservice")
+
 	ClientAddressNodeID   = report.MakeAddressNodeID(ClientHostID, ClientIP)
 	ServerAddressNodeID   = report.MakeAddressNodeID(ServerHostID, ServerIP)
 	UnknownAddress1NodeID = report.MakeAddressNodeID(ServerHostID, UnknownClient1IP)
@@ -88,201 +95,235 @@ var (
 	RandomAddressNodeID   = report.MakeAddressNodeID(ServerHostID, RandomClientIP) // this should become an internet node
 
 	Report = report.Report{
-		Endpoint: report.Topology{
-			Nodes: report.Nodes{
-				// Node is arbitrary. We're free to put only precisely what we
-				// care to test into the fixture. Just be sure to include the bits
-				// that the mapping funcs extract :)
-				Client54001NodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:      ClientIP,
-					endpoint.Port:      ClientPort54001,
-					process.PID:        Client1PID,
-					report.HostNodeID:  ClientHostNodeID,
-					endpoint.Procspied: True,
-				}).WithEdge(Server80NodeID, report.EdgeMetadata{
-					EgressPacketCount: newu64(10),
-					EgressByteCount:   newu64(100),
-				}),
+		Topologies: map[string]report.Topology{
+			report.Endpoint: report.Topology{
+				Nodes: report.MakeNodes(map[string]report.Node{
+					// Node is arbitrary. We're free to put only precisely what we
+					// care to test into the fixture. Just be sure to include the bits
+					// that the mapping funcs extract :)
+					Client54001NodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:      ClientIP,
+						endpoint.Port:      ClientPort54001,
+						process.PID:        Client1PID,
+						report.HostNodeID:  ClientHostNodeID,
+						endpoint.Procspied: True,
+					}).WithEdge(Server80NodeID, report.EdgeMetadata{
+						EgressPacketCount: newu64(10),
+						EgressByteCount:   newu64(100),
+					}),
 
-				Client54002NodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:      ClientIP,
-					endpoint.Port:      ClientPort54002,
-					process.PID:        Client2PID,
-					report.HostNodeID:  ClientHostNodeID,
-					endpoint.Procspied: True,
-				}).WithEdge(Server80NodeID, report.EdgeMetadata{
-					EgressPacketCount: newu64(20),
-					EgressByteCount:   newu64(200),
-				}),
+					Client54002NodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:      ClientIP,
+						endpoint.Port:      ClientPort54002,
+						process.PID:        Client2PID,
+						report.HostNodeID:  ClientHostNodeID,
+						endpoint.Procspied: True,
+					}).WithEdge(Server80NodeID, report.EdgeMetadata{
+						EgressPacketCount: newu64(20),
+						EgressByteCount:   newu64(200),
+					}),
 
-				Server80NodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:      ServerIP,
-					endpoint.Port:      ServerPort,
-					process.PID:        ServerPID,
-					report.HostNodeID:  ServerHostNodeID,
-					endpoint.Procspied: True,
-				}),
+					Server80NodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:      ServerIP,
+						endpoint.Port:      ServerPort,
+						process.PID:        ServerPID,
+						report.HostNodeID:  ServerHostNodeID,
+						endpoint.Procspied: True,
+					}),
 
-				NonContainerNodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:      ServerIP,
-					endpoint.Port:      NonContainerClientPort,
-					process.PID:        NonContainerPID,
-					report.HostNodeID:  ServerHostNodeID,
-					endpoint.Procspied: True,
-				}).WithAdjacent(GoogleEndpointNodeID),
-
-				// Probe pseudo nodes
-				UnknownClient1NodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:      UnknownClient1IP,
-					endpoint.Port:      UnknownClient1Port,
-					endpoint.Procspied: True,
-				}).WithEdge(Server80NodeID, report.EdgeMetadata{
-					EgressPacketCount: newu64(30),
-					EgressByteCount:   newu64(300),
-				}),
+					NonContainerNodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:      ServerIP,
+						endpoint.Port:      NonContainerClientPort,
+						process.PID:        NonContainerPID,
+						report.HostNodeID:  ServerHostNodeID,
+						endpoint.Procspied: True,
+					}).WithAdjacent(GoogleEndpointNodeID),
 
-				UnknownClient2NodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:      UnknownClient2IP,
-					endpoint.Port:      UnknownClient2Port,
-					endpoint.Procspied: True,
-				}).WithEdge(Server80NodeID, report.EdgeMetadata{
-					EgressPacketCount: newu64(40),
-					EgressByteCount:   newu64(400),
-				}),
+					// Probe pseudo nodes
+					UnknownClient1NodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:      UnknownClient1IP,
+						endpoint.Port:      UnknownClient1Port,
+						endpoint.Procspied: True,
+					}).WithEdge(Server80NodeID, report.EdgeMetadata{
+						EgressPacketCount: newu64(30),
+						EgressByteCount:   newu64(300),
+					}),
 
-				UnknownClient3NodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:      UnknownClient3IP,
-					endpoint.Port:      UnknownClient3Port,
-					endpoint.Procspied: True,
-				}).WithEdge(Server80NodeID, report.EdgeMetadata{
-					EgressPacketCount: newu64(50),
-					EgressByteCount:   newu64(500),
-				}),
+					UnknownClient2NodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:      UnknownClient2IP,
+						endpoint.Port:      UnknownClient2Port,
+						endpoint.Procspied: True,
+					}).WithEdge(Server80NodeID, report.EdgeMetadata{
+						EgressPacketCount: newu64(40),
+						EgressByteCount:   newu64(400),
+					}),
 
-				RandomClientNodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:      RandomClientIP,
-					endpoint.Port:      RandomClientPort,
-					endpoint.Procspied: True,
-				}).WithEdge(Server80NodeID, report.EdgeMetadata{
-					EgressPacketCount: newu64(60),
-					EgressByteCount:   newu64(600),
-				}),
+					UnknownClient3NodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:      UnknownClient3IP,
+						endpoint.Port:      UnknownClient3Port,
+						endpoint.Procspied: True,
+					}).WithEdge(Server80NodeID, report.EdgeMetadata{
+						EgressPacketCount: newu64(50),
+						EgressByteCount:   newu64(500),
+					}),
+
+					RandomClientNodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:      RandomClientIP,
+						endpoint.Port:      RandomClientPort,
+						endpoint.Procspied: True,
+					}).WithEdge(Server80NodeID, report.EdgeMetadata{
+						EgressPacketCount: newu64(60),
+						EgressByteCount:   newu64(600),
+					}),
 
-				GoogleEndpointNodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:      GoogleIP,
-					endpoint.Port:      GooglePort,
-					endpoint.Procspied: True,
+					GoogleEndpointNodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:      GoogleIP,
+						endpoint.Port:      GooglePort,
+						endpoint.Procspied: True,
+					}),
 				}),
 			},
-		},
-		Process: report.Topology{
-			Nodes: report.Nodes{
-				ClientProcess1NodeID: report.MakeNodeWith(map[string]string{
-					process.PID:        Client1PID,
-					"comm":             Client1Comm,
-					docker.ContainerID: ClientContainerID,
-					report.HostNodeID:  ClientHostNodeID,
-				}),
-				ClientProcess2NodeID: report.MakeNodeWith(map[string]string{
-					process.PID:        Client2PID,
-					"comm":             Client2Comm,
-					docker.ContainerID: ClientContainerID,
-					report.HostNodeID:  ClientHostNodeID,
-				}),
-				ServerProcessNodeID: report.MakeNodeWith(map[string]string{
-					process.PID:        ServerPID,
-					"comm":             ServerComm,
-					docker.ContainerID: ServerContainerID,
-					report.HostNodeID:  ServerHostNodeID,
-				}),
-				NonContainerProcessNodeID: report.MakeNodeWith(map[string]string{
-					process.PID:       NonContainerPID,
-					"comm":            NonContainerComm,
-					report.HostNodeID: ServerHostNodeID,
+			report.Process: report.Topology{
+				Nodes: report.MakeNodes(map[string]report.Node{
+					ClientProcess1NodeID: report.MakeNodeWith(map[string]string{
+						process.PID:        Client1PID,
+						"comm":             Client1Comm,
+						docker.ContainerID: ClientContainerID,
+						report.HostNodeID:  ClientHostNodeID,
+					}),
+					ClientProcess2NodeID: report.MakeNodeWith(map[string]string{
+						process.PID:        Client2PID,
+						"comm":             Client2Comm,
+						docker.ContainerID: ClientContainerID,
+						report.HostNodeID:  ClientHostNodeID,
+					}),
+					ServerProcessNodeID: report.MakeNodeWith(map[string]string{
+						process.PID:        ServerPID,
+						"comm":             ServerComm,
+						docker.ContainerID: ServerContainerID,
+						report.HostNodeID:  ServerHostNodeID,
+					}),
+					NonContainerProcessNodeID: report.MakeNodeWith(map[string]string{
+						process.PID:       NonContainerPID,
+						"comm":            NonContainerComm,
+						report.HostNodeID: ServerHostNodeID,
+					}),
 				}),
 			},
-		},
-		Container: report.Topology{
-			Nodes: report.Nodes{
-				ClientContainerNodeID: report.MakeNodeWith(map[string]string{
-					docker.ContainerID:   ClientContainerID,
-					docker.ContainerName: "client",
-					docker.ImageID:       ClientContainerImageID,
-					report.HostNodeID:    ClientHostNodeID,
-				}),
-				ServerContainerNodeID: report.MakeNodeWith(map[string]string{
-					docker.ContainerID:                                      ServerContainerID,
-					docker.ContainerName:                                    "task-name-5-server-aceb93e2f2b797caba01",
-					docker.ImageID:                                          ServerContainerImageID,
-					report.HostNodeID:                                       ServerHostNodeID,
-					docker.LabelPrefix + render.AmazonECSContainerNameLabel: "server",
-					docker.LabelPrefix + "foo1":                             "bar1",
-					docker.LabelPrefix + "foo2":                             "bar2",
+			report.Container: report.Topology{
+				Nodes: report.MakeNodes(map[string]report.Node{
+					ClientContainerNodeID: report.MakeNodeWith(map[string]string{
+						docker.ContainerID:   ClientContainerID,
+						docker.ContainerName: "client",
+						docker.ImageID:       ClientContainerImageID,
+						report.HostNodeID:    ClientHostNodeID,
+						kubernetes.PodID:     ClientPodNodeID,
+						kubernetes.PodName:   "pong-a",
+						kubernetes.Namespace: KubernetesNamespace,
+					}),
+					ServerContainerNodeID: report.MakeNodeWith(map[string]string{
+						docker.ContainerID:   ServerContainerID,
+						docker.ContainerName: "task-name-5-server-aceb93e2f2b797caba01",
+						docker.ImageID:       ServerContainerImageID,
+						report.HostNodeID:    ServerHostNodeID,
+						docker.LabelPrefix + render.AmazonECSContainerNameLabel: "server",
+						docker.LabelPrefix + "foo1":                             "bar1",
+						docker.LabelPrefix + "foo2":                             "bar2",
+						kubernetes.PodID:                                        ServerPodNodeID,
+						kubernetes.PodName:                                      "pong-b",
+						kubernetes.Namespace:                                    KubernetesNamespace,
+					}),
 				}),
 			},
-		},
-		ContainerImage: report.Topology{
-			Nodes: report.Nodes{
-				ClientContainerImageNodeID: report.MakeNodeWith(map[string]string{
-					docker.ImageID:    ClientContainerImageID,
-					docker.ImageName:  ClientContainerImageName,
-					report.HostNodeID: ClientHostNodeID,
-				}),
-				ServerContainerImageNodeID: report.MakeNodeWith(map[string]string{
-					docker.ImageID:              ServerContainerImageID,
-					docker.ImageName:            ServerContainerImageName,
-					report.HostNodeID:           ServerHostNodeID,
-					docker.LabelPrefix + "foo1": "bar1",
-					docker.LabelPrefix + "foo2": "bar2",
+			report.ContainerImage: report.Topology{
+				Nodes: report.MakeNodes(map[string]report.Node{
+					ClientContainerImageNodeID: report.MakeNodeWith(map[string]string{
+						docker.ImageID:    ClientContainerImageID,
+						docker.ImageName:  ClientContainerImageName,
+						report.HostNodeID: ClientHostNodeID,
+					}),
+					ServerContainerImageNodeID: report.MakeNodeWith(map[string]string{
+						docker.ImageID:              ServerContainerImageID,
+						docker.ImageName:            ServerContainerImageName,
+						report.HostNodeID:           ServerHostNodeID,
+						docker.LabelPrefix + "foo1": "bar1",
+						docker.LabelPrefix + "foo2": "bar2",
+					}),
 				}),
 			},
-		},
-		Address: report.Topology{
-			Nodes: report.Nodes{
-				ClientAddressNodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:     ClientIP,
-					report.HostNodeID: ClientHostNodeID,
-				}).WithEdge(ServerAddressNodeID, report.EdgeMetadata{
-					MaxConnCountTCP: newu64(3),
-				}),
+			report.Address: report.Topology{
+				Nodes: report.MakeNodes(map[string]report.Node{
+					ClientAddressNodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:     ClientIP,
+						report.HostNodeID: ClientHostNodeID,
+					}).WithEdge(ServerAddressNodeID, report.EdgeMetadata{
+						MaxConnCountTCP: newu64(3),
+					}),
 
-				ServerAddressNodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr:     ServerIP,
-					report.HostNodeID: ServerHostNodeID,
-				}),
+					ServerAddressNodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr:     ServerIP,
+						report.HostNodeID: ServerHostNodeID,
+					}),
 
-				UnknownAddress1NodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr: UnknownClient1IP,
-				}).WithAdjacent(ServerAddressNodeID),
+					UnknownAddress1NodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr: UnknownClient1IP,
+					}).WithAdjacent(ServerAddressNodeID),
 
-				UnknownAddress2NodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr: UnknownClient2IP,
-				}).WithAdjacent(ServerAddressNodeID),
+					UnknownAddress2NodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr: UnknownClient2IP,
+					}).WithAdjacent(ServerAddressNodeID),
 
-				UnknownAddress3NodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr: UnknownClient3IP,
-				}).WithAdjacent(ServerAddressNodeID),
+					UnknownAddress3NodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr: UnknownClient3IP,
+					}).WithAdjacent(ServerAddressNodeID),
 
-				RandomAddressNodeID: report.MakeNode().WithMetadata(map[string]string{
-					endpoint.Addr: RandomClientIP,
-				}).WithAdjacent(ServerAddressNodeID),
+					RandomAddressNodeID: report.MakeNode().WithMetadata(map[string]string{
+						endpoint.Addr: RandomClientIP,
+					}).WithAdjacent(ServerAddressNodeID),
+				}),
 			},
-		},
-		Host: report.Topology{
-			Nodes: report.Nodes{
-				ClientHostNodeID: report.MakeNodeWith(map[string]string{
-					"host_name":       ClientHostName,
-					"local_networks":  "10.10.10.0/24",
-					"os":              "Linux",
-					"load":            "0.01 0.01 0.01",
-					report.HostNodeID: ClientHostNodeID,
+			report.Host: report.Topology{
+				Nodes: report.MakeNodes(map[string]report.Node{
+					ClientHostNodeID: report.MakeNodeWith(map[string]string{
+						"host_name":       ClientHostName,
+						"local_networks":  "10.10.10.0/24",
+						"os":              "Linux",
+						"load":            "0.01 0.01 0.01",
+						report.HostNodeID: ClientHostNodeID,
+					}),
+					ServerHostNodeID: report.MakeNodeWith(map[string]string{
+						"host_name":       ServerHostName,
+						"local_networks":  "10.10.10.0/24",
+						"os":              "Linux",
+						"load":            "0.01 0.01 0.01",
+						report.HostNodeID: ServerHostNodeID,
+					}),
 				}),
-				ServerHostNodeID: report.MakeNodeWith(map[string]string{
-					"host_name":       ServerHostName,
-					"local_networks":  "10.10.10.0/24",
-					"os":              "Linux",
-					"load":            "0.01 0.01 0.01",
-					report.HostNodeID: ServerHostNodeID,
+			},
+			report.Pod: report.Topology{
+				Nodes: report.MakeNodes(map[string]report.Node{
+					ClientPodNodeID: report.MakeNodeWith(map[string]string{
+						kubernetes.PodID:     ClientPodNodeID,
+						kubernetes.PodName:   "pong-a",
+						kubernetes.Namespace: KubernetesNamespace,
+					}),
+					ServerPodNodeID: report.MakeNodeWith(map[string]string{
+						kubernetes.PodID:                  ServerPodNodeID,
+						kubernetes.PodName:                "pong-b",
+						kubernetes.Namespace:              KubernetesNamespace,
+						kubernetes.PodState:               "running",
+						kubernetes.ServiceIDs:             ServiceNodeID,
+						kubernetes.PodLabelPrefix + "app": "pong",
+					}),
+				}),
+			},
+			report.Service: report.Topology{
+				Nodes: report.MakeNodes(map[string]report.Node{
+					ServiceNodeID: report.MakeNodeWith(map[string]string{
+						kubernetes.ServiceID:   ServiceNodeID,
+						kubernetes.ServiceName: "pongservice",
+						kubernetes.Namespace:   KubernetesNamespace,
+					}),
 				}),
 			},
 		},
@@ -4,9 +4,22 @@ import (
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/weaveworks/scope/report"
 )
 
+// MergeDuration is an exported prometheus metric
+var MergeDuration = prometheus.NewSummary(
+	prometheus.SummaryOpts{
+		Namespace: "scope",
+		Subsystem: "app",
+		Name:      "report_merge_time_nanoseconds",
+		Help:      "Time spent merging the reports in the collector's window.",
+		MaxAge:    10 * time.Second, // like statsd
+	},
+)
+
 // Reporter is something that can produce reports on demand. It's a convenient
 // interface for parts of the app, and several experimental components.
 type Reporter interface {
@@ -19,12 +32,23 @@ type Adder interface {
 	Add(report.Report)
 }
 
+// Generationer is something whose reports are numbered, the number
+// changing whenever the report does. Read the generation before the report,
+// so a report is never older than its generation.
+type Generationer interface {
+	Generation() uint64
+}
+
 // Collector receives published reports from multiple producers. It yields a
-// single merged report, representing all collected reports.
+// single merged report, representing all collected reports. The merged
+// report is cached until reports are added or expire, so it must not be
+// modified.
 type Collector struct {
-	mtx     sync.Mutex
-	reports []timestampReport
-	window  time.Duration
+	mtx        sync.Mutex
+	reports    []timestampReport
+	window     time.Duration
+	merged     *report.Report
+	generation uint64
 }
 
 // NewCollector returns a collector ready for use.
@@ -42,6 +66,7 @@ func (c *Collector) Add(rpt report.Report) {
 	defer c.mtx.Unlock()
 	c.reports = append(c.reports, timestampReport{now(), rpt})
 	c.reports = clean(c.reports, c.window)
+	c.invalidate()
 }
 
 // Report returns a merged report over all added reports. It implements
@@ -50,13 +75,49 @@ func (c *Collector) Report() report.Report {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	c.reports = clean(c.reports, c.window)
+	c.expire()
+	if c.merged == nil {
+		begin := time.Now()
+		rpt := report.MakeReport()
+		for _, tr := range c.reports {
+			rpt = rpt.Merge(tr.report)
+		}
+		c.merged = &rpt
+		MergeDuration.Observe(float64(time.Since(begin)))
+	}
+	return *c.merged
+}
 
-	rpt := report.MakeReport()
-	for _, tr := range c.reports {
-		rpt = rpt.Merge(tr.report)
+// Size returns the number of reports in the collector's window.
+func (c *Collector) Size() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.expire()
+	return len(c.reports)
+}
+
+// Generation returns the generation of the merged report. It implements
+// Generationer.
+func (c *Collector) Generation() uint64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.expire()
+	return c.generation
+}
+
+// expire removes reports which are out of the window.
+func (c *Collector) expire() {
+	if cleaned := clean(c.reports, c.window); len(cleaned) != len(c.reports) {
+		c.reports = cleaned
+		c.invalidate()
 	}
-	return rpt
+}
+
+func (c *Collector) invalidate() {
+	c.merged = nil
+	c.generation++
 }
 
 type timestampReport struct {
@@ -17,10 +17,10 @@ func TestCollector(t *testing.T) {
 	c := xfer.NewCollector(window)
 
 	r1 := report.MakeReport()
-	r1.Endpoint.AddNode("foo", report.MakeNode())
+	r1.Topologies[report.Endpoint] = r1.Topologies[report.Endpoint].AddNode("foo", report.MakeNode())
 
 	r2 := report.MakeReport()
-	r2.Endpoint.AddNode("bar", report.MakeNode())
+	r2.Topologies[report.Endpoint] = r2.Topologies[report.Endpoint].AddNode("bar", report.MakeNode())
 
 	if want, have := report.MakeReport(), c.Report(); !reflect.DeepEqual(want, have) {
 		t.Error(test.Diff(want, have))
@@ -40,3 +40,31 @@ func TestCollector(t *testing.T) {
 		t.Error(test.Diff(want, have))
 	}
 }
+
+func TestCollectorGeneration(t *testing.T) {
+	window := 50 * time.Millisecond
+	c := xfer.NewCollector(window)
+	g0 := c.Generation()
+
+	r1 := report.MakeReport()
+	r1.Topologies[report.Endpoint] = r1.Topologies[report.Endpoint].AddNode("foo", report.MakeNode())
+	c.Add(r1)
+	g1 := c.Generation()
+	if g1 == g0 {
+		t.Fatalf("generation didn't change on Add")
+	}
+
+	// The merged report is cached while the generation stays the same.
+	c.Report()
+	if have := c.Generation(); have != g1 {
+		t.Errorf("generation changed on Report: %d -> %d", g1, have)
+	}
+
+	// Expiring reports changes the generation, and the report.
+	test.Poll(t, time.Second, true, func() interface{} {
+		return c.Generation() != g1
+	})
+	if want, have := report.MakeReport(), c.Report(); !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+}
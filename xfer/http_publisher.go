@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/weaveworks/scope/common/sanitize"
@@ -21,6 +24,13 @@ var fastClient = http.Client{
 	Timeout: 5 * time.Second,
 }
 
+// ReportResponse is the app's response to a published report.
+type ReportResponse struct {
+	// Truncated is how many nodes the app dropped from each topology of
+	// the report with too many nodes, by topology name.
+	Truncated map[string]int `json:"truncated,omitempty"`
+}
+
 // NewHTTPPublisher returns an HTTPPublisher ready for use.
 func NewHTTPPublisher(target, token, probeID string) (string, *HTTPPublisher, error) {
 	targetAPI := sanitize.URL("http://", 0, "/api")(target)
@@ -66,9 +76,24 @@ func (p HTTPPublisher) Publish(r io.Reader) error {
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf(resp.Status)
 	}
+
+	// Older apps respond with an empty body.
+	var response ReportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err == nil && len(response.Truncated) > 0 {
+		log.Printf("%s truncated the report: %s", p.url, describeTruncation(response.Truncated))
+	}
 	return nil
 }
 
+func describeTruncation(truncated map[string]int) string {
+	parts := []string{}
+	for name, dropped := range truncated {
+		parts = append(parts, fmt.Sprintf("%d %s nodes dropped", dropped, name))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
 // Stop implements Publisher
 func (p HTTPPublisher) Stop() {}
 
@@ -2,7 +2,6 @@ package xfer_test
 
 import (
 	"compress/gzip"
-	"encoding/gob"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -50,7 +49,7 @@ func TestHTTPPublisher(t *testing.T) {
 			defer reader.Close()
 		}
 
-		if err := gob.NewDecoder(reader).Decode(&have); err != nil {
+		if err := have.ReadBinary(reader); err != nil {
 			t.Error(err)
 			return
 		}
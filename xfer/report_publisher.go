@@ -3,7 +3,6 @@ package xfer
 import (
 	"bytes"
 	"compress/gzip"
-	"encoding/gob"
 
 	"github.com/weaveworks/scope/report"
 )
@@ -25,7 +24,7 @@ func NewReportPublisher(publisher Publisher) *ReportPublisher {
 func (p *ReportPublisher) Publish(r report.Report) error {
 	buf := &bytes.Buffer{}
 	gzwriter := gzip.NewWriter(buf)
-	if err := gob.NewEncoder(gzwriter).Encode(r); err != nil {
+	if err := r.WriteBinary(gzwriter); err != nil {
 		return err
 	}
 	gzwriter.Close() // otherwise the content won't get flushed to the output stream